@@ -0,0 +1,95 @@
+/*
+This file provides the support of GitLab APIs that are not served from the default /api/v4 path.
+go-gitlab always appends /api/v4 to the base URL, which does not work for proxies or installs serving the API
+from a different path. If GITLAB_API_URL is set, it is used as the full base URL of the API including its path,
+and the /api/v4 prefix of every request is rewritten to the path of GITLAB_API_URL by the HTTP transport.
+On startup, the API is checked with a trivial call so that a wrong base URL fails with a clear error.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// defaultAPIPath is the path go-gitlab appends to the base URL
+const defaultAPIPath = "/api/v4"
+
+var ErrGitlabAPIUnavailable = errors.New("GitLab API not available, check GITLAB_URL and GITLAB_API_URL")
+
+// NewGitlabAPIClient creates a client for the API served at the given URL including the API path,
+// e.g. https://proxy.example.com/gitlab/api, whose requests carry the extra headers.
+func NewGitlabAPIClient(token string, apiURL string, timeout time.Duration, headers http.Header, options ...gitlab.ClientOptionFunc) (*gitlab.Client, error) {
+	u, err := parseAPIURL(apiURL)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := &http.Client{
+		Timeout: timeout,
+		Transport: &apiPathTransport{
+			base: withExtraHeaders(http.DefaultTransport, headers),
+			path: strings.TrimSuffix(u.Path, "/"),
+		},
+	}
+
+	// The path is added by the transport, go-gitlab only gets the root of the server
+	root := url.URL{Scheme: u.Scheme, Host: u.Host}
+	options = append([]gitlab.ClientOptionFunc{gitlab.WithBaseURL(root.String()), gitlab.WithHTTPClient(httpClient)}, options...)
+	return gitlab.NewClient(token, options...)
+}
+
+// parseAPIURL parses and validates the base URL of the API.
+func parseAPIURL(apiURL string) (*url.URL, error) {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid GITLAB_API_URL: %w", ErrInvalidConfig, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%w: invalid GITLAB_API_URL %q: scheme must be http or https", ErrInvalidConfig, apiURL)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%w: invalid GITLAB_API_URL %q: host is required", ErrInvalidConfig, apiURL)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("%w: invalid GITLAB_API_URL %q: query and fragment are not allowed", ErrInvalidConfig, apiURL)
+	}
+
+	return u, nil
+}
+
+// apiPathTransport replaces the default API path of every request with the configured path.
+type apiPathTransport struct {
+	base http.RoundTripper
+	path string
+}
+
+func (t *apiPathTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasPrefix(req.URL.Path, defaultAPIPath+"/") {
+		return t.base.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the original request
+	req = req.Clone(req.Context())
+	req.URL.Path = t.path + strings.TrimPrefix(req.URL.Path, defaultAPIPath)
+	if req.URL.RawPath != "" {
+		req.URL.RawPath = t.path + strings.TrimPrefix(req.URL.RawPath, defaultAPIPath)
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// checkGitlabAPI makes a trivial call to the API to check that it is reachable under the configured URL.
+func checkGitlabAPI(git *gitlab.Client) error {
+	if _, _, err := git.Version.GetVersion(); err != nil {
+		return fmt.Errorf("%w: %w", ErrGitlabAPIUnavailable, err)
+	}
+
+	return nil
+}
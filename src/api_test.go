@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAPIURL(t *testing.T) {
+	testCases := []struct {
+		name   string
+		apiURL string
+		err    bool
+	}{
+		{name: "custom path", apiURL: "https://proxy.example.com/gitlab/api"},
+		{name: "default path", apiURL: "https://gitlab.example.com/api/v4/"},
+		{name: "no scheme", apiURL: "gitlab.example.com/api", err: true},
+		{name: "unsupported scheme", apiURL: "ftp://gitlab.example.com/api", err: true},
+		{name: "no host", apiURL: "https:///api", err: true},
+		{name: "query", apiURL: "https://gitlab.example.com/api?private_token=secret", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseAPIURL(tc.apiURL)
+			if tc.err != (err != nil) {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("expected %v, got %v", ErrInvalidConfig, err)
+			}
+		})
+	}
+}
+
+func TestGitlabAPIClientCustomPath(t *testing.T) {
+	fake, _ := newFakeGitlab(t, "main", fakeZone)
+
+	// Serve the fake GitLab API under /custom/gitlab-api instead of /api/v4
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/custom/gitlab-api/") {
+			http.Error(w, `{"message":"404 Not found"}`, http.StatusNotFound)
+			return
+		}
+		r.URL.Path = defaultAPIPath + strings.TrimPrefix(r.URL.Path, "/custom/gitlab-api")
+		r.URL.RawPath = ""
+		fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	c, err := NewGitlabAPIClient("token", srv.URL+"/custom/gitlab-api", time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkGitlabAPI(c); err != nil {
+		t.Fatalf("expected API to be available, got %v", err)
+	}
+	content, err := ReadZoneFile(c, "main", fakeProject, fakeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != fakeZone {
+		t.Errorf("expected %q, got %q", fakeZone, content)
+	}
+
+	// The root of the server and a wrong path do not reach the API
+	for _, apiURL := range []string{srv.URL, srv.URL + "/wrong"} {
+		c, err := NewGitlabAPIClient("token", apiURL, time.Second, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := checkGitlabAPI(c); !errors.Is(err, ErrGitlabAPIUnavailable) {
+			t.Errorf("expected %v for %s, got %v", ErrGitlabAPIUnavailable, apiURL, err)
+		}
+	}
+}
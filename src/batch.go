@@ -0,0 +1,35 @@
+/*
+This file provides the batching of several record changes into one commit and merge request.
+The edits of a batch are applied to the zone file in order, and the serial number is increased once for the
+whole batch on the final content, so that a merge request changing three records increases the serial number by
+one step like a merge request changing a single record. If the zone file changed concurrently, the whole batch is
+applied to the fresh content again, see conflict.go. The batches are written by the manual cleanup, see cleanup.go,
+and by the batched cleanups of CLEANUP_BATCH_WINDOW, see cleanupbatch.go.
+*/
+package main
+
+// zoneBatch is a list of edits written to the zone file in one commit
+type zoneBatch []zoneEdit
+
+// apply applies the edits of the batch in order.
+func (b zoneBatch) apply(content string) (string, error) {
+	for _, edit := range b {
+		var err error
+		if content, err = edit(content); err != nil {
+			return "", err
+		}
+	}
+
+	return content, nil
+}
+
+// updateBotZoneFileBatch applies all edits of the batch to the content and writes the result to the bot branch.
+// If bumpSerial is set, the serial number is increased once for the whole batch, see updateBotZoneFile.
+func (h *gitSolver) updateBotZoneFileBatch(content string, message string, batch zoneBatch, bumpSerial bool) (string, error) {
+	changed, err := batch.apply(content)
+	if err != nil {
+		return "", err
+	}
+
+	return h.updateBotZoneFile(changed, message, batch.apply, bumpSerial)
+}
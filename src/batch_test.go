@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kallepan/cert-manager-webhook/src/zone"
+)
+
+func TestUpdateBotZoneFileBatch(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	fake.copyBranch("main", "acme-bot")
+
+	batch := zoneBatch{}
+	for i := 1; i <= 3; i++ {
+		record := solver.newRecord(fmt.Sprintf("_acme-challenge.%d.example.com.", i), "example.com.", fmt.Sprintf("key-%d", i))
+		batch = append(batch, func(content string) (string, error) {
+			return solver.addRecord(content, record, "")
+		})
+	}
+
+	written, err := solver.updateBotZoneFileBatch(fakeZone, "Add TXT records", batch, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// All records are written in one commit, which increases the serial number by exactly one step
+	if len(fake.commits) != 1 {
+		t.Fatalf("expected 1 commit, got %d", len(fake.commits))
+	}
+	want, err := zone.NextSerialNumber(zone.SerialNumber(fakeZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := zone.SerialNumber(written); got != want {
+		t.Errorf("expected serial number %s, got %s", want, got)
+	}
+	if got := zone.SerialNumber(fake.content("acme-bot")); got != want {
+		t.Errorf("expected serial number %s on the bot branch, got %s", want, got)
+	}
+	for i := 1; i <= 3; i++ {
+		if !strings.Contains(written, fmt.Sprintf("\"key-%d\"", i)) {
+			t.Errorf("expected record %d in %q", i, written)
+		}
+	}
+}
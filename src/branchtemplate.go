@@ -0,0 +1,188 @@
+/*
+This file provides per-challenge bot branches, for operators whose CI or branch protection rules expect a naming
+convention. If GITLAB_BOT_BRANCH_TEMPLATE is set, Present and CleanUp use a branch rendered from the go template
+instead of GITLAB_BOT_BRANCH, e.g.
+
+	acme-bot/{{.ZoneSafe}}/{{.Hash}}    acme-bot/example-com/3f2a9c1b04de
+
+The template is rendered with the fields of botBranchData. The FQDN and the zone are passed as they are and as
+components that are safe to use in a ref name. Hash identifies the record of the challenge, so that Present and
+CleanUp of the same challenge use the same branch name. The rendered name is checked against the rules of git for
+ref names, see checkBranchName.
+
+Every challenge starts its branch from the target branch and the branch is removed when its merge request is
+merged. GITLAB_BOT_BRANCH is still used to read the records on startup, for the manual cleanup and to onboard
+zone files without markers.
+*/
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+var ErrInvalidBranchName = errors.New("invalid branch name")
+
+const (
+	// maxBranchNameLength is the maximum length of a rendered branch name, GitLab rejects longer names
+	maxBranchNameLength = 255
+
+	// maxRefComponentLength is the maximum length of a sanitized FQDN or zone in a branch name
+	maxRefComponentLength = 63
+
+	// branchHashLength is the number of hex digits of Hash
+	branchHashLength = 12
+)
+
+// botBranchData is passed to the bot branch template
+type botBranchData struct {
+	FQDN      string
+	FQDNSafe  string
+	Zone      string
+	ZoneSafe  string
+	Hash      string
+	Namespace string
+	UID       string
+}
+
+// unsafeRefCharsRegex matches the runs of characters that are replaced in a ref component
+var unsafeRefCharsRegex = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// parseBotBranchTemplate parses the bot branch template and checks that it renders a valid branch name.
+// An empty string disables the template.
+func parseBotBranchTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	tmpl, err := template.New("bot-branch").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid GITLAB_BOT_BRANCH_TEMPLATE: %w", ErrInvalidConfig, err)
+	}
+
+	// A template with illegal characters outside of its fields fails on startup instead of on every challenge
+	sample := &acme.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		ResourceNamespace: "default",
+		UID:               "00000000-0000-0000-0000-000000000000",
+	}
+	if _, err := renderBotBranch(tmpl, sample, "example"); err != nil {
+		return nil, fmt.Errorf("%w: invalid GITLAB_BOT_BRANCH_TEMPLATE: %w", ErrInvalidConfig, err)
+	}
+
+	return tmpl, nil
+}
+
+// renderBotBranch renders the name of the bot branch of the challenge, id is the record ID of the challenge.
+func renderBotBranch(tmpl *template.Template, ch *acme.ChallengeRequest, id string) (string, error) {
+	sum := sha256.Sum256([]byte(id))
+
+	var sb strings.Builder
+	err := tmpl.Execute(&sb, botBranchData{
+		FQDN:      ch.ResolvedFQDN,
+		FQDNSafe:  sanitizeRefComponent(ch.ResolvedFQDN),
+		Zone:      ch.ResolvedZone,
+		ZoneSafe:  sanitizeRefComponent(ch.ResolvedZone),
+		Hash:      hex.EncodeToString(sum[:])[:branchHashLength],
+		Namespace: ch.ResourceNamespace,
+		UID:       string(ch.UID),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	name := sb.String()
+	if err := checkBranchName(name); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// sanitizeRefComponent turns the FQDN into a single component of a ref name, e.g. "_acme-challenge.Example.com."
+// into "_acme-challenge-example-com". Runs of other characters than letters, digits, "_" and "-" become a single
+// "-", and the result is cut to maxRefComponentLength characters.
+func sanitizeRefComponent(fqdn string) string {
+	s := unsafeRefCharsRegex.ReplaceAllString(strings.ToLower(fqdn), "-")
+	if len(s) > maxRefComponentLength {
+		s = s[:maxRefComponentLength]
+	}
+	s = strings.Trim(s, "-")
+
+	if s == "" {
+		return "root"
+	}
+
+	return s
+}
+
+// checkBranchName checks the name against the rules of git for ref names, see git-check-ref-format(1).
+func checkBranchName(name string) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w: %q %s", ErrInvalidBranchName, name, reason)
+	}
+
+	switch {
+	case name == "":
+		return invalid("is empty")
+	case len(name) > maxBranchNameLength:
+		return invalid(fmt.Sprintf("is longer than %d characters", maxBranchNameLength))
+	case name == "@":
+		return invalid("is @")
+	case strings.ContainsAny(name, " ~^:?*[\\\x7f"):
+		return invalid("contains a space or one of ~^:?*[\\")
+	case strings.Contains(name, ".."):
+		return invalid("contains ..")
+	case strings.Contains(name, "@{"):
+		return invalid("contains @{")
+	case strings.HasPrefix(name, "-"):
+		return invalid("starts with -")
+	case strings.HasSuffix(name, "."):
+		return invalid("ends with .")
+	}
+
+	for _, r := range name {
+		if r < 0x20 {
+			return invalid("contains a control character")
+		}
+	}
+
+	for _, component := range strings.Split(name, "/") {
+		switch {
+		case component == "":
+			return invalid("has an empty component")
+		case strings.HasPrefix(component, "."):
+			return invalid("has a component starting with .")
+		case strings.HasSuffix(component, ".lock"):
+			return invalid("has a component ending with .lock")
+		}
+	}
+
+	return nil
+}
+
+// beginBotBranch switches the solver to the bot branch of the challenge holding the zone lock, if a template is
+// configured. The returned function switches back to GITLAB_BOT_BRANCH.
+func (h *gitSolver) beginBotBranch(ch *acme.ChallengeRequest) (func(), error) {
+	if h.botBranchTemplate == nil {
+		return func() {}, nil
+	}
+
+	branch, err := renderBotBranch(h.botBranchTemplate, ch, h.recordID(ch))
+	if err != nil {
+		return nil, fmt.Errorf("%w: rendering GITLAB_BOT_BRANCH_TEMPLATE: %w", ErrInvalidConfig, err)
+	}
+
+	defaultBranch := h.gitBotBranch
+	h.gitBotBranch = branch
+
+	return func() { h.gitBotBranch = defaultBranch }, nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestSanitizeRefComponent(t *testing.T) {
+	testCases := []struct {
+		fqdn string
+		want string
+	}{
+		{fqdn: "example.com.", want: "example-com"},
+		{fqdn: "_acme-challenge.Example.COM.", want: "_acme-challenge-example-com"},
+		{fqdn: "*.example.com.", want: "example-com"},
+		{fqdn: "_acme-challenge..example.com..", want: "_acme-challenge-example-com"},
+		{fqdn: "xn--bcher-kva.example.", want: "xn--bcher-kva-example"},
+		{fqdn: "bücher.example.", want: "b-cher-example"},
+		{fqdn: "a b~c^d:e?f*g[h\\i@{j}.lock.", want: "a-b-c-d-e-f-g-h-i-j-lock"},
+		{fqdn: ".", want: "root"},
+		{fqdn: "", want: "root"},
+		{fqdn: strings.Repeat("a", 62) + ".example.com.", want: strings.Repeat("a", 62)},
+		{fqdn: strings.Repeat("abc.", 30), want: strings.TrimSuffix(strings.Repeat("abc-", 16), "-")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.fqdn, func(t *testing.T) {
+			got := sanitizeRefComponent(tc.fqdn)
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+			if err := checkBranchName(got); err != nil {
+				t.Errorf("expected a valid branch name, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckBranchName(t *testing.T) {
+	testCases := []struct {
+		name  string
+		valid bool
+	}{
+		{name: "acme-bot", valid: true},
+		{name: "acme-bot/example-com/3f2a9c1b04de", valid: true},
+		{name: "acme-bot/_acme-challenge.example.com", valid: true},
+		{name: ""},
+		{name: "@"},
+		{name: "acme bot"},
+		{name: "acme-bot/*.example.com"},
+		{name: "acme-bot/example.com."},
+		{name: "acme-bot/..example"},
+		{name: "acme-bot/.hidden"},
+		{name: "acme-bot/example.lock"},
+		{name: "acme-bot//example"},
+		{name: "/acme-bot"},
+		{name: "acme-bot/"},
+		{name: "-acme-bot"},
+		{name: "acme-bot@{1}"},
+		{name: "acme-bot\tbranch"},
+		{name: strings.Repeat("a", 256)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkBranchName(tc.name)
+			if tc.valid && err != nil {
+				t.Errorf("expected %q to be valid, got %v", tc.name, err)
+			}
+			if !tc.valid && !errors.Is(err, ErrInvalidBranchName) {
+				t.Errorf("expected %v for %q, got %v", ErrInvalidBranchName, tc.name, err)
+			}
+		})
+	}
+}
+
+func TestRenderBotBranch(t *testing.T) {
+	challenge := &acme.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.Example.com.",
+		ResolvedZone:      "example.com.",
+		ResourceNamespace: "certs",
+		UID:               "1234",
+	}
+
+	testCases := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{
+			name:     "zone and hash",
+			template: "acme-bot/{{.ZoneSafe}}/{{.Hash}}",
+			want:     "acme-bot/example-com/422946d6d487",
+		},
+		{
+			name:     "fqdn",
+			template: "acme-bot/{{.Namespace}}/{{.FQDNSafe}}-{{.UID}}",
+			want:     "acme-bot/certs/_acme-challenge-example-com-1234",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := parseBotBranchTemplate(tc.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := renderBotBranch(tmpl, challenge, "_acme-challenge.example.com.wow-so-secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParseBotBranchTemplate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		template string
+		err      bool
+	}{
+		{name: "empty"},
+		{name: "valid", template: "acme-bot/{{.ZoneSafe}}/{{.Hash}}"},
+		{name: "syntax", template: "acme-bot/{{.ZoneSafe", err: true},
+		{name: "unknown field", template: "acme-bot/{{.Missing}}", err: true},
+		{name: "illegal characters", template: "acme bot/{{.Hash}}", err: true},
+		{name: "unsafe field", template: "acme-bot/{{.FQDN}}", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseBotBranchTemplate(tc.template)
+			if tc.err != errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("expected error %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestPresentCleanUpBotBranchTemplate(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	tmpl, err := parseBotBranchTemplate("acme-bot/{{.ZoneSafe}}/{{.Hash}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	solver.botBranchTemplate = tmpl
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", ResolvedZone: "example.com.", Key: "wow-so-secret"}
+	branch, err := renderBotBranch(tmpl, challenge, solver.recordID(challenge))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if err := solver.CleanUp(challenge); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both commits are written to the branch of the challenge, and the solver switches back afterwards
+	if len(fake.commits) != 2 {
+		t.Fatalf("expected 2 commits, got %d", len(fake.commits))
+	}
+	for _, commit := range fake.commits {
+		if commit.branch != branch {
+			t.Errorf("expected commit on %q, got %q", branch, commit.branch)
+		}
+	}
+	if solver.gitBotBranch != "acme-bot" {
+		t.Errorf("expected bot branch to be reset to %q, got %q", "acme-bot", solver.gitBotBranch)
+	}
+	if strings.Contains(fake.content("main"), "wow-so-secret") {
+		t.Errorf("expected record to be removed, got %q", fake.content("main"))
+	}
+}
@@ -0,0 +1,147 @@
+/*
+This file provides the circuit breaker of the GitLab backend, so that challenges fail fast while GitLab is down
+instead of each going through the full retries and timeouts of the client.
+If GITLAB_CIRCUIT_BREAKER_THRESHOLD is set, the circuit opens after that many consecutive Present or CleanUp
+calls failed because GitLab was unreachable, i.e. with a network error, a timeout or a 5xx response. While it is
+open, the calls fail immediately with ErrCircuitOpen, which cert-manager retries like any other error. After
+GITLAB_CIRCUIT_BREAKER_COOLDOWN the circuit is half-open: a single call is let through to probe GitLab, and
+closes the circuit if GitLab answered or opens it for another cooldown otherwise. Other errors, e.g. a record
+that already exists, show that GitLab is reachable and close the circuit as well.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+var ErrCircuitOpen = errors.New("GitLab unreachable, circuit breaker open")
+
+// defaultCircuitBreakerCooldown is how long the circuit stays open before GitLab is probed again
+var defaultCircuitBreakerCooldown = 30 * time.Second
+
+// circuitState is the state of a circuitBreaker
+type circuitState string
+
+const (
+	circuitClosed   circuitState = "closed"
+	circuitOpen     circuitState = "open"
+	circuitHalfOpen circuitState = "half-open"
+)
+
+// circuitBreaker counts the consecutive calls that failed because GitLab was unreachable.
+// A nil circuitBreaker lets every call through.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	// now returns the current time, it is replaced in tests
+	now func() time.Time
+
+	lock     sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// newCircuitBreaker creates a breaker opening after threshold consecutive failures for the cooldown.
+// A breaker created with threshold 0 is nil.
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		state:     circuitClosed,
+	}
+}
+
+// allow returns ErrCircuitOpen if the call must fail fast. Otherwise, the outcome of the call must be passed
+// to done.
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		remaining := b.cooldown - b.now().Sub(b.openedAt)
+		if remaining > 0 {
+			return fmt.Errorf("%w: retrying in %s", ErrCircuitOpen, remaining.Round(time.Second))
+		}
+		slog.Info("circuit breaker half-open, probing GitLab")
+		b.state = circuitHalfOpen
+		b.probing = true
+		return nil
+
+	case circuitHalfOpen:
+		// Only a single call probes GitLab
+		if b.probing {
+			return fmt.Errorf("%w: probing GitLab", ErrCircuitOpen)
+		}
+		b.probing = true
+		return nil
+	}
+
+	return nil
+}
+
+// done records the outcome of a call let through by allow.
+func (b *circuitBreaker) done(err error) {
+	if b == nil {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.state == circuitHalfOpen {
+		b.probing = false
+	}
+
+	if !isUnreachable(err) {
+		if b.state != circuitClosed {
+			slog.Info("GitLab reachable again, circuit breaker closed")
+		}
+		b.state = circuitClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		slog.Warn("GitLab unreachable, circuit breaker open", "failures", b.failures, "cooldown", b.cooldown)
+		b.state = circuitOpen
+		b.openedAt = b.now()
+	}
+}
+
+// isUnreachable reports whether the error shows that GitLab could not be reached or failed to answer.
+func isUnreachable(err error) bool {
+	if err == nil || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+
+	var errResp *gitlab.ErrorResponse
+	if errors.As(err, &errResp) && errResp.Response != nil {
+		return errResp.Response.StatusCode >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/xanzy/go-gitlab"
+)
+
+var errUnreachable = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2024, 9, 15, 10, 0, 0, 0, time.UTC)
+	b := newCircuitBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	call := func(err error) error {
+		t.Helper()
+
+		if allowErr := b.allow(); allowErr != nil {
+			return allowErr
+		}
+		b.done(err)
+		return nil
+	}
+
+	// Closed: the failures are counted until the threshold
+	if err := call(errUnreachable); err != nil {
+		t.Fatalf("expected call to be let through, got %v", err)
+	}
+	if b.state != circuitClosed {
+		t.Fatalf("expected circuit %s, got %s", circuitClosed, b.state)
+	}
+	if err := call(errUnreachable); err != nil {
+		t.Fatalf("expected call to be let through, got %v", err)
+	}
+	if b.state != circuitOpen {
+		t.Fatalf("expected circuit %s, got %s", circuitOpen, b.state)
+	}
+
+	// Open: the calls fail fast until the cooldown passed
+	now = now.Add(30 * time.Second)
+	if err := call(nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected %v, got %v", ErrCircuitOpen, err)
+	}
+
+	// Half-open: a single call probes GitLab, a failed probe opens the circuit again
+	now = now.Add(time.Minute)
+	if err := b.allow(); err != nil {
+		t.Fatalf("expected probe to be let through, got %v", err)
+	}
+	if b.state != circuitHalfOpen {
+		t.Fatalf("expected circuit %s, got %s", circuitHalfOpen, b.state)
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected concurrent call to fail with %v, got %v", ErrCircuitOpen, err)
+	}
+	b.done(errUnreachable)
+	if b.state != circuitOpen {
+		t.Fatalf("expected circuit %s, got %s", circuitOpen, b.state)
+	}
+
+	// A successful probe closes the circuit
+	now = now.Add(time.Minute)
+	if err := call(ErrTextRecordAlreadyExists); err != nil {
+		t.Fatalf("expected probe to be let through, got %v", err)
+	}
+	if b.state != circuitClosed || b.failures != 0 {
+		t.Fatalf("expected circuit %s without failures, got %s with %d", circuitClosed, b.state, b.failures)
+	}
+}
+
+func TestNewCircuitBreakerDisabled(t *testing.T) {
+	b := newCircuitBreaker(0, time.Minute)
+	if b != nil {
+		t.Fatalf("expected no breaker, got %v", b)
+	}
+
+	// A nil breaker lets every call through
+	for i := 0; i < 3; i++ {
+		if err := b.allow(); err != nil {
+			t.Fatalf("expected call to be let through, got %v", err)
+		}
+		b.done(errUnreachable)
+	}
+}
+
+func TestIsUnreachable(t *testing.T) {
+	response := func(status int) error {
+		return &gitlab.ErrorResponse{Response: &http.Response{StatusCode: status}}
+	}
+
+	testCases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "no error"},
+		{name: "network error", err: fmt.Errorf("GET /projects: %w", errUnreachable), want: true},
+		{name: "server error", err: response(http.StatusBadGateway), want: true},
+		{name: "client error", err: response(http.StatusNotFound)},
+		{name: "circuit open", err: ErrCircuitOpen},
+		{name: "other error", err: ErrTextRecordDoesNotExist},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isUnreachable(tc.err); got != tc.want {
+				t.Errorf("expected %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPresentCircuitBreaker(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, `{"message":"502 Bad Gateway"}`, http.StatusBadGateway)
+	}))
+	t.Cleanup(srv.Close)
+
+	solver := newTestSolver(t, srv)
+	git, err := gitlab.NewClient("token", gitlab.WithBaseURL(srv.URL), gitlab.WithoutRetries())
+	if err != nil {
+		t.Fatal(err)
+	}
+	solver.gitClient = git
+	solver.breaker = newCircuitBreaker(2, time.Minute)
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+	for i := 0; i < 2; i++ {
+		if err := solver.Present(challenge); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected GitLab error, got %v", err)
+		}
+	}
+
+	// The open circuit fails without contacting GitLab
+	before := requests
+	if err := solver.Present(challenge); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected %v, got %v", ErrCircuitOpen, err)
+	}
+	if err := solver.CleanUp(challenge); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected %v, got %v", ErrCircuitOpen, err)
+	}
+	if requests != before {
+		t.Errorf("expected no requests while the circuit is open, got %d", requests-before)
+	}
+}
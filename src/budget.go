@@ -0,0 +1,98 @@
+/*
+This file provides the time budget of a challenge, so that the webhook returns before cert-manager gives up on it.
+Issuers with short DNS propagation timeouts set a timeout hint in the webhook config of the solver, e.g.
+
+	webhook:
+	  groupName: acme.example.com
+	  solverName: git-solver
+	  config:
+	    timeout: 90s
+
+The budget defaults to CHALLENGE_TIMEOUT and starts when Present or CleanUp is called. All internal waits of the
+challenge are bounded by its deadline: the merge request polls (rebase, approvals, mergeability) and the waits for
+lagging reads, see consistency.go. A challenge whose budget ran out while it waited for the zone lock fails before
+changing the zone file, so that no work is done for a challenge cert-manager has already abandoned.
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+var ErrChallengeTimeout = errors.New("challenge timeout exceeded")
+
+// challengeConfig is the webhook config of the solver sent with every challenge
+type challengeConfig struct {
+	Timeout string `json:"timeout"`
+
+	// Issuer names the issuer of the solver in the record comment, see comment.go
+	Issuer string `json:"issuer"`
+}
+
+// challengeDeadline returns the deadline of the challenge, or the zero time if it has no budget.
+func (h *gitSolver) challengeDeadline(ch *acme.ChallengeRequest, start time.Time) (time.Time, error) {
+	timeout := h.challengeTimeout
+
+	if ch.Config != nil && len(ch.Config.Raw) > 0 {
+		var cfg challengeConfig
+		if err := json.Unmarshal(ch.Config.Raw, &cfg); err != nil {
+			return time.Time{}, fmt.Errorf("%w: invalid webhook config: %w", ErrInvalidConfig, err)
+		}
+		if cfg.Timeout != "" {
+			d, err := time.ParseDuration(cfg.Timeout)
+			if err != nil || d < 0 {
+				return time.Time{}, fmt.Errorf("%w: invalid timeout %q in webhook config", ErrInvalidConfig, cfg.Timeout)
+			}
+			timeout = d
+		}
+	}
+
+	if timeout <= 0 {
+		return time.Time{}, nil
+	}
+
+	return start.Add(timeout), nil
+}
+
+// beginBudget bounds the waits of the solver by the deadline of the challenge holding the zone lock. It fails
+// if the deadline has passed, e.g. while waiting for the lock. The returned function ends the budget.
+func (h *gitSolver) beginBudget(fqdn string, deadline time.Time) (func(), error) {
+	if deadline.IsZero() {
+		return func() {}, nil
+	}
+	if !time.Now().Before(deadline) {
+		return nil, fmt.Errorf("%w: %s was not handled before %s", ErrChallengeTimeout, fqdn, deadline.Format(time.RFC3339))
+	}
+
+	h.deadlineLock.Lock()
+	h.deadline = deadline
+	h.deadlineLock.Unlock()
+
+	return func() {
+		h.deadlineLock.Lock()
+		h.deadline = time.Time{}
+		h.deadlineLock.Unlock()
+	}, nil
+}
+
+// bounded returns the timeout, shortened to the time left until the deadline of the current challenge.
+func (h *gitSolver) bounded(timeout time.Duration) time.Duration {
+	h.deadlineLock.Lock()
+	defer h.deadlineLock.Unlock()
+
+	return boundTimeout(timeout, h.deadline)
+}
+
+// boundTimeout returns the timeout, shortened to the time left until the deadline unless it is zero.
+func boundTimeout(timeout time.Duration, deadline time.Time) time.Duration {
+	if deadline.IsZero() {
+		return timeout
+	}
+
+	return max(min(timeout, time.Until(deadline)), 0)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/xanzy/go-gitlab"
+)
+
+// challengeWithConfig returns a challenge with the given webhook config, as sent by cert-manager
+func challengeWithConfig(t *testing.T, fqdn string, key string, config string) *acme.ChallengeRequest {
+	t.Helper()
+
+	ch := &acme.ChallengeRequest{ResolvedFQDN: fqdn, Key: key}
+	if config != "" {
+		if err := json.Unmarshal([]byte(`{"config": `+config+`}`), ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return ch
+}
+
+func TestChallengeDeadline(t *testing.T) {
+	start := time.Date(2024, 9, 15, 10, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		fallback time.Duration
+		config   string
+		want     time.Time
+		err      bool
+	}{
+		{name: "no budget"},
+		{name: "fallback", fallback: time.Minute, want: start.Add(time.Minute)},
+		{name: "config", fallback: time.Minute, config: `{"timeout": "90s"}`, want: start.Add(90 * time.Second)},
+		{name: "config without timeout", fallback: time.Minute, config: `{"other": true}`, want: start.Add(time.Minute)},
+		{name: "config disables budget", fallback: time.Minute, config: `{"timeout": "0s"}`},
+		{name: "invalid timeout", config: `{"timeout": "soon"}`, err: true},
+		{name: "negative timeout", config: `{"timeout": "-1s"}`, err: true},
+		{name: "invalid config", config: `[]`, err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &gitSolver{challengeTimeout: tc.fallback}
+			got, err := h.challengeDeadline(challengeWithConfig(t, "", "", tc.config), start)
+			if tc.err != errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if !got.Equal(tc.want) {
+				t.Errorf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestBoundTimeout(t *testing.T) {
+	if got := boundTimeout(time.Minute, time.Time{}); got != time.Minute {
+		t.Errorf("expected the timeout without a deadline, got %s", got)
+	}
+	if got := boundTimeout(time.Minute, time.Now().Add(time.Second)); got > time.Second || got <= 0 {
+		t.Errorf("expected at most the time left, got %s", got)
+	}
+	if got := boundTimeout(time.Minute, time.Now().Add(-time.Second)); got != 0 {
+		t.Errorf("expected no time after the deadline, got %s", got)
+	}
+}
+
+func TestMergeRespectsDeadline(t *testing.T) {
+	defer func(d time.Duration) { mergeRequestPollInterval = d }(mergeRequestPollInterval)
+	mergeRequestPollInterval = 10 * time.Millisecond
+
+	fake, srv := newFakeGitlab(t, "main", "old")
+	fake.branches["acme-bot"] = "new"
+	fake.mergeStatus = "checking"
+	fake.detailedMergeStatus = "checking"
+
+	c, err := gitlab.NewClient("token", gitlab.WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The deadline ends the wait long before the timeout of the merge
+	start := time.Now()
+	cfg := MergeConfig{Timeout: time.Minute}.WithDeadline(start.Add(100 * time.Millisecond))
+	if err := Merge(c, fakeProject, "acme-bot", "main", "title", "description", cfg); !errors.Is(err, ErrMergeRequestNotMergeable) {
+		t.Fatalf("expected %v, got %v", ErrMergeRequestNotMergeable, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the merge to give up at the deadline, took %s", elapsed)
+	}
+}
+
+func TestPresentChallengeBudget(t *testing.T) {
+	defer func(d time.Duration) { mergeRequestPollInterval = d }(mergeRequestPollInterval)
+	mergeRequestPollInterval = 10 * time.Millisecond
+
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	fake.mergeStatus = "checking"
+	fake.detailedMergeStatus = "checking"
+	solver := newTestSolver(t, srv)
+	solver.mergeConfig.Timeout = time.Minute
+	solver.challengeTimeout = time.Minute
+
+	// The timeout of the issuer replaces the default budget
+	challenge := challengeWithConfig(t, "_acme-challenge.example.com.", "wow-so-secret", `{"timeout": "200ms"}`)
+
+	start := time.Now()
+	if err := solver.Present(challenge); !errors.Is(err, ErrMergeRequestNotMergeable) {
+		t.Fatalf("expected %v, got %v", ErrMergeRequestNotMergeable, err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected Present to return within the budget, took %s", elapsed)
+	}
+	if !solver.deadline.IsZero() {
+		t.Errorf("expected the budget to end with the challenge, got %s", solver.deadline)
+	}
+}
+
+func TestPresentBudgetExceededWaitingForZoneLock(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	solver.challengeTimeout = 50 * time.Millisecond
+
+	// Another challenge holds the zone lock beyond the budget
+	solver.zoneLock.Lock()
+	done := make(chan error)
+	go func() {
+		done <- solver.Present(&acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"})
+	}()
+	time.Sleep(100 * time.Millisecond)
+	solver.zoneLock.Unlock()
+
+	if err := <-done; !errors.Is(err, ErrChallengeTimeout) {
+		t.Fatalf("expected %v, got %v", ErrChallengeTimeout, err)
+	}
+	if len(fake.commits) != 0 {
+		t.Errorf("expected no commits for an abandoned challenge, got %d", len(fake.commits))
+	}
+}
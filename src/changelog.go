@@ -0,0 +1,106 @@
+/*
+This file provides the changelog of the zone file, for teams that have to document every change of the zone in the
+zone file itself. If ZONE_CHANGELOG_TEMPLATE is set, every added and removed record appends a comment line rendered
+from the go template to a changelog block of its own, e.g. with "{{.Time}} {{.Action}} {{.FQDN}} by {{.Author}}":
+
+	; TEST-ACME-CHANGELOG
+	; 2026-10-15T09:30:00Z add _acme-challenge.example.com. by acme-bot
+	; 2026-10-15T09:32:00Z remove _acme-challenge.example.com. by acme-bot
+	; TEST-ACME-CHANGELOG-END
+
+The block is created at the end of the zone file by the first change. Its markers do not contain "-ACME-BOT", so
+that they are never mistaken for the markers of the records, and its lines are comments, which are never read as
+records. The line is appended by the same edit as the record change, so both are written in the same commit and
+applied again together if the zone file changed concurrently. The changelog requires ZONE_FORMAT bind.
+*/
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+// changelogData is passed to the changelog template
+type changelogData struct {
+	Time      string
+	Action    string
+	FQDN      string
+	DNSName   string
+	Namespace string
+	UID       string
+	Author    string
+}
+
+// parseChangelogTemplate parses the changelog template. An empty string disables the changelog.
+func parseChangelogTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	tmpl, err := template.New("changelog").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid ZONE_CHANGELOG_TEMPLATE: %w", ErrInvalidConfig, err)
+	}
+
+	return tmpl, nil
+}
+
+// changelogEntry renders the changelog line of the action on the record of the challenge, e.g. "add" or "remove".
+// It returns an empty string if the changelog is disabled.
+func (h *gitSolver) changelogEntry(action string, ch *acme.ChallengeRequest, now time.Time) (string, error) {
+	if h.changelogTemplate == nil {
+		return "", nil
+	}
+
+	var sb strings.Builder
+	err := h.changelogTemplate.Execute(&sb, changelogData{
+		Time:      now.UTC().Format(time.RFC3339),
+		Action:    action,
+		FQDN:      ch.ResolvedFQDN,
+		DNSName:   ch.DNSName,
+		Namespace: ch.ResourceNamespace,
+		UID:       string(ch.UID),
+		Author:    h.commitConfig.AuthorName,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// The entry has to stay on a single line
+	return "; " + strings.Join(strings.Fields(sb.String()), " "), nil
+}
+
+// changelogMarkers returns the begin and end marker of the changelog block.
+func (h *gitSolver) changelogMarkers() (string, string) {
+	return fmt.Sprintf("; %s-ACME-CHANGELOG", h.gitBotCommentPrefix), fmt.Sprintf("; %s-ACME-CHANGELOG-END", h.gitBotCommentPrefix)
+}
+
+// appendChangelog appends the entry to the changelog block, which is created at the end of the content if it is
+// missing. An empty entry leaves the content unchanged.
+func (h *gitSolver) appendChangelog(content string, entry string) (string, error) {
+	if entry == "" {
+		return content, nil
+	}
+
+	begin, end := h.changelogMarkers()
+	re, err := regexp.Compile(fmt.Sprintf(`(?m)^%s\n(?:[^\n]*\n)*?(%s)$`, regexp.QuoteMeta(begin), regexp.QuoteMeta(end)))
+	if err != nil {
+		return "", err
+	}
+
+	loc := re.FindStringSubmatchIndex(content)
+	if loc == nil {
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		return fmt.Sprintf("%s\n%s\n%s\n%s\n", content, begin, entry, end), nil
+	}
+
+	// The entry is inserted before the end marker, after the entries so far
+	return content[:loc[2]] + entry + "\n" + content[loc[2]:], nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestAppendChangelog(t *testing.T) {
+	h := &gitSolver{gitBotCommentPrefix: "TEST"}
+
+	content, err := h.appendChangelog("www IN A 1.2.3.4", "; first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err = h.appendChangelog(content, "; second"); err != nil {
+		t.Fatal(err)
+	}
+	if content, err = h.appendChangelog(content, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "www IN A 1.2.3.4\n\n; TEST-ACME-CHANGELOG\n; first\n; second\n; TEST-ACME-CHANGELOG-END\n"
+	if content != want {
+		t.Errorf("expected %q, got %q", want, content)
+	}
+}
+
+func TestPresentCleanUpChangelog(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	solver.commitConfig.AuthorName = "acme-bot"
+	tmpl, err := parseChangelogTemplate("{{.Action}} {{.FQDN}} by {{.Author}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	solver.changelogTemplate = tmpl
+
+	first := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "first-key"}
+	second := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.www.example.com.", Key: "second-key"}
+	for _, challenge := range []*acme.ChallengeRequest{first, second} {
+		if err := solver.Present(challenge); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := solver.CleanUp(first); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every change appended its line in the same commit as the record change
+	content := fake.content("main")
+	want := "; TEST-ACME-CHANGELOG\n" +
+		"; add _acme-challenge.example.com. by acme-bot\n" +
+		"; add _acme-challenge.www.example.com. by acme-bot\n" +
+		"; remove _acme-challenge.example.com. by acme-bot\n" +
+		"; TEST-ACME-CHANGELOG-END\n"
+	if !strings.HasSuffix(content, want) {
+		t.Errorf("expected the changelog %q, got %q", want, content)
+	}
+	for _, commit := range fake.commits {
+		if !strings.Contains(commit.content, "TEST-ACME-CHANGELOG") {
+			t.Errorf("expected commit %q to change the changelog", commit.message)
+		}
+	}
+
+	// The records are still read from the zone file
+	records, err := solver.readAcmeBotRecords(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[solver.recordID(second)] != second.Key {
+		t.Errorf("expected only the record of %s, got %v", second.ResolvedFQDN, records)
+	}
+}
+
+func TestChangelogEntry(t *testing.T) {
+	h := &gitSolver{}
+	if entry, err := h.changelogEntry("add", &acme.ChallengeRequest{}, time.Now()); err != nil || entry != "" {
+		t.Errorf("expected no entry without a template, got %q, %v", entry, err)
+	}
+
+	tmpl, err := parseChangelogTemplate("{{.Time}}\n{{.Action}}   {{.Namespace}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.changelogTemplate = tmpl
+
+	entry, err := h.changelogEntry("remove", &acme.ChallengeRequest{ResourceNamespace: "default"}, time.Date(2026, 10, 15, 9, 30, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "; 2026-10-15T09:30:00Z remove default"; entry != want {
+		t.Errorf("expected %q, got %q", want, entry)
+	}
+}
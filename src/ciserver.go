@@ -0,0 +1,24 @@
+/*
+This file provides the default of GITLAB_URL inside GitLab CI, e.g. for a webhook started by a job with a CI job
+token. If GITLAB_URL is not set, the URL of the instance running the job is read from CI_SERVER_URL, which GitLab
+sets for every job. GITLAB_URL is authoritative if set, and GITLAB_API_URL replaces both as before, see api.go.
+*/
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// ciServerURLEnv is the variable holding the URL of the GitLab instance in GitLab CI jobs
+const ciServerURLEnv = "CI_SERVER_URL"
+
+// getGitlabURL returns GITLAB_URL, or the URL of the GitLab instance of the CI job if it is not set.
+func getGitlabURL() (string, error) {
+	gitlabURL, err := getEnv("GITLAB_URL")
+	if err != nil || gitlabURL != "" {
+		return gitlabURL, err
+	}
+
+	return strings.TrimSuffix(os.Getenv(ciServerURLEnv), "/"), nil
+}
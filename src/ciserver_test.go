@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestGetGitlabURL(t *testing.T) {
+	testCases := []struct {
+		name      string
+		gitlabURL string
+		ciServer  string
+		want      string
+	}{
+		{name: "GITLAB_URL", gitlabURL: "https://gitlab.example.com", want: "https://gitlab.example.com"},
+		{name: "CI_SERVER_URL", ciServer: "https://ci.example.com/", want: "https://ci.example.com"},
+		{name: "GITLAB_URL takes precedence", gitlabURL: "https://gitlab.example.com", ciServer: "https://ci.example.com", want: "https://gitlab.example.com"},
+		{name: "neither"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("GITLAB_URL", tc.gitlabURL)
+			t.Setenv("CI_SERVER_URL", tc.ciServer)
+
+			got, err := getGitlabURL()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
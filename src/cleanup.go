@@ -0,0 +1,202 @@
+/*
+This file provides the maintenance mode of the webhook.
+If WEBHOOK_CLEANUP_FQDN is set, the webhook does not start the server but removes the TXT records of the
+given FQDN from the zone file using the same branch, serial number and merge request path as CleanUp, and exits.
+If WEBHOOK_CLEANUP_KEY is set as well, only the record with the given key is removed.
+If SHARED_RECORD_NAME is set, the records of the shared owner name are removed regardless of the given FQDN.
+If UNIQUE_RECORD_NAME is set, the owner name is derived from the key, so WEBHOOK_CLEANUP_KEY is required.
+If STATE_CONFIGMAP_NAME is set, the removed records are forgotten in the state backend as well, which is reached
+with the in-cluster configuration of the pod, as the maintenance mode is not started by the webhook framework.
+*/
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"k8s.io/client-go/rest"
+)
+
+// inClusterConfig returns the kubernetes client configuration of the maintenance mode
+var inClusterConfig = rest.InClusterConfig
+
+// runCleanup initializes the solver and removes the records of the given FQDN.
+func runCleanup(fqdn string, key string) error {
+	// The state backend is only reachable with a client configuration, which is nil if it is not configured
+	var kubeClientConfig *rest.Config
+	if os.Getenv("STATE_CONFIGMAP_NAME") != "" {
+		config, err := inClusterConfig()
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrKubeConfigNotDefined, err)
+		}
+		kubeClientConfig = config
+	}
+
+	h := newGitSolver()
+	if err := h.Initialize(kubeClientConfig, nil); err != nil {
+		return err
+	}
+
+	removed, err := h.RemoveRecords(fqdn, key)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("manual cleanup completed", "fqdn", fqdn, "removed", removed)
+	return nil
+}
+
+// RemoveRecords removes all TXT records of the given FQDN from the zone file and merges the change.
+// If key is not empty, only the records with the given key are removed.
+// It returns the number of removed records.
+func (h *gitSolver) RemoveRecords(fqdn string, key string) (int, error) {
+	route, err := h.route(fqdn)
+	if err != nil {
+		return 0, err
+	}
+	if route != h {
+		return route.RemoveRecords(fqdn, key)
+	}
+	if h.uniqueRecordNames && key == "" {
+		return 0, fmt.Errorf("%w: the records of %s cannot be removed without their key, as UNIQUE_RECORD_NAME derives the owner name from it", ErrInvalidConfig, fqdn)
+	}
+
+	h.zoneLock.Lock()
+	defer h.zoneLock.Unlock()
+	defer h.beginSerialZones("")()
+
+	endReplicaLock, err := h.beginReplicaLock(fqdn)
+	if err != nil {
+		return 0, err
+	}
+	defer endReplicaLock()
+
+	// Create the branch if it does not exist
+	if err := h.createBotBranch(); err != nil {
+		return 0, err
+	}
+
+	content, err := h.readBotZoneFile()
+	if err != nil {
+		return 0, err
+	}
+
+	// The zone of the FQDN is not known, the owner names are relative to the origin of the zone file instead
+	name := h.newRecord(h.uniqueRecordName(fqdn, key), h.zoneOrigin(content), key).Domain
+	entry, err := h.changelogEntry("remove", &acme.ChallengeRequest{ResolvedFQDN: fqdn}, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	_, found, err := h.removeTxtRecordsByName(content, name, key)
+	if err != nil {
+		return 0, err
+	}
+	if found == 0 {
+		return 0, ErrTextRecordDoesNotExist
+	}
+
+	// All records of the FQDN and the changelog entry are written as one batch, which increases the serial number
+	// once unless disabled for cleanups, see batch.go
+	removed := 0
+	batch := zoneBatch{
+		func(content string) (string, error) {
+			var err error
+			content, removed, err = h.removeTxtRecordsByName(content, name, key)
+			return content, err
+		},
+		func(content string) (string, error) {
+			return h.appendChangelog(content, entry)
+		},
+	}
+	written, err := h.updateBotZoneFileBatch(content, fmt.Sprintf("Remove TXT record: %s (manual cleanup)", fqdn), batch, !h.keepSerialOnCleanup)
+	if err != nil {
+		return 0, err
+	}
+
+	// Create a merge request
+	description := mergeRequestDescription(fmt.Sprintf("Manual cleanup of %s", fqdn), content, written)
+	if err := Merge(h.gitClient, h.gitPath, h.gitBotBranch, h.gitTargetBranch, "Remove TXT record (manual cleanup)", description, h.mergeConfig.WithLabels(zoneLabel(os.Getenv("ROOT_DOMAIN")))); err != nil {
+		return 0, err
+	}
+
+	// Remove the record from memory and from the state backend, if the key is known it has to match
+	if err := h.loadRecords(); err != nil {
+		return 0, err
+	}
+	h.recordsLock.RLock()
+	ids := []string{}
+	for id, recordKey := range h.txtRecords {
+		if id == h.recordIDFor(h.uniqueRecordName(fqdn, recordKey), recordKey) && (key == "" || recordKey == key) {
+			ids = append(ids, id)
+		}
+	}
+	h.recordsLock.RUnlock()
+
+	for _, id := range ids {
+		if err := h.forgetRecord(id); err != nil {
+			return 0, err
+		}
+	}
+
+	return removed, nil
+}
+
+// removeTxtRecordsByName removes the TXT records with the given owner name from the -ACME-BOT block.
+// If key is not empty, only the records with the given key are removed.
+// It returns the updated content and the number of removed records.
+func (h *gitSolver) removeTxtRecordsByName(content string, name string, key string) (string, int, error) {
+	if h.structuredZone != nil {
+		return h.structuredZone.removeRecords(content, name, key)
+	}
+
+	block, err := h.extractAcmeBotContent(content)
+	if err != nil {
+		return "", 0, err
+	}
+
+	removed := 0
+	kept := []string{}
+	for _, line := range strings.SplitAfter(block, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[0] == name && strings.EqualFold(fields[1], h.rrType()) {
+			if key == "" || h.parseRecordValue(strings.Join(fields[2:], " ")) == key {
+				removed++
+				if h.recordTombstones {
+					kept = append(kept, h.tombstone(line))
+					continue
+				}
+
+				// Remove the comment written by the webhook together with the record
+				if len(kept) > 0 && isRecordComment(kept[len(kept)-1]) {
+					kept = kept[:len(kept)-1]
+				}
+				continue
+			}
+		}
+		kept = append(kept, line)
+	}
+
+	re, err := h.acmeBotBlockRegex()
+	if err != nil {
+		return "", 0, err
+	}
+	loc := re.FindStringSubmatchIndex(content)
+	if loc == nil {
+		// The block was removed with its last record, see emptyblock.go
+		return content, 0, nil
+	}
+	content = content[:loc[2]] + strings.Join(kept, "") + content[loc[3]:]
+
+	if h.recordBlockSpacing {
+		if content, err = h.spaceAcmeBotBlock(content); err != nil {
+			return "", 0, err
+		}
+	}
+
+	content, err = h.handleEmptyBlock(content)
+	return content, removed, err
+}
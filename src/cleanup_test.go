@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+func TestRemoveTxtRecordsByName(t *testing.T) {
+	const content = "; TEST-ACME-BOT\n" +
+		"_acme-challenge.example.com            TXT \"one\"\n" +
+		"_acme-challenge.example.com            TXT \"two\"\n" +
+		"_acme-challenge.other.com            TXT \"three\"\n" +
+		"; TEST-ACME-BOT-END\n" +
+		"_acme-challenge.example.com            TXT \"outside\"\n"
+
+	testCases := []struct {
+		name    string
+		record  string
+		key     string
+		want    string
+		removed int
+	}{
+		{
+			name:   "all keys",
+			record: "_acme-challenge.example.com",
+			want: "; TEST-ACME-BOT\n" +
+				"_acme-challenge.other.com            TXT \"three\"\n" +
+				"; TEST-ACME-BOT-END\n" +
+				"_acme-challenge.example.com            TXT \"outside\"\n",
+			removed: 2,
+		},
+		{
+			name:   "single key",
+			record: "_acme-challenge.example.com",
+			key:    "two",
+			want: "; TEST-ACME-BOT\n" +
+				"_acme-challenge.example.com            TXT \"one\"\n" +
+				"_acme-challenge.other.com            TXT \"three\"\n" +
+				"; TEST-ACME-BOT-END\n" +
+				"_acme-challenge.example.com            TXT \"outside\"\n",
+			removed: 1,
+		},
+		{
+			name:    "no match",
+			record:  "_acme-challenge.missing.com",
+			want:    content,
+			removed: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &gitSolver{gitBotCommentPrefix: "TEST"}
+
+			got, removed, err := h.removeTxtRecordsByName(content, tc.record, tc.key)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+			if removed != tc.removed {
+				t.Errorf("expected %d removed records, got %d", tc.removed, removed)
+			}
+		})
+	}
+}
+
+func TestRemoveRecords(t *testing.T) {
+	zone := strings.Replace(fakeZone, "; TEST-ACME-BOT\n", "; TEST-ACME-BOT\n_acme-challenge.example.com            TXT \"leaked\"\n", 1)
+	fake, srv := newFakeGitlab(t, "main", zone)
+	solver := newTestSolver(t, srv)
+	solver.txtRecords[solver.recordIDFor("_acme-challenge.example.com.", "leaked")] = "leaked"
+
+	removed, err := solver.RemoveRecords("_acme-challenge.example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("expected 1 removed record, got %d", removed)
+	}
+	if strings.Contains(fake.content("main"), "leaked") {
+		t.Errorf("expected record to be removed, got %q", fake.content("main"))
+	}
+	if solver.hasRecord(solver.recordIDFor("_acme-challenge.example.com.", "leaked")) {
+		t.Error("expected record to be removed from memory")
+	}
+
+	if _, err := solver.RemoveRecords("_acme-challenge.example.com", ""); err != ErrTextRecordDoesNotExist {
+		t.Errorf("expected %v, got %v", ErrTextRecordDoesNotExist, err)
+	}
+}
+
+func TestRemoveRecordsAllKeys(t *testing.T) {
+	zone := strings.Replace(fakeZone, "; TEST-ACME-BOT\n", "; TEST-ACME-BOT\n"+
+		"_acme-challenge.example.com            TXT \"one\"\n"+
+		"_acme-challenge.www.example.com            TXT \"kept\"\n"+
+		"_acme-challenge.example.com            TXT \"two\"\n"+
+		"_acme-challenge.example.com            TXT \"three\"\n", 1)
+	fake, srv := newFakeGitlab(t, "main", zone)
+	solver := newTestSolver(t, srv)
+	for _, key := range []string{"one", "two", "three"} {
+		solver.txtRecords[solver.recordIDFor("_acme-challenge.example.com.", key)] = key
+	}
+
+	removed, err := solver.RemoveRecords("_acme-challenge.example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 3 {
+		t.Errorf("expected 3 removed records, got %d", removed)
+	}
+
+	content := fake.content("main")
+	if want := "; TEST-ACME-BOT\n_acme-challenge.www.example.com            TXT \"kept\"\n; TEST-ACME-BOT-END\n"; !strings.Contains(content, want) {
+		t.Errorf("expected %q in %q", want, content)
+	}
+	if len(solver.txtRecords) != 0 {
+		t.Errorf("expected records to be removed from memory, got %v", solver.txtRecords)
+	}
+
+	// All records are removed in a single commit that increases the serial number once
+	if len(fake.commits) != 1 {
+		t.Fatalf("expected 1 commit, got %d", len(fake.commits))
+	}
+	if want := "    " + time.Now().Format("20060102") + "01 ; serial number\n"; !strings.Contains(content, want) {
+		t.Errorf("expected %q in %q", want, content)
+	}
+}
+
+// newFakeConfigMapAPI serves the ConfigMap of the state backend like the kubernetes API server and returns the
+// ConfigMap, which is nil until it is created.
+func newFakeConfigMapAPI(t *testing.T, cm *corev1.ConfigMap) (func() *corev1.ConfigMap, *httptest.Server) {
+	var lock sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			if cm == nil {
+				status := apierrors.NewNotFound(corev1.Resource("configmaps"), "records").Status()
+				w.WriteHeader(http.StatusNotFound)
+				_ = json.NewEncoder(w).Encode(status)
+				return
+			}
+		case http.MethodPost, http.MethodPut:
+			cm = &corev1.ConfigMap{}
+			if err := json.NewDecoder(r.Body).Decode(cm); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(cm)
+	}))
+	t.Cleanup(srv.Close)
+
+	return func() *corev1.ConfigMap {
+		lock.Lock()
+		defer lock.Unlock()
+		return cm
+	}, srv
+}
+
+func TestRunCleanupWithStore(t *testing.T) {
+	zone := strings.Replace(fakeZone, "; TEST-ACME-BOT\n", "; TEST-ACME-BOT\n_acme-challenge.example.com            TXT \"leaked\"\n", 1)
+	fake, srv := newFakeGitlab(t, "main", zone)
+
+	id := (&gitSolver{}).recordIDFor("_acme-challenge.example.com.", "leaked")
+	configMap, kubeSrv := newFakeConfigMapAPI(t, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "records", Namespace: "default"},
+		Data:       map[string]string{id: "leaked"},
+	})
+	defer func(config func() (*rest.Config, error)) { inClusterConfig = config }(inClusterConfig)
+	inClusterConfig = func() (*rest.Config, error) { return &rest.Config{Host: kubeSrv.URL}, nil }
+
+	t.Setenv("GITLAB_BOT_BRANCH", "acme-bot")
+	t.Setenv("GITLAB_BOT_COMMENT_PREFIX", "TEST")
+	t.Setenv("GITLAB_TARGET_BRANCH", "main")
+	t.Setenv("GITLAB_PATH", fakeProject)
+	t.Setenv("GITLAB_FILE", fakeFile)
+	t.Setenv("GITLAB_TOKEN", "token")
+	t.Setenv("GITLAB_URL", srv.URL)
+	t.Setenv("MERGE_REQUEST_TIMEOUT", "1s")
+	t.Setenv("STATE_CONFIGMAP_NAME", "records")
+	t.Setenv("STATE_CONFIGMAP_NAMESPACE", "default")
+
+	if err := runCleanup("_acme-challenge.example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	if content := fake.content("main"); strings.Contains(content, "leaked") {
+		t.Errorf("expected record to be removed, got %q", content)
+	}
+	if cm := configMap(); cm == nil || len(cm.Data) != 0 {
+		t.Errorf("expected record to be removed from the store, got %v", cm)
+	}
+}
@@ -0,0 +1,276 @@
+/*
+This file provides the coalescing of cleanups, as cert-manager cleans up the records of all names of a certificate
+in rapid succession at the end of an issuance. If CLEANUP_BATCH_WINDOW is set, e.g. to "5s", the first CleanUp
+starts a batch that collects the cleanups of the following window. The records of the batch are then removed in a
+single commit and merge request with one serial number increase, see batch.go, instead of one merge request per
+record.
+
+Every CleanUp of the batch returns once the merge request was merged and its record verified, or with the error of
+the batch. A CleanUp whose record is already gone fails with ErrTextRecordDoesNotExist without failing the others.
+The batch is bounded by the earliest deadline of its challenges, see budget.go, and a CleanUp stops waiting for the
+batch once its own deadline passed.
+*/
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+// pendingCleanup is a CleanUp waiting for its batch to be merged
+type pendingCleanup struct {
+	log      *slog.Logger
+	ch       *acme.ChallengeRequest
+	id       string
+	record   *Record
+	deadline time.Time
+
+	// done receives the result of the cleanup once
+	done chan error
+}
+
+// coalesceCleanup adds the cleanup to the current batch, starting a batch flushed after CLEANUP_BATCH_WINDOW if
+// there is none, and waits for its result.
+func (h *gitSolver) coalesceCleanup(log *slog.Logger, ch *acme.ChallengeRequest, id string, record *Record, deadline time.Time) error {
+	pending := &pendingCleanup{log: log, ch: ch, id: id, record: record, deadline: deadline, done: make(chan error, 1)}
+
+	h.cleanupBatchLock.Lock()
+	if len(h.cleanupBatch) == 0 {
+		time.AfterFunc(h.cleanupBatchWindow, h.flushCleanupBatch)
+	}
+	h.cleanupBatch = append(h.cleanupBatch, pending)
+	h.cleanupBatchLock.Unlock()
+
+	if deadline.IsZero() {
+		return <-pending.done
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case err := <-pending.done:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("%w: %s was not cleaned up before %s", ErrChallengeTimeout, ch.ResolvedFQDN, deadline.Format(time.RFC3339))
+	}
+}
+
+// flushCleanupBatch removes the records of the current batch and passes the result to its cleanups.
+func (h *gitSolver) flushCleanupBatch() {
+	h.cleanupBatchLock.Lock()
+	batch := h.cleanupBatch
+	h.cleanupBatch = nil
+	h.cleanupBatchLock.Unlock()
+
+	remaining, err := h.cleanUpBatch(batch)
+	for _, pending := range remaining {
+		pending.done <- err
+	}
+}
+
+// cleanUpBatch removes the records of the batch in one commit and merge request. The cleanups failing on their
+// own, e.g. because their record is already gone, receive their error directly. The remaining cleanups are
+// returned with the error of the batch.
+func (h *gitSolver) cleanUpBatch(batch []*pendingCleanup) ([]*pendingCleanup, error) {
+	fqdns := cleanupFQDNs(batch)
+	deadline := time.Time{}
+	for _, pending := range batch {
+		if !pending.deadline.IsZero() && (deadline.IsZero() || pending.deadline.Before(deadline)) {
+			deadline = pending.deadline
+		}
+	}
+
+	// The batch has a request ID of its own, which is logged with the request IDs of its cleanups
+	requestID := newRequestID()
+	log := slog.With("request_id", requestID)
+	for _, pending := range batch {
+		pending.log.Info("Cleaning up challenge request in batch", "fqdn", pending.ch.ResolvedFQDN, "batch_request_id", requestID)
+	}
+	log.Info("Cleaning up batch of challenge requests", "fqdns", fqdns)
+
+	h.zoneLock.Lock()
+	defer h.zoneLock.Unlock()
+	defer h.beginRequest(requestID)()
+	defer h.beginSerialZones(cleanupZones(batch)...)()
+
+	endBudget, err := h.beginBudget(strings.Join(fqdns, ", "), deadline)
+	if err != nil {
+		return batch, err
+	}
+	defer endBudget()
+
+	endBotBranch, err := h.beginBotBranch(batch[0].ch)
+	if err != nil {
+		return batch, err
+	}
+	defer endBotBranch()
+
+	endReplicaLock, err := h.beginReplicaLock(strings.Join(fqdns, ", "))
+	if err != nil {
+		return batch, err
+	}
+	defer endReplicaLock()
+
+	// The records may have been cleaned up while waiting for the lock
+	if err := h.loadRecords(); err != nil {
+		return batch, err
+	}
+	batch = dropCleanups(batch, func(pending *pendingCleanup) error {
+		if h.cachedMissingRecord(pending.id) {
+			return ErrTextRecordDoesNotExist
+		}
+		return nil
+	})
+	if len(batch) == 0 {
+		return nil, nil
+	}
+
+	// Create the branch if it does not exist
+	if err := h.createBotBranch(); err != nil {
+		return batch, err
+	}
+	h.fireCleanups(batch, HookBranchCreated)
+
+	// Remove the TXT records from the zone file
+	content, err := h.readBotZoneFile()
+	if err != nil {
+		return batch, err
+	}
+	batch = dropCleanups(batch, func(pending *pendingCleanup) error {
+		return h.checkZoneRecordExists(content, pending.id)
+	})
+	if len(batch) == 0 {
+		return nil, nil
+	}
+
+	edits := make(zoneBatch, 0, len(batch))
+	for _, pending := range batch {
+		entry, err := h.changelogEntry("remove", pending.ch, time.Now())
+		if err != nil {
+			return batch, err
+		}
+		record := pending.record
+		edits = append(edits, func(content string) (string, error) {
+			content, err := h.removeRecord(content, record)
+			if err != nil {
+				return "", err
+			}
+			return h.appendChangelog(content, entry)
+		})
+	}
+
+	// Update the zone file and increase its serial number once for the whole batch
+	message := fmt.Sprintf("Remove TXT records: %s", strings.Join(cleanupFQDNs(batch), ", "))
+	bumpSerial := h.cleanupBumpsSerial(time.Now())
+	written, err := h.updateBotZoneFileBatch(content, message, edits, bumpSerial)
+	if err != nil {
+		return batch, err
+	}
+	if bumpSerial {
+		h.noteSerialBump(time.Now())
+	}
+	h.fireCleanups(batch, HookFileUpdated)
+
+	// Create a single merge request for all records
+	description := withRequestID(mergeRequestDescription("Remove TXT records", content, written), requestID)
+	cfg := h.mergeConfig.WithLabels(cleanupLabels(batch)...).WithReadyCheck(h.batchReadyCheck(batch)).WithDeadline(deadline).WithNotify(h.batchMergeHook(batch))
+	if err := Merge(h.gitClient, h.gitPath, h.gitBotBranch, h.gitTargetBranch, "Remove TXT records", description, cfg); err != nil {
+		return batch, err
+	}
+	for _, pending := range batch {
+		h.expectMerged(pending.id, false)
+	}
+
+	// Finally, remove the TXT records from memory and from the state backend
+	batch = dropCleanups(batch, func(pending *pendingCleanup) error {
+		if err := h.verifyMerged(pending.ch.ResolvedFQDN, pending.ch.Key, false); err != nil {
+			return err
+		}
+		return h.forgetRecord(pending.id)
+	})
+
+	log.Info("Batch of challenge requests cleaned up", "fqdns", cleanupFQDNs(batch))
+
+	return batch, nil
+}
+
+// dropCleanups passes the error of check to the cleanups failing it and returns the others.
+func dropCleanups(batch []*pendingCleanup, check func(pending *pendingCleanup) error) []*pendingCleanup {
+	remaining := batch[:0]
+	for _, pending := range batch {
+		if err := check(pending); err != nil {
+			pending.done <- err
+			continue
+		}
+		remaining = append(remaining, pending)
+	}
+
+	return remaining
+}
+
+// cleanupFQDNs returns the FQDNs of the cleanups.
+func cleanupFQDNs(batch []*pendingCleanup) []string {
+	fqdns := make([]string, 0, len(batch))
+	for _, pending := range batch {
+		fqdns = append(fqdns, pending.ch.ResolvedFQDN)
+	}
+
+	return fqdns
+}
+
+// cleanupZones returns the resolved zones of the cleanups.
+func cleanupZones(batch []*pendingCleanup) []string {
+	zones := make([]string, 0, len(batch))
+	for _, pending := range batch {
+		zones = append(zones, pending.ch.ResolvedZone)
+	}
+
+	return zones
+}
+
+// cleanupLabels returns the zone labels of the cleanups without duplicates.
+func cleanupLabels(batch []*pendingCleanup) []string {
+	labels := []string{}
+	for _, pending := range batch {
+		if label := zoneLabel(pending.ch.ResolvedZone); !slices.Contains(labels, label) {
+			labels = append(labels, label)
+		}
+	}
+
+	return labels
+}
+
+// fireCleanups fires the stage for every cleanup of the batch.
+func (h *gitSolver) fireCleanups(batch []*pendingCleanup, stage HookStage) {
+	for _, pending := range batch {
+		h.fire(HookEvent{Stage: stage, FQDN: pending.ch.ResolvedFQDN, Action: "cleanup"})
+	}
+}
+
+// batchReadyCheck returns the ready check of the merge request, which checks that all records of the batch are
+// removed from the bot branch.
+func (h *gitSolver) batchReadyCheck(batch []*pendingCleanup) func() error {
+	return func() error {
+		for _, pending := range batch {
+			if err := h.readyCheck(pending.ch.ResolvedFQDN, pending.ch.Key, false)(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// batchMergeHook returns the MergeConfig.Notify function firing the merge request stages of every cleanup.
+func (h *gitSolver) batchMergeHook(batch []*pendingCleanup) func(HookStage, int) {
+	return func(stage HookStage, iid int) {
+		for _, pending := range batch {
+			h.mergeHook("cleanup", pending.ch.ResolvedFQDN)(stage, iid)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/kallepan/cert-manager-webhook/src/zone"
+)
+
+func TestCleanUpBatch(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+
+	challenges := []*acme.ChallengeRequest{}
+	for i := 1; i <= 3; i++ {
+		challenge := &acme.ChallengeRequest{ResolvedFQDN: fmt.Sprintf("_acme-challenge.%d.example.com.", i), ResolvedZone: "example.com.", Key: fmt.Sprintf("key-%d", i)}
+		if err := solver.Present(challenge); err != nil {
+			t.Fatal(err)
+		}
+		challenges = append(challenges, challenge)
+	}
+	presented := fake.content("main")
+	mergeRequests := len(fake.mergeRequests)
+
+	solver.cleanupBatchWindow = 100 * time.Millisecond
+
+	// The unknown record fails on its own without failing the batch
+	unknown := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.4.example.com.", ResolvedZone: "example.com.", Key: "key-4"}
+
+	errs := make([]error, len(challenges)+1)
+	var wg sync.WaitGroup
+	for i, challenge := range append(challenges, unknown) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = solver.CleanUp(challenge)
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs[:len(challenges)] {
+		if err != nil {
+			t.Errorf("cleanup %d: %v", i+1, err)
+		}
+	}
+	if !errors.Is(errs[len(challenges)], ErrTextRecordDoesNotExist) {
+		t.Errorf("expected %v for the unknown record, got %v", ErrTextRecordDoesNotExist, errs[len(challenges)])
+	}
+
+	// The records are removed in a single merge request, which increases the serial number by one step
+	if got := len(fake.mergeRequests) - mergeRequests; got != 1 {
+		t.Errorf("expected 1 merge request for the batch, got %d", got)
+	}
+	content := fake.content("main")
+	for _, challenge := range challenges {
+		if strings.Contains(content, challenge.Key) {
+			t.Errorf("expected the record of %s to be removed, got %q", challenge.ResolvedFQDN, content)
+		}
+		if solver.hasRecord(solver.recordID(challenge)) {
+			t.Errorf("expected the record of %s to be forgotten", challenge.ResolvedFQDN)
+		}
+	}
+	want, err := zone.NextSerialNumber(zone.SerialNumber(presented))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := zone.SerialNumber(content); got != want {
+		t.Errorf("expected serial number %s, got %s", want, got)
+	}
+}
+
+func TestCleanUpBatchDeadline(t *testing.T) {
+	_, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cleanup stops waiting for a batch flushed after its deadline
+	solver.cleanupBatchWindow = time.Second
+	solver.challengeTimeout = 50 * time.Millisecond
+	if err := solver.CleanUp(challenge); !errors.Is(err, ErrChallengeTimeout) {
+		t.Errorf("expected %v, got %v", ErrChallengeTimeout, err)
+	}
+}
@@ -0,0 +1,52 @@
+/*
+This file provides the cleanup modes, for audited environments where the automated deletion of DNS records is
+prohibited. CLEANUP_MODE defines what CleanUp does with the record of a challenge:
+
+  - delete (default): the record is removed from the zone file and the change is merged.
+  - comment: the record is commented out instead, like with RECORD_TOMBSTONES, see tombstone.go.
+  - disabled: the zone file is not changed and the record is left for a human to remove.
+
+In disabled mode, CleanUp still succeeds so that cert-manager does not retry it, and the webhook forgets the record.
+A record left in the zone file is adopted again if the same challenge is presented once more. The manual cleanup
+of WEBHOOK_CLEANUP_FQDN is started by a human and is not affected by the disabled mode.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// CleanupMode defines what CleanUp does with the record of a challenge
+type CleanupMode string
+
+const (
+	CleanupModeDelete   CleanupMode = "delete"
+	CleanupModeComment  CleanupMode = "comment"
+	CleanupModeDisabled CleanupMode = "disabled"
+)
+
+var ErrInvalidCleanupMode = errors.New("invalid cleanup mode")
+
+// ParseCleanupMode parses the given string into a CleanupMode. An empty string defaults to CleanupModeDelete.
+func ParseCleanupMode(s string) (CleanupMode, error) {
+	switch CleanupMode(strings.ToLower(s)) {
+	case "", CleanupModeDelete:
+		return CleanupModeDelete, nil
+	case CleanupModeComment:
+		return CleanupModeComment, nil
+	case CleanupModeDisabled:
+		return CleanupModeDisabled, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidCleanupMode, s)
+}
+
+// skipCleanup forgets the record without changing the zone file, leaving its removal to a human.
+func (h *gitSolver) skipCleanup(fqdn string, id string) error {
+	slog.Info("cleanup disabled, leaving the record in the zone file", "fqdn", fqdn)
+
+	return h.forgetRecord(id)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestParseCleanupMode(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  CleanupMode
+		err   bool
+	}{
+		{input: "", want: CleanupModeDelete},
+		{input: "delete", want: CleanupModeDelete},
+		{input: "Comment", want: CleanupModeComment},
+		{input: "DISABLED", want: CleanupModeDisabled},
+		{input: "keep", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseCleanupMode(tc.input)
+			if tc.err != errors.Is(err, ErrInvalidCleanupMode) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCleanUpModes(t *testing.T) {
+	const record = `_acme-challenge.example.com            TXT "wow-so-secret"`
+
+	testCases := []struct {
+		mode CleanupMode
+		// want is the line of the record in the zone file after the cleanup, or empty if it was removed
+		want string
+		// commits is the number of commits of the cleanup
+		commits int
+	}{
+		{mode: CleanupModeDelete, want: "", commits: 1},
+		{mode: CleanupModeComment, want: "; " + record, commits: 1},
+		{mode: CleanupModeDisabled, want: record, commits: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.mode), func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", fakeZone)
+
+			t.Setenv("GITLAB_BOT_BRANCH", "acme-bot")
+			t.Setenv("GITLAB_BOT_COMMENT_PREFIX", "TEST")
+			t.Setenv("GITLAB_TARGET_BRANCH", "main")
+			t.Setenv("GITLAB_PATH", fakeProject)
+			t.Setenv("GITLAB_FILE", fakeFile)
+			t.Setenv("GITLAB_TOKEN", "token")
+			t.Setenv("GITLAB_URL", srv.URL)
+			t.Setenv("MERGE_REQUEST_TIMEOUT", "1s")
+			t.Setenv("CLEANUP_MODE", string(tc.mode))
+
+			solver := newGitSolver()
+			if err := solver.Initialize(nil, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+			if err := solver.Present(challenge); err != nil {
+				t.Fatal(err)
+			}
+			presented := len(fake.commits)
+
+			// The cleanup succeeds in every mode, so that cert-manager does not retry it
+			if err := solver.CleanUp(challenge); err != nil {
+				t.Fatalf("expected cleanup to succeed, got %v", err)
+			}
+
+			content := fake.content("main")
+			lines := strings.Split(content, "\n")
+			if tc.want == "" && strings.Contains(content, record) {
+				t.Errorf("expected record to be removed, got %q", content)
+			}
+			if tc.want != "" && !slices.Contains(lines, tc.want) {
+				t.Errorf("expected line %q in %q", tc.want, content)
+			}
+			if got := len(fake.commits) - presented; got != tc.commits {
+				t.Errorf("expected %d commits, got %d", tc.commits, got)
+			}
+
+			// The record is forgotten in every mode
+			if solver.hasRecord(solver.recordID(challenge)) {
+				t.Error("expected record to be forgotten")
+			}
+		})
+	}
+}
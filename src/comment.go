@@ -0,0 +1,101 @@
+/*
+This file provides the optional comment that is written before every TXT record added by the webhook.
+The comment is rendered from the RECORD_COMMENT_TEMPLATE go template and always starts with the
+RECORD_COMMENT_TAG, so that only the comments written by the webhook are removed together with their record.
+
+For audits that map the records back to Kubernetes resources, RECORD_COMMENT_ISSUER writes the comment of
+issuerCommentTemplate instead, with the issuer, the namespace and the UID of the Challenge resource:
+
+	; acme-bot: issuer=letsencrypt-prod namespace=default challenge=6f1c2a4e-...
+
+The challenge request of cert-manager does not name the issuer, so it is taken from the issuer field of the webhook
+config of the solver, which every issuer sets for itself. Neither does it name the Certificate, whose Order owns
+the Challenge with the UID.
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/kallepan/cert-manager-webhook/src/zone"
+)
+
+// RECORD_COMMENT_TAG identifies the comments written by the webhook
+const RECORD_COMMENT_TAG = zone.RecordCommentTag
+
+// issuerCommentTemplate is the record comment template of RECORD_COMMENT_ISSUER
+const issuerCommentTemplate = "{{with .Issuer}}issuer={{.}} {{end}}namespace={{.Namespace}} challenge={{.UID}}"
+
+// recordCommentData is passed to the record comment template
+type recordCommentData struct {
+	Time      string
+	FQDN      string
+	DNSName   string
+	Namespace string
+	UID       string
+	Issuer    string
+}
+
+// parseRecordCommentTemplate parses the record comment template. An empty string disables the comment.
+func parseRecordCommentTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	tmpl, err := template.New("record-comment").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid RECORD_COMMENT_TEMPLATE: %w", ErrInvalidConfig, err)
+	}
+
+	return tmpl, nil
+}
+
+// renderRecordComment renders the comment for the given challenge. It returns an empty string if comments are disabled.
+func renderRecordComment(tmpl *template.Template, ch *acme.ChallengeRequest, now time.Time) (string, error) {
+	if tmpl == nil {
+		return "", nil
+	}
+
+	var sb strings.Builder
+	err := tmpl.Execute(&sb, recordCommentData{
+		Time:      now.UTC().Format(time.RFC3339),
+		FQDN:      ch.ResolvedFQDN,
+		DNSName:   ch.DNSName,
+		Namespace: ch.ResourceNamespace,
+		UID:       string(ch.UID),
+		Issuer:    challengeIssuer(ch),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// The comment has to stay on a single line
+	comment := strings.Join(strings.Fields(sb.String()), " ")
+
+	return fmt.Sprintf("%s %s", RECORD_COMMENT_TAG, comment), nil
+}
+
+// challengeIssuer returns the issuer named in the webhook config of the challenge, or an empty string.
+func challengeIssuer(ch *acme.ChallengeRequest) string {
+	if ch.Config == nil || len(ch.Config.Raw) == 0 {
+		return ""
+	}
+
+	// An invalid config fails the challenge before the comment is rendered, see challengeDeadline
+	var cfg challengeConfig
+	if err := json.Unmarshal(ch.Config.Raw, &cfg); err != nil {
+		return ""
+	}
+
+	return strings.Join(strings.Fields(cfg.Issuer), "-")
+}
+
+// isRecordComment reports whether the given line is a comment written by the webhook.
+func isRecordComment(line string) bool {
+	return strings.HasPrefix(line, RECORD_COMMENT_TAG)
+}
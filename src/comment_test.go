@@ -0,0 +1,194 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/kallepan/cert-manager-webhook/src/zone"
+)
+
+func TestRenderRecordComment(t *testing.T) {
+	now := time.Date(2024, 9, 15, 10, 0, 0, 0, time.UTC)
+	ch := &acme.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		DNSName:           "example.com",
+		ResourceNamespace: "default",
+	}
+
+	testCases := []struct {
+		name     string
+		template string
+		want     string
+		err      bool
+	}{
+		{
+			name:     "disabled",
+			template: "",
+			want:     "",
+		},
+		{
+			name:     "time and dns name",
+			template: "added by acme-bot at {{.Time}} for {{.DNSName}}",
+			want:     "; acme-bot: added by acme-bot at 2024-09-15T10:00:00Z for example.com",
+		},
+		{
+			name:     "newlines are collapsed",
+			template: "added\nin {{.Namespace}}",
+			want:     "; acme-bot: added in default",
+		},
+		{
+			name:     "unknown field",
+			template: "{{.Certificate}}",
+			err:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := parseRecordCommentTemplate(tc.template)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			got, err := renderRecordComment(tmpl, ch, now)
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+
+			if tc.err && err == nil {
+				t.Error("expected error, got nil")
+			}
+
+			if !tc.err && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseRecordCommentTemplateInvalid(t *testing.T) {
+	if _, err := parseRecordCommentTemplate("{{.Time"); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+func TestRecordCommentRoundTrip(t *testing.T) {
+	const content = "; TEST-ACME-BOT\n; unrelated comment\n; TEST-ACME-BOT-END\n"
+	const recordStr = "_acme-challenge.example.com            TXT \"key\""
+	const comment = "; acme-bot: added at 2024-09-15T10:00:00Z for example.com"
+
+	added, err := zone.AddTxtRecord(content, recordStr, regexp.MustCompile(zone.BlockPattern("TEST")), comment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "; TEST-ACME-BOT\n; unrelated comment\n" + comment + "\n" + recordStr + "\n; TEST-ACME-BOT-END\n"
+	if added != want {
+		t.Errorf("expected %q, got %q", want, added)
+	}
+
+	removed, err := zone.RemoveTxtRecord(added, recordStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != content {
+		t.Errorf("expected %q, got %q", content, removed)
+	}
+
+	// Comments not written by the webhook must be kept
+	withoutTag := "; TEST-ACME-BOT\n; unrelated comment\n" + recordStr + "\n; TEST-ACME-BOT-END\n"
+	removed, err = zone.RemoveTxtRecord(withoutTag, recordStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != content {
+		t.Errorf("expected %q, got %q", content, removed)
+	}
+}
+
+func TestIssuerRecordComment(t *testing.T) {
+	now := time.Date(2024, 9, 15, 10, 0, 0, 0, time.UTC)
+	tmpl, err := parseRecordCommentTemplate(issuerCommentTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{name: "issuer", config: `{"issuer": "letsencrypt-prod"}`, want: "; acme-bot: issuer=letsencrypt-prod namespace=default challenge=6f1c2a4e"},
+		{name: "issuer with spaces", config: `{"issuer": "lets encrypt"}`, want: "; acme-bot: issuer=lets-encrypt namespace=default challenge=6f1c2a4e"},
+		{name: "no issuer", config: `{"timeout": "90s"}`, want: "; acme-bot: namespace=default challenge=6f1c2a4e"},
+		{name: "no config", want: "; acme-bot: namespace=default challenge=6f1c2a4e"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := challengeWithConfig(t, "_acme-challenge.example.com.", "key", tc.config)
+			ch.ResourceNamespace = "default"
+			ch.UID = "6f1c2a4e"
+
+			got, err := renderRecordComment(tmpl, ch, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPresentCleanUpIssuerComment(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	tmpl, err := parseRecordCommentTemplate(issuerCommentTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	solver.recordCommentTemplate = tmpl
+
+	staging := challengeWithConfig(t, "_acme-challenge.example.com.", "staging-key", `{"issuer": "letsencrypt-staging"}`)
+	staging.ResourceNamespace, staging.UID = "default", "uid-staging"
+	prod := challengeWithConfig(t, "_acme-challenge.example.com.", "prod-key", `{"issuer": "letsencrypt-prod"}`)
+	prod.ResourceNamespace, prod.UID = "default", "uid-prod"
+
+	for _, ch := range []*acme.ChallengeRequest{staging, prod} {
+		if err := solver.Present(ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	content := fake.content("main")
+	for _, want := range []string{
+		"; acme-bot: issuer=letsencrypt-staging namespace=default challenge=uid-staging\n_acme-challenge.example.com",
+		"; acme-bot: issuer=letsencrypt-prod namespace=default challenge=uid-prod\n_acme-challenge.example.com",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in %q", want, content)
+		}
+	}
+
+	// Only the comment of the removed record is removed, the comment of the other record of the same name is kept
+	if err := solver.CleanUp(staging); err != nil {
+		t.Fatal(err)
+	}
+	content = fake.content("main")
+	if strings.Contains(content, "letsencrypt-staging") || strings.Contains(content, "staging-key") {
+		t.Errorf("expected the staging record and its comment to be removed, got %q", content)
+	}
+	if !strings.Contains(content, "; acme-bot: issuer=letsencrypt-prod namespace=default challenge=uid-prod\n_acme-challenge.example.com") {
+		t.Errorf("expected the prod record and its comment to be kept, got %q", content)
+	}
+
+	if err := solver.CleanUp(prod); err != nil {
+		t.Fatal(err)
+	}
+	if content := fake.content("main"); strings.Contains(content, "acme-bot: issuer") {
+		t.Errorf("expected all comments to be removed, got %q", content)
+	}
+}
@@ -0,0 +1,102 @@
+/*
+This file provides the identity of the commits written by the webhook.
+By default, GitLab attributes the commits to the user of GITLAB_TOKEN and they only carry the message describing
+the change. Deployments sharing a repository, e.g. a staging and a production webhook committing to different
+branches, can set GITLAB_COMMIT_AUTHOR_NAME, GITLAB_COMMIT_AUTHOR_EMAIL and GITLAB_COMMIT_MESSAGE_PREFIX to tell
+their commits apart in the history:
+
+	[staging] Add TXT record: _acme-challenge.example.com.    staging-bot <staging-bot@example.com>
+
+The identity applies to every commit of the webhook, i.e. the record changes of Present and CleanUp, the serial
+number increases and the refresh of the bot branch.
+*/
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// CommitConfig holds the identity of the commits written by the webhook, empty fields keep the GitLab defaults
+type CommitConfig struct {
+	// AuthorName and AuthorEmail replace the user of the token as the author of the commits
+	AuthorName  string
+	AuthorEmail string
+
+	// MessagePrefix is prepended to every commit message, separated by a space
+	MessagePrefix string
+
+	// Encoding is the encoding of the content sent to GitLab, see writeencoding.go
+	Encoding ContentEncoding
+
+	// RequestID is added to every commit message as a trailer while an operation holds the zone lock, see
+	// requestid.go
+	RequestID string
+}
+
+// ParseCommitConfig validates the commit identity, the email must be a bare address, e.g. "bot@example.com".
+func ParseCommitConfig(name string, email string, prefix string) (CommitConfig, error) {
+	cfg := CommitConfig{
+		AuthorName:    strings.TrimSpace(name),
+		AuthorEmail:   strings.TrimSpace(email),
+		MessagePrefix: strings.TrimSpace(prefix),
+	}
+
+	if cfg.AuthorEmail != "" {
+		address, err := mail.ParseAddress(cfg.AuthorEmail)
+		if err != nil || address.Address != cfg.AuthorEmail {
+			return CommitConfig{}, fmt.Errorf("%w: invalid GITLAB_COMMIT_AUTHOR_EMAIL %q", ErrInvalidConfig, email)
+		}
+	}
+
+	return cfg, nil
+}
+
+// message returns the commit message with the configured prefix and the request ID.
+func (cfg CommitConfig) message(message string) string {
+	if cfg.MessagePrefix != "" {
+		message = cfg.MessagePrefix + " " + message
+	}
+	if cfg.RequestID != "" {
+		message += "\n\n" + requestIDTrailer(cfg.RequestID)
+	}
+
+	return message
+}
+
+// updateFileOptions returns the options of a commit writing the content to the branch.
+func (cfg CommitConfig) updateFileOptions(branch string, content string, message string) *gitlab.UpdateFileOptions {
+	opts := &gitlab.UpdateFileOptions{
+		Branch:        gitlab.Ptr(branch),
+		CommitMessage: gitlab.Ptr(cfg.message(message)),
+	}
+	opts.Content, opts.Encoding = cfg.Encoding.encode(content)
+	if cfg.AuthorName != "" {
+		opts.AuthorName = gitlab.Ptr(cfg.AuthorName)
+	}
+	if cfg.AuthorEmail != "" {
+		opts.AuthorEmail = gitlab.Ptr(cfg.AuthorEmail)
+	}
+
+	return opts
+}
+
+// createCommitOptions returns the options of a commit applying the actions to the branch.
+func (cfg CommitConfig) createCommitOptions(branch string, message string, actions []*gitlab.CommitActionOptions) *gitlab.CreateCommitOptions {
+	opts := &gitlab.CreateCommitOptions{
+		Branch:        gitlab.Ptr(branch),
+		CommitMessage: gitlab.Ptr(cfg.message(message)),
+		Actions:       actions,
+	}
+	if cfg.AuthorName != "" {
+		opts.AuthorName = gitlab.Ptr(cfg.AuthorName)
+	}
+	if cfg.AuthorEmail != "" {
+		opts.AuthorEmail = gitlab.Ptr(cfg.AuthorEmail)
+	}
+
+	return opts
+}
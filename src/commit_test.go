@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestParseCommitConfig(t *testing.T) {
+	testCases := []struct {
+		name   string
+		email  string
+		prefix string
+		want   CommitConfig
+		err    bool
+	}{
+		{name: "empty", want: CommitConfig{}},
+		{name: "bare address", email: " staging-bot@example.com ", want: CommitConfig{AuthorEmail: "staging-bot@example.com"}},
+		{name: "prefix", prefix: "[staging] ", want: CommitConfig{MessagePrefix: "[staging]"}},
+		{name: "address with name", email: "Staging Bot <staging-bot@example.com>", err: true},
+		{name: "no address", email: "staging-bot", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseCommitConfig("", tc.email, tc.prefix)
+			if got != tc.want {
+				t.Errorf("expected %+v, got %+v", tc.want, got)
+			}
+			if tc.err != errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("expected error %t, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestPresentCleanUpCommitIdentity(t *testing.T) {
+	testCases := []struct {
+		name     string
+		separate bool
+		commits  int
+	}{
+		{name: "single commit", commits: 2},
+		{name: "separate serial commit", separate: true, commits: 4},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", fakeZone)
+			solver := newTestSolver(t, srv)
+			solver.separateSerialCommit = tc.separate
+			solver.commitConfig = CommitConfig{
+				AuthorName:    "staging-bot",
+				AuthorEmail:   "staging-bot@example.com",
+				MessagePrefix: "[staging]",
+			}
+
+			challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+			if err := solver.Present(challenge); err != nil {
+				t.Fatal(err)
+			}
+			if err := solver.CleanUp(challenge); err != nil {
+				t.Fatal(err)
+			}
+
+			// Every commit of both flows carries the identity of the deployment
+			if len(fake.commits) != tc.commits {
+				t.Fatalf("expected %d commits, got %d", tc.commits, len(fake.commits))
+			}
+			for _, commit := range fake.commits {
+				if commit.authorName != "staging-bot" || commit.authorEmail != "staging-bot@example.com" {
+					t.Errorf("expected staging-bot <staging-bot@example.com>, got %s <%s>", commit.authorName, commit.authorEmail)
+				}
+				if !strings.HasPrefix(commit.message, "[staging] ") {
+					t.Errorf("expected commit message with prefix, got %q", commit.message)
+				}
+			}
+			if fake.commits[0].subject() != "[staging] Add TXT record: _acme-challenge.example.com." {
+				t.Errorf("expected the Present commit first, got %q", fake.commits[0].message)
+			}
+			if !strings.HasPrefix(fake.commits[tc.commits/2].message, "[staging] Remove TXT record") {
+				t.Errorf("expected the CleanUp commit, got %q", fake.commits[tc.commits/2].message)
+			}
+		})
+	}
+}
+
+func TestUpdateFileOptionsDefaultIdentity(t *testing.T) {
+	opts := CommitConfig{}.updateFileOptions("acme-bot", "content", "Add TXT record")
+
+	if opts.AuthorName != nil || opts.AuthorEmail != nil {
+		t.Errorf("expected the author of the token, got %v <%v>", opts.AuthorName, opts.AuthorEmail)
+	}
+	if *opts.CommitMessage != "Add TXT record" {
+		t.Errorf("expected unchanged commit message, got %q", *opts.CommitMessage)
+	}
+}
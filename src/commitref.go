@@ -0,0 +1,66 @@
+/*
+This file provides exact read-your-writes for the bot branch, without the polling of READ_YOUR_WRITES_TIMEOUT, see
+consistency.go. The files API of GitLab does not return the commit of an update, so if READ_YOUR_WRITES_BY_COMMIT
+is set, the files of the bot branch are written through the commits API instead, which returns the SHA of the
+created commit. The next read of a written file, e.g. the ready check of the merge request, uses that SHA as its ref
+instead of the name of the bot branch, which may still resolve to the commit before the write on a lagging replica.
+
+A SHA is only used by the first read of its file after the write and only within the request that wrote it, see
+beginRequest, so that a later operation never reads a file as it was before another writer changed it.
+*/
+package main
+
+// updateBotFile writes the content to the file of the bot branch, through the commits API if
+// READ_YOUR_WRITES_BY_COMMIT is set.
+func (h *gitSolver) updateBotFile(file string, content string, message string) error {
+	if h.readByCommit {
+		return h.commitBotFiles([]fileUpdate{{file: file, content: content}}, message)
+	}
+
+	if err := UpdateZoneFile(h.gitClient, h.gitBotBranch, h.gitBotPath(), file, content, message, h.commitConfig); err != nil {
+		return err
+	}
+	h.expectRead(h.gitBotPath(), h.gitBotBranch, file, func(read string) bool { return read == content })
+
+	return nil
+}
+
+// pinRead makes the next read of the file of the bot branch use the commit with the given SHA as its ref.
+// It does nothing unless READ_YOUR_WRITES_BY_COMMIT is set.
+func (h *gitSolver) pinRead(file string, sha string) {
+	if !h.readByCommit || sha == "" {
+		return
+	}
+
+	h.expectationsLock.Lock()
+	defer h.expectationsLock.Unlock()
+
+	if h.readRefs == nil {
+		h.readRefs = make(map[string]string)
+	}
+	h.readRefs[readKey(h.gitBotPath(), h.gitBotBranch, file)] = sha
+}
+
+// takeReadRef returns the ref of the next read of the file of the branch: the SHA pinned by the last write, which
+// is used only once, or the branch itself.
+func (h *gitSolver) takeReadRef(projectPath string, branch string, file string) string {
+	h.expectationsLock.Lock()
+	defer h.expectationsLock.Unlock()
+
+	key := readKey(projectPath, branch, file)
+	sha, ok := h.readRefs[key]
+	if !ok {
+		return branch
+	}
+	delete(h.readRefs, key)
+
+	return sha
+}
+
+// dropReadRefs forgets the SHAs pinned by the writes so far.
+func (h *gitSolver) dropReadRefs() {
+	h.expectationsLock.Lock()
+	defer h.expectationsLock.Unlock()
+
+	h.readRefs = nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestReadByCommit(t *testing.T) {
+	testCases := []struct {
+		name         string
+		readByCommit bool
+		want         string
+	}{
+		{name: "disabled", readByCommit: false, want: fakeZone},
+		{name: "enabled", readByCommit: true, want: fakeZone + "; written\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", fakeZone)
+			solver := newTestSolver(t, srv)
+			solver.readByCommit = tc.readByCommit
+			if err := solver.createBotBranch(); err != nil {
+				t.Fatal(err)
+			}
+
+			// The next read of the bot branch lags behind the write
+			fake.staleReads = 1
+			written := fakeZone + "; written\n"
+			if _, err := solver.writeBotZoneFile(written, "Write zone file", nil); err != nil {
+				t.Fatal(err)
+			}
+
+			fake.readRefs = nil
+			got, err := solver.readZoneFile(fakeProject, "acme-bot")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+			if !tc.readByCommit {
+				return
+			}
+
+			// The follow-up read uses the SHA returned for the write, later reads the branch again
+			sha := strconv.Itoa(fake.commits[len(fake.commits)-1].id)
+			if len(fake.readRefs) != 1 || fake.readRefs[0] != sha {
+				t.Errorf("expected the read of commit %s, got %v", sha, fake.readRefs)
+			}
+			if _, err := solver.readZoneFile(fakeProject, "acme-bot"); err != nil {
+				t.Fatal(err)
+			}
+			if ref := fake.readRefs[len(fake.readRefs)-1]; ref != "acme-bot" {
+				t.Errorf("expected the read of the bot branch, got %s", ref)
+			}
+		})
+	}
+}
+
+func TestPresentReadByCommit(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	solver.readByCommit = true
+	solver.verifyAfterMerge = true
+	solver.mergeConfig.Draft = true
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if content := fake.content("main"); !strings.Contains(content, "wow-so-secret") {
+		t.Fatalf("expected the record to be merged, got %q", content)
+	}
+
+	// The ready check of the merge request reads the commit of the write
+	sha := strconv.Itoa(fake.commits[len(fake.commits)-1].id)
+	if !slices.Contains(fake.readRefs, sha) {
+		t.Errorf("expected a read of commit %s, got %v", sha, fake.readRefs)
+	}
+	if len(solver.readRefs) != 0 {
+		t.Errorf("expected the pinned commits to be dropped after the request, got %v", solver.readRefs)
+	}
+}
@@ -0,0 +1,69 @@
+/*
+This file provides the retry of zone file updates that conflict with a concurrent writer.
+If the zone file on the bot branch changes between reading and writing it, e.g. because another replica or a
+person committed to the bot branch, GitLab rejects the update with a "file has changed since you started editing
+it" error. Instead of failing the challenge, the zone file is read again, the edit is applied to the fresh
+content and the update is retried, up to zoneFileUpdateAttempts times.
+*/
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// zoneFileUpdateAttempts is the number of attempts to write the zone file if it changed concurrently
+const zoneFileUpdateAttempts = 3
+
+// zoneEdit applies a change, e.g. adding a record, to the content of the zone file
+type zoneEdit func(content string) (string, error)
+
+// writeBotZoneFile writes the content to the bot branch and returns the written content. If the zone file
+// changed since it was read, edit is applied to the fresh zone file and the update is retried. If edit leaves
+// the fresh zone file unchanged, e.g. because the record was added concurrently, nothing is written.
+func (h *gitSolver) writeBotZoneFile(content string, message string, edit zoneEdit) (string, error) {
+	return h.writeBotFile(h.gitFile, content, message, edit)
+}
+
+// writeBotFile writes the content to the given file of the bot branch like writeBotZoneFile.
+func (h *gitSolver) writeBotFile(file string, content string, message string, edit zoneEdit) (string, error) {
+	for attempt := 1; ; attempt++ {
+		err := h.updateBotFile(file, content, message)
+		if err == nil || !isZoneFileChanged(err) || attempt == zoneFileUpdateAttempts {
+			return content, err
+		}
+
+		slog.Warn("zone file changed since it was read, retrying", "branch", h.gitBotBranch, "file", file, "attempt", attempt)
+		fresh, err := h.readFile(h.gitBotPath(), h.gitBotBranch, file)
+		if err != nil {
+			return "", err
+		}
+		if content, err = edit(fresh); err != nil {
+			return "", err
+		}
+		if content == fresh {
+			return content, nil
+		}
+	}
+}
+
+// isZoneFileChanged reports whether GitLab rejected an update because the file changed since it was read.
+func isZoneFileChanged(err error) bool {
+	var errResp *gitlab.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Response == nil {
+		return false
+	}
+
+	switch errResp.Response.StatusCode {
+	case http.StatusBadRequest, http.StatusConflict:
+	default:
+		return false
+	}
+
+	message := strings.ToLower(errResp.Message)
+	return strings.Contains(message, "changed since") || strings.Contains(message, "updated since")
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/kallepan/cert-manager-webhook/src/zone"
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestIsZoneFileChanged(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "file changed",
+			err:  &gitlab.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadRequest}, Message: "{message: You are attempting to update a file that has changed since you started editing it.}"},
+			want: true,
+		},
+		{
+			name: "conflict",
+			err:  &gitlab.ErrorResponse{Response: &http.Response{StatusCode: http.StatusConflict}, Message: "{message: The branch has been updated since you started editing}"},
+			want: true,
+		},
+		{
+			name: "other bad request",
+			err:  &gitlab.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadRequest}, Message: "{message: A file with this name doesn't exist}"},
+		},
+		{
+			name: "server error",
+			err:  &gitlab.ErrorResponse{Response: &http.Response{StatusCode: http.StatusInternalServerError}, Message: "{message: file has changed since}"},
+		},
+		{
+			name: "other error",
+			err:  errors.New("file has changed since"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isZoneFileChanged(tc.err); got != tc.want {
+				t.Errorf("expected %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPresentRetriesChangedZoneFile(t *testing.T) {
+	const other = "_acme-challenge.other.example.com            TXT \"other\"\n"
+	const record = "_acme-challenge.example.com            TXT \"wow-so-secret\"\n"
+
+	testCases := []struct {
+		name     string
+		separate bool
+		edit     string
+		commits  int
+	}{
+		{name: "single commit", edit: other, commits: 1},
+		{name: "separate commit", separate: true, edit: other, commits: 2},
+		// The concurrent writer added the same record, so there is nothing left to write
+		{name: "same record", edit: record, commits: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", fakeZone)
+			fake.fileChanges = 1
+			fake.concurrentEdit = func(content string) string {
+				return strings.Replace(content, "; TEST-ACME-BOT-END", tc.edit+"; TEST-ACME-BOT-END", 1)
+			}
+			solver := newTestSolver(t, srv)
+			solver.separateSerialCommit = tc.separate
+
+			if err := solver.Present(&acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}); err != nil {
+				t.Fatal(err)
+			}
+
+			content := fake.content("main")
+			if strings.Count(content, record) != 1 {
+				t.Errorf("expected the record once, got %q", content)
+			}
+			if !strings.Contains(content, tc.edit) {
+				t.Errorf("expected the concurrent change to be kept, got %q", content)
+			}
+			if len(fake.commits) != tc.commits {
+				t.Errorf("expected %d commits, got %d", tc.commits, len(fake.commits))
+			}
+			if tc.commits > 0 && strings.Contains(content, "2021091501 ; serial number") {
+				t.Errorf("expected increased serial number, got %q", content)
+			}
+		})
+	}
+}
+
+func TestPresentChangedZoneFileAttempts(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	fake.fileChanges = zoneFileUpdateAttempts
+	solver := newTestSolver(t, srv)
+
+	err := solver.Present(&acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"})
+	if !isZoneFileChanged(err) {
+		t.Errorf("expected zone file changed error, got %v", err)
+	}
+	if len(fake.commits) != 0 {
+		t.Errorf("expected no commits, got %d", len(fake.commits))
+	}
+}
+
+func TestPresentSerialNumberExceedsRebasedBranch(t *testing.T) {
+	currentDate := time.Now().Format("20060102")
+
+	testCases := []struct {
+		name string
+		live string
+		want string
+	}{
+		{name: "same date", live: currentDate + "50", want: currentDate + "51"},
+		{name: "future date", live: "2999010101", want: "2999010102"},
+		// A live serial number below the one of the read content does not lower the serial number
+		{name: "older", live: "2000010101", want: currentDate + "01"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", fakeZone)
+			// The bot branch is rebased onto a target branch with another serial number right after it was read
+			fake.readEdit = func(branch string, reads int, content string) string {
+				if branch != "acme-bot" || reads != 1 {
+					return content
+				}
+				return strings.Replace(content, "2021091501 ; serial number", tc.live+" ; serial number", 1)
+			}
+			solver := newTestSolver(t, srv)
+
+			if err := solver.Present(&acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := zone.SerialNumber(fake.content("main")); got != tc.want {
+				t.Errorf("expected serial number %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+/*
+This file provides read-your-writes consistency for GitLab deployments whose file reads may lag behind writes,
+e.g. because of caching or replication. If READ_YOUR_WRITES_TIMEOUT is set, the webhook remembers what it expects
+to read after each of its writes: the written content of the bot branch, and the presence or absence of the record
+in the target branch after a merge. The next read of that file polls until the expected content is observed, so
+that the next operation never acts on a view older than its own writes. If the expected content is not observed
+within the timeout, e.g. because another writer changed the file in the meantime, the last read content is used
+and the expectation is dropped.
+*/
+package main
+
+import "log/slog"
+
+// readExpectation reports whether the content of a file reflects a write of the webhook
+type readExpectation struct {
+	check func(content string) bool
+}
+
+// readKey returns the key of the expectations of the file in the branch of the project.
+func readKey(projectPath string, branch string, file string) string {
+	return projectPath + "\x00" + branch + "\x00" + file
+}
+
+// expectRead makes the next read of the file wait until check reports the content as expected. A later
+// expectation of the same file replaces the earlier one. It does nothing unless READ_YOUR_WRITES_TIMEOUT is set.
+func (h *gitSolver) expectRead(projectPath string, branch string, file string, check func(content string) bool) {
+	if h.readYourWritesTimeout <= 0 {
+		return
+	}
+
+	h.expectationsLock.Lock()
+	defer h.expectationsLock.Unlock()
+
+	if h.readExpectations == nil {
+		h.readExpectations = make(map[string]*readExpectation)
+	}
+	h.readExpectations[readKey(projectPath, branch, file)] = &readExpectation{check: check}
+}
+
+// expectMerged makes the next read of the zone file of the target branch wait until the record with the
+// given ID is present, or absent if present is false.
+func (h *gitSolver) expectMerged(id string, present bool) {
+	h.expectRead(h.gitPath, h.gitTargetBranch, h.gitFile, func(content string) bool {
+		found, err := h.hasZoneRecord(content, id)
+		return err == nil && found == present
+	})
+}
+
+// readExpected reads the file with read, polling until the content is as expected if there is an expectation.
+func (h *gitSolver) readExpected(projectPath string, branch string, file string, read func() (string, error)) (string, error) {
+	key := readKey(projectPath, branch, file)
+
+	h.expectationsLock.Lock()
+	expectation := h.readExpectations[key]
+	h.expectationsLock.Unlock()
+
+	if expectation == nil {
+		return read()
+	}
+
+	// The wait ends with the budget of the challenge, see budget.go
+	timeout := h.bounded(h.readYourWritesTimeout)
+
+	var content string
+	expected, err := pollWithBackoff(timeout, func() (bool, error) {
+		var err error
+		if content, err = read(); err != nil {
+			return false, err
+		}
+		return expectation.check(content), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if !expected {
+		slog.Warn("file does not reflect the last write after the timeout, using the last read content", "branch", branch, "file", file, "timeout", timeout)
+	}
+
+	// Later reads do not wait for this write again, unless it was replaced by a newer expectation meanwhile
+	h.expectationsLock.Lock()
+	if h.readExpectations[key] == expectation {
+		delete(h.readExpectations, key)
+	}
+	h.expectationsLock.Unlock()
+
+	return content, nil
+}
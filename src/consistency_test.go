@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestReadYourWrites(t *testing.T) {
+	defer func(d time.Duration) { mergeRequestPollInterval = d }(mergeRequestPollInterval)
+	mergeRequestPollInterval = time.Millisecond
+
+	testCases := []struct {
+		name       string
+		timeout    time.Duration
+		staleReads int
+		err        error
+	}{
+		{name: "consistent", staleReads: 0},
+		{name: "disabled with stale reads", staleReads: 2, err: ErrVerificationFailed},
+		{name: "enabled with stale reads", timeout: time.Second, staleReads: 2},
+		{name: "enabled with timeout", timeout: 5 * time.Millisecond, staleReads: 1000, err: ErrVerificationFailed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", fakeZone)
+			fake.staleReads = tc.staleReads
+			solver := newTestSolver(t, srv)
+			solver.verifyAfterMerge = true
+			solver.readYourWritesTimeout = tc.timeout
+
+			// The verification right after the merge reads the target branch from before the merge if it is stale
+			challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+			if err := solver.Present(challenge); !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if tc.err != nil {
+				return
+			}
+
+			if err := solver.CleanUp(challenge); err != nil {
+				t.Fatal(err)
+			}
+
+			// The expectation of the target branch is dropped once it was read
+			if _, ok := solver.readExpectations[readKey(fakeProject, "main", fakeFile)]; ok {
+				t.Error("expected the expectation of the target branch to be dropped")
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+/*
+This file provides the descriptions of the merge requests. Besides the kind of change, the description shows the
+lines of the zone file that the change removes and adds and the old and new serial number, so that reviewers of
+merge requests that wait for approvals see the change without opening the diff:
+
+	Add TXT record
+
+	Serial number: `2021091501` → `2021091502`
+
+	```diff
+	-    2021091501 ; serial number
+	+    2021091502 ; serial number
+	+_acme-challenge.svc            TXT "key"
+	```
+
+The lines are shown in a fenced code block that is longer than any run of backticks in the lines, so that the
+content of the zone file cannot end the block and is never rendered as Markdown. At most
+mergeRequestSummaryLines lines are shown. The serial number of a separate serial file is not shown.
+*/
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kallepan/cert-manager-webhook/src/zone"
+)
+
+// mergeRequestSummaryLines is the maximum number of changed lines shown in the description of a merge request
+const mergeRequestSummaryLines = 50
+
+// mergeRequestDescription returns the description followed by a summary of the change from before to after.
+// The description is returned unchanged if nothing changed.
+func mergeRequestDescription(description string, before string, after string) string {
+	removed, added := diffLines(before, after)
+	if len(removed) == 0 && len(added) == 0 {
+		return description
+	}
+
+	lines := make([]string, 0, len(removed)+len(added))
+	for _, line := range removed {
+		lines = append(lines, "-"+line)
+	}
+	for _, line := range added {
+		lines = append(lines, "+"+line)
+	}
+	if len(lines) > mergeRequestSummaryLines {
+		omitted := len(lines) - mergeRequestSummaryLines
+		lines = append(lines[:mergeRequestSummaryLines], fmt.Sprintf("... %d more lines", omitted))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(description)
+
+	oldSerial, newSerial := zone.SerialNumber(before), zone.SerialNumber(after)
+	if oldSerial != "" && newSerial != "" && oldSerial != newSerial {
+		fmt.Fprintf(&sb, "\n\nSerial number: `%s` → `%s`", oldSerial, newSerial)
+	}
+
+	block := strings.Join(lines, "\n")
+	fence := codeFence(block)
+	fmt.Fprintf(&sb, "\n\n%sdiff\n%s\n%s\n", fence, block, fence)
+
+	return sb.String()
+}
+
+// diffLines returns the lines of before that are not in after and the lines of after that are not in before,
+// in their order. Lines that occur several times are compared by their number of occurrences.
+func diffLines(before string, after string) ([]string, []string) {
+	beforeLines, afterLines := strings.Split(before, "\n"), strings.Split(after, "\n")
+
+	return missingLines(beforeLines, afterLines), missingLines(afterLines, beforeLines)
+}
+
+// missingLines returns the lines of a that are not in b.
+func missingLines(a []string, b []string) []string {
+	counts := make(map[string]int, len(b))
+	for _, line := range b {
+		counts[line]++
+	}
+
+	missing := []string{}
+	for _, line := range a {
+		if counts[line] > 0 {
+			counts[line]--
+			continue
+		}
+		missing = append(missing, line)
+	}
+
+	return missing
+}
+
+// codeFence returns a backtick fence longer than the longest run of backticks in the content.
+func codeFence(content string) string {
+	longest, run := 0, 0
+	for _, c := range content {
+		if c != '`' {
+			run = 0
+			continue
+		}
+		run++
+		longest = max(longest, run)
+	}
+
+	return strings.Repeat("`", max(3, longest+1))
+}
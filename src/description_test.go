@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestMergeRequestDescription(t *testing.T) {
+	testCases := []struct {
+		name   string
+		before string
+		after  string
+		want   string
+	}{
+		{
+			name:   "unchanged",
+			before: fakeZone,
+			after:  fakeZone,
+			want:   "Add TXT record",
+		},
+		{
+			name:   "added record and serial number",
+			before: "    2021091501 ; serial number\n; BOT\n; BOT-END\n",
+			after:  "    2021091502 ; serial number\n; BOT\n_acme-challenge.svc TXT \"key\"\n; BOT-END\n",
+			want: "Add TXT record\n\nSerial number: `2021091501` → `2021091502`\n\n" +
+				"```diff\n" +
+				"-    2021091501 ; serial number\n" +
+				"+    2021091502 ; serial number\n" +
+				"+_acme-challenge.svc TXT \"key\"\n" +
+				"```\n",
+		},
+		{
+			name:   "duplicate lines",
+			before: "a TXT \"key\"\na TXT \"key\"\n",
+			after:  "a TXT \"key\"\n",
+			want:   "Add TXT record\n\n```diff\n-a TXT \"key\"\n```\n",
+		},
+		{
+			name:   "backticks",
+			before: "",
+			after:  "; ```` not the end of the block\n",
+			want:   "Add TXT record\n\n`````diff\n+; ```` not the end of the block\n`````\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := mergeRequestDescription("Add TXT record", tc.before, tc.after); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMergeRequestDescriptionTruncated(t *testing.T) {
+	after := strings.Repeat("a TXT \"key\"\n", mergeRequestSummaryLines+10)
+
+	got := mergeRequestDescription("Add TXT record", "", after)
+	if !strings.Contains(got, "\n... 10 more lines\n```\n") {
+		t.Errorf("expected the summary to be truncated, got %q", got)
+	}
+	if lines := strings.Count(got, "\n+a TXT"); lines != mergeRequestSummaryLines {
+		t.Errorf("expected %d shown records, got %d", mergeRequestSummaryLines, lines)
+	}
+}
+
+func TestPresentCleanUpMergeRequestDescription(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+	record := "_acme-challenge.example.com            TXT \"wow-so-secret\""
+
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if err := solver.CleanUp(challenge); err != nil {
+		t.Fatal(err)
+	}
+
+	present, cleanUp := fake.mergeRequests[1].description, fake.mergeRequests[2].description
+	for _, want := range []string{"Add TXT record\n\nSerial number: `2021091501` → ", "\n+" + record + "\n", "\n-    2021091501 ; serial number\n"} {
+		if !strings.Contains(present, want) {
+			t.Errorf("expected %q in %q", want, present)
+		}
+	}
+	for _, want := range []string{"Remove TXT record\n\nSerial number: ", "\n-" + record + "\n"} {
+		if !strings.Contains(cleanUp, want) {
+			t.Errorf("expected %q in %q", want, cleanUp)
+		}
+	}
+}
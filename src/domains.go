@@ -0,0 +1,43 @@
+/*
+This file provides the allowlist of the domains the webhook is permitted to modify.
+If ALLOWED_DOMAINS is set, Present and CleanUp refuse every challenge whose FQDN is not one of the listed
+domains or a subdomain of them, before GitLab is contacted. If it is not set, all domains are allowed.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrDomainNotAllowed = errors.New("domain not allowed")
+
+// parseAllowedDomains normalizes the allowed domains, removing their leading and trailing dots.
+func parseAllowedDomains(domains []string) []string {
+	allowed := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		if domain = strings.ToLower(strings.Trim(domain, ".")); domain != "" {
+			allowed = append(allowed, domain)
+		}
+	}
+
+	return allowed
+}
+
+// checkDomainAllowed returns ErrDomainNotAllowed if the allowlist is not empty and the FQDN is neither
+// one of the allowed domains nor a subdomain of them.
+func (h *gitSolver) checkDomainAllowed(fqdn string) error {
+	if len(h.allowedDomains) == 0 {
+		return nil
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(fqdn, "."))
+	for _, domain := range h.allowedDomains {
+		if name == domain || strings.HasSuffix(name, "."+domain) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s is not in ALLOWED_DOMAINS", ErrDomainNotAllowed, fqdn)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestCheckDomainAllowed(t *testing.T) {
+	testCases := []struct {
+		name    string
+		allowed []string
+		fqdn    string
+		err     bool
+	}{
+		{
+			name: "no allowlist",
+			fqdn: "_acme-challenge.example.org.",
+		},
+		{
+			name:    "subdomain",
+			allowed: []string{"example.com"},
+			fqdn:    "_acme-challenge.svc.example.com.",
+		},
+		{
+			name:    "domain itself",
+			allowed: []string{".example.com."},
+			fqdn:    "example.com",
+		},
+		{
+			name:    "case insensitive",
+			allowed: []string{"Example.com"},
+			fqdn:    "_acme-challenge.EXAMPLE.com.",
+		},
+		{
+			name:    "other domain",
+			allowed: []string{"example.com", "example.net"},
+			fqdn:    "_acme-challenge.example.org.",
+			err:     true,
+		},
+		{
+			name:    "suffix without label boundary",
+			allowed: []string{"example.com"},
+			fqdn:    "_acme-challenge.badexample.com.",
+			err:     true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &gitSolver{allowedDomains: parseAllowedDomains(tc.allowed)}
+
+			err := h.checkDomainAllowed(tc.fqdn)
+			if tc.err != (err != nil) {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if err != nil && !errors.Is(err, ErrDomainNotAllowed) {
+				t.Errorf("expected %v, got %v", ErrDomainNotAllowed, err)
+			}
+		})
+	}
+}
+
+func TestPresentCleanUpDeniedDomain(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	solver.allowedDomains = parseAllowedDomains([]string{"example.com"})
+
+	allowed := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "allowed"}
+	if err := solver.Present(allowed); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.Lock()
+	requests := fake.requests
+	fake.Unlock()
+
+	denied := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.org.", Key: "denied"}
+	if err := solver.Present(denied); !errors.Is(err, ErrDomainNotAllowed) {
+		t.Errorf("expected %v, got %v", ErrDomainNotAllowed, err)
+	}
+	if err := solver.CleanUp(denied); !errors.Is(err, ErrDomainNotAllowed) {
+		t.Errorf("expected %v, got %v", ErrDomainNotAllowed, err)
+	}
+
+	// Denied challenges never reach GitLab
+	fake.Lock()
+	if fake.requests != requests {
+		t.Errorf("expected no requests for denied challenges, got %d", fake.requests-requests)
+	}
+	fake.Unlock()
+
+	if err := solver.CleanUp(allowed); err != nil {
+		t.Fatal(err)
+	}
+}
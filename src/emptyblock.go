@@ -0,0 +1,98 @@
+/*
+This file provides the handling of an -ACME-BOT block that is emptied by the cleanup of its last record.
+EMPTY_BLOCK defines what happens to the block:
+
+  - keep (default): the block is left as it is, including the blank lines between the markers.
+  - collapse: the blank lines are removed, so that the end marker directly follows the begin marker.
+  - remove: the markers are removed as well, and the block is created again at MARKERS_POSITION by the next
+    Present, see markerblock.go.
+
+A block is empty if it only holds whitespace, so a block with tombstones (see tombstone.go) or other comments is
+never collapsed or removed. A zone file without the block is read as a zone file with an empty block if EMPTY_BLOCK
+is remove. The removal is not supported with custom markers, which cannot be created again, or with structured zone
+files, which have no block.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// EmptyBlockMode defines what happens to an -ACME-BOT block without records
+type EmptyBlockMode string
+
+const (
+	EmptyBlockKeep     EmptyBlockMode = "keep"
+	EmptyBlockCollapse EmptyBlockMode = "collapse"
+	EmptyBlockRemove   EmptyBlockMode = "remove"
+)
+
+var ErrInvalidEmptyBlockMode = errors.New("invalid empty block mode")
+
+// ParseEmptyBlockMode parses the given string into an EmptyBlockMode. An empty string defaults to EmptyBlockKeep.
+func ParseEmptyBlockMode(s string) (EmptyBlockMode, error) {
+	switch EmptyBlockMode(strings.ToLower(s)) {
+	case "", EmptyBlockKeep:
+		return EmptyBlockKeep, nil
+	case EmptyBlockCollapse:
+		return EmptyBlockCollapse, nil
+	case EmptyBlockRemove:
+		return EmptyBlockRemove, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidEmptyBlockMode, s)
+}
+
+// handleEmptyBlock collapses or removes the -ACME-BOT block of the content if it is empty, as configured.
+func (h *gitSolver) handleEmptyBlock(content string) (string, error) {
+	if h.emptyBlock == EmptyBlockKeep || h.emptyBlock == "" {
+		return content, nil
+	}
+
+	re, err := h.acmeBotBlockRegex()
+	if err != nil {
+		return "", err
+	}
+	loc := re.FindStringSubmatchIndex(content)
+	if loc == nil || strings.TrimSpace(content[loc[2]:loc[3]]) != "" {
+		return content, nil
+	}
+
+	if h.emptyBlock == EmptyBlockCollapse {
+		return content[:loc[2]] + content[loc[3]:], nil
+	}
+
+	// The lines of the markers are removed including their indentation and newline
+	start := strings.LastIndexByte(content[:loc[0]], '\n') + 1
+	if strings.TrimSpace(content[start:loc[0]]) != "" {
+		start = loc[0]
+	}
+	end := loc[1]
+	if newline := strings.IndexByte(content[end:], '\n'); newline >= 0 && strings.TrimSpace(content[end:end+newline]) == "" {
+		end += newline + 1
+	}
+
+	return content[:start] + content[end:], nil
+}
+
+// ensureBlock creates the -ACME-BOT block removed by EMPTY_BLOCK remove again, before a record is added.
+func (h *gitSolver) ensureBlock(content string) (string, error) {
+	if h.emptyBlock != EmptyBlockRemove {
+		return content, nil
+	}
+
+	re, err := h.acmeBotBlockRegex()
+	if err != nil {
+		return "", err
+	}
+	if re.MatchString(content) {
+		return content, nil
+	}
+	if marker := anyMarkerRegex.FindString(content); marker != "" {
+		return "", fmt.Errorf("%w: %q, check GITLAB_BOT_COMMENT_PREFIX", ErrForeignMarkers, strings.TrimSpace(marker))
+	}
+
+	return h.insertMarkers(content)
+}
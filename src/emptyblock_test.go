@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestParseEmptyBlockMode(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  EmptyBlockMode
+		err   bool
+	}{
+		{input: "", want: EmptyBlockKeep},
+		{input: "keep", want: EmptyBlockKeep},
+		{input: "Collapse", want: EmptyBlockCollapse},
+		{input: "REMOVE", want: EmptyBlockRemove},
+		{input: "delete", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseEmptyBlockMode(tc.input)
+			if tc.err != errors.Is(err, ErrInvalidEmptyBlockMode) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestHandleEmptyBlock(t *testing.T) {
+	const empty = "www IN A 1.2.3.4\n; TEST-ACME-BOT\n\n; TEST-ACME-BOT-END\nmail IN A 1.2.3.5\n"
+	const tombstone = "; TEST-ACME-BOT\n; _acme-challenge TXT \"old\"\n; TEST-ACME-BOT-END\n"
+	const record = "; TEST-ACME-BOT\n_acme-challenge TXT \"key\"\n; TEST-ACME-BOT-END\n"
+
+	testCases := []struct {
+		name    string
+		mode    EmptyBlockMode
+		content string
+		want    string
+	}{
+		{name: "keep", mode: EmptyBlockKeep, content: empty, want: empty},
+		{
+			name:    "collapse",
+			mode:    EmptyBlockCollapse,
+			content: empty,
+			want:    "www IN A 1.2.3.4\n; TEST-ACME-BOT\n; TEST-ACME-BOT-END\nmail IN A 1.2.3.5\n",
+		},
+		{name: "remove", mode: EmptyBlockRemove, content: empty, want: "www IN A 1.2.3.4\nmail IN A 1.2.3.5\n"},
+		{
+			name:    "remove indented block at the end",
+			mode:    EmptyBlockRemove,
+			content: "www IN A 1.2.3.4\n  ; TEST-ACME-BOT\n  ; TEST-ACME-BOT-END",
+			want:    "www IN A 1.2.3.4\n",
+		},
+		{name: "remove keeps tombstones", mode: EmptyBlockRemove, content: tombstone, want: tombstone},
+		{name: "remove keeps records", mode: EmptyBlockRemove, content: record, want: record},
+		{name: "collapse keeps records", mode: EmptyBlockCollapse, content: record, want: record},
+		{name: "no block", mode: EmptyBlockRemove, content: "www IN A 1.2.3.4\n", want: "www IN A 1.2.3.4\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &gitSolver{gitBotCommentPrefix: "TEST", emptyBlock: tc.mode}
+
+			got, err := h.handleEmptyBlock(tc.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPresentCleanUpEmptyBlock(t *testing.T) {
+	const record = `_acme-challenge.example.com            TXT "wow-so-secret"`
+
+	testCases := []struct {
+		mode    EmptyBlockMode
+		spacing bool
+		// want is the zone file after the cleanup of the only record
+		want string
+	}{
+		{mode: EmptyBlockKeep, want: fakeZone},
+		{mode: EmptyBlockKeep, spacing: true, want: strings.Replace(fakeZone, "; TEST-ACME-BOT\n", "; TEST-ACME-BOT\n\n", 1)},
+		{mode: EmptyBlockCollapse, spacing: true, want: fakeZone},
+		{mode: EmptyBlockRemove, want: strings.Replace(fakeZone, "; TEST-ACME-BOT\n; TEST-ACME-BOT-END\n", "", 1)},
+	}
+
+	for _, tc := range testCases {
+		name := string(tc.mode)
+		if tc.spacing {
+			name += " with spacing"
+		}
+		t.Run(name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", fakeZone)
+			solver := newTestSolver(t, srv)
+			solver.emptyBlock = tc.mode
+			solver.recordBlockSpacing = tc.spacing
+			solver.unmanagedSerial = true
+
+			challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+
+			// The record can be presented again after the block was collapsed or removed
+			for i := 1; i <= 2; i++ {
+				if err := solver.Present(challenge); err != nil {
+					t.Fatalf("present %d: %v", i, err)
+				}
+				if content := fake.content("main"); !strings.Contains(content, "; TEST-ACME-BOT\n") || !strings.Contains(content, record) {
+					t.Fatalf("expected record in the block after present %d, got %q", i, content)
+				}
+
+				if err := solver.CleanUp(challenge); err != nil {
+					t.Fatalf("cleanup %d: %v", i, err)
+				}
+				if content := fake.content("main"); content != tc.want {
+					t.Errorf("expected %q after cleanup %d, got %q", tc.want, i, content)
+				}
+			}
+
+			// A restarted solver reads the zone file without the block as a zone file without records
+			restarted := newTestSolver(t, srv)
+			restarted.emptyBlock = tc.mode
+			restarted.synced = false
+			if err := restarted.CleanUp(challenge); !errors.Is(err, ErrTextRecordDoesNotExist) {
+				t.Errorf("expected %v, got %v", ErrTextRecordDoesNotExist, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+/*
+This file provides the helpers reading the configuration from environment variables.
+Following the convention for secrets mounted as files, the GITLAB_* variables and the other secrets, e.g.
+SERIAL_SIGNING_SECRET, STATUS_CALLBACK_URL and the tokens of ZONE_MIRRORS, can also be read from the file named by
+the variable with a _FILE suffix, e.g. GITLAB_TOKEN_FILE. The trailing newline of the file is trimmed and the
+file takes precedence over the variable itself. Only the variables read with these helpers support the suffix,
+not the ones read with os.Getenv, e.g. ROOT_DOMAIN.
+*/
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lookupEnv reads the given environment variable, or the file named by <key>_FILE if that is set.
+// It reports whether either of them is set.
+func lookupEnv(key string) (string, bool, error) {
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		value, ok := os.LookupEnv(key)
+		return value, ok, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%w: reading %s_FILE: %w", ErrInvalidConfig, key, err)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+// getEnv reads the given environment variable, or the file named by <key>_FILE if that is set.
+func getEnv(key string) (string, error) {
+	value, _, err := lookupEnv(key)
+	return value, err
+}
+
+// getEnvDuration reads a duration (e.g. "30s") from the given environment variable.
+// The fallback is returned if the variable is not set.
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value, err := getEnv(key)
+	if err != nil {
+		return 0, err
+	}
+	if value == "" {
+		return fallback, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid duration for %s: %w", ErrInvalidConfig, key, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%w: invalid duration for %s: must not be negative", ErrInvalidConfig, key)
+	}
+
+	return d, nil
+}
+
+// getEnvBool reads a boolean (e.g. "true", "1") from the given environment variable.
+// The fallback is returned if the variable is not set.
+func getEnvBool(key string, fallback bool) (bool, error) {
+	value, err := getEnv(key)
+	if err != nil {
+		return false, err
+	}
+	if value == "" {
+		return fallback, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%w: invalid boolean for %s: %q", ErrInvalidConfig, key, value)
+	}
+
+	return b, nil
+}
+
+// getEnvFloat reads a non-negative number (e.g. "0.5") from the given environment variable.
+// The fallback is returned if the variable is not set.
+func getEnvFloat(key string, fallback float64) (float64, error) {
+	value, err := getEnv(key)
+	if err != nil {
+		return 0, err
+	}
+	if value == "" {
+		return fallback, nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid number for %s: %q", ErrInvalidConfig, key, value)
+	}
+	if f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, fmt.Errorf("%w: invalid number for %s: must be a finite non-negative number", ErrInvalidConfig, key)
+	}
+
+	return f, nil
+}
+
+// getEnvInt reads a non-negative integer (e.g. "5") from the given environment variable.
+// The fallback is returned if the variable is not set.
+func getEnvInt(key string, fallback int) (int, error) {
+	value, err := getEnv(key)
+	if err != nil {
+		return 0, err
+	}
+	if value == "" {
+		return fallback, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid integer for %s: %q", ErrInvalidConfig, key, value)
+	}
+	if i < 0 {
+		return 0, fmt.Errorf("%w: invalid integer for %s: must not be negative", ErrInvalidConfig, key)
+	}
+
+	return i, nil
+}
+
+// getEnvList reads a comma separated list (e.g. "a, b") from the given environment variable.
+// Empty items are dropped. The fallback is returned if the variable is not set.
+func getEnvList(key string, fallback []string) ([]string, error) {
+	value, ok, err := lookupEnv(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return fallback, nil
+	}
+
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list, nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGetEnvDuration(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value string
+		want  time.Duration
+		err   bool
+	}{
+		{
+			name:  "not set",
+			value: "",
+			want:  time.Minute,
+		},
+		{
+			name:  "seconds",
+			value: "30s",
+			want:  30 * time.Second,
+		},
+		{
+			name:  "invalid",
+			value: "thirty",
+			err:   true,
+		},
+		{
+			name:  "negative",
+			value: "-1s",
+			err:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("TEST_DURATION", tc.value)
+
+			got, err := getEnvDuration("TEST_DURATION", time.Minute)
+			if got != tc.want {
+				t.Errorf("expected %s, got %s", tc.want, got)
+			}
+
+			if tc.err && err == nil {
+				t.Error("expected error, got nil")
+			}
+
+			if !tc.err && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestGetEnvBool(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value string
+		want  bool
+		err   bool
+	}{
+		{
+			name:  "not set",
+			value: "",
+			want:  true,
+		},
+		{
+			name:  "false",
+			value: "false",
+			want:  false,
+		},
+		{
+			name:  "numeric",
+			value: "1",
+			want:  true,
+		},
+		{
+			name:  "invalid",
+			value: "yes please",
+			err:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("TEST_BOOL", tc.value)
+
+			got, err := getEnvBool("TEST_BOOL", true)
+			if got != tc.want && !tc.err {
+				t.Errorf("expected %t, got %t", tc.want, got)
+			}
+
+			if tc.err && err == nil {
+				t.Error("expected error, got nil")
+			}
+
+			if !tc.err && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestGetEnvList(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value *string
+		want  []string
+	}{
+		{
+			name: "not set",
+			want: []string{"fallback"},
+		},
+		{
+			name:  "empty",
+			value: ptr(""),
+			want:  []string{},
+		},
+		{
+			name:  "list",
+			value: ptr("a, b,,c "),
+			want:  []string{"a", "b", "c"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.value != nil {
+				t.Setenv("TEST_LIST", *tc.value)
+			}
+
+			got, err := getEnvList("TEST_LIST", []string{"fallback"})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
+
+func TestGetEnv(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name  string
+		value string
+		file  string
+		want  string
+		err   bool
+	}{
+		{
+			name: "not set",
+			want: "",
+		},
+		{
+			name:  "env",
+			value: "from-env",
+			want:  "from-env",
+		},
+		{
+			name: "file",
+			file: file,
+			want: "from-file",
+		},
+		{
+			name:  "file takes precedence",
+			value: "from-env",
+			file:  file,
+			want:  "from-file",
+		},
+		{
+			name: "missing file",
+			file: filepath.Join(t.TempDir(), "missing"),
+			err:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("TEST_VALUE", tc.value)
+			t.Setenv("TEST_VALUE_FILE", tc.file)
+
+			got, err := getEnv("TEST_VALUE")
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+			if tc.err != (err != nil) {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("expected %v, got %v", ErrInvalidConfig, err)
+			}
+		})
+	}
+}
+
+func TestGetEnvFloat(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value string
+		want  float64
+		err   bool
+	}{
+		{name: "not set", value: "", want: 1},
+		{name: "integer", value: "5", want: 5},
+		{name: "fraction", value: "0.5", want: 0.5},
+		{name: "zero", value: "0", want: 0},
+		{name: "invalid", value: "fast", err: true},
+		{name: "negative", value: "-1", err: true},
+		{name: "infinite", value: "Inf", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("TEST_FLOAT", tc.value)
+
+			got, err := getEnvFloat("TEST_FLOAT", 1)
+			if got != tc.want {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+			if tc.err != (err != nil) {
+				t.Errorf("expected error %t, got %v", tc.err, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("expected %v, got %v", ErrInvalidConfig, err)
+			}
+		})
+	}
+}
+
+func TestGetEnvInt(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value string
+		want  int
+		err   bool
+	}{
+		{name: "not set", value: "", want: 1},
+		{name: "integer", value: "5", want: 5},
+		{name: "fraction", value: "0.5", err: true},
+		{name: "negative", value: "-1", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("TEST_INT", tc.value)
+
+			got, err := getEnvInt("TEST_INT", 1)
+			if got != tc.want {
+				t.Errorf("expected %d, got %d", tc.want, got)
+			}
+			if tc.err != (err != nil) {
+				t.Errorf("expected error %t, got %v", tc.err, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("expected %v, got %v", ErrInvalidConfig, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+/*
+This file provides the classification of errors into retryable and permanent errors.
+The webhook framework of cert-manager has no way to signal that a challenge can never succeed, every error
+returned by Present or CleanUp is retried with a backoff. The classification is therefore attached to the logs,
+so that operators can tell a transient GitLab outage apart from a configuration or validation problem.
+*/
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// ErrorClass describes whether a failed operation may succeed if it is retried.
+type ErrorClass string
+
+const (
+	ErrorClassRetryable ErrorClass = "retryable"
+	ErrorClassPermanent ErrorClass = "permanent"
+)
+
+var (
+	ErrInvalidRecord = errors.New("invalid record")
+	ErrInvalidConfig = errors.New("invalid configuration")
+)
+
+// permanentErrors will never succeed on retry without a change to the configuration, the challenge or the zone file
+var permanentErrors = []error{
+	ErrInvalidRecord,
+	ErrInvalidConfig,
+	ErrInvalidKeyValidation,
+	ErrInvalidValueFormat,
+	ErrInvalidQuoteStyle,
+	ErrInvalidOwnerNameCase,
+	ErrInvalidApprovalsMode,
+	ErrInvalidSelfApprovalMode,
+	ErrSelfApprovalForbidden,
+	ErrInvalidMergeMethod,
+	ErrDomainNotAllowed,
+	ErrNoZoneRoute,
+	ErrProjectNotFound,
+	ErrInvalidZoneFormat,
+	ErrZoneRecordsNotFound,
+	ErrInvalidRecordEntryFormat,
+	ErrTextRecordAlreadyExists,
+	ErrTextRecordDoesNotExist,
+	ErrACMEBotContentNotFound,
+	ErrForeignMarkers,
+	ErrMarkerPrefixMismatch,
+	ErrForeignRecord,
+	ErrZoneFileTooLarge,
+	ErrInvalidMarkersPosition,
+	ErrInvalidCleanupMode,
+	ErrInvalidBranchName,
+	ErrTargetBranchNotFound,
+	ErrInvalidMissingTargetBranch,
+	ErrInvalidEmptyBlockMode,
+	ErrInvalidRecordSort,
+	ErrInvalidSerialStrategy,
+	ErrInvalidMissingPipelineMode,
+	ErrMissingPipeline,
+	ErrSOARecordNotFound,
+	ErrZoneFileIsDirectory,
+	ErrZoneFileNotFound,
+	ErrNotAZoneFile,
+	ErrSerialNumberNotFound,
+	ErrGitlabBotCommentPrefixNotDefined,
+	ErrGitlabTargetBranchNotDefined,
+	ErrGitlabBotBranchNotDefined,
+	ErrGitlabPathNotDefined,
+	ErrGitlabFileNotDefined,
+	ErrGitlabTokenNotDefined,
+	ErrGitlabURLNotDefined,
+	gitlab.ErrNotFound,
+}
+
+// ClassifyError returns whether the given error is retryable or permanent.
+// Unknown errors are considered retryable.
+func ClassifyError(err error) ErrorClass {
+	for _, permanent := range permanentErrors {
+		if errors.Is(err, permanent) {
+			return ErrorClassPermanent
+		}
+	}
+
+	// Authentication and authorization failures require a new token or different permissions
+	var errResp *gitlab.ErrorResponse
+	if errors.As(err, &errResp) && errResp.Response != nil {
+		switch errResp.Response.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return ErrorClassPermanent
+		}
+	}
+
+	// Network errors, timeouts and other GitLab responses are transient
+	return ErrorClassRetryable
+}
+
+// IsPermanent reports whether the given error will never succeed on retry.
+func IsPermanent(err error) bool {
+	return ClassifyError(err) == ErrorClassPermanent
+}
+
+// logError logs the failure of an operation together with its error class. A record that already exists or was
+// already removed is the routine outcome of a repeated Present or CleanUp and is not logged as a failure.
+func logError(log *slog.Logger, operation string, fqdn string, err error) {
+	if err == nil {
+		return
+	}
+	if errors.Is(err, ErrTextRecordAlreadyExists) || errors.Is(err, ErrTextRecordDoesNotExist) {
+		log.Info("operation had no effect", "operation", operation, "fqdn", fqdn, "reason", err)
+		return
+	}
+
+	log.Error("operation failed", "operation", operation, "fqdn", fqdn, "class", ClassifyError(err), "error", err)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestClassifyError(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{
+			name: "record validation",
+			err:  (&Record{Domain: "example", Key: "key"}).Validate(),
+			want: ErrorClassPermanent,
+		},
+		{
+			name: "missing configuration",
+			err:  ErrGitlabTokenNotDefined,
+			want: ErrorClassPermanent,
+		},
+		{
+			name: "invalid duration",
+			err:  fmt.Errorf("%w: invalid duration for GITLAB_HTTP_TIMEOUT", ErrInvalidConfig),
+			want: ErrorClassPermanent,
+		},
+		{
+			name: "wrapped missing marker",
+			err:  fmt.Errorf("reading zone: %w", ErrACMEBotContentNotFound),
+			want: ErrorClassPermanent,
+		},
+		{
+			name: "gitlab unauthorized",
+			err:  &gitlab.ErrorResponse{Response: &http.Response{StatusCode: http.StatusUnauthorized}},
+			want: ErrorClassPermanent,
+		},
+		{
+			name: "gitlab not found",
+			err:  gitlab.ErrNotFound,
+			want: ErrorClassPermanent,
+		},
+		{
+			name: "gitlab server error",
+			err:  &gitlab.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadGateway}},
+			want: ErrorClassRetryable,
+		},
+		{
+			name: "timeout",
+			err:  context.DeadlineExceeded,
+			want: ErrorClassRetryable,
+		},
+		{
+			name: "unknown",
+			err:  fmt.Errorf("something went wrong"),
+			want: ErrorClassRetryable,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ClassifyError(tc.err); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestClassifyTimeout(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	fake.delay = 200 * time.Millisecond
+
+	c, err := NewGitlabClient("token", srv.URL, 10*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ReadZoneFile(c, "main", fakeProject, fakeFile)
+	if got := ClassifyError(err); got != ErrorClassRetryable {
+		t.Errorf("expected %q, got %q for %v", ErrorClassRetryable, got, err)
+	}
+}
+
+func TestLogError(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "failure",
+			err:  ErrInvalidRecord,
+			want: "level=ERROR",
+		},
+		{
+			name: "record already exists",
+			err:  fmt.Errorf("present: %w", ErrTextRecordAlreadyExists),
+			want: "level=INFO",
+		},
+		{
+			name: "record already removed",
+			err:  ErrTextRecordDoesNotExist,
+			want: "level=INFO",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logError(slog.New(slog.NewTextHandler(&buf, nil)), "present", "_acme-challenge.example.com.", tc.err)
+			if !strings.Contains(buf.String(), tc.want) {
+				t.Errorf("expected %q in %q", tc.want, buf.String())
+			}
+		})
+	}
+}
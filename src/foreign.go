@@ -0,0 +1,39 @@
+/*
+This file provides the strict mode for zone files that other systems might write to. By default, Present adds its
+record next to any other record of the same FQDN in the -ACME-BOT block. If FAIL_ON_FOREIGN_RECORDS is set, Present
+fails instead if the block has a record of the same FQDN with another key that the webhook does not know, i.e. that
+was neither presented by it nor read from the zone file on startup, as this indicates drift or another writer.
+
+The known records are those in memory, or in STATE_CONFIGMAP_NAME if configured. Replicas without a shared state
+see the records of each other as foreign and must not use the strict mode.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrForeignRecord = errors.New("foreign txt record in -ACME-BOT block")
+
+// checkForeignRecords fails if the zone file has a record of the FQDN with another key that is not known.
+// It does nothing unless FAIL_ON_FOREIGN_RECORDS is set.
+func (h *gitSolver) checkForeignRecords(content string, fqdn string, key string) error {
+	if !h.failOnForeignRecords {
+		return nil
+	}
+
+	txtRecords, err := h.readAcmeBotRecords(content)
+	if err != nil {
+		return err
+	}
+
+	for id, other := range txtRecords {
+		if other == key || id != h.recordIDFor(fqdn, other) || h.hasRecord(id) {
+			continue
+		}
+		return fmt.Errorf("%w: %s has a TXT record with another key that was not presented by the webhook", ErrForeignRecord, fqdn)
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestPresentForeignRecords(t *testing.T) {
+	foreign := strings.Replace(fakeZone, "; TEST-ACME-BOT-END", "_acme-challenge.example.com            TXT \"foreign\"\n; TEST-ACME-BOT-END", 1)
+
+	testCases := []struct {
+		name   string
+		strict bool
+		fqdn   string
+		// known marks the foreign record as presented by the webhook
+		known bool
+		err   error
+	}{
+		{name: "disabled", fqdn: "_acme-challenge.example.com."},
+		{name: "same fqdn", strict: true, fqdn: "_acme-challenge.example.com.", err: ErrForeignRecord},
+		{name: "known record", strict: true, fqdn: "_acme-challenge.example.com.", known: true},
+		{name: "other fqdn", strict: true, fqdn: "_acme-challenge.www.example.com."},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", foreign)
+			solver := newTestSolver(t, srv)
+			solver.failOnForeignRecords = tc.strict
+			if tc.known {
+				solver.setRecord(solver.recordIDFor("_acme-challenge.example.com.", "foreign"), "foreign")
+			}
+
+			challenge := &acme.ChallengeRequest{ResolvedFQDN: tc.fqdn, Key: "wow-so-secret"}
+			err := solver.Present(challenge)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if err != nil && !IsPermanent(err) {
+				t.Errorf("expected a permanent error, got %v", err)
+			}
+
+			// A refused challenge leaves the zone file unchanged
+			added := strings.Contains(fake.content("main"), "wow-so-secret")
+			if added != (tc.err == nil) {
+				t.Errorf("expected record added %t, got %q", tc.err == nil, fake.content("main"))
+			}
+			if tc.err != nil && len(fake.commits) != 0 {
+				t.Errorf("expected no commits, got %d", len(fake.commits))
+			}
+		})
+	}
+}
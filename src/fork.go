@@ -0,0 +1,18 @@
+/*
+This file provides the fork workflow for bots that may not push to the project of the zone file.
+If GITLAB_FORK_PATH is set, the bot branch lives in that project, usually a fork of GITLAB_PATH: the bot branch is
+created from the target branch of the fork and the records are committed to it, while the merge requests target
+the target branch of GITLAB_PATH, from which the records are verified and reconstructed. The fork must therefore
+contain the target branch. It does not need to be up to date, as the bot branch is refreshed from the target
+branch of GITLAB_PATH whenever it is missing records, see readBotZoneFile.
+*/
+package main
+
+// gitBotPath returns the project of the bot branch, the fork if configured.
+func (h *gitSolver) gitBotPath() string {
+	if h.gitForkPath != "" {
+		return h.gitForkPath
+	}
+
+	return h.gitPath
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestMergeCrossProject(t *testing.T) {
+	defer func(d time.Duration) { mergeRequestPollInterval = d }(mergeRequestPollInterval)
+	mergeRequestPollInterval = time.Millisecond
+
+	testCases := []struct {
+		name          string
+		openMRs       map[int]*fakeMergeRequest
+		mergeRequests int
+	}{
+		{
+			name:          "new merge request",
+			mergeRequests: 1,
+		},
+		{
+			name: "open merge request of the fork is reused",
+			openMRs: map[int]*fakeMergeRequest{
+				// An open merge request from a branch of the same name in the target project is not reused
+				1: {source: "acme-bot", target: "main", project: fakeProject, state: "opened"},
+				2: {source: branchKey(fakeFork, "acme-bot"), target: "main", project: fakeProject, state: "opened"},
+			},
+			mergeRequests: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", "old")
+			fake.branches["acme-bot"] = "unrelated"
+			fake.branches[branchKey(fakeFork, "acme-bot")] = "new"
+			for iid, mr := range tc.openMRs {
+				fake.mergeRequests[iid] = mr
+			}
+
+			git, err := gitlab.NewClient("token", gitlab.WithBaseURL(srv.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := MergeConfig{Timeout: time.Second, SourceProject: fakeFork}
+			if err := Merge(git, fakeProject, "acme-bot", "main", "title", "description", cfg); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if got := fake.content("main"); got != "new" {
+				t.Errorf("expected the fork to be merged, got %q", got)
+			}
+			if len(fake.mergeRequests) != tc.mergeRequests {
+				t.Errorf("expected %d merge requests, got %d", tc.mergeRequests, len(fake.mergeRequests))
+			}
+			for _, mr := range fake.mergeRequests {
+				if mr.source == branchKey(fakeFork, "acme-bot") && (mr.state != "merged" || mr.project != fakeProject) {
+					t.Errorf("expected merge request of the fork to be merged in %s, got %s in %s", fakeProject, mr.state, mr.project)
+				}
+			}
+		})
+	}
+}
+
+func TestPresentCleanUpFork(t *testing.T) {
+	defer func(d time.Duration) { mergeRequestPollInterval = d }(mergeRequestPollInterval)
+	mergeRequestPollInterval = time.Millisecond
+
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	// The target branch of the fork is behind the target branch of the project
+	fake.branches[branchKey(fakeFork, "main")] = strings.Replace(fakeZone, "2021091501", "2021010101", 1)
+
+	solver := newTestSolver(t, srv)
+	solver.gitForkPath = fakeFork
+	solver.mergeConfig.SourceProject = fakeFork
+
+	challenge := &acme.ChallengeRequest{
+		ResolvedFQDN: "_acme-challenge.example.com.",
+		Key:          "wow-so-secret",
+	}
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(fake.content("main"), "wow-so-secret") {
+		t.Errorf("expected record to be merged into the target branch, got %q", fake.content("main"))
+	}
+	if _, ok := fake.branches["acme-bot"]; ok {
+		t.Error("expected no bot branch in the project")
+	}
+	for _, commit := range fake.commits {
+		if commit.branch != branchKey(fakeFork, "acme-bot") {
+			t.Errorf("expected commits to the bot branch of the fork only, got %s", commit.branch)
+		}
+	}
+
+	present, err := solver.Verify(challenge.ResolvedFQDN, challenge.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !present {
+		t.Error("expected record to be verified on the target branch of the project")
+	}
+
+	if err := solver.CleanUp(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(fake.content("main"), "wow-so-secret") {
+		t.Errorf("expected record to be removed, got %q", fake.content("main"))
+	}
+}
+
+func TestRouteSolverFork(t *testing.T) {
+	h := &gitSolver{gitPath: fakeProject, gitForkPath: fakeFork, gitBotBranch: "acme-bot"}
+
+	testCases := []struct {
+		name  string
+		route ZoneRoute
+		want  string
+	}{
+		{
+			name:  "default project",
+			route: ZoneRoute{Pattern: "."},
+			want:  fakeFork,
+		},
+		{
+			name:  "other project",
+			route: ZoneRoute{Pattern: ".", Project: "dns/internal"},
+			want:  "dns/internal",
+		},
+		{
+			name:  "other project with fork",
+			route: ZoneRoute{Pattern: ".", Project: "dns/internal", Fork: "bot/internal"},
+			want:  "bot/internal",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			solver := h.newRouteSolver(tc.route)
+			if got := solver.gitBotPath(); got != tc.want {
+				t.Errorf("expected bot branch in %q, got %q", tc.want, got)
+			}
+			if solver.mergeConfig.SourceProject != solver.gitForkPath {
+				t.Errorf("expected merge requests from %q, got %q", solver.gitForkPath, solver.mergeConfig.SourceProject)
+			}
+		})
+	}
+}
@@ -0,0 +1,722 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+const (
+	fakeProject = "zone"
+	fakeFork    = "zone-fork"
+	fakeFile    = "db.zone"
+)
+
+// fakeProjectIDs are the IDs of the projects of the fake, other projects have the ID 0
+var fakeProjectIDs = map[string]int{fakeProject: 1, fakeFork: 2}
+
+var (
+	fakeVersionPath      = regexp.MustCompile(`^/api/v4/version$`)
+	fakeProjectPrefix    = regexp.MustCompile(`^/api/v4/projects/([^/]+)`)
+	fakeProjectPath      = regexp.MustCompile(`^/api/v4/projects/[^/]+$`)
+	fakeBranchPath       = regexp.MustCompile(`^/api/v4/projects/[^/]+/repository/branches/([^/]+)$`)
+	fakeBranchesPath     = regexp.MustCompile(`^/api/v4/projects/[^/]+/repository/branches$`)
+	fakeFilePath         = regexp.MustCompile(`^/api/v4/projects/[^/]+/repository/files/([^/]+)$`)
+	fakeCommitsPath      = regexp.MustCompile(`^/api/v4/projects/[^/]+/repository/commits$`)
+	fakeComparePath      = regexp.MustCompile(`^/api/v4/projects/[^/]+/repository/compare$`)
+	fakeTreePath         = regexp.MustCompile(`^/api/v4/projects/[^/]+/repository/tree$`)
+	fakeMergeRequestPath = regexp.MustCompile(`^/api/v4/projects/[^/]+/merge_requests$`)
+	fakeMergeRequestIID  = regexp.MustCompile(`^/api/v4/projects/[^/]+/merge_requests/(\d+)$`)
+	fakeMergeRequestAny  = regexp.MustCompile(`^/api/v4/projects/[^/]+/merge_requests/(\d+)(/|$)`)
+	fakeApprovalsPath    = regexp.MustCompile(`^/api/v4/projects/[^/]+/merge_requests/(\d+)/approvals$`)
+	fakeRebasePath       = regexp.MustCompile(`^/api/v4/projects/[^/]+/merge_requests/(\d+)/rebase$`)
+	fakeApprovePath      = regexp.MustCompile(`^/api/v4/projects/[^/]+/merge_requests/(\d+)/approve$`)
+	fakeMergePath        = regexp.MustCompile(`^/api/v4/projects/[^/]+/merge_requests/(\d+)/merge$`)
+)
+
+// fakeGitlab is a minimal in-memory GitLab API used to test the solver without a real instance.
+// It keeps the zone file of every branch in branches and other files in files, see file, and supports the
+// endpoints used by the solver. The branches of projects other than fakeProject, e.g. fakeFork, are kept as
+// "<project>:<branch>", see branchKey.
+type fakeGitlab struct {
+	// delay is applied to every request to simulate a slow GitLab instance
+	delay time.Duration
+
+	// mergeStatus and detailedMergeStatus are reported for every merge request
+	mergeStatus         string
+	detailedMergeStatus string
+
+	// mergeMethod is the merge method of the project, merge requests of "ff" projects need a rebase
+	mergeMethod string
+	rebases     int
+
+	// headPipeline reports a running head pipeline for every merge request
+	headPipeline bool
+
+	// noDifferences makes creating a merge request fail as if the source branch had no changes
+	noDifferences bool
+
+	// mergeRequestFailures makes the next merge request creations fail with a 503
+	mergeRequestFailures int
+
+	// approvalsRequired and approvalsLeft are reported for every merge request after the bot approved it
+	approvalsRequired int
+	approvalsLeft     int
+
+	// approveStatus makes approving a merge request fail with the given status, e.g. if self-approval is forbidden
+	approveStatus int
+
+	// mergedConcurrently merges every merge request right before the bot accepts it,
+	// so that accepting it fails as if a previous attempt had merged it
+	mergedConcurrently bool
+
+	// fallsBehind moves the target branch right before the first merge request is accepted, so that accepting
+	// fails until it is rebased. conflicts makes accepting fail with a conflict instead.
+	fallsBehind bool
+	conflicts   bool
+
+	// behindOnCreate reports every new merge request as behind the target branch until it is rebased, and
+	// rebasePolls is the number of polls a rebase reports as in progress
+	behindOnCreate bool
+	rebasePolls    int
+	rebasing       int
+
+	// fileChanges makes the next file updates fail as if the file changed since it was read,
+	// after applying concurrentEdit to the branch as another writer would
+	fileChanges    int
+	concurrentEdit func(content string) string
+
+	// invalidFile makes every commit with an action on this file fail, as if the action was invalid
+	invalidFile string
+
+	// readEdit changes the zone file of a branch after it was read, e.g. to rebase the branch between reading and
+	// writing the zone file. It is called with the branch and the number of reads of its zone file so far.
+	readEdit func(branch string, reads int, content string) string
+	reads    map[string]int
+
+	// mergeEdit changes the content of the target branch after a merge, e.g. to corrupt it
+	mergeEdit func(content string) string
+
+	// staleReads makes the next zone file reads after every write or merge return the content from before it,
+	// like a lagging replica. stale holds the branches from before the last write, lagging the reads left.
+	staleReads int
+	stale      map[string]string
+	lagging    int
+
+	// defaultBranch is the default branch of the projects
+	defaultBranch string
+
+	// missingProjects are reported as not found, with their path escaped as in the URL
+	missingProjects []string
+
+	branches      map[string]string
+	files         map[string]string
+	commits       []fakeCommit
+	mergeRequests map[int]*fakeMergeRequest
+	requests      int
+
+	// readRefs are the refs of the file reads, i.e. branches or the IDs of commits created with the commits API
+	readRefs []string
+
+	sync.Mutex
+}
+
+type fakeCommit struct {
+	// id is shared by the files of a commit with several file actions
+	id      int
+	branch  string
+	file    string
+	message string
+	content string
+
+	authorName  string
+	authorEmail string
+}
+
+// subject returns the first line of the commit message, without the trailers
+func (c fakeCommit) subject() string {
+	subject, _, _ := strings.Cut(c.message, "\n")
+	return subject
+}
+
+type fakeMergeRequest struct {
+	// source and target are the branch keys, project is the target project the merge request lives in
+	source  string
+	target  string
+	project string
+	state   string
+	labels  gitlab.LabelOptions
+
+	// title marks the merge request as a draft, see draft
+	title       string
+	description string
+
+	// behind and conflict report the merge request as "need_rebase" or "conflict"
+	behind   bool
+	conflict bool
+
+	// created is the time the merge request was created
+	created time.Time
+}
+
+// draft reports whether the title marks the merge request as a draft, which GitLab does not merge
+func (mr *fakeMergeRequest) draft() bool {
+	return strings.HasPrefix(mr.title, draftTitlePrefix)
+}
+
+func newFakeGitlab(t testing.TB, target string, content string) (*fakeGitlab, *httptest.Server) {
+	f := &fakeGitlab{
+		mergeStatus:         "can_be_merged",
+		detailedMergeStatus: "mergeable",
+		defaultBranch:       target,
+		branches:            map[string]string{target: content},
+		files:               make(map[string]string),
+		mergeRequests:       make(map[int]*fakeMergeRequest),
+	}
+
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	return f, srv
+}
+
+func (f *fakeGitlab) content(branch string) string {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.branches[branch]
+}
+
+// fileKey returns the key of a file other than fakeFile of the branch in files
+func fileKey(branch string, file string) string {
+	return branch + "#" + file
+}
+
+// file returns the content of the file of the branch
+func (f *fakeGitlab) file(branch string, file string) (string, bool) {
+	if file == fakeFile {
+		content, ok := f.branches[branch]
+		return content, ok
+	}
+
+	content, ok := f.files[fileKey(branch, file)]
+	return content, ok
+}
+
+// setFile sets the content of the file of the branch
+func (f *fakeGitlab) setFile(branch string, file string, content string) {
+	if file == fakeFile {
+		f.branches[branch] = content
+		return
+	}
+
+	f.files[fileKey(branch, file)] = content
+}
+
+// commitFile returns the commit of the file with the given ID, which is only known for the commits created with
+// the commits API. The file of a commit is never stale.
+func (f *fakeGitlab) commitFile(id string, file string) (fakeCommit, bool) {
+	for _, commit := range f.commits {
+		if commit.id > 0 && strconv.Itoa(commit.id) == id && commit.file == file {
+			return commit, true
+		}
+	}
+
+	return fakeCommit{}, false
+}
+
+// lag makes the next staleReads zone file reads return the current content of the branches.
+func (f *fakeGitlab) lag() {
+	if f.staleReads > 0 {
+		f.stale = maps.Clone(f.branches)
+		f.lagging = f.staleReads
+	}
+}
+
+// copyBranch sets the files of the branch to to those of the branch from
+func (f *fakeGitlab) copyBranch(from string, to string) {
+	f.branches[to] = f.branches[from]
+	for key, content := range f.files {
+		if file, ok := strings.CutPrefix(key, from+"#"); ok {
+			f.files[fileKey(to, file)] = content
+		}
+	}
+}
+
+// sameBranch reports whether the branches have the same files
+func (f *fakeGitlab) sameBranch(a string, b string) bool {
+	if f.branches[a] != f.branches[b] {
+		return false
+	}
+	for key, content := range f.files {
+		if file, ok := strings.CutPrefix(key, a+"#"); ok && f.files[fileKey(b, file)] != content {
+			return false
+		}
+		if file, ok := strings.CutPrefix(key, b+"#"); ok && f.files[fileKey(a, file)] != content {
+			return false
+		}
+	}
+
+	return true
+}
+
+// branchKey returns the key of the branch of the project in branches
+func branchKey(project string, branch string) string {
+	if project == fakeProject {
+		return branch
+	}
+
+	return project + ":" + branch
+}
+
+// fakeProjectByID returns the path of the project with the given ID
+func fakeProjectByID(id int) string {
+	for project, projectID := range fakeProjectIDs {
+		if projectID == id {
+			return project
+		}
+	}
+
+	return ""
+}
+
+func (f *fakeGitlab) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(f.delay)
+
+	f.Lock()
+	defer f.Unlock()
+	f.requests++
+
+	path := r.URL.EscapedPath()
+	project := ""
+	if m := fakeProjectPrefix.FindStringSubmatch(path); m != nil {
+		project = m[1]
+	}
+
+	// The IID of a merge request is only known in the project it lives in
+	if m := fakeMergeRequestAny.FindStringSubmatch(path); m != nil {
+		iid, _ := strconv.Atoi(m[1])
+		if mr, ok := f.mergeRequests[iid]; ok && mr.project != project {
+			http.Error(w, `{"message":"404 Not found"}`, http.StatusNotFound)
+			return
+		}
+	}
+
+	switch {
+	case r.Method == http.MethodGet && fakeVersionPath.MatchString(path):
+		writeJSON(w, http.StatusOK, map[string]any{"version": "17.0.0", "revision": "fake"})
+
+	case r.Method == http.MethodGet && fakeProjectPath.MatchString(path) && slices.Contains(f.missingProjects, project):
+		http.Error(w, `{"message":"404 Project Not Found"}`, http.StatusNotFound)
+
+	case r.Method == http.MethodGet && fakeProjectPath.MatchString(path):
+		writeJSON(w, http.StatusOK, map[string]any{"id": fakeProjectIDs[project], "merge_method": f.mergeMethod, "default_branch": f.defaultBranch})
+
+	case r.Method == http.MethodDelete && fakeBranchPath.MatchString(path):
+		key := branchKey(project, fakeBranchPath.FindStringSubmatch(path)[1])
+		if _, ok := f.branches[key]; !ok {
+			http.Error(w, `{"message":"404 Branch Not Found"}`, http.StatusNotFound)
+			return
+		}
+		delete(f.branches, key)
+		for file := range f.files {
+			if strings.HasPrefix(file, key+"#") {
+				delete(f.files, file)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodGet && fakeBranchPath.MatchString(path):
+		name := fakeBranchPath.FindStringSubmatch(path)[1]
+		if _, ok := f.branches[branchKey(project, name)]; !ok {
+			http.Error(w, `{"message":"404 Branch Not Found"}`, http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"name": name})
+
+	case r.Method == http.MethodPost && fakeBranchesPath.MatchString(path):
+		var opts gitlab.CreateBranchOptions
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.copyBranch(branchKey(project, *opts.Ref), branchKey(project, *opts.Branch))
+		writeJSON(w, http.StatusCreated, map[string]any{"name": *opts.Branch})
+
+	case r.Method == http.MethodGet && fakeFilePath.MatchString(path):
+		file, _ := url.PathUnescape(fakeFilePath.FindStringSubmatch(path)[1])
+		ref := r.URL.Query().Get("ref")
+		f.readRefs = append(f.readRefs, ref)
+		if commit, ok := f.commitFile(ref, file); ok {
+			writeJSON(w, http.StatusOK, map[string]any{
+				"file_path": file,
+				"encoding":  "base64",
+				"content":   base64.StdEncoding.EncodeToString([]byte(commit.content)),
+			})
+			return
+		}
+		branch := branchKey(project, ref)
+		content, ok := f.file(branch, file)
+		if stale, isStale := f.stale[branch]; isStale && f.lagging > 0 && file == fakeFile {
+			f.lagging--
+			content = stale
+		}
+		if !ok {
+			http.Error(w, `{"message":"404 File Not Found"}`, http.StatusNotFound)
+			return
+		}
+		if f.readEdit != nil && file == fakeFile {
+			if f.reads == nil {
+				f.reads = make(map[string]int)
+			}
+			f.reads[branch]++
+			f.branches[branch] = f.readEdit(branch, f.reads[branch], f.branches[branch])
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"file_path": file,
+			"encoding":  "base64",
+			"content":   base64.StdEncoding.EncodeToString([]byte(content)),
+		})
+
+	case r.Method == http.MethodPut && fakeFilePath.MatchString(path):
+		var opts gitlab.UpdateFileOptions
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		file, _ := url.PathUnescape(fakeFilePath.FindStringSubmatch(path)[1])
+		branch := branchKey(project, *opts.Branch)
+		if f.fileChanges > 0 {
+			f.fileChanges--
+			if f.concurrentEdit != nil {
+				content, _ := f.file(branch, file)
+				f.setFile(branch, file, f.concurrentEdit(content))
+			}
+			http.Error(w, `{"message":"You are attempting to update a file that has changed since you started editing it."}`, http.StatusBadRequest)
+			return
+		}
+		f.lag()
+		content := decodeFakeContent(opts.Content, opts.Encoding)
+		f.setFile(branch, file, content)
+		commit := fakeCommit{branch: branch, file: file, message: *opts.CommitMessage, content: content}
+		if opts.AuthorName != nil {
+			commit.authorName = *opts.AuthorName
+		}
+		if opts.AuthorEmail != nil {
+			commit.authorEmail = *opts.AuthorEmail
+		}
+		f.commits = append(f.commits, commit)
+		writeJSON(w, http.StatusOK, map[string]any{"file_path": file, "branch": *opts.Branch})
+
+	case r.Method == http.MethodPost && fakeCommitsPath.MatchString(path):
+		var opts gitlab.CreateCommitOptions
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		branch := branchKey(project, *opts.Branch)
+		if f.fileChanges > 0 {
+			f.fileChanges--
+			if f.concurrentEdit != nil {
+				f.branches[branch] = f.concurrentEdit(f.branches[branch])
+			}
+			http.Error(w, `{"message":"You are attempting to update a file that has changed since you started editing it."}`, http.StatusBadRequest)
+			return
+		}
+
+		// A missing branch is created from the start branch by the commit
+		_, exists := f.branches[branch]
+		if !exists && opts.StartBranch == nil {
+			http.Error(w, `{"message":"You can only create or edit files when you are on a branch"}`, http.StatusBadRequest)
+			return
+		}
+		startBranch := branch
+		if !exists {
+			startBranch = branchKey(project, *opts.StartBranch)
+		}
+
+		// All actions are checked before any is applied, like GitLab does
+		for _, action := range opts.Actions {
+			_, ok := f.file(startBranch, *action.FilePath)
+			if *action.Action == gitlab.FileCreate && ok {
+				http.Error(w, `{"message":"A file with this name already exists"}`, http.StatusBadRequest)
+				return
+			}
+			if *action.Action == gitlab.FileCreate {
+				continue
+			}
+			if !ok || *action.Action != gitlab.FileUpdate || *action.FilePath == f.invalidFile {
+				http.Error(w, `{"message":"A file with this name doesn't exist"}`, http.StatusBadRequest)
+				return
+			}
+		}
+		if !exists {
+			f.copyBranch(startBranch, branch)
+		}
+		f.lag()
+		id := len(f.commits) + 1
+		for _, action := range opts.Actions {
+			content := decodeFakeContent(action.Content, action.Encoding)
+			f.setFile(branch, *action.FilePath, content)
+			f.commits = append(f.commits, fakeCommit{id: id, branch: branch, file: *action.FilePath, message: *opts.CommitMessage, content: content})
+		}
+		writeJSON(w, http.StatusCreated, map[string]any{"id": strconv.Itoa(id)})
+
+	case r.Method == http.MethodGet && fakeTreePath.MatchString(path):
+		// The files of the branch below the path, the fake has no other entries in a tree
+		query := r.URL.Query()
+		branch, dir := branchKey(project, query.Get("ref")), query.Get("path")+"/"
+		entries := []any{}
+		if _, ok := f.branches[branch]; ok && strings.HasPrefix(fakeFile, dir) {
+			entries = append(entries, map[string]any{"name": fakeFile, "type": "blob", "path": fakeFile})
+		}
+		for key := range f.files {
+			if file, ok := strings.CutPrefix(key, branch+"#"); ok && strings.HasPrefix(file, dir) {
+				entries = append(entries, map[string]any{"name": file, "type": "blob", "path": file})
+			}
+		}
+		writeJSON(w, http.StatusOK, entries)
+
+	case r.Method == http.MethodGet && fakeComparePath.MatchString(path):
+		// Branches with the same content have nothing to compare
+		query := r.URL.Query()
+		fromProject := project
+		if id := query.Get("from_project_id"); id != "" {
+			projectID, _ := strconv.Atoi(id)
+			fromProject = fakeProjectByID(projectID)
+		}
+		from, to := branchKey(fromProject, query.Get("from")), branchKey(project, query.Get("to"))
+		if f.sameBranch(from, to) {
+			writeJSON(w, http.StatusOK, map[string]any{"commits": []any{}, "diffs": []any{}})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"commits": []any{map[string]any{"id": "1"}},
+			"diffs":   []any{map[string]any{"new_path": fakeFile}},
+		})
+
+	case r.Method == http.MethodPost && fakeMergeRequestPath.MatchString(path):
+		if f.mergeRequestFailures > 0 {
+			f.mergeRequestFailures--
+			http.Error(w, `{"message":"503 Service Unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		var opts gitlab.CreateMergeRequestOptions
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Cross-project merge requests are created in the source project and live in the target project
+		targetProject := project
+		if opts.TargetProjectID != nil {
+			targetProject = fakeProjectByID(*opts.TargetProjectID)
+		}
+		source, target := branchKey(project, *opts.SourceBranch), branchKey(targetProject, *opts.TargetBranch)
+		for _, mr := range f.mergeRequests {
+			if mr.state == "opened" && mr.source == source && mr.target == target {
+				http.Error(w, `{"message":["Another open merge request already exists for this source branch"]}`, http.StatusConflict)
+				return
+			}
+		}
+		if f.noDifferences {
+			http.Error(w, `{"message":["Source branch does not have any differences to the target branch"]}`, http.StatusUnprocessableEntity)
+			return
+		}
+		iid := len(f.mergeRequests) + 1
+		mr := &fakeMergeRequest{source: source, target: target, project: targetProject, state: "opened", title: *opts.Title, description: *opts.Description, behind: f.behindOnCreate, created: time.Now()}
+		if opts.Labels != nil {
+			// The labels are sent as a comma separated string
+			for _, label := range *opts.Labels {
+				mr.labels = append(mr.labels, strings.Split(label, ",")...)
+			}
+		}
+		f.mergeRequests[iid] = mr
+		writeJSON(w, http.StatusCreated, map[string]any{"iid": iid, "state": "opened", "title": mr.title, "draft": mr.draft()})
+
+	case r.Method == http.MethodGet && fakeMergeRequestPath.MatchString(path):
+		query := r.URL.Query()
+		mrs := []any{}
+		for iid, mr := range f.mergeRequests {
+			// The source branch may be in another project
+			sourceProject, sourceBranch, ok := strings.Cut(mr.source, ":")
+			if !ok {
+				sourceProject, sourceBranch = fakeProject, mr.source
+			}
+			if mr.project == project && mr.state == query.Get("state") && sourceBranch == query.Get("source_branch") && mr.target == branchKey(project, query.Get("target_branch")) {
+				mrs = append(mrs, map[string]any{"iid": iid, "state": mr.state, "title": mr.title, "draft": mr.draft(), "source_project_id": fakeProjectIDs[sourceProject]})
+			}
+		}
+		writeJSON(w, http.StatusOK, mrs)
+
+	case r.Method == http.MethodGet && fakeMergeRequestIID.MatchString(path):
+		iid, _ := strconv.Atoi(fakeMergeRequestIID.FindStringSubmatch(path)[1])
+		state := "opened"
+		detailedMergeStatus := f.detailedMergeStatus
+		if f.mergeMethod == "ff" && f.rebases == 0 {
+			detailedMergeStatus = "need_rebase"
+		}
+		if mr, ok := f.mergeRequests[iid]; ok {
+			state = mr.state
+			if mr.behind {
+				detailedMergeStatus = "need_rebase"
+			}
+			if mr.conflict {
+				detailedMergeStatus = "conflict"
+			}
+			if mr.draft() {
+				detailedMergeStatus = "draft_status"
+			}
+		}
+		rebaseInProgress := f.rebasing > 0
+		if rebaseInProgress {
+			f.rebasing--
+		}
+		response := map[string]any{
+			"iid":                   iid,
+			"state":                 state,
+			"merge_status":          f.mergeStatus,
+			"detailed_merge_status": detailedMergeStatus,
+			"rebase_in_progress":    rebaseInProgress,
+		}
+		if f.headPipeline {
+			response["head_pipeline"] = map[string]any{"id": 1, "status": "running"}
+		}
+		writeJSON(w, http.StatusOK, response)
+
+	case r.Method == http.MethodPut && fakeMergeRequestIID.MatchString(path):
+		var opts gitlab.UpdateMergeRequestOptions
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		iid, _ := strconv.Atoi(fakeMergeRequestIID.FindStringSubmatch(path)[1])
+		mr, ok := f.mergeRequests[iid]
+		if !ok {
+			http.Error(w, `{"message":"404 Not found"}`, http.StatusNotFound)
+			return
+		}
+		if opts.Title != nil {
+			mr.title = *opts.Title
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"iid": iid, "state": mr.state, "title": mr.title, "draft": mr.draft()})
+
+	case r.Method == http.MethodPut && fakeRebasePath.MatchString(path):
+		iid, _ := strconv.Atoi(fakeRebasePath.FindStringSubmatch(path)[1])
+		if mr, ok := f.mergeRequests[iid]; ok {
+			mr.behind = false
+		}
+		f.rebases++
+		f.rebasing = f.rebasePolls
+		writeJSON(w, http.StatusAccepted, map[string]any{"rebase_in_progress": true})
+
+	case r.Method == http.MethodPost && fakeApprovePath.MatchString(path):
+		if f.approveStatus != 0 {
+			http.Error(w, `{"message":"`+http.StatusText(f.approveStatus)+`"}`, f.approveStatus)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]any{"approvals_required": f.approvalsRequired, "approvals_left": f.approvalsLeft})
+
+	case r.Method == http.MethodGet && fakeApprovalsPath.MatchString(path):
+		writeJSON(w, http.StatusOK, map[string]any{"approvals_required": f.approvalsRequired, "approvals_left": f.approvalsLeft})
+
+	case r.Method == http.MethodPut && fakeMergePath.MatchString(path):
+		iid, _ := strconv.Atoi(fakeMergePath.FindStringSubmatch(path)[1])
+		mr, ok := f.mergeRequests[iid]
+		if !ok {
+			http.Error(w, `{"message":"404 Not found"}`, http.StatusNotFound)
+			return
+		}
+		if f.mergedConcurrently && mr.state == "opened" {
+			f.copyBranch(mr.source, mr.target)
+			mr.state = "merged"
+		}
+		if mr.state == "merged" {
+			http.Error(w, `{"message":"405 Method Not Allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		if f.fallsBehind {
+			f.fallsBehind = false
+			mr.behind = true
+		}
+		if f.conflicts {
+			mr.conflict = true
+		}
+		if mr.behind || mr.conflict || mr.draft() {
+			http.Error(w, `{"message":"406 Branch cannot be merged"}`, http.StatusNotAcceptable)
+			return
+		}
+		f.lag()
+		f.copyBranch(mr.source, mr.target)
+		if f.mergeEdit != nil {
+			f.branches[mr.target] = f.mergeEdit(f.branches[mr.target])
+		}
+		mr.state = "merged"
+		writeJSON(w, http.StatusOK, map[string]any{"iid": iid, "state": "merged"})
+
+	default:
+		http.Error(w, `{"message":"404 Not found"}`, http.StatusNotFound)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// newTestSolver returns a solver configured against the given fake GitLab server.
+func newTestSolver(t testing.TB, srv *httptest.Server) *gitSolver {
+	c, err := gitlab.NewClient("token", gitlab.WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &gitSolver{
+		name:                "git-solver",
+		txtRecords:          make(map[string]string),
+		gitClient:           c,
+		gitBotCommentPrefix: "TEST",
+		gitBotBranch:        "acme-bot",
+		gitTargetBranch:     "main",
+		gitPath:             fakeProject,
+		gitFile:             fakeFile,
+		mergeConfig: MergeConfig{
+			Timeout: time.Second,
+		},
+		synced: true,
+	}
+}
+
+// decodeFakeContent returns the content written with the encoding like GitLab, text by default.
+func decodeFakeContent(content *string, encoding *string) string {
+	if encoding == nil || *encoding != "base64" {
+		return *content
+	}
+
+	data, err := base64.StdEncoding.DecodeString(*content)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+const fakeZone = `$ORIGIN example.com.
+@ IN SOA ns.example.com. admin.example.com. (
+    2021091501 ; serial number
+    3600 ; refresh
+)
+; TEST-ACME-BOT
+; TEST-ACME-BOT-END
+`
@@ -0,0 +1,67 @@
+/*
+This file provides extra HTTP headers sent with every request to the GitLab API, e.g. for a WAF or CDN in front
+of GitLab that only lets requests with a certain header through. GITLAB_EXTRA_HEADERS is a comma separated list of
+name=value pairs, e.g. "X-WAF-Token=secret, X-Client=acme-bot", and can be read from a file with
+GITLAB_EXTRA_HEADERS_FILE if the values are secret. The headers are set by the HTTP transport of the client and
+replace headers of the same name set by go-gitlab. The values of the headers are never logged.
+*/
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// headerNameRegex matches the names of HTTP headers, which are tokens as defined by RFC 9110
+var headerNameRegex = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// ParseExtraHeaders parses the name=value pairs of the headers. No pairs return no headers.
+func ParseExtraHeaders(pairs []string) (http.Header, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+
+	headers := http.Header{}
+	for i, pair := range pairs {
+		// The pair may hold a secret, so only its position is reported
+		name, value, ok := strings.Cut(pair, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || !headerNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("%w: invalid GITLAB_EXTRA_HEADERS: pair %d is not a name=value pair", ErrInvalidConfig, i+1)
+		}
+		if strings.ContainsAny(value, "\r\n\x00") {
+			return nil, fmt.Errorf("%w: invalid GITLAB_EXTRA_HEADERS: the value of %s contains a line break", ErrInvalidConfig, name)
+		}
+		headers.Add(name, value)
+	}
+
+	return headers, nil
+}
+
+// headerTransport sets the headers on every request.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+// withExtraHeaders wraps the transport to send the headers with every request, the transport is returned
+// unchanged if there are no headers.
+func withExtraHeaders(base http.RoundTripper, headers http.Header) http.RoundTripper {
+	if len(headers) == 0 {
+		return base
+	}
+
+	return &headerTransport{base: base, headers: headers}
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the original request
+	req = req.Clone(req.Context())
+	for name, values := range t.headers {
+		req.Header[name] = values
+	}
+
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseExtraHeaders(t *testing.T) {
+	testCases := []struct {
+		name  string
+		pairs []string
+		want  http.Header
+		err   bool
+	}{
+		{name: "empty"},
+		{name: "single", pairs: []string{"x-waf-token=secret"}, want: http.Header{"X-Waf-Token": {"secret"}}},
+		{name: "value with equals sign", pairs: []string{"X-Token = a=b"}, want: http.Header{"X-Token": {"a=b"}}},
+		{name: "repeated", pairs: []string{"X-Client=a", "X-Client=b"}, want: http.Header{"X-Client": {"a", "b"}}},
+		{name: "empty value", pairs: []string{"X-Empty="}, want: http.Header{"X-Empty": {""}}},
+		{name: "no value", pairs: []string{"X-Token"}, err: true},
+		{name: "colon", pairs: []string{"X-Token: secret"}, err: true},
+		{name: "no name", pairs: []string{"=secret"}, err: true},
+		{name: "line break", pairs: []string{"X-Token=a\nX-Other: b"}, err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseExtraHeaders(tc.pairs)
+			if tc.err != errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+			for name, values := range tc.want {
+				if !slices.Equal(got[name], values) {
+					t.Errorf("expected %s: %q, got %q", name, values, got[name])
+				}
+			}
+		})
+	}
+}
+
+func TestParseExtraHeadersHidesValues(t *testing.T) {
+	_, err := ParseExtraHeaders([]string{"X-Token: secret"})
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("expected an error without the value, got %v", err)
+	}
+}
+
+func TestGitlabClientExtraHeaders(t *testing.T) {
+	fake, _ := newFakeGitlab(t, "main", fakeZone)
+	headers := http.Header{"X-Waf-Token": {"secret"}}
+
+	// The WAF rejects requests without the header
+	var lock sync.Mutex
+	seen := []string{}
+	waf := func(prefix string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			seen = append(seen, r.Header.Get("X-Waf-Token"))
+			lock.Unlock()
+			if r.Header.Get("X-Waf-Token") != "secret" || r.Header.Get("Private-Token") != "token" {
+				http.Error(w, "blocked", http.StatusForbidden)
+				return
+			}
+			r.URL.Path = defaultAPIPath + strings.TrimPrefix(r.URL.Path, prefix)
+			r.URL.RawPath = ""
+			fake.ServeHTTP(w, r)
+		}
+	}
+
+	srv := httptest.NewServer(waf(defaultAPIPath))
+	t.Cleanup(srv.Close)
+	apiSrv := httptest.NewServer(waf("/gitlab/api"))
+	t.Cleanup(apiSrv.Close)
+
+	c, err := NewGitlabClient("token", srv.URL, time.Second, headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadZoneFile(c, "main", fakeProject, fakeFile); err != nil {
+		t.Fatal(err)
+	}
+
+	// The headers are also sent by the client of an API with a custom path
+	c, err = NewGitlabAPIClient("token", apiSrv.URL+"/gitlab/api", time.Second, headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadZoneFile(c, "main", fakeProject, fakeFile); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the headers, the requests are blocked
+	c, err = NewGitlabClient("token", srv.URL, time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadZoneFile(c, "main", fakeProject, fakeFile); err == nil {
+		t.Error("expected the request without headers to be blocked")
+	}
+
+	if want := []string{"secret", "secret", ""}; !slices.Equal(seen, want) {
+		t.Errorf("expected headers %q, got %q", want, seen)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+This file provides the health server of the webhook, for a quick triage without scraping the logs.
+If HEALTH_ADDR is set, e.g. to ":8081", GET /healthz returns the time of the last successful Present or CleanUp
+and the time and error of the last failed one as JSON:
+
+	{
+	  "status": "ok",
+	  "lastSuccess": {"operation": "present", "fqdn": "_acme-challenge.example.com.", "time": "2026-10-15T09:30:00Z"},
+	  "lastFailure": {"operation": "cleanup", "fqdn": "_acme-challenge.example.com.", "time": "2026-10-15T09:25:00Z",
+	                  "error": "TXT record does not exist"},
+	  "records": [{"fqdn": "_acme-challenge.example.com.", "mergeRequestIID": 42, ...}]
+	}
+
+The fields are omitted until the first operation succeeded or failed. The records link the presented records to
+their merge requests, see recordorigins.go. The status is shared by the solvers of
+the zone routes, see routes.go. The server answers on its own port next to the webhook server, which only serves
+the cert-manager API over TLS.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// healthShutdownTimeout is how long the health server waits for its requests when the webhook stops
+const healthShutdownTimeout = 5 * time.Second
+
+// operationResult is the outcome of a Present or CleanUp call
+type operationResult struct {
+	Operation string    `json:"operation"`
+	FQDN      string    `json:"fqdn"`
+	Time      time.Time `json:"time"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// healthResponse is the body of the health endpoint
+type healthResponse struct {
+	Status      string           `json:"status"`
+	LastSuccess *operationResult `json:"lastSuccess,omitempty"`
+	LastFailure *operationResult `json:"lastFailure,omitempty"`
+	Records     []recordOrigin   `json:"records,omitempty"`
+}
+
+// operationStatus holds the last successful and the last failed operation and the origins of the presented records.
+// A nil operationStatus records nothing.
+type operationStatus struct {
+	lock        sync.Mutex
+	lastSuccess *operationResult
+	lastFailure *operationResult
+	origins     map[string]recordOrigin
+}
+
+// record stores the outcome of the operation at the given time.
+func (s *operationStatus) record(operation string, fqdn string, err error, now time.Time) {
+	if s == nil {
+		return
+	}
+
+	result := &operationResult{Operation: operation, FQDN: fqdn, Time: now.UTC()}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err != nil {
+		result.Error = err.Error()
+		s.lastFailure = result
+		return
+	}
+	s.lastSuccess = result
+}
+
+// snapshot returns the health response of the current status.
+func (s *operationStatus) snapshot() healthResponse {
+	response := healthResponse{Status: "ok"}
+	if s == nil {
+		return response
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// The results are copied, as the response is encoded after the lock is released
+	if s.lastSuccess != nil {
+		success := *s.lastSuccess
+		response.LastSuccess = &success
+	}
+	if s.lastFailure != nil {
+		failure := *s.lastFailure
+		response.LastFailure = &failure
+	}
+	for _, origin := range s.origins {
+		response.Records = append(response.Records, origin)
+	}
+	slices.SortFunc(response.Records, func(a, b recordOrigin) int {
+		return strings.Compare(a.FQDN, b.FQDN)
+	})
+
+	return response
+}
+
+// finishOperation logs the failure of a Present or CleanUp call, records its outcome in the health status, fires
+// the error hooks and posts the outcome to the status callback.
+func (h *gitSolver) finishOperation(log *slog.Logger, operation string, fqdn string, err error) {
+	logError(log, operation, fqdn, err)
+	h.status.record(operation, fqdn, err, time.Now())
+	if err != nil {
+		h.fire(HookEvent{Stage: HookError, FQDN: fqdn, Action: operation, Err: err})
+	}
+	h.postStatus(operation, fqdn, err)
+}
+
+// healthHandler serves the health status as JSON on /healthz.
+func (h *gitSolver) healthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(h.status.snapshot()); err != nil {
+			slog.Warn("writing health response failed", "error", err)
+		}
+	})
+
+	return mux
+}
+
+// startHealthServer serves the health status on the given address until the stop channel is closed.
+// The address is bound before returning, so that a port in use fails the initialization.
+func (h *gitSolver) startHealthServer(addr string, stopCh <-chan struct{}) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: h.healthHandler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("health server failed", "addr", addr, "error", err)
+		}
+	}()
+
+	if stopCh != nil {
+		go func() {
+			<-stopCh
+			ctx, cancel := context.WithTimeout(context.Background(), healthShutdownTimeout)
+			defer cancel()
+			_ = server.Shutdown(ctx)
+		}()
+	}
+
+	slog.Info("health server listening", "addr", listener.Addr().String())
+	return nil
+}
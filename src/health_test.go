@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestHealthStatus(t *testing.T) {
+	_, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	solver.status = &operationStatus{}
+
+	health := httptest.NewServer(solver.healthHandler())
+	t.Cleanup(health.Close)
+
+	get := func() healthResponse {
+		t.Helper()
+
+		resp, err := http.Get(health.URL + "/healthz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		var body healthResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+
+	// No operation has run yet
+	if body := get(); body.Status != "ok" || body.LastSuccess != nil || body.LastFailure != nil {
+		t.Errorf("expected no operations, got %+v", body)
+	}
+
+	start := time.Now().UTC().Add(-time.Second)
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+
+	body := get()
+	if body.LastSuccess == nil || body.LastSuccess.Operation != "present" || body.LastSuccess.FQDN != challenge.ResolvedFQDN {
+		t.Fatalf("expected last success of present, got %+v", body.LastSuccess)
+	}
+	if body.LastSuccess.Time.Before(start) {
+		t.Errorf("expected last success after %s, got %s", start, body.LastSuccess.Time)
+	}
+	if body.LastFailure != nil {
+		t.Errorf("expected no failure, got %+v", body.LastFailure)
+	}
+
+	// Presenting the same record again fails and keeps the last success
+	if err := solver.Present(challenge); err == nil {
+		t.Fatal("expected second present to fail")
+	}
+
+	body = get()
+	if body.LastFailure == nil || body.LastFailure.Operation != "present" || body.LastFailure.Error != ErrTextRecordAlreadyExists.Error() {
+		t.Fatalf("expected last failure of present, got %+v", body.LastFailure)
+	}
+	if body.LastSuccess == nil || body.LastSuccess.Operation != "present" {
+		t.Errorf("expected last success to be kept, got %+v", body.LastSuccess)
+	}
+}
+
+func TestOperationStatusNil(t *testing.T) {
+	var status *operationStatus
+	status.record("present", "_acme-challenge.example.com.", nil, time.Now())
+
+	if body := status.snapshot(); body.Status != "ok" || body.LastSuccess != nil {
+		t.Errorf("expected an empty status, got %+v", body)
+	}
+}
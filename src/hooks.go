@@ -0,0 +1,95 @@
+/*
+This file provides the hooks of the lifecycle of a challenge, for custom integrations such as audit logging or
+external notifications. A hook is called with a HookEvent at each stage of Present and CleanUp:
+
+	branch-created         the bot branch exists, either created or reused
+	file-updated           the zone file was written to the bot branch
+	merge-request-created  the merge request was created, MergeRequestIID is set
+	merged                 the merge request was merged, MergeRequestIID is set
+	error                  Present or CleanUp failed, Err is set
+
+A build registers its hooks in an init function of a file of its own, e.g.
+
+	func init() {
+		RegisterHook(func(event HookEvent) {
+			if event.Stage == HookMerged {
+				notify(event.FQDN, event.MergeRequestIID)
+			}
+		})
+	}
+
+The hooks are called synchronously in the order of their registration, so they should return quickly. A panic
+in a hook is logged and does not fail the challenge. The default hook logs the events at debug level.
+*/
+package main
+
+import (
+	"log/slog"
+)
+
+// HookStage is a stage of the lifecycle of a challenge
+type HookStage string
+
+const (
+	HookBranchCreated       HookStage = "branch-created"
+	HookFileUpdated         HookStage = "file-updated"
+	HookMergeRequestCreated HookStage = "merge-request-created"
+	HookMerged              HookStage = "merged"
+	HookError               HookStage = "error"
+)
+
+// HookEvent is passed to the hooks at every stage
+type HookEvent struct {
+	Stage HookStage
+
+	// FQDN is the resolved FQDN of the challenge and Action is "present" or "cleanup"
+	FQDN   string
+	Action string
+
+	// MergeRequestIID is the IID of the merge request, or 0 before it was created
+	MergeRequestIID int
+
+	// Err is the error of Present or CleanUp for the error stage
+	Err error
+}
+
+// Hook is called at every stage of a challenge
+type Hook func(event HookEvent)
+
+// registeredHooks are the hooks of every solver created by newGitSolver
+var registeredHooks = []Hook{logHook}
+
+// RegisterHook adds the hook to the solvers created afterwards, it must be called from an init function.
+func RegisterHook(hook Hook) {
+	registeredHooks = append(registeredHooks, hook)
+}
+
+// logHook logs the events at debug level
+func logHook(event HookEvent) {
+	slog.Debug("challenge stage reached", "stage", event.Stage, "action", event.Action, "fqdn", event.FQDN, "id", event.MergeRequestIID, "error", event.Err)
+}
+
+// fire calls the hooks of the solver with the event.
+func (h *gitSolver) fire(event HookEvent) {
+	for _, hook := range h.hooks {
+		callHook(hook, event)
+	}
+}
+
+// callHook calls the hook, a panic is logged instead of failing the challenge.
+func callHook(hook Hook, event HookEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("hook panicked", "stage", event.Stage, "fqdn", event.FQDN, "panic", r)
+		}
+	}()
+
+	hook(event)
+}
+
+// mergeHook returns the MergeConfig.Notify function firing the merge request stages of the challenge.
+func (h *gitSolver) mergeHook(action string, fqdn string) func(HookStage, int) {
+	return func(stage HookStage, iid int) {
+		h.fire(HookEvent{Stage: stage, FQDN: fqdn, Action: action, MergeRequestIID: iid})
+	}
+}
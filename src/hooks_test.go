@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestHooks(t *testing.T) {
+	_, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+
+	events := []HookEvent{}
+	solver.hooks = []Hook{
+		func(event HookEvent) { panic("broken hook") },
+		func(event HookEvent) { events = append(events, event) },
+	}
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if err := solver.CleanUp(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if err := solver.CleanUp(challenge); err == nil {
+		t.Fatal("expected second cleanup to fail")
+	}
+
+	want := []HookEvent{
+		{Stage: HookBranchCreated, Action: "present"},
+		{Stage: HookFileUpdated, Action: "present"},
+		{Stage: HookMergeRequestCreated, Action: "present", MergeRequestIID: 1},
+		{Stage: HookMerged, Action: "present", MergeRequestIID: 1},
+		{Stage: HookBranchCreated, Action: "cleanup"},
+		{Stage: HookFileUpdated, Action: "cleanup"},
+		{Stage: HookMergeRequestCreated, Action: "cleanup", MergeRequestIID: 2},
+		{Stage: HookMerged, Action: "cleanup", MergeRequestIID: 2},
+		{Stage: HookError, Action: "cleanup", Err: ErrTextRecordDoesNotExist},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %d: %+v", len(want), len(events), events)
+	}
+	for i, event := range events {
+		if event.Stage != want[i].Stage || event.Action != want[i].Action || event.MergeRequestIID != want[i].MergeRequestIID {
+			t.Errorf("expected event %d to be %+v, got %+v", i, want[i], event)
+		}
+		if event.FQDN != challenge.ResolvedFQDN {
+			t.Errorf("expected FQDN %q in event %d, got %q", challenge.ResolvedFQDN, i, event.FQDN)
+		}
+		if !errors.Is(event.Err, want[i].Err) {
+			t.Errorf("expected error %v in event %d, got %v", want[i].Err, i, event.Err)
+		}
+	}
+}
+
+func TestRegisterHook(t *testing.T) {
+	defer func(hooks []Hook) { registeredHooks = hooks }(slices.Clone(registeredHooks))
+
+	called := false
+	RegisterHook(func(event HookEvent) { called = true })
+
+	newGitSolver().fire(HookEvent{Stage: HookMerged})
+	if !called {
+		t.Error("expected the registered hook to be called")
+	}
+}
@@ -0,0 +1,85 @@
+/*
+This file provides the validation of the key of a challenge before it is written to the zone file, so that a
+malformed challenge cannot corrupt the zone file. KEY_VALIDATION defines how strict the check is:
+
+  - basic (default): the key must not be empty.
+  - charset: the key must consist of the base64url characters A-Z, a-z, 0-9, "-" and "_" and be at most
+    maxKeyLength characters long, which rules out quotes, whitespace and semicolons breaking the record.
+  - strict: the key must be exactly what cert-manager passes for DNS-01, the unpadded base64url encoding of a
+    SHA-256 digest, i.e. 43 base64url characters.
+
+Only Present checks the key, CleanUp still removes the records written before the check was tightened. The keys of
+other record types than TXT are written verbatim and are not base64url, so charset and strict require RECORD_TYPE
+TXT.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// KeyValidation defines how strictly the key of a challenge is checked
+type KeyValidation string
+
+const (
+	KeyValidationBasic   KeyValidation = "basic"
+	KeyValidationCharset KeyValidation = "charset"
+	KeyValidationStrict  KeyValidation = "strict"
+)
+
+const (
+	// maxKeyLength is the maximum length of a key with KEY_VALIDATION charset
+	maxKeyLength = 512
+
+	// acmeKeyLength is the length of the unpadded base64url encoding of a SHA-256 digest
+	acmeKeyLength = 43
+)
+
+var ErrInvalidKeyValidation = errors.New("invalid key validation")
+
+// base64URLRegex matches the keys consisting of base64url characters without padding
+var base64URLRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ParseKeyValidation parses the given string into a KeyValidation. An empty string defaults to KeyValidationBasic.
+func ParseKeyValidation(s string) (KeyValidation, error) {
+	switch KeyValidation(strings.ToLower(s)) {
+	case "", KeyValidationBasic:
+		return KeyValidationBasic, nil
+	case KeyValidationCharset:
+		return KeyValidationCharset, nil
+	case KeyValidationStrict:
+		return KeyValidationStrict, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidKeyValidation, s)
+}
+
+// validateKey checks the key of a challenge against KEY_VALIDATION. The key itself is not part of the error, as
+// it is a secret of the challenge.
+func (h *gitSolver) validateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("%w: key is required", ErrInvalidRecord)
+	}
+
+	switch h.keyValidation {
+	case KeyValidationCharset:
+		if len(key) > maxKeyLength {
+			return fmt.Errorf("%w: key has %d characters, at most %d are allowed", ErrInvalidRecord, len(key), maxKeyLength)
+		}
+	case KeyValidationStrict:
+		if len(key) != acmeKeyLength {
+			return fmt.Errorf("%w: key has %d characters, an ACME DNS-01 key has %d", ErrInvalidRecord, len(key), acmeKeyLength)
+		}
+	default:
+		return nil
+	}
+
+	if !base64URLRegex.MatchString(key) {
+		return fmt.Errorf("%w: key contains characters outside of the base64url alphabet", ErrInvalidRecord)
+	}
+
+	return nil
+}
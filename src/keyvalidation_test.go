@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+// acmeKey is a key like cert-manager passes for DNS-01, the base64url encoded SHA-256 digest of a key authorization
+const acmeKey = "LoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0"
+
+func TestParseKeyValidation(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  KeyValidation
+		err   bool
+	}{
+		{input: "", want: KeyValidationBasic},
+		{input: "basic", want: KeyValidationBasic},
+		{input: "Charset", want: KeyValidationCharset},
+		{input: "strict", want: KeyValidationStrict},
+		{input: "paranoid", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseKeyValidation(tc.input)
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+			if tc.err != (err != nil) {
+				t.Errorf("expected error %t, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestValidateKey(t *testing.T) {
+	testCases := []struct {
+		name       string
+		validation KeyValidation
+		key        string
+		err        bool
+	}{
+		{name: "basic acme key", validation: KeyValidationBasic, key: acmeKey},
+		{name: "basic quotes", validation: KeyValidationBasic, key: `wow "so" secret`},
+		{name: "basic empty", validation: KeyValidationBasic, key: "", err: true},
+		{name: "charset acme key", validation: KeyValidationCharset, key: acmeKey},
+		{name: "charset short key", validation: KeyValidationCharset, key: "wow-so_secret"},
+		{name: "charset quote", validation: KeyValidationCharset, key: `wow"secret`, err: true},
+		{name: "charset semicolon", validation: KeyValidationCharset, key: "wow;secret", err: true},
+		{name: "charset whitespace", validation: KeyValidationCharset, key: "wow secret", err: true},
+		{name: "charset padding", validation: KeyValidationCharset, key: acmeKey + "=", err: true},
+		{name: "charset too long", validation: KeyValidationCharset, key: strings.Repeat("a", maxKeyLength+1), err: true},
+		{name: "strict acme key", validation: KeyValidationStrict, key: acmeKey},
+		{name: "strict short key", validation: KeyValidationStrict, key: "wow-so-secret", err: true},
+		{name: "strict standard base64", validation: KeyValidationStrict, key: "LoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEu+/", err: true},
+		{name: "strict empty", validation: KeyValidationStrict, key: "", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &gitSolver{keyValidation: tc.validation}
+
+			err := h.validateKey(tc.key)
+			if tc.err != (err != nil) {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidRecord) {
+				t.Errorf("expected %v, got %v", ErrInvalidRecord, err)
+			}
+		})
+	}
+}
+
+func TestPresentRejectsMalformedKey(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	solver.keyValidation = KeyValidationStrict
+
+	malformed := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: `"; injected`}
+	if err := solver.Present(malformed); !errors.Is(err, ErrInvalidRecord) {
+		t.Fatalf("expected %v, got %v", ErrInvalidRecord, err)
+	}
+	if len(fake.commits) != 0 || strings.Contains(fake.content("main"), "injected") {
+		t.Errorf("expected the zone file to be left alone, got %q", fake.content("main"))
+	}
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: acmeKey}
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(fake.content("main"), acmeKey) {
+		t.Errorf("expected the record in the zone file, got %q", fake.content("main"))
+	}
+}
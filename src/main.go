@@ -1,11 +1,106 @@
 // This application requires the following environment variables to be set:
 // - GITLAB_TOKEN: The token used for authenticating with the GitLab API.
-// - GITLAB_URL: The URL of the GitLab instance.
+// - GITLAB_URL: The URL of the GitLab instance (default: CI_SERVER_URL inside GitLab CI).
 // - GITLAB_TARGET_BRANCH: The branch the bot will create merge requests against.
 // - GITLAB_BOT_BRANCH: The branch the bot will use to create merge requests.
 // - GITLAB_BOT_COMMENT_PREFIX: The prefix used to identify the ACME-BOT comments in the zone file.
 // - GITLAB_PATH: The path within the GitLab repository.
 // - GITLAB_FILE: The specific file within the GitLab repository.
+// Each of them can also be read from the file named by the variable with a _FILE suffix, e.g. GITLAB_TOKEN_FILE.
+//
+// The following environment variables are optional:
+// - ROOT_DOMAIN: The root domain removed from the challenge FQDN before it is written to the zone file.
+// - RECORD_NAME_SUFFIX: A fixed suffix appended to the owner name of the records after removing the ROOT_DOMAIN.
+// - ZONE_RELATIVE_NAMES: Make the owner names relative to the zone resolved by cert-manager instead of ROOT_DOMAIN, which remains the fallback (default: false).
+// - TXT_VALUE_FORMAT: How the key is written, one of "quoted" (default, split into 255-byte strings if longer) or "unquoted".
+// - RECORD_TYPE: The RR type of the records, for experimental challenge schemes other than DNS-01, e.g. "CAA" (default "TXT"). The key of other types is written verbatim.
+// - KEY_VALIDATION: How strictly Present checks the key of a challenge, one of "basic" (default, not empty), "charset" (base64url characters) or "strict" (43 base64url characters, like an ACME DNS-01 key).
+// - TXT_QUOTE_STYLE: The quotes of the key for legacy zone tooling, one of "double" (default), "none" or "single". Takes over TXT_VALUE_FORMAT.
+// - ACME_BOT_BEGIN_MARKER, ACME_BOT_END_MARKER: Regexes of custom markers of the managed block, replacing GITLAB_BOT_COMMENT_PREFIX.
+// - CREATE_MARKERS_IF_MISSING: Insert and merge an empty -ACME-BOT block if the zone file has none (default false).
+// - MARKERS_POSITION: Where the missing -ACME-BOT block is inserted, one of "end" (default) or "after-soa".
+// - GITLAB_EXTRA_FILES: Comma separated zone files, e.g. the other views of a split-horizon zone, that get the same records in the same commit as GITLAB_FILE, see multifile.go.
+// - GITLAB_SERIAL_FILE: The file with the SOA record whose serial number is increased, if GITLAB_FILE is included by it (default: GITLAB_FILE).
+// - GITLAB_BOT_BRANCH_TEMPLATE: A go template for a bot branch per challenge, e.g. "acme-bot/{{.ZoneSafe}}/{{.Hash}}", see branchtemplate.go.
+// - TARGET_BRANCH_MISSING: What to do if GITLAB_TARGET_BRANCH does not exist, one of "fail" (default) or "create" to create it from the default branch.
+// - GITLAB_FORK_PATH: The project the bot branch is pushed to, e.g. a fork of GITLAB_PATH, the merge requests target GITLAB_PATH.
+// - OWNER_NAME_CASE: The case of the owner names written to the zone file, one of "preserve" (default) or "lower".
+// - GITLAB_API_URL: The full base URL of the GitLab API including its path, replaces GITLAB_URL if the API is not served from /api/v4.
+// - GITLAB_EXTRA_HEADERS: Comma separated name=value pairs of HTTP headers sent with every GitLab API request, e.g. for a WAF in front of GitLab.
+// - GITLAB_RATE_LIMIT: The maximum number of requests per second to the GitLab API (default: no client-side limit).
+// - GITLAB_RATE_LIMIT_BURST: The number of requests that may be sent at once before GITLAB_RATE_LIMIT applies (default: the rate rounded up).
+// - GITLAB_CIRCUIT_BREAKER_THRESHOLD: Fail challenges fast after this many consecutive challenges found GitLab unreachable (default: disabled).
+// - GITLAB_CIRCUIT_BREAKER_COOLDOWN: How long challenges fail fast before GitLab is probed again (default 30s).
+// - STATUS_CALLBACK_URL: Post the outcome of every Present and CleanUp as JSON to this URL (default: disabled).
+// - STATUS_CALLBACK_TIMEOUT: The timeout of an attempt to post to STATUS_CALLBACK_URL (default 10s).
+// - STATUS_CALLBACK_RETRIES: How often a failed post to STATUS_CALLBACK_URL is retried (default 2).
+// - RECONSTRUCT_FROM_BRANCH: The branch the records are read from on startup (default: GITLAB_TARGET_BRANCH).
+// - GITLAB_HTTP_TIMEOUT: The timeout of a single request to the GitLab API (default 30s).
+// - ZONE_CHANGELOG_TEMPLATE: A go template for a line appended to the changelog block on every change, e.g. "{{.Time}} {{.Action}} {{.FQDN}}".
+// - RECORD_COMMENT_TEMPLATE: A go template for a comment written before every added record, e.g. "added at {{.Time}} for {{.DNSName}}".
+// - RECORD_COMMENT_ISSUER: Write a comment with the issuer from the webhook config, the namespace and the challenge UID before every added record, for audits (default false).
+// - SHARED_RECORD_NAME: Write all records under this owner name and match them by key, for delegated challenge zones.
+// - UNIQUE_RECORD_NAME: Append a suffix derived from the challenge to the first label of the owner name (default false).
+// - MERGE_REQUEST_TIMEOUT: How long to wait for a merge request to become mergeable (default 60s).
+// - PRESENT_RETRIES: How often Present runs its whole pipeline again after a transient failure, from a fresh read of the zone file (default 0).
+// - PRESENT_RETRY_DELAY: The delay before Present runs its pipeline again (default 5s).
+// - CHALLENGE_TIMEOUT: The time budget of a challenge bounding all waits, unless the webhook config of the issuer sets a timeout (default: disabled).
+// - MERGE_REQUEST_REBASE: Rebase a merge request that fell behind the target branch with the rebase API and merge it once mergeable, otherwise it fails (default true).
+// - MERGE_REQUEST_MIN_INTERVAL: The minimum interval between two merge request creations in a project, for GitLab's merge request creation limits (default: disabled).
+// - MERGE_REQUEST_POLL_JITTER: The maximum random delay added to every check of the merge status, to spread the checks of concurrent challenges (default: disabled).
+// - MISSING_PIPELINE: Whether to "fail" (default) or "ignore" if a merge request requiring a pipeline has none after MISSING_PIPELINE_GRACE (default 30s).
+// - MERGE_REQUEST_APPROVALS_MODE: Whether to "fail" (default) or "wait" if a merge request needs more approvals than the bot can give.
+// - MERGE_REQUEST_SELF_APPROVAL_MODE: Whether to "fail" (default), "skip" the approval or "wait" for another approver if the bot may not approve its own merge requests.
+// - GITLAB_MERGE_METHOD: The merge method of the project, one of "merge" (default), "rebase_merge", "ff" or "auto".
+// - GITLAB_MERGE_SQUASH: Squash the commits of the bot branch when merging (default false).
+// - GITLAB_COMMIT_AUTHOR_NAME, GITLAB_COMMIT_AUTHOR_EMAIL: The author of the commits of the webhook (default: the user of GITLAB_TOKEN).
+// - GITLAB_COMMIT_MESSAGE_PREFIX: A prefix of the commit messages, e.g. "[staging]", to tell the commits of deployments apart.
+// - GITLAB_WRITE_ENCODING: How the zone files are sent to GitLab, "text" (default) or "base64" for files with characters the API mangles.
+// - MERGE_REQUEST_DRAFT: Create the merge requests as drafts and mark them as ready before merging, after the VERIFY_AFTER_MERGE check of the bot branch (default false).
+// - GITLAB_MERGE_REQUEST_LABELS: Comma separated labels of the merge requests (default "acme-bot"), an "acme:<zone>" label is always added.
+// - STATE_CONFIGMAP_NAME: Checkpoint the presented records into this ConfigMap to share them between replicas.
+// - STATE_CONFIGMAP_NAMESPACE: The namespace of the state ConfigMap (default: the namespace of the pod).
+// - DISABLE_RECORD_CACHE: Decide whether a record exists from the zone file on every call instead of the in-memory records, for several replicas (default false).
+// - VERIFY_AFTER_MERGE: Re-read the target branch after every merge and fail if the record is missing, or still present after a cleanup (default false).
+// - REQUIRE_SERIAL: Fail if the zone file has no serial number, otherwise the record is changed without increasing it (default true).
+// - READ_YOUR_WRITES_TIMEOUT: How long a read waits for the file to reflect the last write of the webhook, for lagging GitLab replicas (default: disabled).
+// - READ_YOUR_WRITES_BY_COMMIT: Write the bot branch through the commits API and read a written file back from the returned commit SHA instead of the branch (default false).
+// - MANAGE_SERIAL: Increase the serial number on every change, disable if the DNS server updates it automatically (default true).
+// - BUMP_SERIAL_ON_CLEANUP: Increase the serial number when removing records, Present always increases it (default true).
+// - SERIAL_BUMP_COOLDOWN: Skip the serial number increase of a cleanup within this duration after the last increase, e.g. "10m" (default: disabled).
+// - CLEANUP_BATCH_WINDOW: Remove the records of the cleanups within this duration in one merge request, e.g. "5s" (default: disabled).
+// - REPLICA_LOCK_BRANCH: A branch used as an advisory lock serializing the writes of several replicas, see replicalock.go (default: disabled).
+// - REPLICA_LOCK_TTL: How long the replica lock is held at most before it is considered stale (default 10m).
+// - SERIAL_STRATEGY: How the serial number is increased, "date" (default) for YYYYMMDDnn or "unixtime" for unix time in seconds.
+// - SERIAL_SIGNING_SECRET: Sign every serial number increase with an HMAC comment and warn about serial numbers changed out of band, also read from SERIAL_SIGNING_SECRET_FILE (default: disabled).
+// - SERIAL_ZONE_SELECTION: Which serial numbers of a zone file with several zones are increased, "all" (default) or "zone" for the zone of the changed records only.
+// - SEPARATE_SERIAL_COMMIT: Increase the serial number in a separate commit after the record change (default false).
+// - ZONE_FILE_NORMALIZE: Convert CRLF to LF, remove trailing whitespace and ensure a single trailing newline when reading the zone file (default false).
+// - MAX_BLOCK_RECORDS: The maximum number of records in the -ACME-BOT block, Present fails instead of adding more (default: disabled).
+// - ZONE_FILE_MAX_SIZE: The maximum size of the zone file in bytes, larger files are rejected (default 16 MiB, 0 disables the limit).
+// - FAIL_ON_FOREIGN_RECORDS: Fail Present if the zone file has a record of the same FQDN with another key that the webhook did not present (default false).
+// - RECORD_SORT: The order of the records in the -ACME-BOT block, one of "none" (default), "name" or "parent" to group them by parent domain.
+// - EMPTY_BLOCK: What happens to the -ACME-BOT block when its last record is removed, one of "keep" (default), "collapse" or "remove".
+// - RECORD_BLOCK_SPACING: Keep exactly one blank line between the -ACME-BOT markers and the records (default false).
+// - CLEANUP_MODE: What CleanUp does with the records, one of "delete" (default), "comment" or "disabled" to leave them for a human.
+// - RECORD_TOMBSTONES: Comment out removed records instead of removing them, for an audit trail in the zone file (default false).
+// - RECORD_TOMBSTONE_NOTE: Append the time of the removal to the commented out records (default false).
+// - ZONE_ROUTES: An ordered YAML list of {pattern, project, file, branch, botBranch, fork, serialFile} rules routing the challenges to other zone files.
+// - ZONE_ROUTES_FALLBACK: Use the default zone file for challenges matching no route instead of failing (default false).
+// - GITLAB_PATH_TEMPLATE: A go template of the zone project by convention, e.g. "dns/{{.Team}}-dns", replacing GITLAB_PATH, see projecttemplate.go.
+// - ZONE_MIRRORS: A YAML list of {name, url, apiURL, tokenEnv, project, file, branch, botBranch} GitLab instances the records are mirrored to.
+// - MIRROR_QUORUM: The number of instances, including the primary one, on which Present and CleanUp must succeed (default 1).
+// - ALLOWED_DOMAINS: Comma separated domains, challenges for other domains than these and their subdomains are refused (default: all domains).
+// - ZONE_FORMAT: The format of the zone file, one of "bind" (default), "yaml" or "json".
+// - ZONE_SERIAL_PATH: The dot separated path of the serial number in a yaml or json zone file (default "serial").
+// - ZONE_RECORDS_PATH: The dot separated path of the list of records managed by the webhook in a yaml or json zone file (default "acme-bot").
+// - ZONE_RECORD_ENTRY: The fields of the entries of the records list, one of "typed" (default) for {name, type, value} or "name-value" for data files of TXT records.
+// - SOLVER_NAME: The name of the solver, referenced by the solverName in the webhook config of the issuers (default "git-solver").
+// - HEALTH_ADDR: The address of the health server reporting the last successful and failed operation on /healthz, e.g. ":8081" (default disabled).
+// - SHUTDOWN_GRACE_PERIOD: How long to wait for the challenges in flight to finish when stopping (default 25s).
+// - LAZY_INIT: Do not contact GitLab in Initialize, but create the bot branch and read the zone file on the first challenge (default false).
+// - WEBHOOK_CLEANUP_FQDN: Run in maintenance mode, remove the records of this FQDN and exit instead of starting the server.
+// - WEBHOOK_CLEANUP_KEY: Only remove the record with this key in maintenance mode.
 
 package main
 
@@ -14,27 +109,43 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
 	"regexp"
-	"strconv"
+	"slices"
 	"strings"
 	"sync"
+	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/cert-manager/cert-manager/pkg/acme/webhook"
 	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
 	"github.com/cert-manager/cert-manager/pkg/acme/webhook/cmd"
+	"github.com/kallepan/cert-manager-webhook/src/zone"
 	"github.com/xanzy/go-gitlab"
 	"k8s.io/client-go/rest"
 )
 
+// acmeChallengeOwnerPattern matches the owner names of the _acme-challenge TXT records, including the suffix of
+// UNIQUE_RECORD_NAME, see uniqueNameSuffixLength
+const acmeChallengeOwnerPattern = `_acme-challenge(?:-[0-9a-f]{8})?\..*?`
+
+// Precompiled regexes for the _acme-challenge TXT records with quoted, unquoted and single-quoted values
+var (
+	txtRecordRegex             = regexp.MustCompile(zone.TxtRecordPattern(acmeChallengeOwnerPattern, false))
+	unquotedTxtRecordRegex     = regexp.MustCompile(zone.TxtRecordPattern(acmeChallengeOwnerPattern, true))
+	singleQuotedTxtRecordRegex = regexp.MustCompile(zone.SingleQuotedTxtRecordPattern(acmeChallengeOwnerPattern))
+)
+
 // Define Errors
 var (
 	ErrTextRecordAlreadyExists = errors.New("txt record already exists")
-	ErrTextRecordsDoNotExist   = errors.New("txt records do not exist")
+	ErrTextRecordsDoNotExist   = zone.ErrTxtRecordsNotFound
 	ErrTextRecordDoesNotExist  = errors.New("txt record does not exist")
-	ErrACMEBotContentNotFound  = errors.New("-ACME-BOT comments not found")
-	ErrSerialNumberNotFound    = errors.New("serial number not found")
+	ErrACMEBotContentNotFound  = zone.ErrBlockNotFound
+	ErrSerialNumberNotFound    = zone.ErrSerialNumberNotFound
 
 	ErrGitlabBotCommentPrefixNotDefined = errors.New("GITLAB_BOT_COMMENT_PREFIX not defined in environment variables")
 	ErrGitlabTargetBranchNotDefined     = errors.New("GITLAB_TARGET_BRANCH not defined in environment variables")
@@ -46,7 +157,11 @@ var (
 )
 
 var (
-	timeToSleepBeforeMergeRequestCheck = 15 * time.Second
+	// defaultGitlabHTTPTimeout is the timeout of a single GitLab API request
+	defaultGitlabHTTPTimeout = 30 * time.Second
+
+	// defaultSolverName is the name referenced by the solverName of the issuers if SOLVER_NAME is not set
+	defaultSolverName = "git-solver"
 
 	// GroupName is the name of the group that the webhook is running in
 	GroupName = os.Getenv("GROUP_NAME")
@@ -55,12 +170,25 @@ var (
 	SecretRefName = os.Getenv("SECRET_REF_NAME")
 )
 
+// Creates a new GitLab client whose requests time out after the given duration and carry the extra headers
+func NewGitlabClient(token string, baseURL string, timeout time.Duration, headers http.Header, options ...gitlab.ClientOptionFunc) (*gitlab.Client, error) {
+	httpClient := &http.Client{
+		Timeout:   timeout,
+		Transport: withExtraHeaders(http.DefaultTransport, headers),
+	}
+
+	options = append([]gitlab.ClientOptionFunc{gitlab.WithBaseURL(baseURL), gitlab.WithHTTPClient(httpClient)}, options...)
+	return gitlab.NewClient(token, options...)
+}
+
 // Creates a target branch if it does not exist
 func CreateBranch(git *gitlab.Client, projectPath string, branch string, ref string) error {
 	// Check if target branch exists
 	_, _, err := git.Branches.GetBranch(projectPath, ref)
+	if errors.Is(err, gitlab.ErrNotFound) {
+		return fmt.Errorf("%w: %s of %s: %w", ErrTargetBranchNotFound, ref, projectPath, err)
+	}
 	if err != nil {
-		slog.Error("target branch does not exist", "branch", ref)
 		return err
 	}
 
@@ -85,41 +213,6 @@ func CreateBranch(git *gitlab.Client, projectPath string, branch string, ref str
 	return err
 }
 
-// Creates a merge request and auto-approves it and merges it
-func Merge(git *gitlab.Client, projectPath string, sourceBranch string, targetBranch string, title string, description string) error {
-	// Create a merge request
-	cm := &gitlab.CreateMergeRequestOptions{
-		Title:        gitlab.Ptr(title),
-		Description:  gitlab.Ptr(description),
-		SourceBranch: gitlab.Ptr(sourceBranch),
-		TargetBranch: gitlab.Ptr(targetBranch),
-	}
-	mr, _, err := git.MergeRequests.CreateMergeRequest(projectPath, cm)
-	if err != nil {
-		return err
-	}
-
-	slog.Info("merge request created", "id", mr.IID, "sleeping for some time before approval", timeToSleepBeforeMergeRequestCheck)
-	time.Sleep(timeToSleepBeforeMergeRequestCheck)
-	slog.Info("waking up, approving merge request", "id", mr.IID)
-
-	// Auto Approve the merge request
-	_, _, err = git.MergeRequestApprovals.ApproveMergeRequest(projectPath, mr.IID, &gitlab.ApproveMergeRequestOptions{})
-	if err != nil {
-		return err
-	}
-
-	// Merge the request
-	_, _, err = git.MergeRequests.AcceptMergeRequest(projectPath, mr.IID, &gitlab.AcceptMergeRequestOptions{
-		ShouldRemoveSourceBranch: gitlab.Ptr(false), // Default should be false but just to be explicit
-	})
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func ReadZoneFile(git *gitlab.Client, branch string, path string, filePath string) (string, error) {
 	cf := &gitlab.GetFileOptions{
 		Ref: gitlab.Ptr(branch),
@@ -139,12 +232,9 @@ func ReadZoneFile(git *gitlab.Client, branch string, path string, filePath strin
 	return string(data), nil
 }
 
-func UpdateZoneFile(git *gitlab.Client, branch string, projectPath string, filePath string, content string, cm string) error {
-	uf := &gitlab.UpdateFileOptions{
-		Branch:        gitlab.Ptr(branch),
-		Content:       gitlab.Ptr(content),
-		CommitMessage: gitlab.Ptr(cm),
-	}
+// Commits the content to the file of the branch with the identity of the commit config
+func UpdateZoneFile(git *gitlab.Client, branch string, projectPath string, filePath string, content string, cm string, commit CommitConfig) error {
+	uf := commit.updateFileOptions(branch, content, cm)
 	_, _, err := git.RepositoryFiles.UpdateFile(projectPath, filePath, uf)
 
 	return err
@@ -155,8 +245,20 @@ func UpdateZoneFile(git *gitlab.Client, branch string, projectPath string, fileP
 // To do so, it must implement the `github.com/cert-manager/cert-manager/pkg/acme/webhook.Solver`
 // interface.
 type gitSolver struct {
-	name       string
-	txtRecords map[string]string
+	name string
+
+	// txtRecords maps the ID of the presented records to their key, see recordID
+	txtRecords       map[string]string
+	sharedRecordName string
+
+	// uniqueRecordNames appends a suffix derived from the challenge to the owner names, see uniquename.go
+	uniqueRecordNames bool
+
+	// store persists txtRecords if configured, see store.go
+	store RecordStore
+
+	// recordCacheDisabled makes Present and CleanUp decide from the zone file instead of txtRecords, see recordcache.go
+	recordCacheDisabled bool
 
 	gitClient           *gitlab.Client
 	gitBotCommentPrefix string
@@ -165,7 +267,203 @@ type gitSolver struct {
 	gitPath             string
 	gitFile             string
 
-	sync.RWMutex
+	// gitSerialFile holds the serial number if the records are written to an included file, see serialfile.go
+	gitSerialFile string
+
+	// gitExtraFiles are written together with gitFile in a single commit, see multifile.go
+	gitExtraFiles []string
+
+	// botBranchTemplate renders a bot branch per challenge that replaces gitBotBranch while the challenge holds
+	// the zone lock, see branchtemplate.go
+	botBranchTemplate *template.Template
+
+	// missingTargetBranch defines whether a missing gitTargetBranch fails or is created, see targetbranch.go
+	missingTargetBranch MissingTargetBranch
+
+	// gitForkPath is the project of the bot branch if the bot may only push to a fork of gitPath, see fork.go
+	gitForkPath string
+
+	// createMarkers inserts a missing -ACME-BOT block at markersPosition, see markerblock.go
+	createMarkers   bool
+	markersPosition MarkersPosition
+
+	// acmeBotBeginMarker and acmeBotEndMarker replace the markers derived from gitBotCommentPrefix if set, see markers.go
+	acmeBotBeginMarker string
+	acmeBotEndMarker   string
+
+	mergeConfig MergeConfig
+
+	// commitConfig is the author and message prefix of the commits, see commit.go
+	commitConfig CommitConfig
+
+	txtValueFormat        ValueFormat
+	recordType            string
+	ownerNameCase         OwnerNameCase
+	recordCommentTemplate *template.Template
+
+	// keyValidation defines how strictly Present checks the key of a challenge, see keyvalidation.go
+	keyValidation KeyValidation
+
+	// changelogTemplate renders the line appended to the changelog block on every change, see changelog.go
+	changelogTemplate *template.Template
+
+	// zoneRelativeNames makes the owner names relative to the ResolvedZone of the challenges, see origin.go
+	zoneRelativeNames bool
+
+	// normalizeZoneFile normalizes line endings and trailing whitespace of the zone file, see zonefile.go
+	normalizeZoneFile bool
+
+	// maxBlockRecords is the maximum number of records in the -ACME-BOT block, zero disables the limit, see
+	// recordlimit.go
+	maxBlockRecords int
+
+	// zoneFileMaxSize is the maximum size of a read file in bytes, zero disables the limit
+	zoneFileMaxSize int
+
+	// optionalSerial skips the serial number increase of zone files without a serial number instead of failing
+	optionalSerial bool
+
+	// keepSerialOnCleanup removes records without increasing the serial number
+	keepSerialOnCleanup bool
+
+	// cleanupBatchWindow collects the cleanups of this duration into cleanupBatch, which is guarded by
+	// cleanupBatchLock and removed in one merge request, see cleanupbatch.go
+	cleanupBatchWindow time.Duration
+	cleanupBatch       []*pendingCleanup
+	cleanupBatchLock   sync.Mutex
+
+	// serialStrategy defines how the serial number is increased, see serialstrategy.go
+	serialStrategy SerialStrategy
+
+	// serialZoneSelection selects the serial numbers of a zone file with several zones to increase, serialZones
+	// holds the zones of the current operation, see zoneserial.go
+	serialZoneSelection SerialZoneSelection
+	serialZones         []string
+
+	// serialSigningSecret signs the serial numbers written by the webhook, see serialsignature.go
+	serialSigningSecret string
+
+	// serialBumpCooldown skips the serial number increase of a cleanup within this duration after lastSerialBump,
+	// which is guarded by zoneLock, see serialcooldown.go
+	serialBumpCooldown time.Duration
+	lastSerialBump     time.Time
+
+	// challengeTimeout is the default budget of a challenge. deadline is the deadline of the challenge holding
+	// the zone lock, which bounds all waits, and is guarded by deadlineLock, see budget.go.
+	challengeTimeout time.Duration
+	deadline         time.Time
+	deadlineLock     sync.Mutex
+
+	// presentRetries is how often Present runs its pipeline again after a transient failure, see pipelineretry.go
+	presentRetries    int
+	presentRetryDelay time.Duration
+
+	// readYourWritesTimeout bounds how long a read waits for the last write of the webhook, see consistency.go.
+	// readExpectations holds what the next read of a file is expected to return and is guarded by expectationsLock.
+	readYourWritesTimeout time.Duration
+	readExpectations      map[string]*readExpectation
+	expectationsLock      sync.Mutex
+
+	// readByCommit reads a file written to the bot branch from the commit of the write, whose SHA is kept in
+	// readRefs until the next read and guarded by expectationsLock, see commitref.go
+	readByCommit bool
+	readRefs     map[string]string
+
+	// unmanagedSerial never changes the serial number, as the DNS server updates it automatically
+	unmanagedSerial bool
+
+	// separateSerialCommit writes the serial number increase as a separate commit
+	separateSerialCommit bool
+
+	// verifyAfterMerge re-reads the target branch after every merge to check the change, see verify.go
+	verifyAfterMerge bool
+
+	// reconstructBranch is the branch the records are read from when they are reconstructed, see syncRecords.
+	// It defaults to the target branch, so that the initial view matches the records that are live in DNS.
+	reconstructBranch string
+
+	// failOnForeignRecords fails Present if the zone file has an unknown record of the same FQDN, see foreign.go
+	failOnForeignRecords bool
+
+	// recordSort defines the order of the records in the -ACME-BOT block, see recordsort.go
+	recordSort RecordSort
+
+	// emptyBlock defines whether an -ACME-BOT block without records is kept, collapsed or removed, see emptyblock.go
+	emptyBlock EmptyBlockMode
+
+	// recordBlockSpacing keeps one blank line between the markers and the records of the -ACME-BOT block, see spacing.go
+	recordBlockSpacing bool
+
+	// recordTombstones comments out removed records instead of removing them, with a note if recordTombstoneNote
+	// is set, see tombstone.go
+	recordTombstones    bool
+	recordTombstoneNote bool
+
+	// cleanupMode defines what CleanUp does with the records, see cleanupmode.go
+	cleanupMode CleanupMode
+
+	// structuredZone edits the zone file as YAML or JSON instead of BIND text if set, see zone_structured.go
+	structuredZone *structuredZone
+
+	// routes dispatch the challenges to the solvers of other zone files, see routes.go.
+	// The challenges matching no route fail unless routeFallback is set.
+	routes        []zoneRoute
+	routeFallback bool
+
+	// projectTemplate renders the zone project of the challenges instead of gitPath, the solvers of the rendered
+	// projects are kept in projectRoutes, see projecttemplate.go
+	projectTemplate   *template.Template
+	projectRoutes     map[string]*gitSolver
+	projectRoutesLock sync.Mutex
+
+	// mirrors apply the challenges to several GitLab instances, of which mirrorQuorum must succeed, see mirrors.go
+	mirrors      []zoneMirror
+	mirrorQuorum int
+
+	// breaker fails the challenges fast while GitLab is unreachable, see breaker.go
+	breaker *circuitBreaker
+
+	// status holds the last successful and failed operation for the health server, see health.go
+	status *operationStatus
+
+	// hooks are called at every stage of a challenge, see hooks.go
+	hooks []Hook
+
+	// statusCallback posts the outcome of every operation, see statuscallback.go
+	statusCallback *statusCallback
+
+	// allowedDomains restricts the challenges to these domains and their subdomains, see domains.go
+	allowedDomains []string
+
+	// acmeBotContentRegex and sharedTxtRecordRegex depend on the configuration and are compiled once in
+	// Initialize, see compilePatterns
+	acmeBotContentRegex  *regexp.Regexp
+	sharedTxtRecordRegex *regexp.Regexp
+
+	// replicaLockBranch is the branch of the advisory lock serializing the writes of several replicas, which
+	// expires after replicaLockTTL, see replicalock.go
+	replicaLockBranch string
+	replicaLockTTL    time.Duration
+
+	// recordsLock guards txtRecords and is only held for map access, so that slow GitLab calls never block
+	// lookups of txtRecords, e.g. of repeated Present calls.
+	// zoneLock serializes the whole write of a challenge, from the read of the zone file to the merge of the
+	// shared bot branch and its verification. All writes go through the same bot branch and merge request, so
+	// the writes of distinct FQDNs run one after another and only the lookups overlap with them.
+	recordsLock sync.RWMutex
+	zoneLock    sync.Mutex
+
+	// synced reports whether the records were reconstructed from the zone file, see syncRecords.
+	// It is false until the first challenge if LAZY_INIT is set.
+	syncLock sync.Mutex
+	synced   bool
+
+	// operations tracks the Present and CleanUp calls in flight, which are refused once stopping is set.
+	// shutdownLock guards stopping, so that no operation is added while shutdown waits, see shutdown.go.
+	operations          sync.WaitGroup
+	shutdownLock        sync.Mutex
+	stopping            bool
+	shutdownGracePeriod time.Duration
 }
 
 // Name is used as the name for this DNS solver when referencing it on the ACME
@@ -183,332 +481,1701 @@ func (h *gitSolver) Name() string {
 // This method should tolerate being called multiple times with the same value.
 // cert-manager itself will later perform a self check to ensure that the
 // solver has correctly configured the DNS provider.
-func (h *gitSolver) Present(ch *acme.ChallengeRequest) error {
-	h.Lock()
-	defer h.Unlock()
+func (h *gitSolver) Present(ch *acme.ChallengeRequest) (err error) {
+	if err := h.beginOperation(); err != nil {
+		return err
+	}
+	defer h.endOperation()
 
-	// If the TXT record already exists, return early
-	if _, ok := h.txtRecords[ch.ResolvedFQDN]; ok {
-		return ErrTextRecordAlreadyExists
+	// The solvers of the instances log their own errors
+	if len(h.mirrors) > 0 {
+		present := func(s *gitSolver) error { return s.Present(ch) }
+		exists := func(err error) bool { return errors.Is(err, ErrTextRecordAlreadyExists) }
+		return h.applyMirrored("present", ch.ResolvedFQDN, present, exists)
 	}
 
-	// Create the branch if it does not exist
-	if err := CreateBranch(h.gitClient, h.gitPath, h.gitBotBranch, h.gitTargetBranch); err != nil {
-		return err
+	// The solver of a route logs its own errors
+	route, err := h.route(ch.ResolvedFQDN)
+	if err == nil && route != h {
+		return route.Present(ch)
 	}
 
-	// Read the zone file
-	content, err := ReadZoneFile(h.gitClient, h.gitBotBranch, h.gitPath, h.gitFile)
+	// The request ID correlates the logs of the operation with its commits and merge request
+	requestID := newRequestID()
+	log := slog.With("request_id", requestID)
+	defer func() { h.finishOperation(log, "present", ch.ResolvedFQDN, err) }()
+
 	if err != nil {
 		return err
 	}
 
-	slog.Info("Received challenge request", "fqdn", ch.ResolvedFQDN)
-
-	// Append the new TXT record to the zone file
-	record := NewRecord(ch.ResolvedFQDN, ch.Key)
-	recordStr, err := record.GenerateTextRecord()
-	if err != nil {
+	if err := h.checkDomainAllowed(ch.ResolvedFQDN); err != nil {
 		return err
 	}
 
-	// Add the TXT record to the zone file
-	content, err = addTxtRecord(content, recordStr, h.gitBotCommentPrefix)
+	deadline, err := h.challengeDeadline(ch, time.Now())
 	if err != nil {
 		return err
 	}
 
-	// Increase the serial number of the zone file
-	content, err = h.increaseSerialNumber(content)
-	if err != nil {
+	// Fail fast while GitLab is unreachable
+	if err := h.breaker.allow(); err != nil {
 		return err
 	}
+	defer func() { h.breaker.done(err) }()
 
-	// Update the zone file
-	if err := UpdateZoneFile(h.gitClient, h.gitBotBranch, h.gitPath, h.gitFile, content, fmt.Sprintf("Add TXT record: %s", ch.ResolvedFQDN)); err != nil {
+	if err := h.syncRecords(); err != nil {
 		return err
 	}
 
-	// Create a merge request
-	if err := Merge(h.gitClient, h.gitPath, h.gitBotBranch, h.gitTargetBranch, "Add TXT record", "Add TXT record"); err != nil {
+	// If the TXT record already exists, return early without waiting for the zone lock
+	if err := h.loadRecords(); err != nil {
 		return err
 	}
+	id := h.recordID(ch)
+	if h.cachedRecord(id) {
+		return ErrTextRecordAlreadyExists
+	}
+
+	log.Info("Received challenge request", "fqdn", ch.ResolvedFQDN)
 
-	// Store the TXT record in memory
-	h.txtRecords[ch.ResolvedFQDN] = ch.Key
+	// Validate the TXT record before locking the zone so invalid requests fail fast
+	record := h.newRecord(h.uniqueRecordName(ch.ResolvedFQDN, ch.Key), ch.ResolvedZone, ch.Key)
+	if err := record.Validate(); err != nil {
+		return err
+	}
+	if err := h.validateKey(ch.Key); err != nil {
+		return err
+	}
 
-	slog.Info("Challenge request completed", "fqdn", ch.ResolvedFQDN)
+	return h.retryPipeline(log, "present", deadline, func(retry bool) error {
+		err := h.present(log, ch, id, record, requestID, deadline)
 
-	return nil
+		// A previous attempt added the record before it failed, the record is complete now
+		if retry && errors.Is(err, ErrTextRecordAlreadyExists) {
+			return nil
+		}
+		return err
+	})
 }
 
-// CleanUp should delete the relevant TXT record from the DNS provider console.
-// If multiple TXT records exist with the same record name (e.g.
-// _acme-challenge.example.com) then **only** the record with the same `key`
-// value provided on the ChallengeRequest should be cleaned up.
-// This is in order to facilitate multiple DNS validations for the same domain
-// concurrently.
-func (h *gitSolver) CleanUp(ch *acme.ChallengeRequest) error {
-	h.Lock()
-	defer h.Unlock()
+// present adds the TXT record of the challenge to the zone file of the bot branch and merges it into the target
+// branch, starting from a fresh read of the zone file. It is retried as a whole by Present, see pipelineretry.go.
+func (h *gitSolver) present(log *slog.Logger, ch *acme.ChallengeRequest, id string, record *Record, requestID string, deadline time.Time) error {
+	h.zoneLock.Lock()
+	defer h.zoneLock.Unlock()
+	defer h.beginRequest(requestID)()
+	defer h.beginSerialZones(ch.ResolvedZone)()
 
-	// If the TXT record does not exist, return early
-	if _, ok := h.txtRecords[ch.ResolvedFQDN]; !ok {
-		return ErrTextRecordDoesNotExist
+	endBudget, err := h.beginBudget(ch.ResolvedFQDN, deadline)
+	if err != nil {
+		return err
+	}
+	defer endBudget()
+
+	endBotBranch, err := h.beginBotBranch(ch)
+	if err != nil {
+		return err
+	}
+	defer endBotBranch()
+
+	endReplicaLock, err := h.beginReplicaLock(ch.ResolvedFQDN)
+	if err != nil {
+		return err
+	}
+	defer endReplicaLock()
+
+	// The record may have been presented while waiting for the lock
+	if err := h.loadRecords(); err != nil {
+		return err
+	}
+	if h.cachedRecord(id) {
+		return ErrTextRecordAlreadyExists
 	}
 
 	// Create the branch if it does not exist
-	if err := CreateBranch(h.gitClient, h.gitPath, h.gitBotBranch, h.gitTargetBranch); err != nil {
+	if err := h.createBotBranch(); err != nil {
 		return err
 	}
+	h.fire(HookEvent{Stage: HookBranchCreated, FQDN: ch.ResolvedFQDN, Action: "present"})
 
-	slog.Info("Cleaning up challenge request", "fqdn", ch.ResolvedFQDN)
-	record := NewRecord(ch.ResolvedFQDN, ch.Key)
-	recordStr, err := record.GenerateTextRecord()
+	// Read the zone file
+	content, err := h.readBotZoneFile()
 	if err != nil {
 		return err
 	}
 
-	// Remove the TXT record from the zone file
-	content, err := ReadZoneFile(h.gitClient, h.gitBotBranch, h.gitPath, h.gitFile)
+	// Another replica may have added the same record to the bot branch already. The record ID is derived from
+	// the FQDN and the key, so the zone file itself identifies an identical present and no second record is added.
+	exists, err := h.hasZoneRecord(content, id)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return h.adoptRecord(ch, id, deadline)
+	}
+
+	comment, err := renderRecordComment(h.recordCommentTemplate, ch, time.Now())
 	if err != nil {
 		return err
 	}
-	content, err = removeTxtRecord(content, recordStr)
+	entry, err := h.changelogEntry("add", ch, time.Now())
 	if err != nil {
 		return err
 	}
 
-	// Increase the serial number of the zone file
-	content, err = h.increaseSerialNumber(content)
+	// Add the TXT record to the zone file, unless it is in the zone file already
+	add := func(content string) (string, error) {
+		exists, err := h.hasZoneRecord(content, id)
+		if err != nil || exists {
+			return content, err
+		}
+		if err := h.checkForeignRecords(content, ch.ResolvedFQDN, ch.Key); err != nil {
+			return "", err
+		}
+		if err := h.checkRecordLimit(content, ch.ResolvedFQDN); err != nil {
+			return "", err
+		}
+		if content, err = h.addRecord(content, record, comment); err != nil {
+			return "", err
+		}
+		return h.appendChangelog(content, entry)
+	}
+	before := content
+	content, err = add(content)
 	if err != nil {
 		return err
 	}
 
-	// Update the zone file
-	if err := UpdateZoneFile(h.gitClient, h.gitBotBranch, h.gitPath, h.gitFile, content, fmt.Sprintf("Remove TXT record: %s", ch.ResolvedFQDN)); err != nil {
+	// Update the zone file and increase its serial number
+	written, err := h.updateBotZoneFile(content, fmt.Sprintf("Add TXT record: %s", ch.ResolvedFQDN), add, true)
+	if err != nil {
 		return err
 	}
+	h.noteSerialBump(time.Now())
+	h.fire(HookEvent{Stage: HookFileUpdated, FQDN: ch.ResolvedFQDN, Action: "present"})
 
 	// Create a merge request
-	if err := Merge(h.gitClient, h.gitPath, h.gitBotBranch, h.gitTargetBranch, "Remove TXT record", "Remove TXT record"); err != nil {
+	description := withRequestID(mergeRequestDescription("Add TXT record", before, written), requestID)
+	iid := 0
+	cfg := h.mergeConfig.WithLabels(zoneLabel(ch.ResolvedZone)).WithReadyCheck(h.readyCheck(ch.ResolvedFQDN, ch.Key, true)).WithDeadline(deadline).WithNotify(h.trackMergeRequest("present", ch.ResolvedFQDN, &iid))
+	if err := Merge(h.gitClient, h.gitPath, h.gitBotBranch, h.gitTargetBranch, "Add TXT record", description, cfg); err != nil {
 		return err
 	}
+	h.expectMerged(id, true)
 
-	// Finally, remove the TXT record from memory
-	delete(h.txtRecords, ch.ResolvedFQDN)
+	if err := h.verifyMerged(ch.ResolvedFQDN, ch.Key, true); err != nil {
+		return err
+	}
+
+	// Store the TXT record in memory and in the state backend
+	if err := h.saveRecord(id, ch.Key); err != nil {
+		return err
+	}
+	h.status.addOrigin(id, recordOrigin{FQDN: ch.ResolvedFQDN, MergeRequestIID: iid, Created: time.Now().UTC(), KeyHash: keyHash(ch.Key)})
 
-	slog.Info("Challenge request cleaned up", "fqdn", ch.ResolvedFQDN)
+	log.Info("Challenge request completed", "fqdn", ch.ResolvedFQDN)
 
 	return nil
 }
 
-// addTxtRecord adds a new TXT record string to the given content and returns the updated content.
-func addTxtRecord(content string, recordStr string, prefix string) (string, error) {
-	reToCompile := fmt.Sprintf(`; %s-ACME-BOT-END`, prefix)
-	re, err := regexp.Compile(reToCompile)
+// hasZoneRecord reports whether the zone file has the TXT record with the given ID.
+func (h *gitSolver) hasZoneRecord(content string, id string) (bool, error) {
+	txtRecords, err := h.readAcmeBotRecords(content)
 	if err != nil {
-		return "", err
+		return false, err
 	}
 
-	newText := fmt.Sprintf("%s\n; %s-ACME-BOT-END", recordStr, prefix)
-	return re.ReplaceAllString(content, newText), nil
+	_, ok := txtRecords[id]
+	return ok, nil
 }
 
-// removeTxtRecord removes the TXT record string from the given content and returns the updated content.
-func removeTxtRecord(content string, recordStr string) (string, error) {
-	reToCompile := fmt.Sprintf(`%s\n`, recordStr)
-	re, err := regexp.Compile(reToCompile)
-	if err != nil {
-		return "", err
-	}
-
-	newText := ""
-	return re.ReplaceAllString(content, newText), nil
-}
+// adoptRecord takes over a record that another replica added to the bot branch. The merge request of the
+// other replica is merged if it is still open, and the record is stored like a record presented by this replica.
+func (h *gitSolver) adoptRecord(ch *acme.ChallengeRequest, id string, deadline time.Time) error {
+	slog.Info("TXT record already in zone file, skipping", "fqdn", ch.ResolvedFQDN)
 
-func (h *gitSolver) extractAcmeBotContent(content string) (string, error) {
-	slog.Info(fmt.Sprintf("extracting acme bot content using %s-ACME-BOT", h.gitBotCommentPrefix))
-	acmeBotCommentPattern := fmt.Sprintf(`; %s-ACME-BOT\n([\s\S]*?); %s-ACME-BOT-END`, h.gitBotCommentPrefix, h.gitBotCommentPrefix)
-	re, err := regexp.Compile(acmeBotCommentPattern)
-	if err != nil {
-		return "", err
+	cfg := h.mergeConfig.WithLabels(zoneLabel(ch.ResolvedZone)).WithReadyCheck(h.readyCheck(ch.ResolvedFQDN, ch.Key, true)).WithDeadline(deadline).WithNotify(h.mergeHook("present", ch.ResolvedFQDN))
+	if err := Merge(h.gitClient, h.gitPath, h.gitBotBranch, h.gitTargetBranch, "Add TXT record", "Add TXT record", cfg); err != nil {
+		return err
 	}
 
-	matches := re.FindStringSubmatch(content)
-	if len(matches) == 0 {
-		return "", ErrACMEBotContentNotFound
+	if err := h.saveRecord(id, ch.Key); err != nil {
+		return err
 	}
 
-	return matches[1], nil
+	return ErrTextRecordAlreadyExists
 }
 
-func (h *gitSolver) extractTxtRecords(content string) (map[string]string, error) {
-	txtRecords := make(map[string]string)
-
-	const recordPattern = `(_acme-challenge\..*?)\s+TXT\s+"(.*?)"\n`
-	re, err := regexp.Compile(recordPattern)
-	if err != nil {
-		return txtRecords, err
+// CleanUp should delete the relevant TXT record from the DNS provider console.
+// If multiple TXT records exist with the same record name (e.g.
+// _acme-challenge.example.com) then **only** the record with the same `key`
+// value provided on the ChallengeRequest should be cleaned up.
+// This is in order to facilitate multiple DNS validations for the same domain
+// concurrently.
+func (h *gitSolver) CleanUp(ch *acme.ChallengeRequest) (err error) {
+	if err := h.beginOperation(); err != nil {
+		return err
 	}
+	defer h.endOperation()
 
-	submatches := re.FindAllStringSubmatch(content, -1)
-	if len(submatches) == 0 {
-		return txtRecords, ErrTextRecordsDoNotExist
+	// The solvers of the instances log their own errors
+	if len(h.mirrors) > 0 {
+		cleanUp := func(s *gitSolver) error { return s.CleanUp(ch) }
+		removed := func(err error) bool { return errors.Is(err, ErrTextRecordDoesNotExist) }
+		return h.applyMirrored("cleanup", ch.ResolvedFQDN, cleanUp, removed)
 	}
 
-	for _, submatch := range submatches {
-		domain := submatch[1]
-		key := submatch[2]
-		if os.Getenv("ROOT_DOMAIN") != "" {
-			domain = fmt.Sprintf("%s.%s.", domain, os.Getenv("ROOT_DOMAIN"))
-		} else {
-			domain = fmt.Sprintf("%s.", domain)
-		}
-
-		txtRecords[domain] = key
-		slog.Info("found txt record", "fqdn", domain, "value", key)
+	// The solver of a route logs its own errors
+	route, err := h.route(ch.ResolvedFQDN)
+	if err == nil && route != h {
+		return route.CleanUp(ch)
 	}
 
-	return txtRecords, nil
-}
+	// The request ID correlates the logs of the operation with its commits and merge request
+	requestID := newRequestID()
+	log := slog.With("request_id", requestID)
+	defer func() { h.finishOperation(log, "cleanup", ch.ResolvedFQDN, err) }()
 
-/**
- * Increase the serial number of the zone file by mutating the content.
- */
-func (h *gitSolver) increaseSerialNumber(content string) (string, error) {
-	// Serial Number pattern: 2021091501
-	const serialNumberPattern = `(\d*)\s?;\s?serial number`
-	re, err := regexp.Compile(serialNumberPattern)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	matches := re.FindStringSubmatch(content)
-	if len(matches) == 0 {
-		return "", ErrSerialNumberNotFound
+	if err := h.checkDomainAllowed(ch.ResolvedFQDN); err != nil {
+		return err
 	}
 
-	// Check if the first part of the serial number is the current date
-	currentDate := time.Now().Format("20060102")
-	serialNumber := matches[1]
-	if !strings.HasPrefix(serialNumber, currentDate) {
-		// Use the currentDate to replace the tail of the serial number
-		return re.ReplaceAllString(content, fmt.Sprintf("%s01 ; serial number", currentDate)), nil
+	// The record is left for a human to remove, without reaching GitLab
+	if h.cleanupMode == CleanupModeDisabled {
+		return h.skipCleanup(ch.ResolvedFQDN, h.recordID(ch))
 	}
 
-	// Increment the tail of the serial number
-	tail := serialNumber[len(currentDate):]
-	convertedTail, err := strconv.Atoi(tail)
+	deadline, err := h.challengeDeadline(ch, time.Now())
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	// Increment the tail of the serial number
-	convertedTail++
-
-	// Convert Tail to 00 if larger than 99
-	if convertedTail > 99 {
-		convertedTail = 0
+	// Fail fast while GitLab is unreachable
+	if err := h.breaker.allow(); err != nil {
+		return err
 	}
+	defer func() { h.breaker.done(err) }()
 
-	return re.ReplaceAllString(content, fmt.Sprintf("%s%02d ; serial number", currentDate, convertedTail)), nil
-}
-
-// Initialize will be called when the webhook first starts.
-func (h *gitSolver) Initialize(kubeClientConfig *rest.Config, stopCh <-chan struct{}) error {
-	slog.Info("initializing git solver")
-
-	// Non-secret fields
-	gitBotBranch := os.Getenv("GITLAB_BOT_BRANCH")
-	if gitBotBranch == "" {
-		return ErrGitlabBotBranchNotDefined
+	if err := h.syncRecords(); err != nil {
+		return err
 	}
-	h.gitBotBranch = gitBotBranch
 
-	gitBotCommentPrefix := os.Getenv("GITLAB_BOT_COMMENT_PREFIX")
-	if gitBotCommentPrefix == "" {
-		return ErrGitlabBotCommentPrefixNotDefined
+	// If the TXT record does not exist, return early without waiting for the zone lock
+	if err := h.loadRecords(); err != nil {
+		return err
 	}
-	h.gitBotCommentPrefix = gitBotCommentPrefix
-
-	gitTargetBranch := os.Getenv("GITLAB_TARGET_BRANCH")
-	if gitTargetBranch == "" {
-		return ErrGitlabTargetBranchNotDefined
+	id := h.recordID(ch)
+	if h.cachedMissingRecord(id) {
+		return ErrTextRecordDoesNotExist
 	}
-	h.gitTargetBranch = gitTargetBranch
 
-	gitPath := os.Getenv("GITLAB_PATH")
-	if gitPath == "" {
-		return ErrGitlabPathNotDefined
+	log.Info("Cleaning up challenge request", "fqdn", ch.ResolvedFQDN)
+	record := h.newRecord(h.uniqueRecordName(ch.ResolvedFQDN, ch.Key), ch.ResolvedZone, ch.Key)
+	if err := record.Validate(); err != nil {
+		return err
 	}
-	h.gitPath = gitPath
 
-	gitFile := os.Getenv("GITLAB_FILE")
-	if gitFile == "" {
-		return ErrGitlabFileNotDefined
+	// The cleanups within CLEANUP_BATCH_WINDOW are removed in one merge request
+	if h.cleanupBatchWindow > 0 {
+		return h.coalesceCleanup(log, ch, id, record, deadline)
 	}
-	h.gitFile = gitFile
 
-	// Super secret fields
-	gitlabToken := os.Getenv("GITLAB_TOKEN")
-	if gitlabToken == "" {
-		return ErrGitlabTokenNotDefined
+	h.zoneLock.Lock()
+	defer h.zoneLock.Unlock()
+	defer h.beginRequest(requestID)()
+	defer h.beginSerialZones(ch.ResolvedZone)()
+
+	endBudget, err := h.beginBudget(ch.ResolvedFQDN, deadline)
+	if err != nil {
+		return err
 	}
+	defer endBudget()
 
-	gitlabUrl := os.Getenv("GITLAB_URL")
-	if gitlabUrl == "" {
-		return ErrGitlabURLNotDefined
+	endBotBranch, err := h.beginBotBranch(ch)
+	if err != nil {
+		return err
 	}
+	defer endBotBranch()
 
-	// Create a new git client
-	c, err := gitlab.NewClient(string(gitlabToken), gitlab.WithBaseURL(string(gitlabUrl)))
+	endReplicaLock, err := h.beginReplicaLock(ch.ResolvedFQDN)
 	if err != nil {
 		return err
 	}
-	h.gitClient = c
+	defer endReplicaLock()
+
+	// The record may have been cleaned up while waiting for the lock
+	if err := h.loadRecords(); err != nil {
+		return err
+	}
+	if h.cachedMissingRecord(id) {
+		return ErrTextRecordDoesNotExist
+	}
 
 	// Create the branch if it does not exist
-	if err := CreateBranch(h.gitClient, h.gitPath, h.gitBotBranch, h.gitTargetBranch); err != nil {
+	if err := h.createBotBranch(); err != nil {
 		return err
 	}
+	h.fire(HookEvent{Stage: HookBranchCreated, FQDN: ch.ResolvedFQDN, Action: "cleanup"})
 
-	// Read the zone file to check if the -ACME-BOT comments are present
-	// Returns base64 encoded content
-	content, err := ReadZoneFile(h.gitClient, h.gitBotBranch, h.gitPath, h.gitFile)
+	// Remove the TXT record from the zone file
+	content, err := h.readBotZoneFile()
+	if err != nil {
+		return err
+	}
+	if err := h.checkZoneRecordExists(content, id); err != nil {
+		return err
+	}
+	entry, err := h.changelogEntry("remove", ch, time.Now())
+	if err != nil {
+		return err
+	}
+	remove := func(content string) (string, error) {
+		content, err := h.removeRecord(content, record)
+		if err != nil {
+			return "", err
+		}
+		return h.appendChangelog(content, entry)
+	}
+	before := content
+	content, err = remove(content)
 	if err != nil {
 		return err
 	}
 
-	// Extract the -ACME-BOT comments from the zone file
-	acmeBotContent, err := h.extractAcmeBotContent(content)
+	// Update the zone file and increase its serial number unless disabled for cleanups or within the cooldown
+	bumpSerial := h.cleanupBumpsSerial(time.Now())
+	written, err := h.updateBotZoneFile(content, fmt.Sprintf("Remove TXT record: %s", ch.ResolvedFQDN), remove, bumpSerial)
 	if err != nil {
 		return err
 	}
+	if bumpSerial {
+		h.noteSerialBump(time.Now())
+	}
+	h.fire(HookEvent{Stage: HookFileUpdated, FQDN: ch.ResolvedFQDN, Action: "cleanup"})
 
-	txtRecords, err := h.extractTxtRecords(acmeBotContent)
-	if err != nil && err != ErrTextRecordsDoNotExist {
+	// Create a merge request
+	description := withRequestID(mergeRequestDescription("Remove TXT record", before, written), requestID)
+	cfg := h.mergeConfig.WithLabels(zoneLabel(ch.ResolvedZone)).WithReadyCheck(h.readyCheck(ch.ResolvedFQDN, ch.Key, false)).WithDeadline(deadline).WithNotify(h.mergeHook("cleanup", ch.ResolvedFQDN))
+	if err := Merge(h.gitClient, h.gitPath, h.gitBotBranch, h.gitTargetBranch, "Remove TXT record", description, cfg); err != nil {
 		return err
 	}
+	h.expectMerged(id, false)
 
-	h.txtRecords = txtRecords
+	if err := h.verifyMerged(ch.ResolvedFQDN, ch.Key, false); err != nil {
+		return err
+	}
+
+	// Finally, remove the TXT record from memory and from the state backend
+	if err := h.forgetRecord(id); err != nil {
+		return err
+	}
+
+	log.Info("Challenge request cleaned up", "fqdn", ch.ResolvedFQDN)
 
-	slog.Info("git solver initialized")
 	return nil
 }
 
-func New() webhook.Solver {
-	return &gitSolver{
-		name:       "git-solver",
-		txtRecords: make(map[string]string),
+// recordID returns the identifier of the challenge's TXT record in txtRecords.
+func (h *gitSolver) recordID(ch *acme.ChallengeRequest) string {
+	return h.recordIDFor(h.uniqueRecordName(ch.ResolvedFQDN, ch.Key), ch.Key)
+}
+
+// recordIDFor returns the identifier of the TXT record with the given FQDN and key in txtRecords.
+// Records are identified by their FQDN and key, since several challenges may need a record under the same
+// owner name at the same time, e.g. for a wildcard and its base domain. If all records share a single owner
+// name, they are identified by their key only. The FQDN always ends with a dot, which separates it from the key.
+func (h *gitSolver) recordIDFor(fqdn string, key string) string {
+	if h.sharedRecordName != "" {
+		return key
 	}
+
+	return strings.TrimSuffix(fqdn, ".") + "." + key
 }
 
-func main() {
-	if GroupName == "" {
-		panic("GROUP_NAME environment variable is required")
+// newRecord creates the record written to the zone file for the given FQDN and key. The owner name is relative
+// to the zone if ZONE_RELATIVE_NAMES is set, the shared owner name is always relative to ROOT_DOMAIN.
+func (h *gitSolver) newRecord(fqdn string, zone string, key string) *Record {
+	if h.sharedRecordName != "" {
+		fqdn = h.sharedRecordName
+	}
+	if !h.zoneRelativeNames || h.sharedRecordName != "" {
+		zone = ""
 	}
 
-	solver := New()
-	cmd.RunWebhookServer(GroupName, solver)
+	record := NewRecord(fqdn, zone, key)
+	record.Domain = h.ownerNameCase.apply(record.Domain)
+	record.Format = h.txtValueFormat
+	record.Type = h.recordType
+
+	return record
+}
+
+// rrType returns the RR type of the records written by the webhook, see RECORD_TYPE.
+func (h *gitSolver) rrType() string {
+	if h.recordType == "" {
+		return RecordTypeTXT
+	}
+
+	return h.recordType
+}
+
+// parseRecordValue returns the key of the record value as written in the zone file. Only the values of TXT records
+// are quoted.
+func (h *gitSolver) parseRecordValue(value string) string {
+	if h.rrType() != RecordTypeTXT {
+		return value
+	}
+
+	return zone.ParseTextValue(value)
+}
+
+// hasRecord reports whether a TXT record with the given ID is known.
+func (h *gitSolver) hasRecord(id string) bool {
+	h.recordsLock.RLock()
+	defer h.recordsLock.RUnlock()
+
+	_, ok := h.txtRecords[id]
+	return ok
+}
+
+// setRecord stores the key of the TXT record with the given ID in memory.
+func (h *gitSolver) setRecord(id string, key string) {
+	h.recordsLock.Lock()
+	defer h.recordsLock.Unlock()
+
+	h.txtRecords[id] = key
+}
+
+// deleteRecord removes the TXT record with the given ID and its origin from memory.
+func (h *gitSolver) deleteRecord(id string) {
+	h.recordsLock.Lock()
+	defer h.recordsLock.Unlock()
+
+	delete(h.txtRecords, id)
+	h.status.removeOrigin(id)
+}
+
+// addRecord adds the record to the -ACME-BOT block of the zone file, or to the records of a structured zone file.
+func (h *gitSolver) addRecord(content string, record *Record, comment string) (string, error) {
+	if h.structuredZone != nil {
+		return h.structuredZone.addRecord(content, record, comment)
+	}
+
+	recordStr, err := record.GenerateTextRecord()
+	if err != nil {
+		return "", err
+	}
+
+	re, err := h.acmeBotBlockRegex()
+	if err != nil {
+		return "", err
+	}
+
+	if content, err = h.ensureBlock(content); err != nil {
+		return "", err
+	}
+
+	content, err = zone.AddTxtRecord(content, recordStr, re, comment)
+	if err != nil {
+		return "", err
+	}
+
+	if content, err = h.sortAcmeBotBlock(content); err != nil || !h.recordBlockSpacing {
+		return content, err
+	}
+
+	return h.spaceAcmeBotBlock(content)
+}
+
+// removeRecord removes the record from the zone file, or from the records of a structured zone file.
+// If RECORD_TOMBSTONES is set, the record is commented out instead, see tombstone.go. An emptied -ACME-BOT block
+// is handled as configured by EMPTY_BLOCK, see emptyblock.go.
+func (h *gitSolver) removeRecord(content string, record *Record) (string, error) {
+	if h.structuredZone != nil {
+		content, _, err := h.structuredZone.removeRecords(content, record.Domain, record.Key)
+		return content, err
+	}
+
+	recordStr, err := record.GenerateTextRecord()
+	if err != nil {
+		return "", err
+	}
+
+	if h.recordTombstones {
+		content, err = h.tombstoneTxtRecord(content, recordStr)
+	} else {
+		content, err = zone.RemoveTxtRecord(content, recordStr)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if h.recordBlockSpacing {
+		if content, err = h.spaceAcmeBotBlock(content); err != nil {
+			return "", err
+		}
+	}
+
+	return h.handleEmptyBlock(content)
+}
+
+// readBotZoneFile reads the zone file from the bot branch. If the -ACME-BOT block of the bot branch is
+// missing records that the target branch has, the bot branch is refreshed with the content of the target
+// branch first, so that the next merge does not revert these records.
+func (h *gitSolver) readBotZoneFile() (string, error) {
+	targetContent, err := h.readZoneFile(h.gitPath, h.gitTargetBranch)
+	if err != nil {
+		return "", err
+	}
+
+	botContent, err := h.readZoneFile(h.gitBotPath(), h.gitBotBranch)
+	if err != nil {
+		return "", err
+	}
+
+	behind, err := h.isBehind(botContent, targetContent)
+	if err != nil || !behind {
+		return botContent, err
+	}
+
+	slog.Info("bot branch is missing records of the target branch, refreshing", "branch", h.gitBotBranch, "target", h.gitTargetBranch)
+	if len(h.gitExtraFiles) > 0 {
+		return targetContent, h.refreshBotZoneFiles(targetContent)
+	}
+	if err := h.updateBotFile(h.gitFile, targetContent, fmt.Sprintf("Refresh zone file from %s", h.gitTargetBranch)); err != nil {
+		return "", err
+	}
+
+	return targetContent, nil
+}
+
+// updateBotZoneFile increases the serial number of the changed content and writes it to the bot branch.
+// If configured, the record change and the serial number increase are written as two separate commits,
+// so that the merge request shows them separately. edit reproduces the change on a fresh zone file if the
+// zone file changed concurrently, see writeBotZoneFile. If bumpSerial is false or the serial number is not
+// managed by the webhook, the serial number is kept.
+// If a separate serial file is configured, its serial number is increased instead, see serialfile.go.
+// If extra zone files are configured, all zone files are written in a single commit, see multifile.go.
+// It returns the zone file as written to the bot branch.
+func (h *gitSolver) updateBotZoneFile(content string, message string, edit zoneEdit, bumpSerial bool) (string, error) {
+	// The extra files of a split-horizon zone are written in the same commit, see multifile.go
+	if len(h.gitExtraFiles) > 0 {
+		return h.updateBotZoneFiles(content, message, edit, bumpSerial && !h.unmanagedSerial)
+	}
+
+	if !bumpSerial || h.unmanagedSerial {
+		return h.writeBotZoneFile(content, message, edit)
+	}
+
+	// The serial number of a separate serial file is always increased in a commit of its own
+	if h.gitSerialFile != "" {
+		written, err := h.writeBotZoneFile(content, message, edit)
+		if err != nil {
+			return "", err
+		}
+		return written, h.increaseSerialFile()
+	}
+
+	if !h.separateSerialCommit {
+		// The content may have been read before the bot branch was rebased or written concurrently, so the serial
+		// number is increased past the one on the bot branch right before the write
+		live, err := h.readFile(h.gitBotPath(), h.gitBotBranch, h.gitFile)
+		if err != nil {
+			return "", err
+		}
+		bumped, err := h.increaseSerialNumber(content, h.serialNumber(live))
+		if err != nil {
+			return "", err
+		}
+
+		return h.writeBotZoneFile(bumped, message, func(fresh string) (string, error) {
+			changed, err := edit(fresh)
+			if err != nil || changed == fresh {
+				return changed, err
+			}
+			return h.increaseSerialNumber(changed, h.serialNumber(fresh))
+		})
+	}
+
+	written, err := h.writeBotZoneFile(content, message, edit)
+	if err != nil {
+		return "", err
+	}
+
+	bumped, err := h.increaseSerialNumber(written)
+	if err != nil || bumped == written {
+		return written, err
+	}
+	return h.writeBotZoneFile(bumped, "Increase serial number", func(fresh string) (string, error) {
+		return h.increaseSerialNumber(fresh)
+	})
+}
+
+// isBehind reports whether the -ACME-BOT block of the bot content is missing records of the target content.
+func (h *gitSolver) isBehind(botContent string, targetContent string) (bool, error) {
+	targetRecords, err := h.readAcmeBotRecords(targetContent)
+	if err != nil {
+		return false, err
+	}
+
+	botRecords, err := h.readAcmeBotRecords(botContent)
+	if err != nil {
+		return false, err
+	}
+
+	for fqdn, key := range targetRecords {
+		if botRecords[fqdn] != key {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// readAcmeBotRecords extracts the TXT records of the -ACME-BOT block of the given content.
+func (h *gitSolver) readAcmeBotRecords(content string) (map[string]string, error) {
+	if h.structuredZone != nil {
+		return h.readStructuredRecords(content)
+	}
+
+	acmeBotContent, err := h.extractAcmeBotContent(content)
+	if err != nil {
+		return nil, err
+	}
+
+	txtRecords, err := h.extractTxtRecords(acmeBotContent, h.zoneOrigin(content))
+	if err != nil && err != ErrTextRecordsDoNotExist {
+		return nil, err
+	}
+
+	return txtRecords, nil
+}
+
+func (h *gitSolver) extractAcmeBotContent(content string) (string, error) {
+	slog.Info("extracting acme bot content", "pattern", h.acmeBotBlockPattern())
+	re, err := h.acmeBotBlockRegex()
+	if err != nil {
+		return "", err
+	}
+
+	// The block may have been removed with its last record
+	block, err := zone.ExtractBlock(content, re)
+	if errors.Is(err, ErrACMEBotContentNotFound) && h.emptyBlock == EmptyBlockRemove {
+		return "", nil
+	}
+
+	return block, err
+}
+
+// extractTxtRecords returns the records of the configured RR type of the content, whose owner names are relative
+// to the origin if given.
+func (h *gitSolver) extractTxtRecords(content string, origin string) (map[string]string, error) {
+	txtRecords := make(map[string]string)
+
+	re, err := h.txtRecordRegex()
+	if err != nil {
+		return txtRecords, err
+	}
+
+	records, err := zone.ExtractRecords(content, re)
+	if err != nil {
+		return txtRecords, err
+	}
+
+	for _, record := range records {
+		domain := recordFQDN(record.Name, origin)
+		record.Value = h.parseRecordValue(record.Value)
+
+		txtRecords[h.recordIDFor(domain, record.Value)] = record.Value
+		slog.Info("found txt record", "fqdn", domain, "value", record.Value)
+	}
+
+	return txtRecords, nil
+}
+
+// recordFQDN reverses NewRecord, returning the FQDN of the given owner name in the zone file.
+// The owner name is relative to the origin if given, otherwise to ROOT_DOMAIN.
+func recordFQDN(name string, origin string) string {
+	domain := removeRecordNameSuffix(name, os.Getenv("RECORD_NAME_SUFFIX"))
+	if origin != "" {
+		return fmt.Sprintf("%s.%s", domain, origin)
+	}
+	if os.Getenv("ROOT_DOMAIN") != "" {
+		return fmt.Sprintf("%s.%s.", domain, os.Getenv("ROOT_DOMAIN"))
+	}
+
+	return fmt.Sprintf("%s.", domain)
+}
+
+// txtRecordRegex returns the regex matching the owner name and value of the TXT records written by the webhook.
+func (h *gitSolver) txtRecordRegex() (*regexp.Regexp, error) {
+	// In shared mode only the records of the shared owner name are considered
+	if h.sharedRecordName != "" {
+		if h.sharedTxtRecordRegex != nil {
+			return h.sharedTxtRecordRegex, nil
+		}
+		return regexp.Compile(h.txtRecordPattern(regexp.QuoteMeta(h.newRecord(h.sharedRecordName, "", "").Domain)))
+	}
+
+	if h.rrType() != RecordTypeTXT {
+		return regexp.Compile(h.txtRecordPattern(acmeChallengeOwnerPattern))
+	}
+
+	switch h.txtValueFormat {
+	case ValueFormatUnquoted:
+		return unquotedTxtRecordRegex, nil
+	case ValueFormatSingleQuoted:
+		return singleQuotedTxtRecordRegex, nil
+	}
+
+	return txtRecordRegex, nil
+}
+
+// txtRecordPattern returns the pattern of the TXT records of the owner names matched by ownerPattern, with the
+// quotes of the configured value format. The records of another RR type than TXT are matched with their RDATA.
+func (h *gitSolver) txtRecordPattern(ownerPattern string) string {
+	if h.rrType() != RecordTypeTXT {
+		return zone.RecordPattern(ownerPattern, h.rrType())
+	}
+	if h.txtValueFormat == ValueFormatSingleQuoted {
+		return zone.SingleQuotedTxtRecordPattern(ownerPattern)
+	}
+
+	return zone.TxtRecordPattern(ownerPattern, h.txtValueFormat == ValueFormatUnquoted)
+}
+
+// compilePatterns compiles the regexes depending on the configuration once, so that they are not
+// compiled on every call. Solvers that were not initialized compile them on demand.
+func (h *gitSolver) compilePatterns() error {
+	re, err := regexp.Compile(h.acmeBotBlockPattern())
+	if err != nil {
+		return err
+	}
+	h.acmeBotContentRegex = re
+
+	if h.sharedRecordName != "" {
+		re, err := regexp.Compile(h.txtRecordPattern(regexp.QuoteMeta(h.newRecord(h.sharedRecordName, "", "").Domain)))
+		if err != nil {
+			return err
+		}
+		h.sharedTxtRecordRegex = re
+	}
+
+	return nil
+}
+
+/**
+ * Increase the serial number of the zone file by mutating the content.
+ * The increased serial number also exceeds the serial numbers after, e.g. of the zone file on the bot branch.
+ */
+func (h *gitSolver) increaseSerialNumber(content string, after ...string) (string, error) {
+	var bumped string
+	var err error
+	if h.structuredZone != nil {
+		bumped, err = h.structuredZone.increaseSerialNumber(content, h.nextSerialNumber(), after...)
+	} else if len(h.serialZones) > 0 {
+		h.verifySerialSignature(content)
+		bumped, err = h.increaseZoneSerialNumbers(content, after...)
+		bumped = h.signSerialNumber(bumped)
+	} else {
+		h.verifySerialSignature(content)
+		bumped, err = zone.IncreaseSerialNumberWith(content, h.nextSerialNumber(), after...)
+		bumped = h.signSerialNumber(bumped)
+	}
+
+	// Zone files without a serial number are written unchanged if REQUIRE_SERIAL is disabled
+	if errors.Is(err, ErrSerialNumberNotFound) && h.optionalSerial {
+		slog.Warn("serial number not found in zone file, skipping the increase", "file", h.serialFile())
+		return content, nil
+	}
+
+	return bumped, err
+}
+
+// serialNumber returns the serial number of the zone file, or an empty string if it has none.
+func (h *gitSolver) serialNumber(content string) string {
+	if h.structuredZone != nil {
+		return h.structuredZone.serialNumber(content)
+	}
+	if len(h.serialZones) > 0 {
+		return zone.ZoneSerialNumber(content, h.serialZones[0])
+	}
+
+	return zone.SerialNumber(content)
+}
+
+// Initialize will be called when the webhook first starts.
+func (h *gitSolver) Initialize(kubeClientConfig *rest.Config, stopCh <-chan struct{}) (err error) {
+	defer func() { logError(slog.Default(), "initialize", "", err) }()
+
+	slog.Info("initializing git solver")
+
+	// Non-secret fields
+	gitBotBranch, err := getEnv("GITLAB_BOT_BRANCH")
+	if err != nil {
+		return err
+	}
+	if gitBotBranch == "" {
+		return ErrGitlabBotBranchNotDefined
+	}
+	h.gitBotBranch = gitBotBranch
+
+	botBranchTemplateText, err := getEnv("GITLAB_BOT_BRANCH_TEMPLATE")
+	if err != nil {
+		return err
+	}
+	botBranchTemplate, err := parseBotBranchTemplate(botBranchTemplateText)
+	if err != nil {
+		return err
+	}
+	h.botBranchTemplate = botBranchTemplate
+
+	// Custom markers replace the markers derived from the prefix
+	acmeBotBeginMarker, acmeBotEndMarker := os.Getenv("ACME_BOT_BEGIN_MARKER"), os.Getenv("ACME_BOT_END_MARKER")
+	if err := validateMarkers(acmeBotBeginMarker, acmeBotEndMarker); err != nil {
+		return err
+	}
+	h.acmeBotBeginMarker = acmeBotBeginMarker
+	h.acmeBotEndMarker = acmeBotEndMarker
+
+	gitBotCommentPrefix, err := getEnv("GITLAB_BOT_COMMENT_PREFIX")
+	if err != nil {
+		return err
+	}
+	if gitBotCommentPrefix == "" && acmeBotBeginMarker == "" {
+		return ErrGitlabBotCommentPrefixNotDefined
+	}
+
+	createMarkers, err := getEnvBool("CREATE_MARKERS_IF_MISSING", false)
+	if err != nil {
+		return err
+	}
+	if createMarkers && acmeBotBeginMarker != "" {
+		return fmt.Errorf("%w: CREATE_MARKERS_IF_MISSING cannot be combined with ACME_BOT_BEGIN_MARKER", ErrInvalidConfig)
+	}
+	h.createMarkers = createMarkers
+
+	recordSort, err := ParseRecordSort(os.Getenv("RECORD_SORT"))
+	if err != nil {
+		return err
+	}
+	h.recordSort = recordSort
+
+	emptyBlock, err := ParseEmptyBlockMode(os.Getenv("EMPTY_BLOCK"))
+	if err != nil {
+		return err
+	}
+	if emptyBlock == EmptyBlockRemove && acmeBotBeginMarker != "" {
+		return fmt.Errorf("%w: EMPTY_BLOCK remove cannot be combined with ACME_BOT_BEGIN_MARKER", ErrInvalidConfig)
+	}
+	h.emptyBlock = emptyBlock
+
+	markersPosition, err := ParseMarkersPosition(os.Getenv("MARKERS_POSITION"))
+	if err != nil {
+		return err
+	}
+	h.markersPosition = markersPosition
+	h.gitBotCommentPrefix = gitBotCommentPrefix
+
+	gitTargetBranch, err := getEnv("GITLAB_TARGET_BRANCH")
+	if err != nil {
+		return err
+	}
+	if gitTargetBranch == "" {
+		return ErrGitlabTargetBranchNotDefined
+	}
+	h.gitTargetBranch = gitTargetBranch
+
+	reconstructBranch, err := getEnv("RECONSTRUCT_FROM_BRANCH")
+	if err != nil {
+		return err
+	}
+	if reconstructBranch == "" {
+		reconstructBranch = gitTargetBranch
+	}
+	h.reconstructBranch = reconstructBranch
+
+	gitPath, err := getEnv("GITLAB_PATH")
+	if err != nil {
+		return err
+	}
+	if gitPath == "" {
+		return ErrGitlabPathNotDefined
+	}
+	h.gitPath = gitPath
+
+	gitForkPath, err := getEnv("GITLAB_FORK_PATH")
+	if err != nil {
+		return err
+	}
+	h.gitForkPath = gitForkPath
+
+	missingTargetBranch, err := ParseMissingTargetBranch(os.Getenv("TARGET_BRANCH_MISSING"))
+	if err != nil {
+		return err
+	}
+	if missingTargetBranch == MissingTargetBranchCreate && gitForkPath != "" {
+		return fmt.Errorf("%w: TARGET_BRANCH_MISSING create cannot be combined with GITLAB_FORK_PATH", ErrInvalidConfig)
+	}
+	h.missingTargetBranch = missingTargetBranch
+
+	gitFile, err := getEnv("GITLAB_FILE")
+	if err != nil {
+		return err
+	}
+	if gitFile == "" {
+		return ErrGitlabFileNotDefined
+	}
+	h.gitFile = gitFile
+
+	gitSerialFile, err := getEnv("GITLAB_SERIAL_FILE")
+	if err != nil {
+		return err
+	}
+	if gitSerialFile == gitFile {
+		gitSerialFile = ""
+	}
+	h.gitSerialFile = gitSerialFile
+
+	txtValueFormat, err := ParseValueFormat(os.Getenv("TXT_VALUE_FORMAT"))
+	if err != nil {
+		return err
+	}
+	txtQuoteStyle, err := ParseQuoteStyle(os.Getenv("TXT_QUOTE_STYLE"))
+	if err != nil {
+		return err
+	}
+	if txtQuoteStyle != "" {
+		// TXT_QUOTE_STYLE takes over TXT_VALUE_FORMAT, so both must agree if set
+		if os.Getenv("TXT_VALUE_FORMAT") != "" && txtQuoteStyle != txtValueFormat && !(txtQuoteStyle == ValueFormatQuoted && txtValueFormat == ValueFormatChunked) {
+			return fmt.Errorf("%w: TXT_QUOTE_STYLE %q conflicts with TXT_VALUE_FORMAT %q", ErrInvalidConfig, os.Getenv("TXT_QUOTE_STYLE"), os.Getenv("TXT_VALUE_FORMAT"))
+		}
+		txtValueFormat = txtQuoteStyle
+	}
+	h.txtValueFormat = txtValueFormat
+
+	recordType, err := ParseRecordType(os.Getenv("RECORD_TYPE"))
+	if err != nil {
+		return err
+	}
+	h.recordType = recordType
+
+	keyValidation, err := ParseKeyValidation(os.Getenv("KEY_VALIDATION"))
+	if err != nil {
+		return err
+	}
+	if keyValidation != KeyValidationBasic && h.rrType() != RecordTypeTXT {
+		return fmt.Errorf("%w: KEY_VALIDATION %s requires RECORD_TYPE TXT", ErrInvalidConfig, keyValidation)
+	}
+	h.keyValidation = keyValidation
+
+	ownerNameCase, err := ParseOwnerNameCase(os.Getenv("OWNER_NAME_CASE"))
+	if err != nil {
+		return err
+	}
+	h.ownerNameCase = ownerNameCase
+
+	recordCommentTemplate, err := getEnv("RECORD_COMMENT_TEMPLATE")
+	if err != nil {
+		return err
+	}
+	recordCommentIssuer, err := getEnvBool("RECORD_COMMENT_ISSUER", false)
+	if err != nil {
+		return err
+	}
+	if recordCommentIssuer {
+		if recordCommentTemplate != "" {
+			return fmt.Errorf("%w: RECORD_COMMENT_ISSUER cannot be combined with RECORD_COMMENT_TEMPLATE, use its Issuer field instead", ErrInvalidConfig)
+		}
+		recordCommentTemplate = issuerCommentTemplate
+	}
+	h.recordCommentTemplate, err = parseRecordCommentTemplate(recordCommentTemplate)
+	if err != nil {
+		return err
+	}
+
+	changelogTemplate, err := parseChangelogTemplate(os.Getenv("ZONE_CHANGELOG_TEMPLATE"))
+	if err != nil {
+		return err
+	}
+	h.changelogTemplate = changelogTemplate
+
+	h.sharedRecordName = os.Getenv("SHARED_RECORD_NAME")
+
+	uniqueRecordNames, err := getEnvBool("UNIQUE_RECORD_NAME", false)
+	if err != nil {
+		return err
+	}
+	if uniqueRecordNames && h.sharedRecordName != "" {
+		return fmt.Errorf("%w: UNIQUE_RECORD_NAME cannot be combined with SHARED_RECORD_NAME", ErrInvalidConfig)
+	}
+	h.uniqueRecordNames = uniqueRecordNames
+
+	normalizeZoneFile, err := getEnvBool("ZONE_FILE_NORMALIZE", false)
+	if err != nil {
+		return err
+	}
+	h.normalizeZoneFile = normalizeZoneFile
+
+	zoneFileMaxSize, err := getEnvInt("ZONE_FILE_MAX_SIZE", defaultZoneFileMaxSize)
+	if err != nil {
+		return err
+	}
+	h.zoneFileMaxSize = zoneFileMaxSize
+
+	maxBlockRecords, err := getEnvInt("MAX_BLOCK_RECORDS", 0)
+	if err != nil {
+		return err
+	}
+	h.maxBlockRecords = maxBlockRecords
+
+	verifyAfterMerge, err := getEnvBool("VERIFY_AFTER_MERGE", false)
+	if err != nil {
+		return err
+	}
+	h.verifyAfterMerge = verifyAfterMerge
+
+	requireSerial, err := getEnvBool("REQUIRE_SERIAL", true)
+	if err != nil {
+		return err
+	}
+	h.optionalSerial = !requireSerial
+
+	recordCacheDisabled, err := getEnvBool("DISABLE_RECORD_CACHE", false)
+	if err != nil {
+		return err
+	}
+	h.recordCacheDisabled = recordCacheDisabled
+
+	bumpSerialOnCleanup, err := getEnvBool("BUMP_SERIAL_ON_CLEANUP", true)
+	if err != nil {
+		return err
+	}
+	h.keepSerialOnCleanup = !bumpSerialOnCleanup
+
+	cleanupBatchWindow, err := getEnvDuration("CLEANUP_BATCH_WINDOW", 0)
+	if err != nil {
+		return err
+	}
+	h.cleanupBatchWindow = cleanupBatchWindow
+
+	replicaLockBranch, err := getEnv("REPLICA_LOCK_BRANCH")
+	if err != nil {
+		return err
+	}
+	if replicaLockBranch != "" && (replicaLockBranch == h.gitBotBranch || replicaLockBranch == h.gitTargetBranch) {
+		return fmt.Errorf("%w: REPLICA_LOCK_BRANCH must differ from GITLAB_BOT_BRANCH and GITLAB_TARGET_BRANCH", ErrInvalidConfig)
+	}
+	h.replicaLockBranch = replicaLockBranch
+
+	replicaLockTTL, err := getEnvDuration("REPLICA_LOCK_TTL", defaultReplicaLockTTL)
+	if err != nil {
+		return err
+	}
+	if replicaLockTTL <= 0 {
+		return fmt.Errorf("%w: REPLICA_LOCK_TTL must be positive", ErrInvalidConfig)
+	}
+	h.replicaLockTTL = replicaLockTTL
+
+	serialStrategy, err := ParseSerialStrategy(os.Getenv("SERIAL_STRATEGY"))
+	if err != nil {
+		return err
+	}
+	h.serialStrategy = serialStrategy
+
+	serialZoneSelection, err := ParseSerialZoneSelection(os.Getenv("SERIAL_ZONE_SELECTION"))
+	if err != nil {
+		return err
+	}
+	h.serialZoneSelection = serialZoneSelection
+
+	serialSigningSecret, err := getEnv("SERIAL_SIGNING_SECRET")
+	if err != nil {
+		return err
+	}
+	h.serialSigningSecret = serialSigningSecret
+
+	serialBumpCooldown, err := getEnvDuration("SERIAL_BUMP_COOLDOWN", 0)
+	if err != nil {
+		return err
+	}
+	h.serialBumpCooldown = serialBumpCooldown
+
+	readYourWritesTimeout, err := getEnvDuration("READ_YOUR_WRITES_TIMEOUT", 0)
+	if err != nil {
+		return err
+	}
+	h.readYourWritesTimeout = readYourWritesTimeout
+
+	readByCommit, err := getEnvBool("READ_YOUR_WRITES_BY_COMMIT", false)
+	if err != nil {
+		return err
+	}
+	h.readByCommit = readByCommit
+
+	manageSerial, err := getEnvBool("MANAGE_SERIAL", true)
+	if err != nil {
+		return err
+	}
+	h.unmanagedSerial = !manageSerial
+
+	separateSerialCommit, err := getEnvBool("SEPARATE_SERIAL_COMMIT", false)
+	if err != nil {
+		return err
+	}
+	h.separateSerialCommit = separateSerialCommit
+
+	gitExtraFiles, err := getEnvList("GITLAB_EXTRA_FILES", nil)
+	if err != nil {
+		return err
+	}
+	if len(gitExtraFiles) > 0 && (h.gitSerialFile != "" || h.separateSerialCommit) {
+		return fmt.Errorf("%w: GITLAB_EXTRA_FILES cannot be combined with GITLAB_SERIAL_FILE or SEPARATE_SERIAL_COMMIT", ErrInvalidConfig)
+	}
+	if slices.Contains(gitExtraFiles, h.gitFile) {
+		return fmt.Errorf("%w: GITLAB_EXTRA_FILES must not contain GITLAB_FILE %q", ErrInvalidConfig, h.gitFile)
+	}
+	h.gitExtraFiles = gitExtraFiles
+
+	failOnForeignRecords, err := getEnvBool("FAIL_ON_FOREIGN_RECORDS", false)
+	if err != nil {
+		return err
+	}
+	h.failOnForeignRecords = failOnForeignRecords
+
+	recordBlockSpacing, err := getEnvBool("RECORD_BLOCK_SPACING", false)
+	if err != nil {
+		return err
+	}
+	h.recordBlockSpacing = recordBlockSpacing
+
+	recordTombstones, err := getEnvBool("RECORD_TOMBSTONES", false)
+	if err != nil {
+		return err
+	}
+	h.recordTombstones = recordTombstones
+
+	cleanupMode, err := ParseCleanupMode(os.Getenv("CLEANUP_MODE"))
+	if err != nil {
+		return err
+	}
+	if cleanupMode == CleanupModeComment {
+		h.recordTombstones = true
+	}
+	h.cleanupMode = cleanupMode
+
+	recordTombstoneNote, err := getEnvBool("RECORD_TOMBSTONE_NOTE", false)
+	if err != nil {
+		return err
+	}
+	h.recordTombstoneNote = recordTombstoneNote
+
+	allowedDomains, err := getEnvList("ALLOWED_DOMAINS", nil)
+	if err != nil {
+		return err
+	}
+	h.allowedDomains = parseAllowedDomains(allowedDomains)
+
+	zoneFormat, err := ParseZoneFormat(os.Getenv("ZONE_FORMAT"))
+	if err != nil {
+		return err
+	}
+	if zoneFormat != ZoneFormatBind {
+		serialPath := os.Getenv("ZONE_SERIAL_PATH")
+		if serialPath == "" {
+			serialPath = defaultZoneSerialPath
+		}
+		recordsPath := os.Getenv("ZONE_RECORDS_PATH")
+		if recordsPath == "" {
+			recordsPath = defaultZoneRecordsPath
+		}
+		h.structuredZone = newStructuredZone(zoneFormat, serialPath, recordsPath)
+	}
+
+	entryFormat, err := ParseRecordEntryFormat(os.Getenv("ZONE_RECORD_ENTRY"))
+	if err != nil {
+		return err
+	}
+	if entryFormat != RecordEntryTyped && h.structuredZone == nil {
+		return fmt.Errorf("%w: ZONE_RECORD_ENTRY requires ZONE_FORMAT yaml or json", ErrInvalidConfig)
+	}
+	if h.structuredZone != nil {
+		h.structuredZone.entryFormat = entryFormat
+	}
+
+	// Structured zone files have neither comments nor markers
+	if h.createMarkers && h.structuredZone != nil {
+		return fmt.Errorf("%w: CREATE_MARKERS_IF_MISSING requires ZONE_FORMAT bind", ErrInvalidConfig)
+	}
+	if h.recordSort != RecordSortNone && h.structuredZone != nil {
+		return fmt.Errorf("%w: RECORD_SORT requires ZONE_FORMAT bind", ErrInvalidConfig)
+	}
+	if h.emptyBlock != EmptyBlockKeep && h.structuredZone != nil {
+		return fmt.Errorf("%w: EMPTY_BLOCK requires ZONE_FORMAT bind", ErrInvalidConfig)
+	}
+	if h.changelogTemplate != nil && h.structuredZone != nil {
+		return fmt.Errorf("%w: ZONE_CHANGELOG_TEMPLATE requires ZONE_FORMAT bind", ErrInvalidConfig)
+	}
+	if h.rrType() != RecordTypeTXT && h.structuredZone != nil {
+		return fmt.Errorf("%w: RECORD_TYPE requires ZONE_FORMAT bind", ErrInvalidConfig)
+	}
+	if h.serialZoneSelection == SerialZoneSelectionZone && h.structuredZone != nil {
+		return fmt.Errorf("%w: SERIAL_ZONE_SELECTION zone requires ZONE_FORMAT bind", ErrInvalidConfig)
+	}
+	if h.serialSigningSecret != "" && h.structuredZone != nil {
+		return fmt.Errorf("%w: SERIAL_SIGNING_SECRET requires ZONE_FORMAT bind", ErrInvalidConfig)
+	}
+	if h.recordTombstones && h.structuredZone != nil {
+		return fmt.Errorf("%w: RECORD_TOMBSTONES and CLEANUP_MODE comment require ZONE_FORMAT bind", ErrInvalidConfig)
+	}
+
+	zoneRelativeNames, err := getEnvBool("ZONE_RELATIVE_NAMES", false)
+	if err != nil {
+		return err
+	}
+
+	// Structured zone files have no $ORIGIN to read the relative owner names back
+	if zoneRelativeNames && h.structuredZone != nil {
+		return fmt.Errorf("%w: ZONE_RELATIVE_NAMES requires ZONE_FORMAT bind", ErrInvalidConfig)
+	}
+	h.zoneRelativeNames = zoneRelativeNames
+
+	if err := h.compilePatterns(); err != nil {
+		return err
+	}
+
+	// Super secret fields
+	gitlabToken, err := getEnv("GITLAB_TOKEN")
+	if err != nil {
+		return err
+	}
+	if gitlabToken == "" {
+		return ErrGitlabTokenNotDefined
+	}
+
+	// GITLAB_API_URL replaces GITLAB_URL for APIs not served from /api/v4
+	gitlabUrl, err := getGitlabURL()
+	if err != nil {
+		return err
+	}
+	gitlabAPIURL, err := getEnv("GITLAB_API_URL")
+	if err != nil {
+		return err
+	}
+	if gitlabUrl == "" && gitlabAPIURL == "" {
+		return ErrGitlabURLNotDefined
+	}
+
+	mergeRequestTimeout, err := getEnvDuration("MERGE_REQUEST_TIMEOUT", defaultMergeRequestTimeout)
+	if err != nil {
+		return err
+	}
+	h.mergeConfig.Timeout = mergeRequestTimeout
+
+	challengeTimeout, err := getEnvDuration("CHALLENGE_TIMEOUT", 0)
+	if err != nil {
+		return err
+	}
+	h.challengeTimeout = challengeTimeout
+
+	presentRetries, err := getEnvInt("PRESENT_RETRIES", 0)
+	if err != nil {
+		return err
+	}
+	h.presentRetries = presentRetries
+
+	presentRetryDelay, err := getEnvDuration("PRESENT_RETRY_DELAY", defaultPresentRetryDelay)
+	if err != nil {
+		return err
+	}
+	h.presentRetryDelay = presentRetryDelay
+
+	mergeRequestMinInterval, err := getEnvDuration("MERGE_REQUEST_MIN_INTERVAL", 0)
+	if err != nil {
+		return err
+	}
+	h.mergeConfig.Pacer = newMergeRequestPacer(mergeRequestMinInterval)
+
+	mergeRequestPollJitter, err := getEnvDuration("MERGE_REQUEST_POLL_JITTER", 0)
+	if err != nil {
+		return err
+	}
+	h.mergeConfig.PollJitter = mergeRequestPollJitter
+
+	approvalsMode, err := ParseApprovalsMode(os.Getenv("MERGE_REQUEST_APPROVALS_MODE"))
+	if err != nil {
+		return err
+	}
+	h.mergeConfig.ApprovalsMode = approvalsMode
+
+	missingPipeline, err := ParseMissingPipelineMode(os.Getenv("MISSING_PIPELINE"))
+	if err != nil {
+		return err
+	}
+	h.mergeConfig.MissingPipeline = missingPipeline
+
+	missingPipelineGrace, err := getEnvDuration("MISSING_PIPELINE_GRACE", defaultMissingPipelineGrace)
+	if err != nil {
+		return err
+	}
+	h.mergeConfig.MissingPipelineGrace = missingPipelineGrace
+
+	selfApprovalMode, err := ParseSelfApprovalMode(os.Getenv("MERGE_REQUEST_SELF_APPROVAL_MODE"))
+	if err != nil {
+		return err
+	}
+	h.mergeConfig.SelfApprovalMode = selfApprovalMode
+
+	mergeMethodValue, err := getEnv("GITLAB_MERGE_METHOD")
+	if err != nil {
+		return err
+	}
+	mergeMethod, err := ParseMergeMethod(mergeMethodValue)
+	if err != nil {
+		return err
+	}
+	h.mergeConfig.MergeMethod = mergeMethod
+
+	squash, err := getEnvBool("GITLAB_MERGE_SQUASH", false)
+	if err != nil {
+		return err
+	}
+	h.mergeConfig.Squash = squash
+
+	rebase, err := getEnvBool("MERGE_REQUEST_REBASE", true)
+	if err != nil {
+		return err
+	}
+	h.mergeConfig.NoRebase = !rebase
+
+	draft, err := getEnvBool("MERGE_REQUEST_DRAFT", false)
+	if err != nil {
+		return err
+	}
+	h.mergeConfig.Draft = draft
+
+	labels, err := getEnvList("GITLAB_MERGE_REQUEST_LABELS", defaultMergeRequestLabels)
+	if err != nil {
+		return err
+	}
+	h.mergeConfig.Labels = labels
+	h.mergeConfig.SourceProject = h.gitForkPath
+	// The branches of the challenges would pile up otherwise
+	h.mergeConfig.RemoveSourceBranch = h.botBranchTemplate != nil
+
+	commitAuthorName, err := getEnv("GITLAB_COMMIT_AUTHOR_NAME")
+	if err != nil {
+		return err
+	}
+	commitAuthorEmail, err := getEnv("GITLAB_COMMIT_AUTHOR_EMAIL")
+	if err != nil {
+		return err
+	}
+	commitMessagePrefix, err := getEnv("GITLAB_COMMIT_MESSAGE_PREFIX")
+	if err != nil {
+		return err
+	}
+	commitConfig, err := ParseCommitConfig(commitAuthorName, commitAuthorEmail, commitMessagePrefix)
+	if err != nil {
+		return err
+	}
+	writeEncodingText, err := getEnv("GITLAB_WRITE_ENCODING")
+	if err != nil {
+		return err
+	}
+	writeEncoding, err := ParseContentEncoding(writeEncodingText)
+	if err != nil {
+		return err
+	}
+	commitConfig.Encoding = writeEncoding
+	h.commitConfig = commitConfig
+
+	gitlabHTTPTimeout, err := getEnvDuration("GITLAB_HTTP_TIMEOUT", defaultGitlabHTTPTimeout)
+	if err != nil {
+		return err
+	}
+
+	extraHeaderPairs, err := getEnvList("GITLAB_EXTRA_HEADERS", nil)
+	if err != nil {
+		return err
+	}
+	extraHeaders, err := ParseExtraHeaders(extraHeaderPairs)
+	if err != nil {
+		return err
+	}
+
+	gitlabRateLimit, err := getEnvFloat("GITLAB_RATE_LIMIT", 0)
+	if err != nil {
+		return err
+	}
+	gitlabRateLimitBurst, err := getEnvInt("GITLAB_RATE_LIMIT_BURST", 0)
+	if err != nil {
+		return err
+	}
+	circuitBreakerThreshold, err := getEnvInt("GITLAB_CIRCUIT_BREAKER_THRESHOLD", 0)
+	if err != nil {
+		return err
+	}
+	circuitBreakerCooldown, err := getEnvDuration("GITLAB_CIRCUIT_BREAKER_COOLDOWN", defaultCircuitBreakerCooldown)
+	if err != nil {
+		return err
+	}
+	h.breaker = newCircuitBreaker(circuitBreakerThreshold, circuitBreakerCooldown)
+
+	statusCallbackURL, err := getEnv("STATUS_CALLBACK_URL")
+	if err != nil {
+		return err
+	}
+	statusCallbackTimeout, err := getEnvDuration("STATUS_CALLBACK_TIMEOUT", defaultStatusCallbackTimeout)
+	if err != nil {
+		return err
+	}
+	statusCallbackRetries, err := getEnvInt("STATUS_CALLBACK_RETRIES", defaultStatusCallbackRetries)
+	if err != nil {
+		return err
+	}
+	h.statusCallback = newStatusCallback(statusCallbackURL, statusCallbackTimeout, statusCallbackRetries)
+	if h.statusCallback != nil {
+		// The hooks are shared with the other solvers, so the hook is added to a copy of them
+		h.hooks = append(slices.Clip(h.hooks), h.statusCallback.hook)
+	}
+
+	clientOptions := []gitlab.ClientOptionFunc{}
+	if limiter := newRateLimiter(gitlabRateLimit, gitlabRateLimitBurst, gitlabHTTPTimeout); limiter != nil {
+		clientOptions = append(clientOptions, gitlab.WithCustomLimiter(limiter))
+	}
+
+	// Create a new git client
+	var c *gitlab.Client
+	if gitlabAPIURL != "" {
+		c, err = NewGitlabAPIClient(gitlabToken, gitlabAPIURL, gitlabHTTPTimeout, extraHeaders, clientOptions...)
+	} else {
+		c, err = NewGitlabClient(gitlabToken, gitlabUrl, gitlabHTTPTimeout, extraHeaders, clientOptions...)
+	}
+	if err != nil {
+		return err
+	}
+	h.gitClient = c
+
+	// Checkpoint the records into the state backend if configured
+	store, err := newRecordStoreFromEnv(kubeClientConfig)
+	if err != nil {
+		return err
+	}
+	h.store = store
+
+	routes, err := getEnv("ZONE_ROUTES")
+	if err != nil {
+		return err
+	}
+	zoneRoutes, err := ParseZoneRoutes(routes)
+	if err != nil {
+		return err
+	}
+	routeFallback, err := getEnvBool("ZONE_ROUTES_FALLBACK", false)
+	if err != nil {
+		return err
+	}
+	if err := h.setRoutes(zoneRoutes, routeFallback); err != nil {
+		return err
+	}
+
+	projectTemplateText, err := getEnv("GITLAB_PATH_TEMPLATE")
+	if err != nil {
+		return err
+	}
+	projectTemplate, err := parseProjectTemplate(projectTemplateText)
+	if err != nil {
+		return err
+	}
+	if projectTemplate != nil && h.store != nil {
+		return fmt.Errorf("%w: GITLAB_PATH_TEMPLATE cannot be combined with STATE_CONFIGMAP_NAME", ErrInvalidConfig)
+	}
+	h.projectTemplate = projectTemplate
+
+	mirrors, err := getEnv("ZONE_MIRRORS")
+	if err != nil {
+		return err
+	}
+	zoneMirrors, err := ParseZoneMirrors(mirrors)
+	if err != nil {
+		return err
+	}
+	mirrorQuorum, err := getEnvInt("MIRROR_QUORUM", 1)
+	if err != nil {
+		return err
+	}
+	if err := h.setMirrors(zoneMirrors, mirrorQuorum, gitlabHTTPTimeout); err != nil {
+		return err
+	}
+
+	shutdownGracePeriod, err := getEnvDuration("SHUTDOWN_GRACE_PERIOD", defaultShutdownGracePeriod)
+	if err != nil {
+		return err
+	}
+	h.shutdownGracePeriod = shutdownGracePeriod
+
+	// The webhook server closes the stop channel when it shuts down
+	if stopCh != nil {
+		go func() {
+			<-stopCh
+			h.stop()
+		}()
+	}
+
+	healthAddr, err := getEnv("HEALTH_ADDR")
+	if err != nil {
+		return err
+	}
+	if healthAddr != "" {
+		if err := h.startHealthServer(healthAddr, stopCh); err != nil {
+			return err
+		}
+	}
+
+	// In lazy mode GitLab is not contacted until the first challenge, so that the webhook
+	// becomes ready even if GitLab is temporarily unavailable
+	lazyInit, err := getEnvBool("LAZY_INIT", false)
+	if err != nil {
+		return err
+	}
+	if lazyInit {
+		slog.Info("git solver initialized, deferring the zone file read to the first challenge")
+		return nil
+	}
+
+	// Fail early with a clear error if the API is not reachable under the configured URL
+	if err := checkGitlabAPI(h.gitClient); err != nil {
+		return err
+	}
+
+	// The default zone file is not used if every challenge is routed to the zone file of a route or project
+	if (len(h.routes) == 0 || h.routeFallback) && h.projectTemplate == nil {
+		if err := h.checkZoneFile(); err != nil {
+			return err
+		}
+		if err := h.syncRecords(); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("git solver initialized", "routes", len(h.routes))
+	return nil
+}
+
+// syncRecords creates the bot branch and reconstructs the records from the zone file, unless this was
+// done already. If it fails, the next call tries again.
+func (h *gitSolver) syncRecords() error {
+	h.syncLock.Lock()
+	defer h.syncLock.Unlock()
+
+	if h.synced {
+		return nil
+	}
+
+	h.zoneLock.Lock()
+	defer h.zoneLock.Unlock()
+
+	// Create the branch if it does not exist
+	if err := h.createBotBranch(); err != nil {
+		return err
+	}
+
+	// Onboard a zone file without the -ACME-BOT comments if configured
+	if err := h.createMarkersIfMissing(); err != nil {
+		return err
+	}
+
+	// Read the zone file of the reconstruct branch to check if the -ACME-BOT comments are present
+	content, err := h.readReconstructZoneFile()
+	if err != nil {
+		return err
+	}
+
+	// Extract the records of the -ACME-BOT comments from the zone file
+	txtRecords, err := h.readAcmeBotRecords(content)
+	if err != nil {
+		return err
+	}
+
+	h.recordsLock.Lock()
+	h.txtRecords = txtRecords
+	h.recordsLock.Unlock()
+
+	if err := h.reconcileStore(txtRecords); err != nil {
+		return err
+	}
+
+	h.synced = true
+	return nil
+}
+
+// readReconstructZoneFile reads the zone file the records are reconstructed from. The bot branch is refreshed
+// from the target branch if needed, other branches are read as they are.
+func (h *gitSolver) readReconstructZoneFile() (string, error) {
+	branch := h.reconstructBranch
+	if branch == "" {
+		branch = h.gitTargetBranch
+	}
+
+	if branch == h.gitBotBranch {
+		return h.readBotZoneFile()
+	}
+
+	return h.readZoneFile(h.gitPath, branch)
+}
+
+func newGitSolver() *gitSolver {
+	// The name is read here instead of in Initialize, as the server registers the solver by its name before
+	// initializing it
+	name := os.Getenv("SOLVER_NAME")
+	if name == "" {
+		name = defaultSolverName
+	}
+
+	return &gitSolver{
+		name:       name,
+		txtRecords: make(map[string]string),
+		status:     &operationStatus{},
+		hooks:      registeredHooks,
+	}
+}
+
+func New() webhook.Solver {
+	return newGitSolver()
+}
+
+func main() {
+	// Maintenance mode, remove the records of a single FQDN and exit without starting the server
+	if fqdn := os.Getenv("WEBHOOK_CLEANUP_FQDN"); fqdn != "" {
+		if err := runCleanup(fqdn, os.Getenv("WEBHOOK_CLEANUP_KEY")); err != nil {
+			slog.Error("manual cleanup failed", "fqdn", fqdn, "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if GroupName == "" {
+		panic("GROUP_NAME environment variable is required")
+	}
+
+	solver := newGitSolver()
+
+	// The webhook server handles the signals as well and returns once it stopped serving
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-signals
+		solver.stop()
+	}()
+
+	cmd.RunWebhookServer(GroupName, solver)
+
+	// Wait for the challenges in flight, so that no change is left half-applied
+	solver.shutdown()
 }
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -39,151 +47,6 @@ func TestGitlabIntegration(t *testing.T) {
 	}
 }
 
-func TestAddTxtRecord(t *testing.T) {
-	testCases := []struct {
-		name      string
-		content   string
-		recordStr string
-		want      string
-		err       error
-	}{
-		{
-			name:      "empty content",
-			content:   "",
-			recordStr: "_acme-challenge.example.com TXT \"somevalue\"",
-			want:      "",
-			err:       nil,
-		},
-		{
-			name:      "single record",
-			content:   "; TEST-ACME-BOT\nsome content\n; TEST-ACME-BOT-END",
-			recordStr: "_acme-challenge.example.com TXT \"somevalue\"",
-			want:      "; TEST-ACME-BOT\nsome content\n_acme-challenge.example.com TXT \"somevalue\"\n; TEST-ACME-BOT-END",
-			err:       nil,
-		},
-		{
-			name:      "no opening comment",
-			content:   "some content\n; ACME-BOT-END",
-			recordStr: "_acme-challenge.example.com TXT \"somevalue\"",
-			want:      "some content\n; ACME-BOT-END",
-			err:       nil,
-		},
-		{
-			name:      "surrounding text",
-			content:   "text-before; TEST-ACME-BOT\nsome content\n; TEST-ACME-BOT-ENDtext-text-after",
-			recordStr: "_acme-challenge.example.com TXT \"somevalue\"",
-			want:      "text-before; TEST-ACME-BOT\nsome content\n_acme-challenge.example.com TXT \"somevalue\"\n; TEST-ACME-BOT-ENDtext-text-after",
-			err:       nil,
-		},
-		{
-			name:      "trailing newline",
-			content:   "; TEST-ACME-BOT\nsome content\n; TEST-ACME-BOT-END\n",
-			recordStr: "_acme-challenge.example.com TXT \"somevalue\"",
-			want:      "; TEST-ACME-BOT\nsome content\n_acme-challenge.example.com TXT \"somevalue\"\n; TEST-ACME-BOT-END\n",
-			err:       nil,
-		},
-		{
-			name:      "no acme bot content",
-			content:   "no acme bot content here",
-			recordStr: "_acme-challenge.example.com TXT \"somevalue\"",
-			want:      "no acme bot content here",
-			err:       nil,
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			actual, err := addTxtRecord(tc.content, tc.recordStr, "TEST")
-			if !reflect.DeepEqual(actual, tc.want) {
-				t.Errorf("expected %q, got %q", tc.want, actual)
-			}
-
-			if tc.err == nil && err != nil {
-				t.Errorf("expected no error, got %v", err)
-			}
-
-			if tc.err != nil {
-				if err == nil {
-					t.Error("expected error, got nil")
-				}
-
-				if err.Error() != tc.err.Error() {
-					t.Errorf("expected error %q, got %q", tc.err, err)
-				}
-			}
-		})
-	}
-}
-
-func TestRemoveTxtRecord(t *testing.T) {
-	testCases := []struct {
-		name      string
-		content   string
-		recordStr string
-		want      string
-		err       error
-	}{
-		{
-			name:      "empty content",
-			content:   "",
-			recordStr: "_acme-challenge.example.com TXT \"somevalue\"",
-			want:      "",
-		},
-		{
-			name:      "single record with trailing newline",
-			content:   "_acme-challenge.example.com TXT \"somevalue\"\notherrecord",
-			recordStr: "_acme-challenge.example.com TXT \"somevalue\"",
-			want:      "otherrecord",
-		},
-		{
-			name:      "multiple records",
-			content:   "_acme-challenge.example.com TXT \"somevalue\"\n_acme-challenge.example.com TXT \"anothervalue\"\n",
-			recordStr: "_acme-challenge.example.com TXT \"somevalue\"",
-			want:      "_acme-challenge.example.com TXT \"anothervalue\"\n",
-		},
-		{
-			name:    "no record",
-			content: "someotherrecord",
-			want:    "someotherrecord",
-		},
-		{
-			name:      "multiple records different domains",
-			content:   "_acme-challenge.example.com TXT \"somevalue\"\n_acme-challenge.test.com TXT \"anothervalue\"\n",
-			recordStr: "_acme-challenge.test.com TXT \"anothervalue\"",
-			want:      "_acme-challenge.example.com TXT \"somevalue\"\n",
-		},
-		{
-			name:      "wrong recordStr",
-			content:   "_acme-challenge.example.com TXT \"somevalue\"\n_acme-challenge.example.com TXT \"anothervalue\"\n",
-			recordStr: "example.com",
-			want:      "_acme-challenge.example.com TXT \"somevalue\"\n_acme-challenge.example.com TXT \"anothervalue\"\n",
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			actual, err := removeTxtRecord(tc.content, tc.recordStr)
-			if !reflect.DeepEqual(actual, tc.want) {
-				t.Errorf("expected %q, got %q", tc.want, actual)
-			}
-
-			if tc.err == nil && err != nil {
-				t.Errorf("expected no error, got %v", err)
-			}
-
-			if tc.err != nil {
-				if err == nil {
-					t.Error("expected error, got nil")
-				}
-
-				if err.Error() != tc.err.Error() {
-					t.Errorf("expected error %q, got %q", tc.err, err)
-				}
-			}
-		})
-	}
-}
-
 func TestExtractAcmeBotContent(t *testing.T) {
 	testCases := []struct {
 		name    string
@@ -258,31 +121,38 @@ func TestExtractTxtRecords(t *testing.T) {
 		want       map[string]string
 		err        error
 		rootDomain string
+		format     ValueFormat
 	}{
 		{
 			name:       "with root domain",
 			content:    "_acme-challenge.svc TXT \"somevalue\"\n",
-			want:       map[string]string{"_acme-challenge.svc.example.com.": "somevalue"},
+			want:       map[string]string{"_acme-challenge.svc.example.com.somevalue": "somevalue"},
 			err:        nil,
 			rootDomain: "example.com",
 		},
 		{
 			name:       "with root domain. multiple records",
 			content:    "_acme-challenge.svc TXT \"somevalue\"\n_acme-challenge.svc2 TXT \"anothervalue\"\n",
-			want:       map[string]string{"_acme-challenge.svc.example.com.": "somevalue", "_acme-challenge.svc2.example.com.": "anothervalue"},
+			want:       map[string]string{"_acme-challenge.svc.example.com.somevalue": "somevalue", "_acme-challenge.svc2.example.com.anothervalue": "anothervalue"},
 			err:        nil,
 			rootDomain: "example.com",
 		},
 		{
 			name:    "valid single record",
 			content: "_acme-challenge.example.com TXT \"somevalue\"\n",
-			want:    map[string]string{"_acme-challenge.example.com.": "somevalue"},
+			want:    map[string]string{"_acme-challenge.example.com.somevalue": "somevalue"},
+			err:     nil,
+		},
+		{
+			name:    "multiple records with the same owner name",
+			content: "_acme-challenge.example.com TXT \"somevalue\"\n_acme-challenge.example.com TXT \"anothervalue\"\n",
+			want:    map[string]string{"_acme-challenge.example.com.somevalue": "somevalue", "_acme-challenge.example.com.anothervalue": "anothervalue"},
 			err:     nil,
 		},
 		{
 			name:    "valid multiple records",
 			content: "_acme-challenge.example.com TXT \"somevalue\"\n_acme-challenge.test.com TXT \"anothervalue\"\n",
-			want:    map[string]string{"_acme-challenge.example.com.": "somevalue", "_acme-challenge.test.com.": "anothervalue"},
+			want:    map[string]string{"_acme-challenge.example.com.somevalue": "somevalue", "_acme-challenge.test.com.anothervalue": "anothervalue"},
 			err:     nil,
 		},
 		{
@@ -297,6 +167,19 @@ func TestExtractTxtRecords(t *testing.T) {
 			want:    map[string]string{},
 			err:     ErrTextRecordsDoNotExist,
 		},
+		{
+			name:    "chunked record",
+			content: "_acme-challenge.example.com TXT \"some\" \"value\"\n",
+			want:    map[string]string{"_acme-challenge.example.com.somevalue": "somevalue"},
+			err:     nil,
+		},
+		{
+			name:    "unquoted record",
+			content: "_acme-challenge.example.com TXT somevalue\n",
+			want:    map[string]string{"_acme-challenge.example.com.somevalue": "somevalue"},
+			err:     nil,
+			format:  ValueFormatUnquoted,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -306,8 +189,8 @@ func TestExtractTxtRecords(t *testing.T) {
 				defer os.Unsetenv("ROOT_DOMAIN")
 			}
 
-			h := &gitSolver{}
-			got, err := h.extractTxtRecords(tc.content)
+			h := &gitSolver{txtValueFormat: tc.format}
+			got, err := h.extractTxtRecords(tc.content, "")
 			if !reflect.DeepEqual(got, tc.want) {
 				t.Errorf("expected %v, got %v", tc.want, got)
 			}
@@ -425,3 +308,729 @@ func TestIncreaseSerialNumber(t *testing.T) {
 	}
 
 }
+
+func TestPresentCleanUpFakeGitlab(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+
+	challenge := &acme.ChallengeRequest{
+		ResolvedFQDN: "_acme-challenge.example.com.",
+		Key:          "wow-so-secret",
+	}
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(fake.content("main"), "_acme-challenge.example.com            TXT \"wow-so-secret\"\n; TEST-ACME-BOT-END") {
+		t.Errorf("expected record in zone file, got %q", fake.content("main"))
+	}
+	if err := solver.Present(challenge); err != ErrTextRecordAlreadyExists {
+		t.Errorf("expected %v, got %v", ErrTextRecordAlreadyExists, err)
+	}
+
+	if err := solver.CleanUp(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(fake.content("main"), "wow-so-secret") {
+		t.Errorf("expected record to be removed, got %q", fake.content("main"))
+	}
+	if err := solver.CleanUp(challenge); err != ErrTextRecordDoesNotExist {
+		t.Errorf("expected %v, got %v", ErrTextRecordDoesNotExist, err)
+	}
+}
+
+func TestPresentWildcardAndBaseDomain(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+
+	// The challenges of *.example.com and example.com share the same owner name
+	wildcard := &acme.ChallengeRequest{
+		ResolvedFQDN: "_acme-challenge.example.com.",
+		DNSName:      "*.example.com",
+		Key:          "wildcard-key",
+	}
+	base := &acme.ChallengeRequest{
+		ResolvedFQDN: "_acme-challenge.example.com.",
+		DNSName:      "example.com",
+		Key:          "base-key",
+	}
+
+	for _, ch := range []*acme.ChallengeRequest{wildcard, base} {
+		if err := solver.Present(ch); err != nil {
+			t.Fatalf("expected no error presenting %s, got %v", ch.DNSName, err)
+		}
+	}
+	for _, key := range []string{wildcard.Key, base.Key} {
+		if want := fmt.Sprintf("_acme-challenge.example.com            TXT \"%s\"\n", key); !strings.Contains(fake.content("main"), want) {
+			t.Errorf("expected %q in zone file, got %q", want, fake.content("main"))
+		}
+	}
+
+	// Cleaning up one challenge keeps the record of the other
+	if err := solver.CleanUp(wildcard); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(fake.content("main"), wildcard.Key) {
+		t.Errorf("expected wildcard record to be removed, got %q", fake.content("main"))
+	}
+	if !strings.Contains(fake.content("main"), base.Key) {
+		t.Errorf("expected base record to be kept, got %q", fake.content("main"))
+	}
+	if !solver.hasRecord(solver.recordID(base)) {
+		t.Error("expected base record to be kept in memory")
+	}
+
+	if err := solver.CleanUp(base); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(fake.content("main"), base.Key) {
+		t.Errorf("expected base record to be removed, got %q", fake.content("main"))
+	}
+}
+
+func TestPresentSeparateSerialCommit(t *testing.T) {
+	testCases := []struct {
+		name     string
+		separate bool
+		messages []string
+	}{
+		{
+			name:     "single commit",
+			messages: []string{"Add TXT record: _acme-challenge.example.com."},
+		},
+		{
+			name:     "separate commit",
+			separate: true,
+			messages: []string{"Add TXT record: _acme-challenge.example.com.", "Increase serial number"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", fakeZone)
+			solver := newTestSolver(t, srv)
+			solver.separateSerialCommit = tc.separate
+
+			if err := solver.Present(&acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}); err != nil {
+				t.Fatal(err)
+			}
+
+			messages := []string{}
+			for _, commit := range fake.commits {
+				messages = append(messages, commit.subject())
+			}
+			if !slices.Equal(messages, tc.messages) {
+				t.Fatalf("expected commits %q, got %q", tc.messages, messages)
+			}
+
+			// The record change keeps the serial number, the last commit increases it
+			first, last := fake.commits[0].content, fake.commits[len(fake.commits)-1].content
+			if !strings.Contains(first, "wow-so-secret") {
+				t.Errorf("expected record in first commit, got %q", first)
+			}
+			if got := strings.Contains(first, "2021091501 ; serial number"); got != tc.separate {
+				t.Errorf("expected unchanged serial number in first commit %t, got %q", tc.separate, first)
+			}
+			if strings.Contains(last, "2021091501 ; serial number") {
+				t.Errorf("expected increased serial number in last commit, got %q", last)
+			}
+			if got := fake.content("main"); got != last {
+				t.Errorf("expected %q to be merged, got %q", last, got)
+			}
+		})
+	}
+}
+
+func TestCleanUpSerialNumber(t *testing.T) {
+	serial := regexp.MustCompile(`(\d+) ; serial number`)
+
+	testCases := []struct {
+		name     string
+		keep     bool
+		separate bool
+		commits  int
+	}{
+		{name: "bumped", commits: 2},
+		{name: "bumped with separate commit", separate: true, commits: 4},
+		{name: "kept", keep: true, commits: 2},
+		{name: "kept with separate commit", keep: true, separate: true, commits: 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", fakeZone)
+			solver := newTestSolver(t, srv)
+			solver.keepSerialOnCleanup = tc.keep
+			solver.separateSerialCommit = tc.separate
+
+			challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+			if err := solver.Present(challenge); err != nil {
+				t.Fatal(err)
+			}
+			presented := serial.FindStringSubmatch(fake.content("main"))[1]
+			if presented == "2021091501" {
+				t.Error("expected the serial number to be increased by present")
+			}
+
+			if err := solver.CleanUp(challenge); err != nil {
+				t.Fatal(err)
+			}
+			content := fake.content("main")
+			if strings.Contains(content, "wow-so-secret") {
+				t.Errorf("expected record to be removed, got %q", content)
+			}
+			if cleanedUp := serial.FindStringSubmatch(content)[1]; (cleanedUp == presented) != tc.keep {
+				t.Errorf("expected serial number kept %t, got %s after present and %s after cleanup", tc.keep, presented, cleanedUp)
+			}
+			if len(fake.commits) != tc.commits {
+				t.Errorf("expected %d commits, got %d", tc.commits, len(fake.commits))
+			}
+		})
+	}
+}
+
+func TestUnmanagedSerialNumber(t *testing.T) {
+	testCases := []struct {
+		name     string
+		zone     string
+		separate bool
+	}{
+		{name: "with serial number", zone: fakeZone},
+		{name: "with separate serial commit", zone: fakeZone, separate: true},
+		// The serial number is not required either
+		{name: "without serial number", zone: strings.Replace(fakeZone, " ; serial number", "", 1)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", tc.zone)
+			solver := newTestSolver(t, srv)
+			solver.unmanagedSerial = true
+			solver.separateSerialCommit = tc.separate
+
+			challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+			if err := solver.Present(challenge); err != nil {
+				t.Fatal(err)
+			}
+			want := strings.Replace(tc.zone, "; TEST-ACME-BOT-END", "_acme-challenge.example.com            TXT \"wow-so-secret\"\n; TEST-ACME-BOT-END", 1)
+			if got := fake.content("main"); got != want {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+
+			if err := solver.CleanUp(challenge); err != nil {
+				t.Fatal(err)
+			}
+			if got := fake.content("main"); got != tc.zone {
+				t.Errorf("expected %q, got %q", tc.zone, got)
+			}
+			if len(fake.commits) != 2 {
+				t.Errorf("expected 2 commits, got %d", len(fake.commits))
+			}
+		})
+	}
+}
+
+func TestPresentWithoutSerialNumber(t *testing.T) {
+	zone := strings.Replace(fakeZone, " ; serial number", "", 1)
+
+	testCases := []struct {
+		name     string
+		optional bool
+		separate bool
+		err      error
+		commits  int
+	}{
+		{name: "required", err: ErrSerialNumberNotFound},
+		{name: "optional", optional: true, commits: 1},
+		{name: "optional with separate commit", optional: true, separate: true, commits: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", zone)
+			solver := newTestSolver(t, srv)
+			solver.optionalSerial = tc.optional
+			solver.separateSerialCommit = tc.separate
+
+			err := solver.Present(&acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"})
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if len(fake.commits) != tc.commits {
+				t.Errorf("expected %d commits, got %d", tc.commits, len(fake.commits))
+			}
+			if err != nil {
+				return
+			}
+
+			want := strings.Replace(zone, "; TEST-ACME-BOT-END", "_acme-challenge.example.com            TXT \"wow-so-secret\"\n; TEST-ACME-BOT-END", 1)
+			if got := fake.content("main"); got != want {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestPresentLongKey(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+
+	key := strings.Repeat("a", TXT_CHUNK_SIZE) + strings.Repeat("b", 10)
+	ch := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: key}
+	if err := solver.Present(ch); err != nil {
+		t.Fatal(err)
+	}
+
+	want := fmt.Sprintf("_acme-challenge.example.com            TXT \"%s\" \"%s\"\n", strings.Repeat("a", TXT_CHUNK_SIZE), strings.Repeat("b", 10))
+	if !strings.Contains(fake.content("main"), want) {
+		t.Errorf("expected %q in %q", want, fake.content("main"))
+	}
+
+	// The chunks are joined to the original key when the zone file is read
+	present, err := solver.Verify(ch.ResolvedFQDN, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !present {
+		t.Error("expected the record with the long key to be verified")
+	}
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(fake.content("main"), "bbbbbbbbbb") {
+		t.Errorf("expected record to be removed, got %q", fake.content("main"))
+	}
+}
+
+func TestPresentAcrossReplicas(t *testing.T) {
+	testCases := []struct {
+		name       string
+		concurrent bool
+	}{
+		{name: "sequential"},
+		{name: "concurrent", concurrent: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", fakeZone)
+
+			// The replicas share the GitLab project but not their records in memory
+			replicas := []*gitSolver{newTestSolver(t, srv), newTestSolver(t, srv)}
+			ch := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+
+			errs := make([]error, len(replicas))
+			var wg sync.WaitGroup
+			for i, replica := range replicas {
+				wg.Add(1)
+				present := func() {
+					defer wg.Done()
+					errs[i] = replica.Present(ch)
+				}
+				if tc.concurrent {
+					go present()
+				} else {
+					present()
+				}
+			}
+			wg.Wait()
+
+			for _, err := range errs {
+				if err != nil && err != ErrTextRecordAlreadyExists {
+					t.Fatal(err)
+				}
+			}
+
+			content := fake.content("main")
+			if n := strings.Count(content, `TXT "wow-so-secret"`); n != 1 {
+				t.Errorf("expected a single record, got %d in %q", n, content)
+			}
+
+			// Both replicas know the record and a retry of either one is a no-op
+			for _, replica := range replicas {
+				if err := replica.Present(ch); err != ErrTextRecordAlreadyExists {
+					t.Errorf("expected %v, got %v", ErrTextRecordAlreadyExists, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLazyInit(t *testing.T) {
+	fake, _ := newFakeGitlab(t, "main", fakeZone)
+
+	// GitLab drops every connection while it is down
+	var down atomic.Bool
+	down.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	t.Setenv("GITLAB_BOT_BRANCH", "acme-bot")
+	t.Setenv("GITLAB_BOT_COMMENT_PREFIX", "TEST")
+	t.Setenv("GITLAB_TARGET_BRANCH", "main")
+	t.Setenv("GITLAB_PATH", fakeProject)
+	t.Setenv("GITLAB_FILE", fakeFile)
+	t.Setenv("GITLAB_TOKEN", "token")
+	t.Setenv("GITLAB_URL", srv.URL)
+	t.Setenv("MERGE_REQUEST_TIMEOUT", "1s")
+
+	// Eager init fails if GitLab is down
+	t.Setenv("LAZY_INIT", "false")
+	if err := newGitSolver().Initialize(nil, nil); err == nil {
+		t.Fatal("expected eager init to fail while GitLab is down")
+	}
+
+	// Lazy init succeeds, only the challenges fail while GitLab is down
+	t.Setenv("LAZY_INIT", "true")
+	solver := newGitSolver()
+	if err := solver.Initialize(nil, nil); err != nil {
+		t.Fatalf("expected lazy init to succeed, got %v", err)
+	}
+
+	challenge := &acme.ChallengeRequest{
+		ResolvedFQDN: "_acme-challenge.example.com.",
+		Key:          "wow-so-secret",
+	}
+	if err := solver.Present(challenge); err == nil {
+		t.Fatal("expected present to fail while GitLab is down")
+	}
+
+	down.Store(false)
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(fake.content("main"), "wow-so-secret") {
+		t.Errorf("expected record in zone file, got %q", fake.content("main"))
+	}
+	if !solver.synced {
+		t.Error("expected records to be synced after the first challenge")
+	}
+}
+
+func TestPresentDoesNotBlockOnInFlightChallenge(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	fake.delay = 50 * time.Millisecond
+	solver := newTestSolver(t, srv)
+	solver.txtRecords[solver.recordIDFor("_acme-challenge.existing.example.com.", "existing")] = "existing"
+
+	done := make(chan error)
+	go func() {
+		done <- solver.Present(&acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.slow.example.com.", Key: "slow"})
+	}()
+
+	// Give the slow challenge time to acquire the zone lock
+	time.Sleep(10 * time.Millisecond)
+
+	start := time.Now()
+	err := solver.Present(&acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.existing.example.com.", Key: "existing"})
+	if err != ErrTextRecordAlreadyExists {
+		t.Errorf("expected %v, got %v", ErrTextRecordAlreadyExists, err)
+	}
+	if elapsed := time.Since(start); elapsed > fake.delay {
+		t.Errorf("expected lookup to return without waiting for the in-flight challenge, took %s", elapsed)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// BenchmarkPresentRepeatedDuringWrite measures repeated Present calls for already presented challenges,
+// which are answered from txtRecords while another challenge is being written to a slow GitLab instance.
+// The writes themselves are serialized by zoneLock and are not measured.
+func BenchmarkPresentRepeatedDuringWrite(b *testing.B) {
+	fake, srv := newFakeGitlab(b, "main", fakeZone)
+	fake.delay = time.Millisecond
+	solver := newTestSolver(b, srv)
+
+	const existing = 100
+	for i := 0; i < existing; i++ {
+		solver.txtRecords[solver.recordIDFor(fmt.Sprintf("_acme-challenge.svc%d.example.com.", i), "key")] = "key"
+	}
+
+	// Keep a distinct challenge in flight for the duration of the benchmark
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ch := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.inflight.example.com.", Key: "inflight"}
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_ = solver.Present(ch)
+			_ = solver.CleanUp(ch)
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			ch := &acme.ChallengeRequest{ResolvedFQDN: fmt.Sprintf("_acme-challenge.svc%d.example.com.", i%existing), Key: "key"}
+			if err := solver.Present(ch); err != ErrTextRecordAlreadyExists {
+				b.Fatalf("expected %v, got %v", ErrTextRecordAlreadyExists, err)
+			}
+			i++
+		}
+	})
+	b.StopTimer()
+
+	close(stop)
+	<-stopped
+}
+
+func TestGitlabHTTPTimeout(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	fake.delay = 500 * time.Millisecond
+
+	c, err := NewGitlabClient("token", srv.URL, 50*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := ReadZoneFile(c, "main", fakeProject, fakeFile); err == nil {
+		t.Fatal("expected timeout error, got nil")
+	}
+	if elapsed := time.Since(start); elapsed >= fake.delay {
+		t.Errorf("expected request to time out before the server responded, took %s", elapsed)
+	}
+}
+
+func TestReadBotZoneFileRefreshesBehindBranch(t *testing.T) {
+	target := strings.Replace(fakeZone, "; TEST-ACME-BOT\n", "; TEST-ACME-BOT\n_acme-challenge.merged.example.com            TXT \"merged\"\n", 1)
+
+	testCases := []struct {
+		name    string
+		bot     string
+		want    string
+		updated bool
+	}{
+		{
+			name:    "bot branch is behind",
+			bot:     fakeZone,
+			want:    target,
+			updated: true,
+		},
+		{
+			name: "bot branch is up to date",
+			bot:  target,
+			want: target,
+		},
+		{
+			name: "bot branch is ahead",
+			bot:  strings.Replace(target, "; TEST-ACME-BOT-END", "_acme-challenge.new.example.com            TXT \"new\"\n; TEST-ACME-BOT-END", 1),
+			want: strings.Replace(target, "; TEST-ACME-BOT-END", "_acme-challenge.new.example.com            TXT \"new\"\n; TEST-ACME-BOT-END", 1),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", target)
+			fake.branches["acme-bot"] = tc.bot
+			solver := newTestSolver(t, srv)
+
+			got, err := solver.readBotZoneFile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+			if updated := fake.content("acme-bot") != tc.bot; updated != tc.updated {
+				t.Errorf("expected bot branch updated to be %t, got %t", tc.updated, updated)
+			}
+		})
+	}
+}
+
+func TestSyncRecordsReconstructBranch(t *testing.T) {
+	target := strings.Replace(fakeZone, "; TEST-ACME-BOT\n", "; TEST-ACME-BOT\n_acme-challenge.merged.example.com            TXT \"merged\"\n", 1)
+	bot := strings.Replace(target, "; TEST-ACME-BOT-END", "_acme-challenge.pending.example.com            TXT \"pending\"\n; TEST-ACME-BOT-END", 1)
+
+	testCases := []struct {
+		name   string
+		branch string
+		want   map[string]string
+	}{
+		{
+			name: "default",
+			want: map[string]string{"_acme-challenge.merged.example.com.merged": "merged"},
+		},
+		{
+			name:   "target branch",
+			branch: "main",
+			want:   map[string]string{"_acme-challenge.merged.example.com.merged": "merged"},
+		},
+		{
+			name:   "bot branch",
+			branch: "acme-bot",
+			want: map[string]string{
+				"_acme-challenge.merged.example.com.merged":   "merged",
+				"_acme-challenge.pending.example.com.pending": "pending",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", target)
+			fake.branches["acme-bot"] = bot
+			solver := newTestSolver(t, srv)
+			solver.reconstructBranch = tc.branch
+			solver.synced = false
+
+			if err := solver.syncRecords(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(solver.txtRecords, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, solver.txtRecords)
+			}
+		})
+	}
+}
+
+func TestSharedRecordName(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	solver.sharedRecordName = "_acme-challenge.shared.example.com."
+
+	first := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.one.example.com.", Key: "first"}
+	second := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.two.example.com.", Key: "second"}
+	for _, ch := range []*acme.ChallengeRequest{first, second} {
+		if err := solver.Present(ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Both records are written under the shared owner name
+	acmeBotContent, err := solver.extractAcmeBotContent(fake.content("main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "_acme-challenge.shared.example.com            TXT \"first\"\n_acme-challenge.shared.example.com            TXT \"second\"\n"
+	if acmeBotContent != want {
+		t.Errorf("expected %q, got %q", want, acmeBotContent)
+	}
+
+	// The records are reconstructed by key
+	txtRecords, err := solver.extractTxtRecords(acmeBotContent, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(txtRecords, map[string]string{"first": "first", "second": "second"}) {
+		t.Errorf("expected records keyed by value, got %v", txtRecords)
+	}
+
+	// Cleaning up one challenge keeps the other record
+	if err := solver.CleanUp(first); err != nil {
+		t.Fatal(err)
+	}
+	acmeBotContent, err = solver.extractAcmeBotContent(fake.content("main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "_acme-challenge.shared.example.com            TXT \"second\"\n"
+	if acmeBotContent != want {
+		t.Errorf("expected %q, got %q", want, acmeBotContent)
+	}
+}
+
+func TestPresentCleanUpRecordType(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	solver.recordType = "CAA"
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: `0 issue "letsencrypt.org"`}
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+
+	acmeBotContent, err := solver.extractAcmeBotContent(fake.content("main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "_acme-challenge.example.com            CAA 0 issue \"letsencrypt.org\"\n"
+	if acmeBotContent != want {
+		t.Errorf("expected %q, got %q", want, acmeBotContent)
+	}
+
+	// A restarted solver reconstructs the record from the zone file and removes it
+	restarted := newTestSolver(t, srv)
+	restarted.recordType = "CAA"
+	restarted.synced = false
+	if err := restarted.CleanUp(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if content := fake.content("main"); strings.Contains(content, "CAA") {
+		t.Errorf("expected the CAA record to be removed, got %q", content)
+	}
+}
+
+func TestCleanUpRecordTypeMetacharacters(t *testing.T) {
+	for _, key := range []string{`"x86+64" "Linux"`, `"(x86" "Linux"`} {
+		t.Run(key, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", fakeZone)
+			solver := newTestSolver(t, srv)
+			solver.recordType = "HINFO"
+
+			challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: key}
+			if err := solver.Present(challenge); err != nil {
+				t.Fatal(err)
+			}
+			if err := solver.CleanUp(challenge); err != nil {
+				t.Fatal(err)
+			}
+			if content := fake.content("main"); strings.Contains(content, "HINFO") {
+				t.Errorf("expected the HINFO record to be removed, got %q", content)
+			}
+		})
+	}
+}
+
+func TestExtractTxtRecordsWithSuffix(t *testing.T) {
+	t.Setenv("ROOT_DOMAIN", "example.com")
+	t.Setenv("RECORD_NAME_SUFFIX", "challenges")
+
+	h := &gitSolver{}
+	got, err := h.extractTxtRecords("_acme-challenge.svc.challenges TXT \"somevalue\"\n", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"_acme-challenge.svc.example.com.somevalue": "somevalue"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestSolverName(t *testing.T) {
+	testCases := []struct {
+		env  string
+		want string
+	}{
+		{env: "", want: "git-solver"},
+		{env: "git-solver-internal", want: "git-solver-internal"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.want, func(t *testing.T) {
+			t.Setenv("SOLVER_NAME", tc.env)
+
+			if got := New().Name(); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
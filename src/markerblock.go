@@ -0,0 +1,161 @@
+/*
+This file provides the creation of a missing -ACME-BOT block, for onboarding zone files that were never prepared
+for the webhook. If CREATE_MARKERS_IF_MISSING is set and the zone file of the target branch has no block, an
+empty block is inserted on the bot branch and merged through the usual merge request before the records are
+read. MARKERS_POSITION defines where the block is inserted: at the end of the zone file (default) or directly
+after the SOA record ("after-soa").
+
+The block is only created if the zone file has no -ACME-BOT marker at all. A marker of another prefix means that
+GITLAB_BOT_COMMENT_PREFIX is wrong, and creating a second block would hide the records of the first one. The
+creation is not supported with custom markers, which are patterns and not text, or with structured zone files.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// MarkersPosition defines where a missing -ACME-BOT block is inserted into the zone file
+type MarkersPosition string
+
+const (
+	MarkersPositionEnd      MarkersPosition = "end"
+	MarkersPositionAfterSOA MarkersPosition = "after-soa"
+)
+
+var (
+	ErrForeignMarkers         = errors.New("zone file has -ACME-BOT markers of another prefix")
+	ErrInvalidMarkersPosition = errors.New("invalid markers position")
+	ErrSOARecordNotFound      = errors.New("SOA record not found")
+)
+
+// anyMarkerRegex matches the -ACME-BOT markers of any prefix
+var anyMarkerRegex = regexp.MustCompile(`(?m)^[ \t]*;[^\n]*-ACME-BOT[^\n]*`)
+
+// soaLineRegex matches the start of an SOA record up to its type
+var soaLineRegex = regexp.MustCompile(`(?im)^[^;\n]*\sSOA\s`)
+
+// ParseMarkersPosition parses the given string into a MarkersPosition. An empty string defaults to MarkersPositionEnd.
+func ParseMarkersPosition(s string) (MarkersPosition, error) {
+	switch MarkersPosition(strings.ToLower(s)) {
+	case "", MarkersPositionEnd:
+		return MarkersPositionEnd, nil
+	case MarkersPositionAfterSOA:
+		return MarkersPositionAfterSOA, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidMarkersPosition, s)
+}
+
+// createMarkersIfMissing inserts an empty -ACME-BOT block into the zone file and merges it, if configured and
+// the zone file of the target branch has no block.
+func (h *gitSolver) createMarkersIfMissing() error {
+	if !h.createMarkers {
+		return nil
+	}
+
+	re, err := h.acmeBotBlockRegex()
+	if err != nil {
+		return err
+	}
+
+	target, err := h.readZoneFile(h.gitPath, h.gitTargetBranch)
+	if err != nil {
+		return err
+	}
+	if re.MatchString(target) {
+		return nil
+	}
+	if marker := anyMarkerRegex.FindString(target); marker != "" {
+		return fmt.Errorf("%w: %q, check GITLAB_BOT_COMMENT_PREFIX", ErrForeignMarkers, strings.TrimSpace(marker))
+	}
+
+	// A previous attempt may have inserted the block on the bot branch already
+	insert := func(content string) (string, error) {
+		if re.MatchString(content) {
+			return content, nil
+		}
+		if marker := anyMarkerRegex.FindString(content); marker != "" {
+			return "", fmt.Errorf("%w: %q, check GITLAB_BOT_COMMENT_PREFIX", ErrForeignMarkers, strings.TrimSpace(marker))
+		}
+		return h.insertMarkers(content)
+	}
+
+	bot, err := h.readZoneFile(h.gitBotPath(), h.gitBotBranch)
+	if err != nil {
+		return err
+	}
+	content, err := insert(bot)
+	if err != nil {
+		return err
+	}
+	if content != bot {
+		slog.Info("zone file has no -ACME-BOT block, creating it", "file", h.gitFile, "position", h.markersPosition)
+		if content, err = h.writeBotZoneFile(content, "Add -ACME-BOT markers", insert); err != nil {
+			return err
+		}
+	}
+
+	description := mergeRequestDescription("Add -ACME-BOT markers", bot, content)
+	return Merge(h.gitClient, h.gitPath, h.gitBotBranch, h.gitTargetBranch, "Add -ACME-BOT markers", description, h.mergeConfig)
+}
+
+// insertMarkers inserts an empty -ACME-BOT block at the configured position of the content.
+func (h *gitSolver) insertMarkers(content string) (string, error) {
+	block := fmt.Sprintf("; %s-ACME-BOT\n; %s-ACME-BOT-END\n", h.gitBotCommentPrefix, h.gitBotCommentPrefix)
+
+	pos := len(content)
+	if h.markersPosition == MarkersPositionAfterSOA {
+		var ok bool
+		if pos, ok = soaRecordEnd(content); !ok {
+			return "", fmt.Errorf("%w: cannot insert the -ACME-BOT markers after it", ErrSOARecordNotFound)
+		}
+	}
+
+	// The block always starts on a line of its own
+	if pos > 0 && content[pos-1] != '\n' {
+		block = "\n" + block
+	}
+	content = content[:pos] + block + content[pos:]
+
+	if h.recordBlockSpacing {
+		return h.spaceAcmeBotBlock(content)
+	}
+
+	return content, nil
+}
+
+// soaRecordEnd returns the position after the line ending the SOA record of the content. An SOA record in
+// parentheses ends with the line of the closing parenthesis.
+func soaRecordEnd(content string) (int, bool) {
+	loc := soaLineRegex.FindStringIndex(content)
+	if loc == nil {
+		return 0, false
+	}
+
+	end := loc[1]
+	if line := lineAt(content, loc[0]); strings.Contains(strings.SplitN(line, ";", 2)[0], "(") {
+		closing := strings.IndexByte(content[loc[1]:], ')')
+		if closing < 0 {
+			return 0, false
+		}
+		end = loc[1] + closing
+	}
+
+	newline := strings.IndexByte(content[end:], '\n')
+	if newline < 0 {
+		return len(content), true
+	}
+
+	return end + newline + 1, true
+}
+
+// lineAt returns the line of the content starting at the given position, without the newline.
+func lineAt(content string, pos int) string {
+	line, _, _ := strings.Cut(content[pos:], "\n")
+	return line
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+const fakeZoneWithoutMarkers = `$ORIGIN example.com.
+@ IN SOA ns.example.com. admin.example.com. (
+    2021091501 ; serial number
+    3600 ; refresh
+)
+www    IN A 1.2.3.4
+`
+
+func TestParseMarkersPosition(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  MarkersPosition
+		err   bool
+	}{
+		{input: "", want: MarkersPositionEnd},
+		{input: "end", want: MarkersPositionEnd},
+		{input: "After-SOA", want: MarkersPositionAfterSOA},
+		{input: "start", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseMarkersPosition(tc.input)
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+			if tc.err != errors.Is(err, ErrInvalidMarkersPosition) {
+				t.Errorf("expected error %t, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestInsertMarkers(t *testing.T) {
+	const block = "; TEST-ACME-BOT\n; TEST-ACME-BOT-END\n"
+
+	testCases := []struct {
+		name     string
+		content  string
+		position MarkersPosition
+		want     string
+		err      error
+	}{
+		{
+			name:     "end",
+			content:  fakeZoneWithoutMarkers,
+			position: MarkersPositionEnd,
+			want:     fakeZoneWithoutMarkers + block,
+		},
+		{
+			name:     "end without trailing newline",
+			content:  "www    IN A 1.2.3.4",
+			position: MarkersPositionEnd,
+			want:     "www    IN A 1.2.3.4\n" + block,
+		},
+		{
+			name:     "after SOA in parentheses",
+			content:  fakeZoneWithoutMarkers,
+			position: MarkersPositionAfterSOA,
+			want:     strings.Replace(fakeZoneWithoutMarkers, ")\n", ")\n"+block, 1),
+		},
+		{
+			name:     "after single line SOA",
+			content:  "@ IN SOA ns.example.com. admin.example.com. 1 3600 600 86400 300 ; soa\nwww IN A 1.2.3.4\n",
+			position: MarkersPositionAfterSOA,
+			want:     "@ IN SOA ns.example.com. admin.example.com. 1 3600 600 86400 300 ; soa\n" + block + "www IN A 1.2.3.4\n",
+		},
+		{
+			name:     "after SOA without SOA",
+			content:  "www IN A 1.2.3.4\n",
+			position: MarkersPositionAfterSOA,
+			err:      ErrSOARecordNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &gitSolver{gitBotCommentPrefix: "TEST", markersPosition: tc.position}
+
+			got, err := h.insertMarkers(tc.content)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCreateMarkersIfMissing(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		create  bool
+		err     error
+		created bool
+	}{
+		{
+			name:    "disabled",
+			content: fakeZoneWithoutMarkers,
+			err:     ErrACMEBotContentNotFound,
+		},
+		{
+			name:    "missing markers",
+			content: fakeZoneWithoutMarkers,
+			create:  true,
+			created: true,
+		},
+		{
+			name:    "existing markers",
+			content: fakeZone,
+			create:  true,
+		},
+		{
+			name:    "markers of another prefix",
+			content: fakeZoneWithoutMarkers + "; OTHER-ACME-BOT\n; OTHER-ACME-BOT-END\n",
+			create:  true,
+			err:     ErrForeignMarkers,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", tc.content)
+			solver := newTestSolver(t, srv)
+			solver.synced = false
+			solver.createMarkers = tc.create
+
+			if err := solver.syncRecords(); !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+
+			if created := len(fake.mergeRequests) > 0; created != tc.created {
+				t.Errorf("expected markers created %t, got %t", tc.created, created)
+			}
+			if tc.err != nil {
+				if fake.content("main") != tc.content {
+					t.Errorf("expected zone file to be unchanged, got %q", fake.content("main"))
+				}
+				return
+			}
+			if strings.Count(fake.content("main"), "; TEST-ACME-BOT\n") != 1 {
+				t.Errorf("expected a single -ACME-BOT block, got %q", fake.content("main"))
+			}
+
+			// The records are added to the created block
+			challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+			if err := solver.Present(challenge); err != nil {
+				t.Fatal(err)
+			}
+			if want := "; TEST-ACME-BOT\n_acme-challenge.example.com            TXT \"wow-so-secret\"\n; TEST-ACME-BOT-END\n"; !strings.Contains(fake.content("main"), want) {
+				t.Errorf("expected %q in %q", want, fake.content("main"))
+			}
+		})
+	}
+}
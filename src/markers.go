@@ -0,0 +1,68 @@
+/*
+This file provides custom markers of the block managed by the webhook, for zone files that do not follow the
+"; <PREFIX>-ACME-BOT" and "; <PREFIX>-ACME-BOT-END" convention. ACME_BOT_BEGIN_MARKER and ACME_BOT_END_MARKER are
+regular expressions matching the begin and end marker, e.g.:
+
+	ACME_BOT_BEGIN_MARKER='^; BEGIN ACME MANAGED$'
+	ACME_BOT_END_MARKER='^; END ACME MANAGED$'
+
+The patterns are matched in multi-line mode, so that ^ and $ match at the line boundaries. The rest of the line of
+the begin marker is ignored, and records are added directly before the end marker. Both markers must be set
+together, in which case GITLAB_BOT_COMMENT_PREFIX is not used.
+*/
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/kallepan/cert-manager-webhook/src/zone"
+)
+
+// acmeBotMarkerPattern returns the pattern of the block between the custom markers, capturing its content.
+func acmeBotMarkerPattern(begin string, end string) string {
+	return fmt.Sprintf(`(?m)(?:%s)[^\n]*\n([\s\S]*?)(?:%s)`, begin, end)
+}
+
+// validateMarkers checks that either both or none of the custom markers are set, and that they are valid
+// regular expressions matching at least one character.
+func validateMarkers(begin string, end string) error {
+	if (begin == "") != (end == "") {
+		return fmt.Errorf("%w: ACME_BOT_BEGIN_MARKER and ACME_BOT_END_MARKER must be set together", ErrInvalidConfig)
+	}
+
+	for name, marker := range map[string]string{"ACME_BOT_BEGIN_MARKER": begin, "ACME_BOT_END_MARKER": end} {
+		if marker == "" {
+			continue
+		}
+
+		re, err := regexp.Compile("(?m)" + marker)
+		if err != nil {
+			return fmt.Errorf("%w: invalid %s: %w", ErrInvalidConfig, name, err)
+		}
+		// A marker matching the empty string would match anywhere in the zone file
+		if re.MatchString("") {
+			return fmt.Errorf("%w: invalid %s: %q matches the empty string", ErrInvalidConfig, name, marker)
+		}
+	}
+
+	return nil
+}
+
+// acmeBotBlockPattern returns the pattern of the block managed by the webhook, capturing its content.
+func (h *gitSolver) acmeBotBlockPattern() string {
+	if h.acmeBotBeginMarker != "" {
+		return acmeBotMarkerPattern(h.acmeBotBeginMarker, h.acmeBotEndMarker)
+	}
+
+	return zone.BlockPattern(h.gitBotCommentPrefix)
+}
+
+// acmeBotBlockRegex returns the compiled pattern of the block, see compilePatterns.
+func (h *gitSolver) acmeBotBlockRegex() (*regexp.Regexp, error) {
+	if h.acmeBotContentRegex != nil {
+		return h.acmeBotContentRegex, nil
+	}
+
+	return regexp.Compile(h.acmeBotBlockPattern())
+}
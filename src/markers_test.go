@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+const fakeManagedZone = `$ORIGIN example.com.
+@ IN SOA ns.example.com. admin.example.com. (
+    2021091501 ; serial number
+    3600 ; refresh
+)
+; BEGIN ACME MANAGED (do not edit)
+; END ACME MANAGED
+; END OF ZONE
+`
+
+func TestValidateMarkers(t *testing.T) {
+	testCases := []struct {
+		name  string
+		begin string
+		end   string
+		err   bool
+	}{
+		{name: "none"},
+		{name: "both", begin: "^; BEGIN ACME MANAGED", end: "^; END ACME MANAGED$"},
+		{name: "begin only", begin: "^; BEGIN ACME MANAGED", err: true},
+		{name: "end only", end: "^; END ACME MANAGED$", err: true},
+		{name: "invalid regex", begin: "^; BEGIN (", end: "^; END$", err: true},
+		{name: "empty match", begin: "^; BEGIN", end: "x*", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateMarkers(tc.begin, tc.end)
+			if tc.err != (err != nil) {
+				t.Errorf("expected error %t, got %v", tc.err, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("expected %v, got %v", ErrInvalidConfig, err)
+			}
+		})
+	}
+}
+
+func TestPresentCleanUpCustomMarkers(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeManagedZone)
+	solver := newTestSolver(t, srv)
+	solver.gitBotCommentPrefix = ""
+	solver.acmeBotBeginMarker = "^; BEGIN ACME MANAGED"
+	solver.acmeBotEndMarker = "^; END ACME MANAGED$"
+	if err := solver.compilePatterns(); err != nil {
+		t.Fatal(err)
+	}
+
+	first := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "first"}
+	second := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.www.example.com.", Key: "second"}
+	for _, ch := range []*acme.ChallengeRequest{first, second} {
+		if err := solver.Present(ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "; BEGIN ACME MANAGED (do not edit)\n" +
+		"_acme-challenge.example.com            TXT \"first\"\n" +
+		"_acme-challenge.www.example.com            TXT \"second\"\n" +
+		"; END ACME MANAGED\n; END OF ZONE\n"
+	if content := fake.content("main"); !strings.HasSuffix(content, want) {
+		t.Errorf("expected zone file to end with %q, got %q", want, content)
+	}
+
+	records, err := solver.readAcmeBotRecords(fake.content("main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Errorf("expected 2 records in the managed block, got %v", records)
+	}
+
+	if err := solver.CleanUp(first); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := solver.RemoveRecords(second.ResolvedFQDN, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	want = "; BEGIN ACME MANAGED (do not edit)\n; END ACME MANAGED\n; END OF ZONE\n"
+	if content := fake.content("main"); !strings.HasSuffix(content, want) {
+		t.Errorf("expected zone file to end with %q, got %q", want, content)
+	}
+}
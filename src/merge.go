@@ -0,0 +1,721 @@
+/*
+This file provides the merge of the bot branch into the target branch.
+A merge request is created and approved by the bot. If the project requires more approvals than the bot can
+provide, the merge either fails naming the missing approvals or waits for them, depending on the ApprovalsMode.
+If GitLab forbids the bot to approve its own merge request, the SelfApprovalMode decides whether to fail, to
+continue without the approval of the bot, or to wait for another approver.
+On projects using fast-forward or semi-linear merges, the bot branch is rebased before it is approved.
+Instead of waiting for a fixed amount of time, the merge request is polled with an exponential backoff until
+GitLab reports it as mergeable, and then accepted.
+Since cert-manager may call Present/CleanUp more than once, a merge that was already done by a previous attempt
+is treated as success: nothing is merged if the bot branch has no changes, also if GitLab only reports it when
+creating the merge request, an open merge request is reused and a merge request that is already merged is not
+accepted again.
+If the merge request falls behind the target branch, e.g. because the merge request of another challenge was
+merged in the meantime, it is rebased with the rebase API, either while waiting for it to become mergeable or when
+accepting it fails, and accepted once GitLab reports it as mergeable again. Conflicts are not retried. If NoRebase
+is set, a merge request that fell behind fails instead, e.g. for projects whose pipelines must not run twice.
+If the source branch is in another project, e.g. a fork the bot may push to, a cross-project merge request is
+created in the source project and handled in the target project, where it and its IID live.
+If Draft is set, the merge request is created as a draft so that reviewers know it is not ready yet. It is marked
+as ready after the ReadyCheck passed, e.g. the verification of the bot branch, right before it is merged.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+var (
+	ErrMergeRequestNotMergeable = errors.New("merge request not mergeable")
+	ErrMergeRequestNotApproved  = errors.New("merge request not approved")
+	ErrInvalidApprovalsMode     = errors.New("invalid approvals mode")
+	ErrSelfApprovalForbidden    = errors.New("bot may not approve its own merge request")
+	ErrInvalidSelfApprovalMode  = errors.New("invalid self-approval mode")
+	ErrInvalidMergeMethod       = errors.New("invalid merge method")
+	ErrMergeRequestRebaseFailed = errors.New("merge request rebase failed")
+
+	// ErrMergeRequestNoDifferences is returned by createMergeRequest if the source branch has no changes
+	ErrMergeRequestNoDifferences = errors.New("source branch has no differences to the target branch")
+)
+
+// draftTitlePrefix marks a merge request as a draft, draftTitleRegex matches the draft prefixes known to GitLab
+const draftTitlePrefix = "Draft: "
+
+var draftTitleRegex = regexp.MustCompile(`(?i)^\s*(draft:|\[draft\]|\(draft\)|wip:|\[wip\])\s*`)
+
+// noDifferencesRegex matches the errors of GitLab creating a merge request from a branch without changes
+var noDifferencesRegex = regexp.MustCompile(`(?i)(no|not have any) (commits|changes|differences)|nothing to merge`)
+
+// MergeMethodAuto detects the merge method from the project settings
+const MergeMethodAuto gitlab.MergeMethodValue = "auto"
+
+// ApprovalsMode defines what happens if a merge request needs more approvals than the bot can provide
+type ApprovalsMode string
+
+const (
+	ApprovalsModeFail ApprovalsMode = "fail"
+	ApprovalsModeWait ApprovalsMode = "wait"
+)
+
+// SelfApprovalMode defines what happens if GitLab forbids the bot to approve its own merge request
+type SelfApprovalMode string
+
+const (
+	// SelfApprovalModeFail fails the merge
+	SelfApprovalModeFail SelfApprovalMode = "fail"
+	// SelfApprovalModeSkip continues without the approval of the bot, the merge fails if approvals are required
+	// unless ApprovalsMode is wait
+	SelfApprovalModeSkip SelfApprovalMode = "skip"
+	// SelfApprovalModeWait waits for the approval of another user, regardless of the ApprovalsMode
+	SelfApprovalModeWait SelfApprovalMode = "wait"
+)
+
+var (
+	// defaultMergeRequestLabels are the labels of every merge request unless configured otherwise
+	defaultMergeRequestLabels = []string{"acme-bot"}
+
+	// defaultMergeRequestTimeout is how long to wait for a merge request to become mergeable
+	defaultMergeRequestTimeout = 60 * time.Second
+
+	// mergeRequestPollInterval is the initial interval between two checks of the merge status,
+	// it is doubled after every check up to mergeRequestMaxPollInterval
+	mergeRequestPollInterval    = 1 * time.Second
+	mergeRequestMaxPollInterval = 15 * time.Second
+
+	// mergeRequestAcceptAttempts is how often a merge request is accepted if it falls behind the target branch
+	mergeRequestAcceptAttempts = 3
+)
+
+// MergeConfig holds the settings used when merging the bot branch into the target branch
+type MergeConfig struct {
+	// Timeout is how long to wait for the merge request to become mergeable
+	Timeout time.Duration
+
+	// PollJitter is the maximum random delay added to every check of the merge status, so that concurrent
+	// challenges do not poll GitLab at the same time
+	PollJitter time.Duration
+
+	// ApprovalsMode defines whether to wait for missing approvals or to fail
+	ApprovalsMode ApprovalsMode
+
+	// MissingPipeline defines what to do if the merge request requires a pipeline, but has none after
+	// MissingPipelineGrace, see missingpipeline.go
+	MissingPipeline      MissingPipelineMode
+	MissingPipelineGrace time.Duration
+
+	// SelfApprovalMode defines what to do if the bot may not approve its own merge request
+	SelfApprovalMode SelfApprovalMode
+
+	// MergeMethod is the merge method of the project, the bot branch is rebased before merging
+	// unless merge commits are used. MergeMethodAuto detects it from the project settings.
+	MergeMethod gitlab.MergeMethodValue
+
+	// Squash squashes the commits of the bot branch when merging
+	Squash bool
+
+	// NoRebase fails a merge request that fell behind the target branch instead of rebasing it. The rebase
+	// required by the MergeMethod is done regardless.
+	NoRebase bool
+
+	// Labels are added to the merge request
+	Labels []string
+
+	// SourceProject is the project of the source branch if it is not the project of the target branch,
+	// e.g. a fork of it
+	SourceProject string
+
+	// RemoveSourceBranch removes the source branch when the merge request is merged, e.g. the bot branch of a
+	// single challenge, see branchtemplate.go
+	RemoveSourceBranch bool
+
+	// Draft creates the merge request as a draft, which is marked as ready before it is merged
+	Draft bool
+
+	// ReadyCheck is called before a draft merge request is marked as ready, an error leaves it a draft
+	ReadyCheck func() error
+
+	// Notify is called with the IID of the merge request once it was created and once it was merged, see hooks.go
+	Notify func(stage HookStage, iid int)
+
+	// Deadline bounds all waits of the merge if set, e.g. to the budget of the challenge, see budget.go
+	Deadline time.Time
+
+	// Pacer spaces the merge request creations of the projects if set, see mrpacer.go
+	Pacer *mergeRequestPacer
+}
+
+// WithLabels returns a copy of the config with the given labels added, empty labels are skipped.
+func (cfg MergeConfig) WithLabels(labels ...string) MergeConfig {
+	merged := make([]string, 0, len(cfg.Labels)+len(labels))
+	merged = append(merged, cfg.Labels...)
+	for _, label := range labels {
+		if label != "" {
+			merged = append(merged, label)
+		}
+	}
+	cfg.Labels = merged
+
+	return cfg
+}
+
+// WithReadyCheck returns a copy of the config with the given check of a draft merge request.
+func (cfg MergeConfig) WithReadyCheck(check func() error) MergeConfig {
+	cfg.ReadyCheck = check
+
+	return cfg
+}
+
+// WithNotify returns a copy of the config calling notify at the stages of the merge request.
+func (cfg MergeConfig) WithNotify(notify func(stage HookStage, iid int)) MergeConfig {
+	cfg.Notify = notify
+
+	return cfg
+}
+
+// notify calls Notify if set.
+func (cfg MergeConfig) notify(stage HookStage, iid int) {
+	if cfg.Notify != nil {
+		cfg.Notify(stage, iid)
+	}
+}
+
+// WithDeadline returns a copy of the config whose waits end at the given deadline.
+func (cfg MergeConfig) WithDeadline(deadline time.Time) MergeConfig {
+	cfg.Deadline = deadline
+
+	return cfg
+}
+
+// timeout returns the Timeout, shortened to the time left until the Deadline.
+func (cfg MergeConfig) timeout() time.Duration {
+	return boundTimeout(cfg.Timeout, cfg.Deadline)
+}
+
+// zoneLabel returns the label of the merge requests changing records of the given zone, e.g. "acme:example.com".
+func zoneLabel(zone string) string {
+	zone = strings.Trim(zone, ".")
+	if zone == "" {
+		return ""
+	}
+
+	return "acme:" + zone
+}
+
+// ParseMergeMethod parses the given string into a merge method. An empty string defaults to merge commits.
+func ParseMergeMethod(s string) (gitlab.MergeMethodValue, error) {
+	switch method := gitlab.MergeMethodValue(strings.ToLower(s)); method {
+	case "":
+		return gitlab.NoFastForwardMerge, nil
+	case gitlab.NoFastForwardMerge, gitlab.FastForwardMerge, gitlab.RebaseMerge, MergeMethodAuto:
+		return method, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidMergeMethod, s)
+}
+
+// ParseApprovalsMode parses the given string into an ApprovalsMode. An empty string defaults to ApprovalsModeFail.
+func ParseApprovalsMode(s string) (ApprovalsMode, error) {
+	switch ApprovalsMode(strings.ToLower(s)) {
+	case "", ApprovalsModeFail:
+		return ApprovalsModeFail, nil
+	case ApprovalsModeWait:
+		return ApprovalsModeWait, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidApprovalsMode, s)
+}
+
+// ParseSelfApprovalMode parses the given string into a SelfApprovalMode. An empty string defaults to SelfApprovalModeFail.
+func ParseSelfApprovalMode(s string) (SelfApprovalMode, error) {
+	switch SelfApprovalMode(strings.ToLower(s)) {
+	case "", SelfApprovalModeFail:
+		return SelfApprovalModeFail, nil
+	case SelfApprovalModeSkip:
+		return SelfApprovalModeSkip, nil
+	case SelfApprovalModeWait:
+		return SelfApprovalModeWait, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidSelfApprovalMode, s)
+}
+
+// Creates a merge request and auto-approves it and merges it.
+// The projectPath is the project of the target branch, the source branch is in cfg.SourceProject if set.
+func Merge(git *gitlab.Client, projectPath string, sourceBranch string, targetBranch string, title string, description string, cfg MergeConfig) error {
+	source, err := resolveSourceProject(git, projectPath, cfg.SourceProject)
+	if err != nil {
+		return err
+	}
+
+	// A previous attempt may have merged the changes already
+	changed, err := hasChanges(git, source, sourceBranch, targetBranch)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		slog.Info("nothing to merge", "source", sourceBranch, "target", targetBranch)
+		return nil
+	}
+
+	// Create a merge request, as a draft until it is ready to be merged
+	if cfg.Draft {
+		title = draftTitlePrefix + title
+	}
+	cm := &gitlab.CreateMergeRequestOptions{
+		Title:        gitlab.Ptr(title),
+		Description:  gitlab.Ptr(description),
+		SourceBranch: gitlab.Ptr(sourceBranch),
+		TargetBranch: gitlab.Ptr(targetBranch),
+	}
+	if source.targetID != 0 {
+		cm.TargetProjectID = gitlab.Ptr(source.targetID)
+	}
+	if len(cfg.Labels) > 0 {
+		cm.Labels = gitlab.Ptr(gitlab.LabelOptions(cfg.Labels))
+	}
+	if err := cfg.Pacer.wait(projectPath, cfg.Deadline); err != nil {
+		return err
+	}
+	mr, err := createMergeRequest(git, source, projectPath, cm)
+	if errors.Is(err, ErrMergeRequestNoDifferences) {
+		// The changes were merged since they were compared, the desired state already holds
+		slog.Info("nothing to merge, GitLab reports no differences", "source", sourceBranch, "target", targetBranch)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	slog.Info("merge request created", "id", mr.IID)
+	cfg.notify(HookMergeRequestCreated, mr.IID)
+
+	// Rebase the bot branch if the project does not allow merge commits
+	method, err := resolveMergeMethod(git, projectPath, cfg.MergeMethod)
+	if err != nil {
+		return err
+	}
+	if method != gitlab.NoFastForwardMerge {
+		if err := rebase(git, projectPath, mr.IID, cfg.timeout()); err != nil {
+			return err
+		}
+	}
+
+	// Auto Approve the merge request
+	approvals, approved, err := approve(git, projectPath, mr.IID, cfg.SelfApprovalMode)
+	if err != nil {
+		return err
+	}
+	if !approved && cfg.SelfApprovalMode == SelfApprovalModeWait {
+		cfg.ApprovalsMode = ApprovalsModeWait
+	}
+
+	// The project may require more approvals than the bot can provide
+	if err := waitForApprovals(git, projectPath, mr.IID, approvals, cfg); err != nil {
+		return err
+	}
+
+	// A draft cannot be merged
+	if err := markReady(git, projectPath, mr, cfg.ReadyCheck); err != nil {
+		return err
+	}
+
+	// Wait until GitLab has checked the merge request
+	if err := waitForMergeable(git, projectPath, mr.IID, cfg); err != nil {
+		return err
+	}
+
+	// Merge the request
+	if err := accept(git, projectPath, mr.IID, cfg); err != nil {
+		return err
+	}
+	cfg.notify(HookMerged, mr.IID)
+
+	return nil
+}
+
+// markReady removes the draft status of the merge request after the check passed. Merge requests that are no
+// drafts are left unchanged, a reused draft of a previous attempt is marked as ready like a new one.
+func markReady(git *gitlab.Client, projectPath string, mr *gitlab.MergeRequest, check func() error) error {
+	if !mr.Draft && !draftTitleRegex.MatchString(mr.Title) {
+		return nil
+	}
+
+	if check != nil {
+		if err := check(); err != nil {
+			return fmt.Errorf("MR %d left as draft: %w", mr.IID, err)
+		}
+	}
+
+	slog.Info("marking merge request as ready", "id", mr.IID)
+	_, _, err := git.MergeRequests.UpdateMergeRequest(projectPath, mr.IID, &gitlab.UpdateMergeRequestOptions{
+		Title: gitlab.Ptr(draftTitleRegex.ReplaceAllString(mr.Title, "")),
+	})
+
+	return err
+}
+
+// accept accepts the merge request. If it fell behind the target branch in the meantime, it is rebased and
+// accepted again, up to mergeRequestAcceptAttempts times. A merge request that was merged concurrently is
+// treated as success.
+func accept(git *gitlab.Client, projectPath string, iid int, cfg MergeConfig) error {
+	for attempt := 1; ; attempt++ {
+		_, _, err := git.MergeRequests.AcceptMergeRequest(projectPath, iid, &gitlab.AcceptMergeRequestOptions{
+			ShouldRemoveSourceBranch: gitlab.Ptr(cfg.RemoveSourceBranch),
+			Squash:                   gitlab.Ptr(cfg.Squash),
+		})
+		if err == nil {
+			return nil
+		}
+
+		mr, _, getErr := git.MergeRequests.GetMergeRequest(projectPath, iid, &gitlab.GetMergeRequestsOptions{})
+		if getErr != nil {
+			return err
+		}
+
+		// The merge request may have been merged concurrently, e.g. by a previous attempt
+		if mr.State == "merged" {
+			slog.Info("merge request already merged", "id", iid)
+			return nil
+		}
+
+		// Only a merge request that fell behind the target branch can be fixed by a rebase
+		if mr.DetailedMergeStatus != "need_rebase" || cfg.NoRebase || attempt >= mergeRequestAcceptAttempts {
+			return err
+		}
+
+		slog.Info("merge request fell behind the target branch, rebasing", "id", iid, "attempt", attempt)
+		if err := rebase(git, projectPath, iid, cfg.timeout()); err != nil {
+			return err
+		}
+		if err := waitForMergeable(git, projectPath, iid, cfg); err != nil {
+			return err
+		}
+	}
+}
+
+// sourceProject is the project of the source branch of a merge request
+type sourceProject struct {
+	path string
+
+	// targetID is the ID of the target project if it differs from the source project, and zero otherwise
+	targetID int
+}
+
+// resolveSourceProject returns the source project of a merge request into the given project. The ID of the
+// target project is only looked up for a cross-project merge request.
+func resolveSourceProject(git *gitlab.Client, projectPath string, sourcePath string) (sourceProject, error) {
+	if sourcePath == "" || sourcePath == projectPath {
+		return sourceProject{path: projectPath}, nil
+	}
+
+	target, _, err := git.Projects.GetProject(projectPath, &gitlab.GetProjectOptions{})
+	if err != nil {
+		return sourceProject{}, err
+	}
+
+	return sourceProject{path: sourcePath, targetID: target.ID}, nil
+}
+
+// compareOptions adds the project of the from ref to the compare options, which go-gitlab does not support
+type compareOptions struct {
+	gitlab.CompareOptions
+	FromProjectID *int `url:"from_project_id,omitempty"`
+}
+
+// hasChanges reports whether the source branch contains changes that are not in the target branch.
+// For a cross-project merge request, the target branch is compared from the target project.
+func hasChanges(git *gitlab.Client, source sourceProject, sourceBranch string, targetBranch string) (bool, error) {
+	opts := &compareOptions{
+		CompareOptions: gitlab.CompareOptions{
+			From: gitlab.Ptr(targetBranch),
+			To:   gitlab.Ptr(sourceBranch),
+		},
+	}
+	if source.targetID != 0 {
+		opts.FromProjectID = gitlab.Ptr(source.targetID)
+	}
+
+	req, err := git.NewRequest(http.MethodGet, fmt.Sprintf("projects/%s/repository/compare", gitlab.PathEscape(source.path)), opts, nil)
+	if err != nil {
+		return false, err
+	}
+
+	cmp := new(gitlab.Compare)
+	if _, err := git.Do(req, cmp); err != nil {
+		return false, err
+	}
+
+	return len(cmp.Commits) > 0 && len(cmp.Diffs) > 0, nil
+}
+
+// createMergeRequest creates the merge request in the source project. If an open merge request for the same
+// branches already exists in the target project, e.g. created by a previous attempt, it is reused instead.
+// If GitLab reports that the source branch has no changes, ErrMergeRequestNoDifferences is returned.
+func createMergeRequest(git *gitlab.Client, source sourceProject, projectPath string, opts *gitlab.CreateMergeRequestOptions) (*gitlab.MergeRequest, error) {
+	mr, resp, err := git.MergeRequests.CreateMergeRequest(source.path, opts)
+	if err == nil {
+		return mr, nil
+	}
+	if resp != nil && resp.StatusCode >= 400 && resp.StatusCode < 500 && noDifferencesRegex.MatchString(err.Error()) {
+		return nil, fmt.Errorf("%w: %w", ErrMergeRequestNoDifferences, err)
+	}
+	if resp == nil || resp.StatusCode != http.StatusConflict {
+		return nil, err
+	}
+
+	mrs, _, listErr := git.MergeRequests.ListProjectMergeRequests(projectPath, &gitlab.ListProjectMergeRequestsOptions{
+		State:        gitlab.Ptr("opened"),
+		SourceBranch: opts.SourceBranch,
+		TargetBranch: opts.TargetBranch,
+	})
+	if listErr != nil {
+		return nil, err
+	}
+
+	// The target project may have open merge requests from branches of the same name in other forks
+	sourceID := 0
+	if source.targetID != 0 {
+		project, _, getErr := git.Projects.GetProject(source.path, &gitlab.GetProjectOptions{})
+		if getErr != nil {
+			return nil, err
+		}
+		sourceID = project.ID
+	}
+
+	for _, mr := range mrs {
+		if sourceID == 0 || mr.SourceProjectID == sourceID {
+			slog.Info("reusing open merge request", "id", mr.IID)
+			return mr, nil
+		}
+	}
+
+	return nil, err
+}
+
+// resolveMergeMethod returns the configured merge method, or the merge method of the project for MergeMethodAuto.
+func resolveMergeMethod(git *gitlab.Client, projectPath string, method gitlab.MergeMethodValue) (gitlab.MergeMethodValue, error) {
+	if method == "" {
+		return gitlab.NoFastForwardMerge, nil
+	}
+	if method != MergeMethodAuto {
+		return method, nil
+	}
+
+	project, _, err := git.Projects.GetProject(projectPath, &gitlab.GetProjectOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	return project.MergeMethod, nil
+}
+
+// rebase rebases the source branch of the merge request onto the target branch and waits for the rebase to finish.
+func rebase(git *gitlab.Client, projectPath string, iid int, timeout time.Duration) error {
+	slog.Info("rebasing merge request", "id", iid)
+	if _, err := git.MergeRequests.RebaseMergeRequest(projectPath, iid, &gitlab.RebaseMergeRequestOptions{}); err != nil {
+		return err
+	}
+
+	var mr *gitlab.MergeRequest
+	rebased, err := pollWithBackoff(timeout, func() (bool, error) {
+		var err error
+		mr, _, err = git.MergeRequests.GetMergeRequest(projectPath, iid, &gitlab.GetMergeRequestsOptions{
+			IncludeRebaseInProgress: gitlab.Ptr(true),
+		})
+		if err != nil {
+			return false, err
+		}
+
+		return !mr.RebaseInProgress, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !rebased {
+		return fmt.Errorf("%w: MR %d still rebasing after %s", ErrMergeRequestRebaseFailed, iid, timeout)
+	}
+	if mr.MergeError != "" {
+		return fmt.Errorf("%w: MR %d: %s", ErrMergeRequestRebaseFailed, iid, mr.MergeError)
+	}
+
+	return nil
+}
+
+// approve approves the merge request and returns its approvals. If GitLab forbids the bot to approve its own
+// merge request, the approvals are returned without the approval of the bot unless the mode is
+// SelfApprovalModeFail. It reports whether the bot approved the merge request.
+func approve(git *gitlab.Client, projectPath string, iid int, mode SelfApprovalMode) (*gitlab.MergeRequestApprovals, bool, error) {
+	approvals, _, err := git.MergeRequestApprovals.ApproveMergeRequest(projectPath, iid, &gitlab.ApproveMergeRequestOptions{})
+	if err == nil {
+		return approvals, true, nil
+	}
+	if !isSelfApprovalForbidden(err) {
+		return nil, false, err
+	}
+	if mode != SelfApprovalModeSkip && mode != SelfApprovalModeWait {
+		return nil, false, fmt.Errorf("%w: approve MR %d as another user or set MERGE_REQUEST_SELF_APPROVAL_MODE: %w", ErrSelfApprovalForbidden, iid, err)
+	}
+
+	slog.Info("approving own merge request is not allowed, continuing without approval", "id", iid, "mode", mode)
+	approvals, _, err = git.MergeRequestApprovals.GetConfiguration(projectPath, iid)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return approvals, false, nil
+}
+
+// isSelfApprovalForbidden reports whether approving a merge request failed because the bot may not approve it.
+// The token was already used to create the merge request, so an authorization error of the approval is caused by
+// the approval settings of the project, e.g. "Prevent approval by author".
+func isSelfApprovalForbidden(err error) bool {
+	var errResp *gitlab.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Response == nil {
+		return false
+	}
+
+	return errResp.Response.StatusCode == http.StatusUnauthorized || errResp.Response.StatusCode == http.StatusForbidden
+}
+
+// waitForApprovals checks that the merge request has all required approvals. Depending on the ApprovalsMode,
+// it either fails naming the missing approvals or polls until they are given.
+func waitForApprovals(git *gitlab.Client, projectPath string, iid int, approvals *gitlab.MergeRequestApprovals, cfg MergeConfig) error {
+	if approvals.ApprovalsLeft <= 0 {
+		return nil
+	}
+
+	if cfg.ApprovalsMode != ApprovalsModeWait {
+		return fmt.Errorf("%w: MR %d requires %d approvals, %d missing", ErrMergeRequestNotApproved, iid, approvals.ApprovalsRequired, approvals.ApprovalsLeft)
+	}
+
+	slog.Info("waiting for approvals", "id", iid, "required", approvals.ApprovalsRequired, "missing", approvals.ApprovalsLeft)
+	timeout := cfg.timeout()
+	approved, err := pollWithBackoff(timeout, func() (bool, error) {
+		var err error
+		approvals, _, err = git.MergeRequestApprovals.GetConfiguration(projectPath, iid)
+		if err != nil {
+			return false, err
+		}
+
+		return approvals.ApprovalsLeft <= 0, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !approved {
+		return fmt.Errorf("%w: MR %d still missing %d of %d approvals after %s", ErrMergeRequestNotApproved, iid, approvals.ApprovalsLeft, approvals.ApprovalsRequired, timeout)
+	}
+
+	return nil
+}
+
+// waitForMergeable polls the merge request with an exponential backoff until it can be merged, every check is
+// delayed by up to the PollJitter. A merge request that is behind the target branch is rebased, up to
+// mergeRequestAcceptAttempts times, unless NoRebase is set. If the timeout is exceeded, the last seen merge
+// status is reported in the error.
+func waitForMergeable(git *gitlab.Client, projectPath string, iid int, cfg MergeConfig) error {
+	timeout := cfg.timeout()
+	rebases := 0
+	noPipelineSince := time.Time{}
+
+	var mr *gitlab.MergeRequest
+	mergeable, err := pollWithJitter(timeout, cfg.PollJitter, func() (bool, error) {
+		var err error
+		mr, _, err = git.MergeRequests.GetMergeRequest(projectPath, iid, &gitlab.GetMergeRequestsOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		// Merged in the meantime, accepting it is handled by the caller
+		if mr.State == "merged" {
+			return true, nil
+		}
+
+		// GitLab does not rebase a merge request that fell behind the target branch by itself
+		if mr.DetailedMergeStatus == "need_rebase" {
+			if cfg.NoRebase || rebases >= mergeRequestAcceptAttempts {
+				return false, fmt.Errorf("%w: MR %d is behind the target branch", ErrMergeRequestNotMergeable, iid)
+			}
+			rebases++
+			slog.Info("merge request is behind the target branch, rebasing", "id", iid, "attempt", rebases)
+			return false, rebase(git, projectPath, iid, timeout)
+		}
+
+		// A project requiring a pipeline without a CI pipeline for merge requests never gets one
+		if accept, err := cfg.checkMissingPipeline(mr, &noPipelineSince); accept || err != nil {
+			return accept, err
+		}
+
+		if !isMergeable(mr) {
+			slog.Info("merge request not mergeable yet", "id", iid, "status", mr.MergeStatus, "detailed_status", mr.DetailedMergeStatus)
+			return false, nil
+		}
+
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !mergeable {
+		return fmt.Errorf("%w: MR %d not mergeable after %s: status=%s (%s)", ErrMergeRequestNotMergeable, iid, timeout, mr.MergeStatus, mr.DetailedMergeStatus)
+	}
+
+	return nil
+}
+
+// pollWithBackoff calls check with an exponential backoff until it returns true, an error or the timeout is exceeded.
+// It returns false if the timeout was exceeded.
+func pollWithBackoff(timeout time.Duration, check func() (bool, error)) (bool, error) {
+	return pollWithJitter(timeout, 0, check)
+}
+
+// pollWithJitter is pollWithBackoff with a random delay of up to jitter before every check, including the first.
+func pollWithJitter(timeout time.Duration, jitter time.Duration, check func() (bool, error)) (bool, error) {
+	start := time.Now()
+	interval := time.Duration(0)
+
+	for {
+		if delay := jitterDelay(interval, jitter); delay > 0 {
+			time.Sleep(min(delay, max(timeout-time.Since(start), 0)))
+		}
+		interval = min(max(interval*2, mergeRequestPollInterval), mergeRequestMaxPollInterval)
+
+		done, err := check()
+		if err != nil || done {
+			return done, err
+		}
+
+		if timeout-time.Since(start) <= 0 {
+			return false, nil
+		}
+	}
+}
+
+// jitterDelay returns the interval plus a random delay in [0, jitter).
+func jitterDelay(interval time.Duration, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+
+	return interval + rand.N(jitter)
+}
+
+// isMergeable reports whether GitLab considers the merge request mergeable.
+// The detailed merge status is preferred, it is only available since GitLab 15.6.
+func isMergeable(mr *gitlab.MergeRequest) bool {
+	if mr.DetailedMergeStatus != "" {
+		return mr.DetailedMergeStatus == "mergeable"
+	}
+
+	return mr.MergeStatus == "can_be_merged"
+}
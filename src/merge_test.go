@@ -0,0 +1,746 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestMergeWaitsForMergeable(t *testing.T) {
+	defer func(d time.Duration) { mergeRequestPollInterval = d }(mergeRequestPollInterval)
+	mergeRequestPollInterval = 10 * time.Millisecond
+
+	fake, srv := newFakeGitlab(t, "main", "old")
+	fake.branches["acme-bot"] = "new"
+	fake.mergeStatus = "checking"
+	fake.detailedMergeStatus = "checking"
+
+	c, err := gitlab.NewClient("token", gitlab.WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// GitLab finishes checking the merge request after a while
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		fake.Lock()
+		fake.mergeStatus = "can_be_merged"
+		fake.detailedMergeStatus = "mergeable"
+		fake.Unlock()
+	}()
+
+	if err := Merge(c, fakeProject, "acme-bot", "main", "title", "description", MergeConfig{Timeout: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.content("main"); got != "new" {
+		t.Errorf("expected target branch to be merged, got %q", got)
+	}
+}
+
+func TestMergeNotMergeableReportsStatus(t *testing.T) {
+	defer func(d time.Duration) { mergeRequestPollInterval = d }(mergeRequestPollInterval)
+	mergeRequestPollInterval = 10 * time.Millisecond
+
+	fake, srv := newFakeGitlab(t, "main", "old")
+	fake.branches["acme-bot"] = "new"
+	fake.mergeStatus = "cannot_be_merged"
+	fake.detailedMergeStatus = "conflict"
+
+	c, err := gitlab.NewClient("token", gitlab.WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Merge(c, fakeProject, "acme-bot", "main", "title", "description", MergeConfig{Timeout: 100 * time.Millisecond})
+	if !errors.Is(err, ErrMergeRequestNotMergeable) {
+		t.Fatalf("expected %v, got %v", ErrMergeRequestNotMergeable, err)
+	}
+	if want := "MR 1 not mergeable after 100ms: status=cannot_be_merged (conflict)"; !strings.Contains(err.Error(), want) {
+		t.Errorf("expected error to contain %q, got %q", want, err)
+	}
+	if got := fake.content("main"); got != "old" {
+		t.Errorf("expected target branch to be unchanged, got %q", got)
+	}
+}
+
+func TestIsMergeable(t *testing.T) {
+	testCases := []struct {
+		name string
+		mr   *gitlab.MergeRequest
+		want bool
+	}{
+		{
+			name: "detailed status mergeable",
+			mr:   &gitlab.MergeRequest{MergeStatus: "can_be_merged", DetailedMergeStatus: "mergeable"},
+			want: true,
+		},
+		{
+			name: "detailed status takes precedence",
+			mr:   &gitlab.MergeRequest{MergeStatus: "can_be_merged", DetailedMergeStatus: "not_approved"},
+			want: false,
+		},
+		{
+			name: "legacy status",
+			mr:   &gitlab.MergeRequest{MergeStatus: "can_be_merged"},
+			want: true,
+		},
+		{
+			name: "checking",
+			mr:   &gitlab.MergeRequest{MergeStatus: "checking"},
+			want: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isMergeable(tc.mr); got != tc.want {
+				t.Errorf("expected %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMergeMissingApprovals(t *testing.T) {
+	defer func(d time.Duration) { mergeRequestPollInterval = d }(mergeRequestPollInterval)
+	mergeRequestPollInterval = 10 * time.Millisecond
+
+	testCases := []struct {
+		name     string
+		mode     ApprovalsMode
+		approved bool
+		want     string
+	}{
+		{
+			name: "fail",
+			mode: ApprovalsModeFail,
+			want: "MR 1 requires 2 approvals, 1 missing",
+		},
+		{
+			name: "wait timeout",
+			mode: ApprovalsModeWait,
+			want: "MR 1 still missing 1 of 2 approvals after 100ms",
+		},
+		{
+			name:     "wait approved",
+			mode:     ApprovalsModeWait,
+			approved: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", "old")
+			fake.branches["acme-bot"] = "new"
+			fake.approvalsRequired = 2
+			fake.approvalsLeft = 1
+
+			c, err := gitlab.NewClient("token", gitlab.WithBaseURL(srv.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Another approver approves the merge request after a while
+			if tc.approved {
+				go func() {
+					time.Sleep(30 * time.Millisecond)
+					fake.Lock()
+					fake.approvalsLeft = 0
+					fake.Unlock()
+				}()
+			}
+
+			err = Merge(c, fakeProject, "acme-bot", "main", "title", "description", MergeConfig{Timeout: 100 * time.Millisecond, ApprovalsMode: tc.mode})
+			if tc.want == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if got := fake.content("main"); got != "new" {
+					t.Errorf("expected target branch to be merged, got %q", got)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrMergeRequestNotApproved) {
+				t.Fatalf("expected %v, got %v", ErrMergeRequestNotApproved, err)
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("expected error to contain %q, got %q", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestMergeSelfApprovalForbidden(t *testing.T) {
+	defer func(d time.Duration) { mergeRequestPollInterval = d }(mergeRequestPollInterval)
+	mergeRequestPollInterval = 10 * time.Millisecond
+
+	testCases := []struct {
+		name          string
+		status        int
+		mode          SelfApprovalMode
+		approvalsLeft int
+		approved      bool
+		err           error
+	}{
+		{
+			name:   "fail",
+			status: http.StatusUnauthorized,
+			mode:   SelfApprovalModeFail,
+			err:    ErrSelfApprovalForbidden,
+		},
+		{
+			name:   "fail forbidden",
+			status: http.StatusForbidden,
+			mode:   SelfApprovalModeFail,
+			err:    ErrSelfApprovalForbidden,
+		},
+		{
+			name:   "skip without required approvals",
+			status: http.StatusUnauthorized,
+			mode:   SelfApprovalModeSkip,
+		},
+		{
+			name:          "skip with required approvals",
+			status:        http.StatusUnauthorized,
+			mode:          SelfApprovalModeSkip,
+			approvalsLeft: 1,
+			err:           ErrMergeRequestNotApproved,
+		},
+		{
+			name:          "wait approved",
+			status:        http.StatusUnauthorized,
+			mode:          SelfApprovalModeWait,
+			approvalsLeft: 1,
+			approved:      true,
+		},
+		{
+			name:          "wait timeout",
+			status:        http.StatusUnauthorized,
+			mode:          SelfApprovalModeWait,
+			approvalsLeft: 1,
+			err:           ErrMergeRequestNotApproved,
+		},
+		{
+			name:   "other error",
+			status: http.StatusInternalServerError,
+			mode:   SelfApprovalModeSkip,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", "old")
+			fake.branches["acme-bot"] = "new"
+			fake.approveStatus = tc.status
+			fake.approvalsRequired = tc.approvalsLeft
+			fake.approvalsLeft = tc.approvalsLeft
+
+			c, err := gitlab.NewClient("token", gitlab.WithBaseURL(srv.URL), gitlab.WithoutRetries())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Another approver approves the merge request after a while
+			if tc.approved {
+				go func() {
+					time.Sleep(30 * time.Millisecond)
+					fake.Lock()
+					fake.approvalsLeft = 0
+					fake.Unlock()
+				}()
+			}
+
+			err = Merge(c, fakeProject, "acme-bot", "main", "title", "description", MergeConfig{Timeout: 100 * time.Millisecond, SelfApprovalMode: tc.mode})
+			if tc.status == http.StatusInternalServerError {
+				// Only authorization errors are caused by the approval settings
+				if err == nil || errors.Is(err, ErrSelfApprovalForbidden) {
+					t.Fatalf("expected the error of GitLab, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if merged := fake.content("main") == "new"; merged != (tc.err == nil) {
+				t.Errorf("expected target branch merged to be %t, got %t", tc.err == nil, merged)
+			}
+		})
+	}
+}
+
+func TestParseSelfApprovalMode(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  SelfApprovalMode
+		err   bool
+	}{
+		{input: "", want: SelfApprovalModeFail},
+		{input: "fail", want: SelfApprovalModeFail},
+		{input: "Skip", want: SelfApprovalModeSkip},
+		{input: "wait", want: SelfApprovalModeWait},
+		{input: "ignore", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseSelfApprovalMode(tc.input)
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+			if tc.err != (err != nil) {
+				t.Errorf("expected error %t, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestParseApprovalsMode(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  ApprovalsMode
+		err   bool
+	}{
+		{input: "", want: ApprovalsModeFail},
+		{input: "fail", want: ApprovalsModeFail},
+		{input: "Wait", want: ApprovalsModeWait},
+		{input: "ignore", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseApprovalsMode(tc.input)
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+			if tc.err != (err != nil) {
+				t.Errorf("expected error %t, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestMergeRebasesFastForwardProjects(t *testing.T) {
+	defer func(d time.Duration) { mergeRequestPollInterval = d }(mergeRequestPollInterval)
+	mergeRequestPollInterval = 10 * time.Millisecond
+
+	testCases := []struct {
+		name     string
+		method   gitlab.MergeMethodValue
+		project  string
+		noRebase bool
+		rebases  int
+		err      bool
+	}{
+		{
+			name:    "merge commit",
+			method:  gitlab.NoFastForwardMerge,
+			project: "merge",
+			rebases: 0,
+		},
+		{
+			name:    "fast forward",
+			method:  gitlab.FastForwardMerge,
+			project: "ff",
+			rebases: 1,
+		},
+		{
+			name:    "auto detects fast forward",
+			method:  MergeMethodAuto,
+			project: "ff",
+			rebases: 1,
+		},
+		{
+			// The merge request is rebased once GitLab reports it as behind the target branch
+			name:    "merge commit on fast forward project",
+			method:  gitlab.NoFastForwardMerge,
+			project: "ff",
+			rebases: 1,
+		},
+		{
+			name:     "merge commit on fast forward project without rebase",
+			method:   gitlab.NoFastForwardMerge,
+			project:  "ff",
+			noRebase: true,
+			rebases:  0,
+			err:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", "old")
+			fake.branches["acme-bot"] = "new"
+			fake.mergeMethod = tc.project
+
+			c, err := gitlab.NewClient("token", gitlab.WithBaseURL(srv.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = Merge(c, fakeProject, "acme-bot", "main", "title", "description", MergeConfig{Timeout: 50 * time.Millisecond, MergeMethod: tc.method, NoRebase: tc.noRebase})
+			if tc.err != (err != nil) {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if fake.rebases != tc.rebases {
+				t.Errorf("expected %d rebases, got %d", tc.rebases, fake.rebases)
+			}
+		})
+	}
+}
+
+func TestParseMergeMethod(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  gitlab.MergeMethodValue
+		err   bool
+	}{
+		{input: "", want: gitlab.NoFastForwardMerge},
+		{input: "merge", want: gitlab.NoFastForwardMerge},
+		{input: "rebase_merge", want: gitlab.RebaseMerge},
+		{input: "FF", want: gitlab.FastForwardMerge},
+		{input: "auto", want: MergeMethodAuto},
+		{input: "squash", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseMergeMethod(tc.input)
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+			if tc.err != (err != nil) {
+				t.Errorf("expected error %t, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestMergeAlreadyDone(t *testing.T) {
+	defer func(d time.Duration) { mergeRequestPollInterval = d }(mergeRequestPollInterval)
+	mergeRequestPollInterval = 10 * time.Millisecond
+
+	testCases := []struct {
+		name          string
+		source        string
+		openMR        bool
+		concurrently  bool
+		mergeRequests int
+	}{
+		{
+			name:          "nothing to merge",
+			source:        "old",
+			mergeRequests: 0,
+		},
+		{
+			name:          "open merge request is reused",
+			source:        "new",
+			openMR:        true,
+			mergeRequests: 1,
+		},
+		{
+			name:          "merged concurrently",
+			source:        "new",
+			concurrently:  true,
+			mergeRequests: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", "old")
+			fake.branches["acme-bot"] = tc.source
+			fake.mergedConcurrently = tc.concurrently
+			if tc.openMR {
+				fake.mergeRequests[1] = &fakeMergeRequest{source: "acme-bot", target: "main", project: fakeProject, state: "opened"}
+			}
+
+			c, err := gitlab.NewClient("token", gitlab.WithBaseURL(srv.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := Merge(c, fakeProject, "acme-bot", "main", "title", "description", MergeConfig{Timeout: 100 * time.Millisecond}); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if got := fake.content("main"); got != tc.source {
+				t.Errorf("expected target branch %q, got %q", tc.source, got)
+			}
+			if got := len(fake.mergeRequests); got != tc.mergeRequests {
+				t.Errorf("expected %d merge requests, got %d", tc.mergeRequests, got)
+			}
+		})
+	}
+}
+
+func TestMergeNoDifferences(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", "old")
+	fake.branches["acme-bot"] = "new"
+	fake.noDifferences = true
+
+	c, err := gitlab.NewClient("token", gitlab.WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// GitLab only reports the missing changes when the merge request is created
+	if err := Merge(c, fakeProject, "acme-bot", "main", "title", "description", MergeConfig{Timeout: 100 * time.Millisecond}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := len(fake.mergeRequests); got != 0 {
+		t.Errorf("expected no merge request, got %d", got)
+	}
+}
+
+func TestMergeRequestLabels(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	solver.mergeConfig.Labels = []string{"acme-bot", "dns"}
+
+	challenge := &acme.ChallengeRequest{
+		ResolvedFQDN: "_acme-challenge.example.com.",
+		ResolvedZone: "example.com.",
+		Key:          "wow-so-secret",
+	}
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"acme-bot", "dns", "acme:example.com"}
+	if got := fake.mergeRequests[1].labels; !slices.Equal(got, want) {
+		t.Errorf("expected labels %q, got %q", want, got)
+	}
+	if got := solver.mergeConfig.Labels; len(got) != 2 {
+		t.Errorf("expected configured labels to be unchanged, got %q", got)
+	}
+}
+
+func TestMergeRetriesAcceptBehindTarget(t *testing.T) {
+	defer func(d time.Duration) { mergeRequestPollInterval = d }(mergeRequestPollInterval)
+	mergeRequestPollInterval = 10 * time.Millisecond
+
+	testCases := []struct {
+		name      string
+		behind    bool
+		conflicts bool
+		noRebase  bool
+		rebases   int
+		err       bool
+	}{
+		{
+			name:    "behind target",
+			behind:  true,
+			rebases: 1,
+		},
+		{
+			name:     "behind target without rebase",
+			behind:   true,
+			noRebase: true,
+			rebases:  0,
+			err:      true,
+		},
+		{
+			name:      "conflict",
+			conflicts: true,
+			rebases:   0,
+			err:       true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", "old")
+			fake.branches["acme-bot"] = "new"
+			fake.fallsBehind = tc.behind
+			fake.conflicts = tc.conflicts
+
+			c, err := gitlab.NewClient("token", gitlab.WithBaseURL(srv.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = Merge(c, fakeProject, "acme-bot", "main", "title", "description", MergeConfig{Timeout: 100 * time.Millisecond, NoRebase: tc.noRebase})
+			if tc.err != (err != nil) {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if fake.rebases != tc.rebases {
+				t.Errorf("expected %d rebases, got %d", tc.rebases, fake.rebases)
+			}
+
+			want := "new"
+			if tc.err {
+				want = "old"
+			}
+			if got := fake.content("main"); got != want {
+				t.Errorf("expected target branch %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestMergeRebasesBehindMergeRequest(t *testing.T) {
+	defer func(d time.Duration) { mergeRequestPollInterval = d }(mergeRequestPollInterval)
+	mergeRequestPollInterval = 10 * time.Millisecond
+
+	testCases := []struct {
+		name     string
+		noRebase bool
+		rebases  int
+		err      error
+	}{
+		{name: "rebase", rebases: 1},
+		{name: "no rebase", noRebase: true, rebases: 0, err: ErrMergeRequestNotMergeable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", "old")
+			fake.branches["acme-bot"] = "new"
+			// The merge request is behind the target branch right away and the rebase takes a few polls
+			fake.behindOnCreate = true
+			fake.rebasePolls = 2
+
+			c, err := gitlab.NewClient("token", gitlab.WithBaseURL(srv.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = Merge(c, fakeProject, "acme-bot", "main", "title", "description", MergeConfig{Timeout: time.Second, NoRebase: tc.noRebase})
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if fake.rebases != tc.rebases {
+				t.Errorf("expected %d rebases, got %d", tc.rebases, fake.rebases)
+			}
+			if fake.rebasing != 0 {
+				t.Errorf("expected the rebase to be polled until done, %d polls left", fake.rebasing)
+			}
+
+			want := "new"
+			if tc.err != nil {
+				want = "old"
+			}
+			if got := fake.content("main"); got != want {
+				t.Errorf("expected target branch %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestJitterDelay(t *testing.T) {
+	testCases := []struct {
+		name     string
+		interval time.Duration
+		jitter   time.Duration
+	}{
+		{name: "disabled", interval: time.Second},
+		{name: "first check", jitter: 500 * time.Millisecond},
+		{name: "later check", interval: time.Second, jitter: 500 * time.Millisecond},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for i := 0; i < 1000; i++ {
+				delay := jitterDelay(tc.interval, tc.jitter)
+				if delay < tc.interval || delay > tc.interval+tc.jitter {
+					t.Fatalf("expected delay in [%s, %s], got %s", tc.interval, tc.interval+tc.jitter, delay)
+				}
+			}
+		})
+	}
+}
+
+func TestMergePollJitter(t *testing.T) {
+	defer func(d time.Duration) { mergeRequestPollInterval = d }(mergeRequestPollInterval)
+	mergeRequestPollInterval = time.Millisecond
+
+	fake, srv := newFakeGitlab(t, "main", "old")
+	fake.branches["acme-bot"] = "new"
+	fake.mergeStatus = "checking"
+	fake.detailedMergeStatus = "checking"
+
+	c, err := gitlab.NewClient("token", gitlab.WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every check of the merge status is delayed by up to the jitter, the timeout still applies
+	jitter := 20 * time.Millisecond
+	timeout := 100 * time.Millisecond
+	start := time.Now()
+	err = Merge(c, fakeProject, "acme-bot", "main", "title", "description", MergeConfig{Timeout: timeout, PollJitter: jitter})
+	if !errors.Is(err, ErrMergeRequestNotMergeable) {
+		t.Fatalf("expected %v, got %v", ErrMergeRequestNotMergeable, err)
+	}
+	if elapsed := time.Since(start); elapsed < timeout || elapsed > timeout+jitter+time.Second {
+		t.Errorf("expected the wait to end after %s plus at most the jitter, got %s", timeout, elapsed)
+	}
+}
+
+func TestMergeDraft(t *testing.T) {
+	errNotReady := errors.New("not ready")
+
+	testCases := []struct {
+		name  string
+		draft bool
+		// reused is the title of an open merge request of a previous attempt
+		reused string
+		check  error
+		err    error
+	}{
+		{name: "not a draft"},
+		{name: "draft", draft: true},
+		{name: "failed check", draft: true, check: errNotReady, err: errNotReady},
+		{name: "reused draft", reused: "Draft: title"},
+		{name: "reused wip", reused: "WIP: title"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", "old")
+			fake.branches["acme-bot"] = "new"
+			if tc.reused != "" {
+				fake.mergeRequests[1] = &fakeMergeRequest{source: "acme-bot", target: "main", project: fakeProject, state: "opened", title: tc.reused}
+			}
+
+			c, err := gitlab.NewClient("token", gitlab.WithBaseURL(srv.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The merge request is a draft until the check passed
+			checked := false
+			check := func() error {
+				checked = true
+				if title := fake.mergeRequests[1].title; !draftTitleRegex.MatchString(title) {
+					t.Errorf("expected a draft before the check, got %q", title)
+				}
+				return tc.check
+			}
+
+			cfg := MergeConfig{Timeout: time.Second, Draft: tc.draft, ReadyCheck: check}
+			if err := Merge(c, fakeProject, "acme-bot", "main", "title", "description", cfg); !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+
+			mr := fake.mergeRequests[1]
+			if checked != (tc.draft || tc.reused != "") {
+				t.Errorf("expected the check to run only for drafts, got %t", checked)
+			}
+			if tc.err != nil {
+				if mr.title != "Draft: title" || mr.state != "opened" || fake.content("main") != "old" {
+					t.Errorf("expected an open draft, got %q in state %s", mr.title, mr.state)
+				}
+				return
+			}
+			if mr.title != "title" || mr.state != "merged" {
+				t.Errorf("expected merged merge request without draft status, got %q in state %s", mr.title, mr.state)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+/*
+This file provides the mirroring of the records to several GitLab instances, for teams that mirror their zone
+across instances, e.g. a primary and a disaster recovery instance, and cannot depend on a single GitLab for the DNS
+updates. ZONE_MIRRORS is a YAML (or JSON) list of the other instances:
+
+  - name: dr
+    url: https://gitlab-dr.example.com
+    tokenEnv: GITLAB_DR_TOKEN
+    project: dns/zones
+    file: example.com.zone
+    branch: main
+    botBranch: acme-bot
+
+url is the URL of the instance, apiURL replaces it like GITLAB_API_URL. tokenEnv names the environment variable
+holding the token of the instance, or with a _FILE suffix the file holding it, so that the token is not part of
+the list. project, file, branch and botBranch
+default to GITLAB_PATH, GITLAB_FILE, GITLAB_TARGET_BRANCH and GITLAB_BOT_BRANCH.
+
+Present and CleanUp are applied to the primary instance of GITLAB_URL and to every mirror at the same time, each
+by its own solver like a zone route, see routes.go. They succeed if at least MIRROR_QUORUM instances succeeded,
+by default one. A record that an instance already has, or no longer has for CleanUp, counts as a success, so that
+the retry of a challenge that failed the quorum catches up on the instances that failed before. The mirrors cannot
+be combined with ZONE_ROUTES, STATE_CONFIGMAP_NAME or GITLAB_FORK_PATH, and the manual cleanup only applies to the
+primary instance.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrMirrorQuorum = errors.New("mirror quorum not reached")
+
+// primaryMirrorName is the name of the instance of GITLAB_URL in logs and errors
+const primaryMirrorName = "primary"
+
+// ZoneMirror is another GitLab instance the records are written to
+type ZoneMirror struct {
+	Name      string `yaml:"name"`
+	URL       string `yaml:"url"`
+	APIURL    string `yaml:"apiURL"`
+	TokenEnv  string `yaml:"tokenEnv"`
+	Project   string `yaml:"project"`
+	File      string `yaml:"file"`
+	Branch    string `yaml:"branch"`
+	BotBranch string `yaml:"botBranch"`
+}
+
+// zoneMirror is the solver writing the records to an instance
+type zoneMirror struct {
+	name   string
+	solver *gitSolver
+}
+
+// ParseZoneMirrors parses the YAML or JSON list of mirrors. An empty string returns no mirrors.
+func ParseZoneMirrors(s string) ([]ZoneMirror, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	dec := yaml.NewDecoder(strings.NewReader(s))
+	dec.KnownFields(true)
+
+	var mirrors []ZoneMirror
+	if err := dec.Decode(&mirrors); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: invalid ZONE_MIRRORS: %w", ErrInvalidConfig, err)
+	}
+
+	names := map[string]bool{primaryMirrorName: true}
+	for i, mirror := range mirrors {
+		if mirror.Name == "" {
+			return nil, fmt.Errorf("%w: invalid ZONE_MIRRORS: mirror %d has no name", ErrInvalidConfig, i)
+		}
+		if names[mirror.Name] {
+			return nil, fmt.Errorf("%w: invalid ZONE_MIRRORS: the name %q of mirror %d is used twice", ErrInvalidConfig, mirror.Name, i)
+		}
+		names[mirror.Name] = true
+
+		if mirror.URL == "" && mirror.APIURL == "" {
+			return nil, fmt.Errorf("%w: invalid ZONE_MIRRORS: mirror %s has no url", ErrInvalidConfig, mirror.Name)
+		}
+		if mirror.TokenEnv == "" {
+			return nil, fmt.Errorf("%w: invalid ZONE_MIRRORS: mirror %s has no tokenEnv", ErrInvalidConfig, mirror.Name)
+		}
+	}
+
+	return mirrors, nil
+}
+
+// setMirrors creates the solvers of the primary instance and of every mirror, which require quorum successes.
+// The requests of the mirrors time out after the given duration.
+func (h *gitSolver) setMirrors(mirrors []ZoneMirror, quorum int, timeout time.Duration) error {
+	if len(mirrors) == 0 {
+		return nil
+	}
+	if len(h.routes) > 0 {
+		return fmt.Errorf("%w: ZONE_MIRRORS cannot be combined with ZONE_ROUTES", ErrInvalidConfig)
+	}
+	if h.store != nil {
+		return fmt.Errorf("%w: ZONE_MIRRORS cannot be combined with STATE_CONFIGMAP_NAME", ErrInvalidConfig)
+	}
+	if h.gitForkPath != "" {
+		return fmt.Errorf("%w: ZONE_MIRRORS cannot be combined with GITLAB_FORK_PATH", ErrInvalidConfig)
+	}
+	if quorum < 1 || quorum > len(mirrors)+1 {
+		return fmt.Errorf("%w: MIRROR_QUORUM must be between 1 and %d, got %d", ErrInvalidConfig, len(mirrors)+1, quorum)
+	}
+
+	h.mirrors = []zoneMirror{{name: primaryMirrorName, solver: h.newRouteSolver(ZoneRoute{})}}
+	for _, mirror := range mirrors {
+		token, err := getEnv(mirror.TokenEnv)
+		if err != nil {
+			return err
+		}
+		if token == "" {
+			return fmt.Errorf("%w: the token of mirror %s is not set in %s", ErrInvalidConfig, mirror.Name, mirror.TokenEnv)
+		}
+
+		var c *gitlab.Client
+		if mirror.APIURL != "" {
+			c, err = NewGitlabAPIClient(token, mirror.APIURL, timeout, nil)
+		} else {
+			c, err = NewGitlabClient(token, mirror.URL, timeout, nil)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: mirror %s: %w", ErrInvalidConfig, mirror.Name, err)
+		}
+
+		solver := h.newRouteSolver(ZoneRoute{
+			Project:   mirror.Project,
+			File:      mirror.File,
+			Branch:    mirror.Branch,
+			BotBranch: mirror.BotBranch,
+		})
+		solver.gitClient = c
+		// An instance being down must not open the circuit of the others
+		if h.breaker != nil {
+			solver.breaker = newCircuitBreaker(h.breaker.threshold, h.breaker.cooldown)
+		}
+
+		h.mirrors = append(h.mirrors, zoneMirror{name: mirror.Name, solver: solver})
+	}
+	h.mirrorQuorum = quorum
+
+	return nil
+}
+
+// applyMirrored applies the operation to all instances at the same time. It fails if less than the quorum of
+// instances succeeded, done reports whether the error of an instance means that it has the wanted state already.
+func (h *gitSolver) applyMirrored(operation string, fqdn string, apply func(*gitSolver) error, done func(error) bool) error {
+	errs := make([]error, len(h.mirrors))
+
+	var wg sync.WaitGroup
+	for i, mirror := range h.mirrors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := apply(mirror.solver); err != nil && !done(err) {
+				errs[i] = fmt.Errorf("%s: %w", mirror.name, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	failed := []error{}
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+
+	succeeded := len(h.mirrors) - len(failed)
+	if succeeded < h.mirrorQuorum {
+		return fmt.Errorf("%w: %s of %s succeeded on %d of %d instances, %d required: %w", ErrMirrorQuorum, operation, fqdn, succeeded, len(h.mirrors), h.mirrorQuorum, errors.Join(failed...))
+	}
+	if len(failed) > 0 {
+		slog.Warn("operation failed on some instances, quorum reached", "operation", operation, "fqdn", fqdn, "succeeded", succeeded, "error", errors.Join(failed...))
+	}
+
+	return nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestParseZoneMirrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		want  int
+		err   bool
+	}{
+		{name: "empty", input: ""},
+		{
+			name:  "yaml",
+			input: "- name: dr\n  url: https://gitlab-dr.example.com\n  tokenEnv: GITLAB_DR_TOKEN\n  project: dns/zones\n",
+			want:  1,
+		},
+		{
+			name:  "json",
+			input: `[{"name": "dr", "apiURL": "https://gitlab-dr.example.com/api/v4", "tokenEnv": "GITLAB_DR_TOKEN"}]`,
+			want:  1,
+		},
+		{name: "no name", input: `[{"url": "https://gitlab-dr.example.com", "tokenEnv": "T"}]`, err: true},
+		{name: "primary name", input: `[{"name": "primary", "url": "https://gitlab-dr.example.com", "tokenEnv": "T"}]`, err: true},
+		{name: "duplicate name", input: `[{"name": "dr", "url": "https://a", "tokenEnv": "T"}, {"name": "dr", "url": "https://b", "tokenEnv": "T"}]`, err: true},
+		{name: "no url", input: `[{"name": "dr", "tokenEnv": "T"}]`, err: true},
+		{name: "no token", input: `[{"name": "dr", "url": "https://gitlab-dr.example.com"}]`, err: true},
+		{name: "token in list", input: `[{"name": "dr", "url": "https://gitlab-dr.example.com", "token": "secret"}]`, err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseZoneMirrors(tc.input)
+			if tc.err != errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if len(got) != tc.want {
+				t.Errorf("expected %d mirrors, got %d", tc.want, len(got))
+			}
+		})
+	}
+}
+
+// newMirroredSolver returns a solver writing to a primary and a disaster recovery fake GitLab, each of which
+// answers with 503 while it is down.
+func newMirroredSolver(t *testing.T, quorum int) (solver *gitSolver, primary *fakeGitlab, dr *fakeGitlab, primaryDown *atomic.Bool, drDown *atomic.Bool) {
+	t.Helper()
+
+	serve := func(fake *fakeGitlab, down *atomic.Bool) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if down.Load() {
+				http.Error(w, `{"message":"503 Service Unavailable"}`, http.StatusServiceUnavailable)
+				return
+			}
+			fake.ServeHTTP(w, r)
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+
+	primaryDown, drDown = &atomic.Bool{}, &atomic.Bool{}
+	primary, _ = newFakeGitlab(t, "main", fakeZone)
+	dr, _ = newFakeGitlab(t, "main", fakeZone)
+	urls := map[string]string{
+		primaryMirrorName: serve(primary, primaryDown).URL,
+		"dr":              serve(dr, drDown).URL,
+	}
+
+	t.Setenv("GITLAB_DR_TOKEN", "token")
+	solver = &gitSolver{
+		name:                "git-solver",
+		txtRecords:          make(map[string]string),
+		gitBotCommentPrefix: "TEST",
+		gitBotBranch:        "acme-bot",
+		gitTargetBranch:     "main",
+		gitPath:             fakeProject,
+		gitFile:             fakeFile,
+		mergeConfig:         MergeConfig{Timeout: time.Second},
+	}
+	if err := solver.setMirrors([]ZoneMirror{{Name: "dr", URL: urls["dr"], TokenEnv: "GITLAB_DR_TOKEN"}}, quorum, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// The client retries 503 responses by default, which only slows the tests down
+	for _, mirror := range solver.mirrors {
+		c, err := gitlab.NewClient("token", gitlab.WithBaseURL(urls[mirror.name]), gitlab.WithoutRetries())
+		if err != nil {
+			t.Fatal(err)
+		}
+		mirror.solver.gitClient = c
+	}
+
+	return solver, primary, dr, primaryDown, drDown
+}
+
+func TestMirroredPresentCleanUp(t *testing.T) {
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+
+	testCases := []struct {
+		name        string
+		quorum      int
+		primaryDown bool
+		drDown      bool
+		err         bool
+	}{
+		{name: "all up, quorum 2", quorum: 2},
+		{name: "dr down, quorum 1", quorum: 1, drDown: true},
+		{name: "primary down, quorum 1", quorum: 1, primaryDown: true},
+		{name: "dr down, quorum 2", quorum: 2, drDown: true, err: true},
+		{name: "all down, quorum 1", quorum: 1, primaryDown: true, drDown: true, err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			solver, primary, dr, primaryDown, drDown := newMirroredSolver(t, tc.quorum)
+			primaryDown.Store(tc.primaryDown)
+			drDown.Store(tc.drDown)
+
+			err := solver.Present(challenge)
+			if tc.err != errors.Is(err, ErrMirrorQuorum) {
+				t.Fatalf("expected quorum error %v, got %v", tc.err, err)
+			}
+
+			// Every instance that is up has the record, whether the quorum was reached or not
+			for name, backend := range map[string]struct {
+				fake *fakeGitlab
+				down bool
+			}{primaryMirrorName: {primary, tc.primaryDown}, "dr": {dr, tc.drDown}} {
+				if got := strings.Contains(backend.fake.content("main"), "wow-so-secret"); got == backend.down {
+					t.Errorf("expected record on %s: %v, got %v", name, !backend.down, got)
+				}
+			}
+
+			// The instances that were down catch up on the retry, the others count as presented already
+			primaryDown.Store(false)
+			drDown.Store(false)
+			if err := solver.Present(challenge); err != nil {
+				t.Fatalf("expected retry to succeed, got %v", err)
+			}
+			for name, fake := range map[string]*fakeGitlab{primaryMirrorName: primary, "dr": dr} {
+				if !strings.Contains(fake.content("main"), "wow-so-secret") {
+					t.Errorf("expected record on %s after the retry, got %q", name, fake.content("main"))
+				}
+			}
+
+			// The cleanup follows the same quorum
+			primaryDown.Store(tc.primaryDown)
+			drDown.Store(tc.drDown)
+			err = solver.CleanUp(challenge)
+			if tc.err != errors.Is(err, ErrMirrorQuorum) {
+				t.Fatalf("expected quorum error %v on cleanup, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestMirroredReconstructBranch(t *testing.T) {
+	pending := strings.Replace(fakeZone, "; TEST-ACME-BOT\n", "; TEST-ACME-BOT\n_acme-challenge.pending.example.com            TXT \"pending\"\n", 1)
+	primary, primarySrv := newFakeGitlab(t, "main", fakeZone)
+	primary.branches["acme-bot"] = pending
+	_, drSrv := newFakeGitlab(t, "main", fakeZone)
+
+	t.Setenv("GITLAB_DR_TOKEN", "token")
+	solver := newTestSolver(t, primarySrv)
+	solver.reconstructBranch = "acme-bot"
+	if err := solver.setMirrors([]ZoneMirror{{Name: "dr", URL: drSrv.URL, TokenEnv: "GITLAB_DR_TOKEN"}}, 1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// The primary instance reconstructs its records from RECONSTRUCT_FROM_BRANCH like the solver without mirrors
+	instance := solver.mirrors[0].solver
+	instance.synced = false
+	if err := instance.syncRecords(); err != nil {
+		t.Fatal(err)
+	}
+	if !instance.hasRecord(instance.recordIDFor("_acme-challenge.pending.example.com.", "pending")) {
+		t.Errorf("expected the record of the bot branch, got %v", instance.txtRecords)
+	}
+}
+
+func TestSetMirrorsValidation(t *testing.T) {
+	t.Setenv("GITLAB_DR_TOKEN", "token")
+	mirrors := []ZoneMirror{{Name: "dr", URL: "https://gitlab-dr.example.com", TokenEnv: "GITLAB_DR_TOKEN"}}
+
+	testCases := []struct {
+		name    string
+		mirrors []ZoneMirror
+		quorum  int
+		fork    string
+	}{
+		{name: "quorum 0", mirrors: mirrors, quorum: 0},
+		{name: "quorum above instances", mirrors: mirrors, quorum: 3},
+		{name: "fork", mirrors: mirrors, quorum: 1, fork: "acme-bot/zones"},
+		{name: "missing token", mirrors: []ZoneMirror{{Name: "dr", URL: "https://gitlab-dr.example.com", TokenEnv: "GITLAB_MISSING_TOKEN"}}, quorum: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &gitSolver{txtRecords: make(map[string]string), gitForkPath: tc.fork}
+			if err := h.setMirrors(tc.mirrors, tc.quorum, time.Second); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("expected %v, got %v", ErrInvalidConfig, err)
+			}
+		})
+	}
+}
+
+func TestSetMirrorsTokenFile(t *testing.T) {
+	_, drSrv := newFakeGitlab(t, "main", fakeZone)
+
+	file := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(file, []byte("token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GITLAB_DR_TOKEN_FILE", file)
+
+	h := &gitSolver{txtRecords: make(map[string]string)}
+	if err := h.setMirrors([]ZoneMirror{{Name: "dr", URL: drSrv.URL, TokenEnv: "GITLAB_DR_TOKEN"}}, 1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.mirrors) != 2 {
+		t.Errorf("expected the primary instance and the mirror, got %d instances", len(h.mirrors))
+	}
+}
@@ -0,0 +1,72 @@
+/*
+This file provides the handling of merge requests waiting for a pipeline that never comes. If the project requires
+a successful pipeline but defines no CI pipeline for merge requests, GitLab never creates one and reports the
+merge request as ci_must_pass until the wait times out. A merge request without a head pipeline after
+MISSING_PIPELINE_GRACE is handled by MISSING_PIPELINE:
+
+  - fail (default): the merge fails right away, naming the missing pipeline.
+  - ignore: the merge request is accepted anyway, e.g. if GitLab considers skipped pipelines successful.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// MissingPipelineMode defines what happens if a merge request requiring a pipeline has none
+type MissingPipelineMode string
+
+const (
+	MissingPipelineFail   MissingPipelineMode = "fail"
+	MissingPipelineIgnore MissingPipelineMode = "ignore"
+)
+
+// defaultMissingPipelineGrace is how long GitLab may take to create the pipeline of a merge request
+const defaultMissingPipelineGrace = 30 * time.Second
+
+var (
+	ErrMissingPipeline            = errors.New("merge request requires a pipeline, but has none")
+	ErrInvalidMissingPipelineMode = errors.New("invalid missing pipeline mode")
+)
+
+// ParseMissingPipelineMode parses the given string into a MissingPipelineMode. An empty string defaults to
+// MissingPipelineFail.
+func ParseMissingPipelineMode(s string) (MissingPipelineMode, error) {
+	switch MissingPipelineMode(strings.ToLower(s)) {
+	case "", MissingPipelineFail:
+		return MissingPipelineFail, nil
+	case MissingPipelineIgnore:
+		return MissingPipelineIgnore, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidMissingPipelineMode, s)
+}
+
+// checkMissingPipeline reports whether the merge request is accepted without its missing pipeline. since holds
+// when the pipeline was first found missing, it is reset once the merge request no longer waits for one.
+func (cfg MergeConfig) checkMissingPipeline(mr *gitlab.MergeRequest, since *time.Time) (bool, error) {
+	if mr.DetailedMergeStatus != "ci_must_pass" || mr.HeadPipeline != nil {
+		*since = time.Time{}
+		return false, nil
+	}
+
+	if since.IsZero() {
+		*since = time.Now()
+	}
+	if time.Since(*since) < cfg.MissingPipelineGrace {
+		return false, nil
+	}
+
+	if cfg.MissingPipeline == MissingPipelineIgnore {
+		slog.Warn("merge request requires a pipeline, but has none, accepting it anyway", "id", mr.IID)
+		return true, nil
+	}
+
+	return false, fmt.Errorf("%w: MR %d has no pipeline after %s, define a CI pipeline for merge requests or set MISSING_PIPELINE to ignore", ErrMissingPipeline, mr.IID, cfg.MissingPipelineGrace)
+}
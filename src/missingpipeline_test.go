@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestParseMissingPipelineMode(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  MissingPipelineMode
+		err   bool
+	}{
+		{input: "", want: MissingPipelineFail},
+		{input: "fail", want: MissingPipelineFail},
+		{input: "Ignore", want: MissingPipelineIgnore},
+		{input: "wait", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseMissingPipelineMode(tc.input)
+			if tc.err != errors.Is(err, ErrInvalidMissingPipelineMode) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMergeMissingPipeline(t *testing.T) {
+	defer func(d time.Duration) { mergeRequestPollInterval = d }(mergeRequestPollInterval)
+	mergeRequestPollInterval = 10 * time.Millisecond
+
+	testCases := []struct {
+		name         string
+		mode         MissingPipelineMode
+		headPipeline bool
+		err          error
+		merged       bool
+	}{
+		{name: "fail", mode: MissingPipelineFail, err: ErrMissingPipeline},
+		{name: "ignore", mode: MissingPipelineIgnore, merged: true},
+		{name: "pipeline running", mode: MissingPipelineFail, headPipeline: true, err: ErrMergeRequestNotMergeable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", "old")
+			fake.branches["acme-bot"] = "new"
+			fake.mergeStatus = "cannot_be_merged"
+			fake.detailedMergeStatus = "ci_must_pass"
+			fake.headPipeline = tc.headPipeline
+
+			c, err := gitlab.NewClient("token", gitlab.WithBaseURL(srv.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// No pipeline appears within the grace period, which ends long before the timeout
+			cfg := MergeConfig{Timeout: 500 * time.Millisecond, MissingPipeline: tc.mode, MissingPipelineGrace: 50 * time.Millisecond}
+			start := time.Now()
+			err = Merge(c, fakeProject, "acme-bot", "main", "title", "description", cfg)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if tc.err == ErrMissingPipeline && time.Since(start) >= cfg.Timeout {
+				t.Errorf("expected the missing pipeline to fail before the timeout, took %s", time.Since(start))
+			}
+			if merged := fake.content("main") == "new"; merged != tc.merged {
+				t.Errorf("expected merged to be %t, got %t", tc.merged, merged)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+/*
+This file provides the pacing of the merge request creation, for GitLab instances limiting how fast merge requests
+are created per project, e.g. GitLab.com. If MERGE_REQUEST_MIN_INTERVAL is set, the merges of the challenges queue
+for their merge request creation so that the merge requests of a project are created at least that interval
+apart. The pacing is separate from GITLAB_RATE_LIMIT, which paces all API requests alike.
+
+The merge requests are created in the order the challenges reached their merge. A challenge whose turn comes after
+its deadline, see budget.go, fails with ErrChallengeTimeout without waiting and gives up its turn.
+*/
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// mergeRequestPacer spaces the merge request creations of every project by the interval. A nil
+// mergeRequestPacer lets every creation through.
+type mergeRequestPacer struct {
+	interval time.Duration
+
+	// next holds the earliest time of the next creation by project
+	lock sync.Mutex
+	next map[string]time.Time
+}
+
+// newMergeRequestPacer creates the pacer spacing the creations by the interval. A pacer created with interval 0
+// is nil.
+func newMergeRequestPacer(interval time.Duration) *mergeRequestPacer {
+	if interval <= 0 {
+		return nil
+	}
+
+	return &mergeRequestPacer{interval: interval, next: make(map[string]time.Time)}
+}
+
+// wait takes the next turn to create a merge request in the project and waits for it. It fails if the turn comes
+// after the deadline.
+func (p *mergeRequestPacer) wait(project string, deadline time.Time) error {
+	if p == nil {
+		return nil
+	}
+
+	p.lock.Lock()
+	turn := time.Now()
+	if next := p.next[project]; next.After(turn) {
+		turn = next
+	}
+	if !deadline.IsZero() && turn.After(deadline) {
+		p.lock.Unlock()
+		return fmt.Errorf("%w: the next merge request of %s can be created at %s", ErrChallengeTimeout, project, turn.Format(time.RFC3339))
+	}
+	p.next[project] = turn.Add(p.interval)
+	p.lock.Unlock()
+
+	if delay := time.Until(turn); delay > 0 {
+		slog.Info("waiting to create the merge request", "project", project, "delay", delay)
+		time.Sleep(delay)
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestMergeRequestPacer(t *testing.T) {
+	const interval = 200 * time.Millisecond
+
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	solver.mergeConfig.Pacer = newMergeRequestPacer(interval)
+
+	for _, key := range []string{"first", "second", "third"} {
+		if err := solver.Present(&acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	created := []time.Time{}
+	for _, mr := range fake.mergeRequests {
+		created = append(created, mr.created)
+	}
+	slices.SortFunc(created, time.Time.Compare)
+	if len(created) != 3 {
+		t.Fatalf("expected 3 merge requests, got %d", len(created))
+	}
+	// The requests are sent the interval apart, their latency may shift the creation slightly
+	for i := 1; i < len(created); i++ {
+		if gap := created[i].Sub(created[i-1]); gap < interval-20*time.Millisecond {
+			t.Errorf("expected the merge requests %s apart, got %s", interval, gap)
+		}
+	}
+}
+
+func TestMergeRequestPacerDeadline(t *testing.T) {
+	pacer := newMergeRequestPacer(time.Hour)
+	if err := pacer.wait("group/project", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next turn is after the deadline, another project has a turn of its own
+	if err := pacer.wait("group/project", time.Now().Add(time.Minute)); !errors.Is(err, ErrChallengeTimeout) {
+		t.Errorf("expected %v, got %v", ErrChallengeTimeout, err)
+	}
+	if err := pacer.wait("group/other", time.Now().Add(time.Minute)); err != nil {
+		t.Errorf("expected the turn of another project, got %v", err)
+	}
+
+	var disabled *mergeRequestPacer
+	if err := disabled.wait("group/project", time.Time{}); err != nil {
+		t.Errorf("expected no pacing, got %v", err)
+	}
+}
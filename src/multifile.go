@@ -0,0 +1,144 @@
+/*
+This file provides the zone files of split-horizon setups, where the same records are published in several zone
+files, e.g. the internal and the external view of a zone. GITLAB_EXTRA_FILES lists the zone files kept next to
+GITLAB_FILE in the same project and branches. Present and CleanUp apply the record change and the serial number
+increase to every zone file and write all of them in a single commit with the commits API. GitLab applies either
+all file actions of the commit or none of them, so the views never diverge, even if one of the files cannot be
+written:
+
+	Add TXT record: _acme-challenge.example.com.
+	    update internal/db.example.com
+	    update external/db.example.com
+
+Each zone file has its own -ACME-BOT block and serial number. A zone file that the change leaves unchanged, e.g.
+because another replica added the record already, is not part of the commit. The extra files apply to the default
+zone file only, zone routes with their own project or files do not inherit them, see routes.go. They cannot be
+combined with GITLAB_SERIAL_FILE or SEPARATE_SERIAL_COMMIT, which write the serial number in a commit of its own.
+*/
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// fileUpdate is the new content of a file of the bot branch
+type fileUpdate struct {
+	file    string
+	content string
+}
+
+// commitBotFiles writes the files to the bot branch in a single commit.
+func (h *gitSolver) commitBotFiles(updates []fileUpdate, message string) error {
+	actions := make([]*gitlab.CommitActionOptions, 0, len(updates))
+	for _, update := range updates {
+		action := &gitlab.CommitActionOptions{
+			Action:   gitlab.Ptr(gitlab.FileUpdate),
+			FilePath: gitlab.Ptr(update.file),
+		}
+		action.Content, action.Encoding = h.commitConfig.Encoding.encode(update.content)
+		actions = append(actions, action)
+	}
+
+	commit, _, err := h.gitClient.Commits.CreateCommit(h.gitBotPath(), h.commitConfig.createCommitOptions(h.gitBotBranch, message, actions))
+	if err != nil {
+		return err
+	}
+
+	for _, update := range updates {
+		written := update.content
+		h.expectRead(h.gitBotPath(), h.gitBotBranch, update.file, func(content string) bool { return content == written })
+		h.pinRead(update.file, commit.ID)
+	}
+
+	return nil
+}
+
+// updateBotZoneFiles writes the changed content of GITLAB_FILE and the edit applied to every extra file to the bot
+// branch in a single commit, increasing the serial number of every changed file if bumpSerial is set. If the files
+// changed concurrently, the edit is applied to the fresh GITLAB_FILE and the commit is retried like
+// writeBotZoneFile. It returns GITLAB_FILE as written to the bot branch.
+func (h *gitSolver) updateBotZoneFiles(content string, message string, edit zoneEdit, bumpSerial bool) (string, error) {
+	for attempt := 1; ; attempt++ {
+		written, updates, err := h.zoneFileUpdates(content, edit, bumpSerial)
+		if err != nil || len(updates) == 0 {
+			return written, err
+		}
+
+		err = h.commitBotFiles(updates, message)
+		if err == nil || !isZoneFileChanged(err) || attempt == zoneFileUpdateAttempts {
+			return written, err
+		}
+
+		slog.Warn("zone files changed since they were read, retrying", "branch", h.gitBotBranch, "attempt", attempt)
+		fresh, err := h.readFile(h.gitBotPath(), h.gitBotBranch, h.gitFile)
+		if err != nil {
+			return "", err
+		}
+		if content, err = edit(fresh); err != nil {
+			return "", err
+		}
+	}
+}
+
+// zoneFileUpdates returns GITLAB_FILE with the changed content and the updates of all zone files the change
+// applies to. The serial numbers are increased past the ones on the bot branch if bumpSerial is set.
+func (h *gitSolver) zoneFileUpdates(content string, edit zoneEdit, bumpSerial bool) (string, []fileUpdate, error) {
+	live, err := h.readFile(h.gitBotPath(), h.gitBotBranch, h.gitFile)
+	if err != nil {
+		return "", nil, err
+	}
+
+	written := content
+	if bumpSerial && content != live {
+		if written, err = h.increaseSerialNumber(content, h.serialNumber(live)); err != nil {
+			return "", nil, err
+		}
+	}
+
+	updates := []fileUpdate{}
+	if written != live {
+		updates = append(updates, fileUpdate{file: h.gitFile, content: written})
+	}
+
+	for _, file := range h.gitExtraFiles {
+		fresh, err := h.readFile(h.gitBotPath(), h.gitBotBranch, file)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		changed, err := edit(fresh)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if changed == fresh {
+			continue
+		}
+		if bumpSerial {
+			if changed, err = h.increaseSerialNumber(changed); err != nil {
+				return "", nil, fmt.Errorf("%s: %w", file, err)
+			}
+		}
+
+		updates = append(updates, fileUpdate{file: file, content: changed})
+	}
+
+	return written, updates, nil
+}
+
+// refreshBotZoneFiles writes GITLAB_FILE and the extra files of the target branch to the bot branch in a single
+// commit, see readBotZoneFile.
+func (h *gitSolver) refreshBotZoneFiles(targetContent string) error {
+	updates := []fileUpdate{{file: h.gitFile, content: targetContent}}
+	for _, file := range h.gitExtraFiles {
+		content, err := h.readFile(h.gitPath, h.gitTargetBranch, file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		updates = append(updates, fileUpdate{file: file, content: content})
+	}
+
+	return h.commitBotFiles(updates, fmt.Sprintf("Refresh zone files from %s", h.gitTargetBranch))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/kallepan/cert-manager-webhook/src/zone"
+	"github.com/xanzy/go-gitlab"
+)
+
+// fakeExternalFile is the external view of fakeFile in the multi-file tests
+const fakeExternalFile = "external/db.zone"
+
+func TestPresentCleanUpExtraFiles(t *testing.T) {
+	const record = `_acme-challenge.example.com            TXT "wow-so-secret"`
+
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	fake.setFile("main", fakeExternalFile, fakeZone)
+	solver := newTestSolver(t, srv)
+	solver.gitExtraFiles = []string{fakeExternalFile}
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+	want, err := zone.NextSerialNumber(zone.SerialNumber(fakeZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{fakeFile, fakeExternalFile} {
+		content, _ := fake.file("main", file)
+		if !strings.Contains(content, record) {
+			t.Errorf("expected the record in %s, got %q", file, content)
+		}
+		if got := zone.SerialNumber(content); got != want {
+			t.Errorf("expected serial number %s in %s, got %s", want, file, got)
+		}
+	}
+
+	if err := solver.CleanUp(challenge); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{fakeFile, fakeExternalFile} {
+		if content, _ := fake.file("main", file); strings.Contains(content, record) {
+			t.Errorf("expected the record to be removed from %s, got %q", file, content)
+		}
+	}
+
+	// Both changes were written as one commit of both files each
+	if len(fake.commits) != 4 || fake.commits[0].id != fake.commits[1].id || fake.commits[2].id != fake.commits[3].id || fake.commits[0].id == fake.commits[2].id {
+		t.Errorf("expected two commits of two files, got %+v", fake.commits)
+	}
+}
+
+func TestPresentExtraFilesAtomic(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	fake.setFile("main", fakeExternalFile, fakeZone)
+	// The update action of the external view is invalid, so GitLab rejects the whole commit
+	fake.invalidFile = fakeExternalFile
+	solver := newTestSolver(t, srv)
+	solver.gitExtraFiles = []string{fakeExternalFile}
+
+	err := solver.Present(&acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"})
+	var errResp *gitlab.ErrorResponse
+	if !errors.As(err, &errResp) {
+		t.Fatalf("expected a GitLab error, got %v", err)
+	}
+
+	if len(fake.commits) != 0 {
+		t.Errorf("expected no commits, got %+v", fake.commits)
+	}
+	for _, branch := range []string{"main", "acme-bot"} {
+		for _, file := range []string{fakeFile, fakeExternalFile} {
+			if content, _ := fake.file(branch, file); content != fakeZone {
+				t.Errorf("expected %s of %s to be unchanged, got %q", file, branch, content)
+			}
+		}
+	}
+}
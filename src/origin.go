@@ -0,0 +1,46 @@
+/*
+This file provides the zone-relative owner names. By default, the owner names of the records are the FQDNs of the
+challenges without ROOT_DOMAIN, a single static zone. If ZONE_RELATIVE_NAMES is set, the owner names are relative
+to the zone cert-manager resolved for the challenge (ResolvedZone) instead, which works for several zones without
+further configuration, e.g. with ZONE_ROUTES. ROOT_DOMAIN remains the fallback for FQDNs outside of the resolved zone.
+
+To read the relative owner names back, the records are resolved against the origin of the zone file: the last
+$ORIGIN directive before the -ACME-BOT block, which must therefore be absolute and name the resolved zone.
+Zone files without such a directive fall back to ROOT_DOMAIN.
+*/
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// originRegex matches the $ORIGIN directives of a zone file
+var originRegex = regexp.MustCompile(`(?m)^\$ORIGIN[ \t]+(\S+)`)
+
+// zoneOrigin returns the origin of the -ACME-BOT block of the content, or an empty string if ZONE_RELATIVE_NAMES
+// is not set or the origin is unknown.
+func (h *gitSolver) zoneOrigin(content string) string {
+	if !h.zoneRelativeNames {
+		return ""
+	}
+
+	end := len(content)
+	if re, err := h.acmeBotBlockRegex(); err == nil {
+		if loc := re.FindStringIndex(content); loc != nil {
+			end = loc[0]
+		}
+	}
+
+	origin := ""
+	for _, match := range originRegex.FindAllStringSubmatch(content[:end], -1) {
+		origin = match[1]
+	}
+
+	// A relative origin is relative to the origin the zone file is loaded with, which is not known
+	if origin == "." || !strings.HasSuffix(origin, ".") {
+		return ""
+	}
+
+	return origin
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestZoneOrigin(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		disabled bool
+		want     string
+	}{
+		{
+			name:    "origin",
+			content: fakeZone,
+			want:    "example.com.",
+		},
+		{
+			name:     "disabled",
+			content:  fakeZone,
+			disabled: true,
+		},
+		{
+			name:    "last origin before the block",
+			content: "$ORIGIN example.org.\n$ORIGIN example.com.\n; TEST-ACME-BOT\n; TEST-ACME-BOT-END\n$ORIGIN example.net.\n",
+			want:    "example.com.",
+		},
+		{
+			name:    "relative origin",
+			content: "$ORIGIN sub\n; TEST-ACME-BOT\n; TEST-ACME-BOT-END\n",
+		},
+		{
+			name:    "no origin",
+			content: "; TEST-ACME-BOT\n; TEST-ACME-BOT-END\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &gitSolver{gitBotCommentPrefix: "TEST", zoneRelativeNames: !tc.disabled}
+			if got := h.zoneOrigin(tc.content); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPresentCleanUpZoneRelativeNames(t *testing.T) {
+	t.Setenv("ROOT_DOMAIN", "")
+	t.Setenv("RECORD_NAME_SUFFIX", "")
+
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	solver.zoneRelativeNames = true
+	solver.verifyAfterMerge = true
+
+	challenge := &acme.ChallengeRequest{
+		ResolvedFQDN: "_acme-challenge.svc.example.com.",
+		ResolvedZone: "example.com.",
+		Key:          "wow-so-secret",
+	}
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if want := "_acme-challenge.svc            TXT \"wow-so-secret\"\n"; !strings.Contains(fake.content("main"), want) {
+		t.Errorf("expected %q in %q", want, fake.content("main"))
+	}
+
+	// A restarted solver reads the record back with the origin of the zone file
+	restarted := newTestSolver(t, srv)
+	restarted.zoneRelativeNames = true
+	restarted.synced = false
+	if err := restarted.Present(challenge); !errors.Is(err, ErrTextRecordAlreadyExists) {
+		t.Errorf("expected %v, got %v", ErrTextRecordAlreadyExists, err)
+	}
+
+	if err := restarted.CleanUp(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(fake.content("main"), "wow-so-secret") {
+		t.Errorf("expected record to be removed, got %q", fake.content("main"))
+	}
+}
@@ -0,0 +1,41 @@
+/*
+This file provides the retry of the whole Present pipeline. The GitLab client retries single requests, but a
+transient failure in the middle of Present, e.g. reading the zone file or creating the merge request after the
+record was written, fails the whole challenge until cert-manager presents it again. If PRESENT_RETRIES is set,
+Present runs the pipeline again after PRESENT_RETRY_DELAY, releasing the zone lock in between, starting from a
+fresh read of the zone file.
+
+A retry is idempotent: the record ID is derived from the FQDN and the key, so a record that a failed attempt wrote
+to the bot branch is found in the zone file and its merge request is merged instead of adding the record twice.
+Permanent errors, see errors.go, are not retried and no retry starts after the deadline of the challenge.
+*/
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// defaultPresentRetryDelay is the delay before the Present pipeline is run again
+const defaultPresentRetryDelay = 5 * time.Second
+
+// retryPipeline runs the pipeline and runs it again up to PRESENT_RETRIES times while it fails with a transient
+// error. retry is set for the runs after the first one.
+func (h *gitSolver) retryPipeline(log *slog.Logger, operation string, deadline time.Time, pipeline func(retry bool) error) error {
+	err := pipeline(false)
+	for attempt := 1; attempt <= h.presentRetries && err != nil; attempt++ {
+		if IsPermanent(err) || errors.Is(err, ErrChallengeTimeout) {
+			return err
+		}
+		if !deadline.IsZero() && time.Now().Add(h.presentRetryDelay).After(deadline) {
+			return err
+		}
+
+		log.Warn("operation failed, running it again", "operation", operation, "attempt", attempt, "error", err)
+		time.Sleep(h.presentRetryDelay)
+		err = pipeline(true)
+	}
+
+	return err
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/kallepan/cert-manager-webhook/src/zone"
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestPresentRetriesPipeline(t *testing.T) {
+	const record = `_acme-challenge.example.com            TXT "wow-so-secret"`
+
+	testCases := []struct {
+		name    string
+		retries int
+		wantErr bool
+	}{
+		{name: "retried", retries: 1},
+		{name: "disabled", retries: 0, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", fakeZone)
+			solver := newTestSolver(t, srv)
+			solver.presentRetries = tc.retries
+			solver.presentRetryDelay = time.Millisecond
+
+			// The client does not retry the failed request itself, so the first attempt fails after writing the record
+			c, err := gitlab.NewClient("token", gitlab.WithBaseURL(srv.URL), gitlab.WithCustomRetryMax(0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			solver.gitClient = c
+			fake.mergeRequestFailures = 1
+
+			err = solver.Present(&acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"})
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected the first attempt to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The retry merged the record of the first attempt instead of adding it again
+			content := fake.content("main")
+			if count := strings.Count(content, record); count != 1 {
+				t.Errorf("expected the record once, got %d times in %q", count, content)
+			}
+			want, err := zone.NextSerialNumber(zone.SerialNumber(fakeZone))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := zone.SerialNumber(content); got != want {
+				t.Errorf("expected the serial number to be increased once to %s, got %s", want, got)
+			}
+			if len(fake.mergeRequests) != 1 {
+				t.Errorf("expected a single merge request, got %d", len(fake.mergeRequests))
+			}
+			if !solver.hasRecord(solver.recordIDFor("_acme-challenge.example.com.", "wow-so-secret")) {
+				t.Error("expected the record to be stored")
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+/*
+This file provides the discovery of the zone project by convention, for organizations in which every team keeps
+its zone file in a "dns" repository of its own. If GITLAB_PATH_TEMPLATE is set, the challenges are handled in the
+project rendered from the go template instead of GITLAB_PATH, e.g.
+
+	dns/{{.Team}}-dns    _acme-challenge.payments.example.com.  ->  dns/payments-dns
+
+The template is rendered with the fields of projectData, which are derived from the FQDN of the challenge, so that
+Present, CleanUp, Verify and the manual cleanup of the same FQDN find the same project. Domain is the FQDN without
+its leading underscore labels, e.g. _acme-challenge, and Team is the label of Domain right below ROOT_DOMAIN, or its
+first label if the FQDN is not below ROOT_DOMAIN.
+
+The rendered project is looked up before its first challenge, a project that does not exist fails the challenge
+with ErrProjectNotFound instead of creating a branch in a typo. Every project is handled by its own solver, like a
+route of ZONE_ROUTES with only a project, see routes.go, and ZONE_ROUTES still take precedence over the template.
+GITLAB_FILE, GITLAB_TARGET_BRANCH and GITLAB_BOT_BRANCH are the same in every project. Group wikis are not
+supported, as their pages cannot be changed through merge requests.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+var ErrProjectNotFound = errors.New("zone project not found")
+
+// projectData is passed to the project template
+type projectData struct {
+	FQDN       string
+	Domain     string
+	DomainSafe string
+	Team       string
+}
+
+// parseProjectTemplate parses the project template and checks that it renders a project path.
+// An empty string disables the template.
+func parseProjectTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	tmpl, err := template.New("project").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid GITLAB_PATH_TEMPLATE: %w", ErrInvalidConfig, err)
+	}
+
+	if _, err := renderProject(tmpl, "_acme-challenge.example.com."); err != nil {
+		return nil, fmt.Errorf("%w: invalid GITLAB_PATH_TEMPLATE: %w", ErrInvalidConfig, err)
+	}
+
+	return tmpl, nil
+}
+
+// newProjectData derives the fields of the project template from the FQDN.
+func newProjectData(fqdn string) projectData {
+	labels := strings.Split(strings.TrimSuffix(fqdn, "."), ".")
+	for len(labels) > 1 && strings.HasPrefix(labels[0], "_") {
+		labels = labels[1:]
+	}
+	domain := strings.Join(labels, ".")
+
+	team := labels[0]
+	if root := strings.Trim(os.Getenv("ROOT_DOMAIN"), "."); root != "" {
+		if prefix, ok := strings.CutSuffix(strings.ToLower(domain), "."+strings.ToLower(root)); ok {
+			team = prefix[strings.LastIndex(prefix, ".")+1:]
+		}
+	}
+
+	return projectData{
+		FQDN:       fqdn,
+		Domain:     domain,
+		DomainSafe: sanitizeRefComponent(domain),
+		Team:       strings.ToLower(team),
+	}
+}
+
+// renderProject renders the path of the zone project of the FQDN.
+func renderProject(tmpl *template.Template, fqdn string) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, newProjectData(fqdn)); err != nil {
+		return "", err
+	}
+
+	project := strings.Trim(strings.TrimSpace(sb.String()), "/")
+	if project == "" || strings.Contains(project, "//") || strings.ContainsAny(project, " \t\n") {
+		return "", fmt.Errorf("%q of %s is not a project path", sb.String(), fqdn)
+	}
+
+	return project, nil
+}
+
+// projectRoute returns the solver of the project rendered from GITLAB_PATH_TEMPLATE for the FQDN. The project
+// is looked up once, its solver is reused for the following challenges.
+func (h *gitSolver) projectRoute(fqdn string) (*gitSolver, error) {
+	project, err := renderProject(h.projectTemplate, fqdn)
+	if err != nil {
+		return nil, fmt.Errorf("%w: GITLAB_PATH_TEMPLATE: %w", ErrInvalidConfig, err)
+	}
+
+	h.projectRoutesLock.Lock()
+	defer h.projectRoutesLock.Unlock()
+
+	if solver, ok := h.projectRoutes[project]; ok {
+		return solver, nil
+	}
+
+	// A missing project is not remembered, so that a project created later is found by the next challenge
+	if _, _, err := h.gitClient.Projects.GetProject(project, &gitlab.GetProjectOptions{}); err != nil {
+		if errors.Is(err, gitlab.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s of %s does not exist or is not visible to the token", ErrProjectNotFound, project, fqdn)
+		}
+		return nil, fmt.Errorf("looking up zone project %s of %s: %w", project, fqdn, err)
+	}
+
+	if h.projectRoutes == nil {
+		h.projectRoutes = make(map[string]*gitSolver)
+	}
+	solver := h.newRouteSolver(ZoneRoute{Project: project})
+	h.projectRoutes[project] = solver
+
+	return solver, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestRenderProject(t *testing.T) {
+	testCases := []struct {
+		name       string
+		template   string
+		rootDomain string
+		fqdn       string
+		want       string
+		err        bool
+	}{
+		{name: "team", template: "dns/{{.Team}}-dns", fqdn: "_acme-challenge.payments.example.com.", want: "dns/payments-dns"},
+		{name: "team below root domain", template: "dns/{{.Team}}-dns", rootDomain: "example.com", fqdn: "_acme-challenge.api.payments.example.com.", want: "dns/payments-dns"},
+		{name: "team outside root domain", template: "dns/{{.Team}}-dns", rootDomain: "example.org", fqdn: "_acme-challenge.api.payments.example.com.", want: "dns/api-dns"},
+		{name: "team is lower case", template: "dns/{{.Team}}-dns", fqdn: "_acme-challenge.Payments.example.com.", want: "dns/payments-dns"},
+		{name: "domain", template: "dns/{{.DomainSafe}}", fqdn: "_acme-challenge.payments.example.com.", want: "dns/payments-example-com"},
+		{name: "underscore labels", template: "{{.Domain}}", fqdn: "_acme-challenge._tcp.example.com.", want: "example.com"},
+		{name: "empty project", template: `{{if false}}dns{{end}}`, fqdn: "_acme-challenge.example.com.", err: true},
+		{name: "unknown field", template: "dns/{{.Zone}}", fqdn: "_acme-challenge.example.com.", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("ROOT_DOMAIN", tc.rootDomain)
+
+			tmpl, err := parseProjectTemplate(tc.template)
+			if tc.err {
+				if !errors.Is(err, ErrInvalidConfig) {
+					t.Fatalf("expected %v, got %v", ErrInvalidConfig, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := renderProject(tmpl, tc.fqdn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+
+	if tmpl, err := parseProjectTemplate(""); tmpl != nil || err != nil {
+		t.Errorf("expected no template, got %v, %v", tmpl, err)
+	}
+}
+
+func TestProjectRoute(t *testing.T) {
+	project := url.PathEscape("dns/payments-dns")
+
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	fake.branches[branchKey(project, "main")] = fakeZone
+	fake.missingProjects = []string{url.PathEscape("dns/billing-dns")}
+
+	solver := newTestSolver(t, srv)
+	tmpl, err := parseProjectTemplate("dns/{{.Team}}-dns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	solver.projectTemplate = tmpl
+
+	// The challenge is handled in the project of its team instead of GITLAB_PATH
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.payments.example.com.", ResolvedZone: "example.com.", Key: "wow-so-secret"}
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if content := fake.content(branchKey(project, "main")); !strings.Contains(content, "wow-so-secret") {
+		t.Errorf("expected the record in the team project, got %q", content)
+	}
+	if content := fake.content("main"); strings.Contains(content, "wow-so-secret") {
+		t.Errorf("expected no record in GITLAB_PATH, got %q", content)
+	}
+
+	// The project is looked up once
+	first, err := solver.route(challenge.ResolvedFQDN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.gitPath != "dns/payments-dns" {
+		t.Errorf("expected dns/payments-dns, got %s", first.gitPath)
+	}
+	if again, _ := solver.route("_acme-challenge.www.payments.example.com."); again == first {
+		t.Errorf("expected the solver of another team for www")
+	}
+	if again, _ := solver.route(challenge.ResolvedFQDN); again != first {
+		t.Errorf("expected the same solver for the same project")
+	}
+
+	if err := solver.CleanUp(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if content := fake.content(branchKey(project, "main")); strings.Contains(content, "wow-so-secret") {
+		t.Errorf("expected the record to be removed from the team project, got %q", content)
+	}
+
+	// A team without a project fails permanently
+	missing := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.billing.example.com.", ResolvedZone: "example.com.", Key: "wow-so-secret"}
+	err = solver.Present(missing)
+	if !errors.Is(err, ErrProjectNotFound) {
+		t.Fatalf("expected %v, got %v", ErrProjectNotFound, err)
+	}
+	if !IsPermanent(err) {
+		t.Errorf("expected %v to be permanent", err)
+	}
+}
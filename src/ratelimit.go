@@ -0,0 +1,54 @@
+/*
+This file provides the client-side rate limit of the GitLab API calls, so that the webhook stays below a fixed
+request rate on a shared GitLab regardless of the number of challenges. If GITLAB_RATE_LIMIT is set, every API
+call waits for a token of a token bucket refilled at GITLAB_RATE_LIMIT requests per second, holding up to
+GITLAB_RATE_LIMIT_BURST tokens. The wait is bounded by GITLAB_HTTP_TIMEOUT like the request itself.
+Without GITLAB_RATE_LIMIT, go-gitlab keeps its own limiter based on the rate limit headers of GitLab.
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+	"golang.org/x/time/rate"
+)
+
+// newRateLimiter creates a limiter allowing requestsPerSecond requests with bursts of up to burst requests.
+// If burst is 0, it is the rate rounded up. A limiter created with requestsPerSecond 0 is nil.
+func newRateLimiter(requestsPerSecond float64, burst int, timeout time.Duration) gitlab.RateLimiter {
+	if requestsPerSecond == 0 {
+		return nil
+	}
+	if burst == 0 {
+		burst = int(math.Ceil(requestsPerSecond))
+	}
+
+	return &timeoutLimiter{
+		limiter: rate.NewLimiter(rate.Limit(requestsPerSecond), burst),
+		timeout: timeout,
+	}
+}
+
+// timeoutLimiter waits for the rate limiter for at most the timeout of a request.
+type timeoutLimiter struct {
+	limiter *rate.Limiter
+	timeout time.Duration
+}
+
+func (l *timeoutLimiter) Wait(ctx context.Context) error {
+	if l.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.timeout)
+		defer cancel()
+	}
+
+	if err := l.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("waiting for GitLab rate limit: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestRateLimitedClient(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+
+	// 20 requests per second without bursts, the first request does not wait
+	c, err := NewGitlabClient("token", srv.URL, time.Second, nil, gitlab.WithCustomLimiter(newRateLimiter(20, 1, time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if _, err := ReadZoneFile(c, "main", fakeProject, fakeFile); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("expected 6 requests to take at least 250ms, took %s", elapsed)
+	}
+	if fake.requests != 6 {
+		t.Errorf("expected 6 requests, got %d", fake.requests)
+	}
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	testCases := []struct {
+		name  string
+		rps   float64
+		burst int
+		want  int
+	}{
+		{name: "explicit burst", rps: 1, burst: 3, want: 3},
+		{name: "rate rounded up", rps: 2.5, want: 3},
+		{name: "below one request per second", rps: 0.1, want: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			limiter := newRateLimiter(tc.rps, tc.burst, time.Second).(*timeoutLimiter)
+			if got := limiter.limiter.Burst(); got != tc.want {
+				t.Errorf("expected burst %d, got %d", tc.want, got)
+			}
+		})
+	}
+
+	if limiter := newRateLimiter(0, 5, time.Second); limiter != nil {
+		t.Errorf("expected no limiter for rate 0, got %v", limiter)
+	}
+}
+
+func TestRateLimiterTimeout(t *testing.T) {
+	// One request every 10 seconds, the second request cannot be sent within the timeout
+	limiter := newRateLimiter(0.1, 1, 50*time.Millisecond)
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if err := limiter.Wait(context.Background()); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("expected wait to be bounded by the timeout, took %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := newRateLimiter(1, 1, 0).Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
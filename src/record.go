@@ -3,6 +3,15 @@ This file provides the Record struct and its methods.
 The struct can be used to represent a DNS record that needs to be added to a zone file and contains a domain and a key.
 The GenerateTextRecord method generates a string representation of the record in the format required for a zone file.
 The Validate method checks if the domain and key are not empty and if the domain has a valid format.
+The ValueFormat controls how the key is rendered: quoted (default) or unquoted. Quoted keys longer than 255 bytes
+are split into several quoted chunks, the chunked format is kept for compatibility and behaves like quoted.
+The OwnerNameCase controls the case of the owner name: preserved as sent by cert-manager (default) or lower-cased,
+for zone files whose tooling expects canonical lower-case names.
+The owner name is made relative to the given zone, usually the ResolvedZone of the challenge, and to ROOT_DOMAIN
+if no zone is given or the domain is not within it.
+The Type is the RR type of the record, TXT by default as required by DNS-01. Other types, e.g. CAA for experimental
+challenge schemes, are set by RECORD_TYPE. Their key is written verbatim as the RDATA of the record, the ValueFormat
+only applies to TXT records.
 */
 package main
 
@@ -12,24 +21,75 @@ import (
 	"log/slog"
 	"os"
 	"regexp"
+	"strings"
 )
 
-const VALID_DOMAIN_REGEX = `^([_a-z0-9]+([-a-z0-9]+)*\.)+[a-z]{2,}\.?$`
+// VALID_DOMAIN_REGEX matches domains case-insensitively, as the case of an owner name is not significant.
+// Any label may start with an underscore, e.g. "_acme-challenge._internal.example.com". The last label is a TLD,
+// or an underscore label if the domain is relative to ROOT_DOMAIN or the zone, e.g. "_acme-challenge._internal".
+const VALID_DOMAIN_REGEX = `^([_a-zA-Z0-9]+([-a-zA-Z0-9]+)*\.)+([a-zA-Z]{2,}|_[a-zA-Z0-9][-a-zA-Z0-9]*)\.?$`
 
-// Precompiled regex for domain validation
-var domainRegex = regexp.MustCompile(VALID_DOMAIN_REGEX)
+// RecordTypeTXT is the default RR type of the records, as required by DNS-01
+const RecordTypeTXT = "TXT"
+
+// TXT_CHUNK_SIZE is the maximum length of a single character-string in a TXT record
+const TXT_CHUNK_SIZE = 255
+
+// ValueFormat defines how the key of a record is written to the zone file
+type ValueFormat string
+
+const (
+	ValueFormatQuoted   ValueFormat = "quoted"
+	ValueFormatUnquoted ValueFormat = "unquoted"
+	ValueFormatChunked  ValueFormat = "chunked"
+
+	// ValueFormatSingleQuoted writes the key in single quotes, it is only set by TXT_QUOTE_STYLE single
+	ValueFormatSingleQuoted ValueFormat = "single-quoted"
+)
+
+// OwnerNameCase defines the case of the owner names written to the zone file
+type OwnerNameCase string
+
+const (
+	OwnerNameCasePreserve OwnerNameCase = "preserve"
+	OwnerNameCaseLower    OwnerNameCase = "lower"
+)
+
+var (
+	ErrInvalidValueFormat   = errors.New("invalid txt value format")
+	ErrInvalidQuoteStyle    = errors.New("invalid txt quote style")
+	ErrInvalidOwnerNameCase = errors.New("invalid owner name case")
+	ErrInvalidRecordType    = errors.New("invalid record type")
+)
+
+// Precompiled regexes for domain and RR type validation
+var (
+	domainRegex     = regexp.MustCompile(VALID_DOMAIN_REGEX)
+	recordTypeRegex = regexp.MustCompile(`^[A-Z][A-Z0-9]*$`)
+)
 
 type Record struct {
 	Domain string
 	Key    string
+	Format ValueFormat
+
+	// Type is the RR type of the record, an empty Type is RecordTypeTXT
+	Type string
 }
 
-// NewRecord creates a new Record with the provided domain and key.
-func NewRecord(domain, key string) *Record {
-	// Remove the root domain from the domain if defined
-	domain = removeRootDomain(domain, os.Getenv("ROOT_DOMAIN"))
+// NewRecord creates a new Record with the provided domain and key, relative to the zone if given.
+func NewRecord(domain, zone, key string) *Record {
+	// Remove the zone from the domain, or the root domain if defined
+	if relative, ok := removeZone(domain, zone); ok {
+		domain = relative
+	} else {
+		domain = removeRootDomain(domain, os.Getenv("ROOT_DOMAIN"))
+	}
 	domain = removeTrailingDot(domain)
 
+	// Append the fixed suffix of the owner names in the zone file if defined
+	domain = addRecordNameSuffix(domain, os.Getenv("RECORD_NAME_SUFFIX"))
+
 	return &Record{
 		Domain: domain,
 		Key:    key,
@@ -50,6 +110,47 @@ func removeRootDomain(domain string, rootDomain string) string {
 	return re.ReplaceAllString(domain, "")
 }
 
+// removeZone returns the domain relative to the zone. It reports false if the zone is empty or the domain is
+// not within it. The zone is matched case-insensitively, with or without trailing dots.
+func removeZone(domain string, zone string) (string, bool) {
+	zone = strings.Trim(zone, ".")
+	if zone == "" {
+		return domain, false
+	}
+
+	domain = strings.TrimSuffix(domain, ".")
+	if strings.EqualFold(domain, zone) {
+		return "", true
+	}
+
+	prefix := len(domain) - len(zone) - 1
+	if prefix <= 0 || domain[prefix] != '.' || !strings.EqualFold(domain[prefix+1:], zone) {
+		return domain, false
+	}
+
+	return domain[:prefix], true
+}
+
+// addRecordNameSuffix appends the suffix as additional labels to the domain.
+func addRecordNameSuffix(domain string, suffix string) string {
+	suffix = strings.Trim(suffix, ".")
+	if domain == "" || suffix == "" {
+		return domain
+	}
+
+	return fmt.Sprintf("%s.%s", domain, suffix)
+}
+
+// removeRecordNameSuffix reverses addRecordNameSuffix.
+func removeRecordNameSuffix(domain string, suffix string) string {
+	suffix = strings.Trim(suffix, ".")
+	if suffix == "" {
+		return domain
+	}
+
+	return strings.TrimSuffix(domain, "."+suffix)
+}
+
 func removeTrailingDot(domain string) string {
 	if len(domain) == 0 {
 		return domain
@@ -61,28 +162,127 @@ func removeTrailingDot(domain string) string {
 	return domain
 }
 
+// ParseValueFormat parses the given string into a ValueFormat. An empty string defaults to ValueFormatQuoted.
+func ParseValueFormat(s string) (ValueFormat, error) {
+	switch ValueFormat(strings.ToLower(s)) {
+	case "", ValueFormatQuoted:
+		return ValueFormatQuoted, nil
+	case ValueFormatUnquoted:
+		return ValueFormatUnquoted, nil
+	case ValueFormatChunked:
+		return ValueFormatChunked, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidValueFormat, s)
+}
+
+// ParseQuoteStyle parses the given TXT_QUOTE_STYLE, one of "double", "none" or "single", into the ValueFormat
+// writing the key with these quotes. An empty string returns an empty ValueFormat, leaving TXT_VALUE_FORMAT in effect.
+func ParseQuoteStyle(s string) (ValueFormat, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return "", nil
+	case "double":
+		return ValueFormatQuoted, nil
+	case "none":
+		return ValueFormatUnquoted, nil
+	case "single":
+		return ValueFormatSingleQuoted, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidQuoteStyle, s)
+}
+
+// ParseOwnerNameCase parses the given string into an OwnerNameCase. An empty string defaults to OwnerNameCasePreserve.
+func ParseOwnerNameCase(s string) (OwnerNameCase, error) {
+	switch OwnerNameCase(strings.ToLower(s)) {
+	case "", OwnerNameCasePreserve:
+		return OwnerNameCasePreserve, nil
+	case OwnerNameCaseLower:
+		return OwnerNameCaseLower, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidOwnerNameCase, s)
+}
+
+// ParseRecordType parses the given string into an upper-case RR type, e.g. "caa" into "CAA". An empty string
+// defaults to RecordTypeTXT.
+func ParseRecordType(s string) (string, error) {
+	if s == "" {
+		return RecordTypeTXT, nil
+	}
+
+	recordType := strings.ToUpper(s)
+	if !recordTypeRegex.MatchString(recordType) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidRecordType, s)
+	}
+
+	return recordType, nil
+}
+
+// apply returns the owner name in the case c.
+func (c OwnerNameCase) apply(name string) string {
+	if c == OwnerNameCaseLower {
+		return strings.ToLower(name)
+	}
+
+	return name
+}
+
 func (r *Record) GenerateTextRecord() (string, error) {
 	if err := r.Validate(); err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf("%s            TXT \"%s\"", r.Domain, r.Key), nil
+	return fmt.Sprintf("%s            %s %s", r.Domain, r.recordType(), r.formatValue()), nil
+}
+
+// recordType returns the RR type of the record.
+func (r *Record) recordType() string {
+	if r.Type == "" {
+		return RecordTypeTXT
+	}
+
+	return r.Type
+}
+
+// formatValue renders the key according to the format of the record.
+// A quoted key longer than TXT_CHUNK_SIZE is always split into several character-strings, as a single
+// character-string cannot hold it (RFC 1035 section 3.3). ValueFormatChunked is kept as an alias of this.
+// A single-quoted key is split the same way, with every chunk in single quotes.
+// The key of a record of another type than TXT is its RDATA and written verbatim.
+func (r *Record) formatValue() string {
+	if r.Format == ValueFormatUnquoted || r.recordType() != RecordTypeTXT {
+		return r.Key
+	}
+
+	quote := "\""
+	if r.Format == ValueFormatSingleQuoted {
+		quote = "'"
+	}
+
+	chunks := []string{}
+	for i := 0; i < len(r.Key); i += TXT_CHUNK_SIZE {
+		end := min(i+TXT_CHUNK_SIZE, len(r.Key))
+		chunks = append(chunks, quote+r.Key[i:end]+quote)
+	}
+	return strings.Join(chunks, " ")
 }
 
 func (r *Record) Validate() error {
 	// Check if the domain is empty
 	if r.Domain == "" {
-		return errors.New("domain is required")
+		return fmt.Errorf("%w: domain is required", ErrInvalidRecord)
 	}
 
 	// Check if the key is empty
 	if r.Key == "" {
-		return errors.New("key is required")
+		return fmt.Errorf("%w: key is required", ErrInvalidRecord)
 	}
 
 	// Validate the domain against the regex
 	if !domainRegex.MatchString(r.Domain) {
-		return errors.New("invalid domain format")
+		return fmt.Errorf("%w: invalid domain format", ErrInvalidRecord)
 	}
 
 	return nil
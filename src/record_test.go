@@ -1,8 +1,15 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/kallepan/cert-manager-webhook/src/zone"
 )
 
 func TestRemoveRootDomain(t *testing.T) {
@@ -120,6 +127,12 @@ func TestGenerateTextRecord(t *testing.T) {
 			want:   "_acme-challenge.example.com            TXT \"key\"",
 			err:    false,
 		},
+		{
+			name:   "underscore labels",
+			domain: "_acme-challenge._internal.example.com.",
+			key:    "key",
+			want:   "_acme-challenge._internal.example.com            TXT \"key\"",
+		},
 		{
 			name:       "svc.example.com",
 			domain:     "_acme-challenge.svc",
@@ -141,6 +154,13 @@ func TestGenerateTextRecord(t *testing.T) {
 			want:       "_acme-challenge.svc            TXT \"key\"",
 			rootDomain: "example.com",
 		},
+		{
+			name:       "underscore labels without root domain",
+			domain:     "_acme-challenge._internal.example.com.",
+			key:        "key",
+			want:       "_acme-challenge._internal            TXT \"key\"",
+			rootDomain: "example.com",
+		},
 		{
 			name:   "invalid domain",
 			domain: "example",
@@ -177,7 +197,7 @@ func TestGenerateTextRecord(t *testing.T) {
 			defer os.Unsetenv("ROOT_DOMAIN")
 		}
 
-		r := NewRecord(tc.domain, tc.key)
+		r := NewRecord(tc.domain, "", tc.key)
 		t.Run(tc.name, func(t *testing.T) {
 			got, err := r.GenerateTextRecord()
 			if got != tc.want {
@@ -195,6 +215,38 @@ func TestGenerateTextRecord(t *testing.T) {
 	}
 }
 
+func TestUnderscoreLabelsRoundTrip(t *testing.T) {
+	testCases := []struct {
+		name       string
+		fqdn       string
+		rootDomain string
+	}{
+		{name: "fqdn", fqdn: "_acme-challenge._internal.example.com."},
+		{name: "without root domain", fqdn: "_acme-challenge._internal.example.com.", rootDomain: "example.com"},
+		{name: "several underscore labels", fqdn: "_acme-challenge._a._b.svc.example.com.", rootDomain: "example.com"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("ROOT_DOMAIN", tc.rootDomain)
+
+			h := &gitSolver{}
+			recordStr, err := h.newRecord(tc.fqdn, "", "key").GenerateTextRecord()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := h.extractTxtRecords(recordStr+"\n", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := map[string]string{h.recordIDFor(tc.fqdn, "key"): "key"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %v, got %v", want, got)
+			}
+		})
+	}
+}
+
 func TestRecordGenerateTextRecord(t *testing.T) {
 	testCases := []struct {
 		name   string
@@ -293,6 +345,12 @@ func TestRecordValidate(t *testing.T) {
 			key:    "key",
 			valid:  true,
 		},
+		{
+			name:   "mixed case",
+			domain: "_acme-challenge.Svc.Example.COM",
+			key:    "key",
+			valid:  true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -313,3 +371,488 @@ func TestRecordValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestParseValueFormat(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		want  ValueFormat
+		err   bool
+	}{
+		{
+			name:  "default",
+			input: "",
+			want:  ValueFormatQuoted,
+		},
+		{
+			name:  "quoted",
+			input: "quoted",
+			want:  ValueFormatQuoted,
+		},
+		{
+			name:  "unquoted uppercase",
+			input: "UNQUOTED",
+			want:  ValueFormatUnquoted,
+		},
+		{
+			name:  "chunked",
+			input: "chunked",
+			want:  ValueFormatChunked,
+		},
+		{
+			name:  "invalid",
+			input: "base64",
+			err:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseValueFormat(tc.input)
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+
+			if tc.err && err == nil {
+				t.Error("expected error, got nil")
+			}
+
+			if !tc.err && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRecordValueFormat(t *testing.T) {
+	longKey := strings.Repeat("a", TXT_CHUNK_SIZE) + "bc"
+
+	testCases := []struct {
+		name   string
+		key    string
+		format ValueFormat
+		want   string
+	}{
+		{
+			name:   "quoted",
+			key:    "key",
+			format: ValueFormatQuoted,
+			want:   "_acme-challenge.example.com            TXT \"key\"",
+		},
+		{
+			name: "default",
+			key:  "key",
+			want: "_acme-challenge.example.com            TXT \"key\"",
+		},
+		{
+			name:   "unquoted",
+			key:    "key",
+			format: ValueFormatUnquoted,
+			want:   "_acme-challenge.example.com            TXT key",
+		},
+		{
+			name:   "chunked short key",
+			key:    "key",
+			format: ValueFormatChunked,
+			want:   "_acme-challenge.example.com            TXT \"key\"",
+		},
+		{
+			name:   "quoted long key",
+			key:    longKey,
+			format: ValueFormatQuoted,
+			want:   fmt.Sprintf("_acme-challenge.example.com            TXT \"%s\" \"bc\"", strings.Repeat("a", TXT_CHUNK_SIZE)),
+		},
+		{
+			name: "default long key",
+			key:  strings.Repeat("k", 2*TXT_CHUNK_SIZE),
+			want: fmt.Sprintf("_acme-challenge.example.com            TXT \"%s\" \"%s\"", strings.Repeat("k", TXT_CHUNK_SIZE), strings.Repeat("k", TXT_CHUNK_SIZE)),
+		},
+		{
+			name:   "chunked long key",
+			key:    longKey,
+			format: ValueFormatChunked,
+			want:   fmt.Sprintf("_acme-challenge.example.com            TXT \"%s\" \"bc\"", strings.Repeat("a", TXT_CHUNK_SIZE)),
+		},
+		{
+			name:   "single-quoted",
+			key:    "key",
+			format: ValueFormatSingleQuoted,
+			want:   "_acme-challenge.example.com            TXT 'key'",
+		},
+		{
+			name:   "single-quoted long key",
+			key:    longKey,
+			format: ValueFormatSingleQuoted,
+			want:   fmt.Sprintf("_acme-challenge.example.com            TXT '%s' 'bc'", strings.Repeat("a", TXT_CHUNK_SIZE)),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &Record{
+				Domain: "_acme-challenge.example.com",
+				Key:    tc.key,
+				Format: tc.format,
+			}
+
+			got, err := r.GenerateTextRecord()
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+
+			// The value must round-trip through zone.ParseTextValue
+			value := strings.TrimPrefix(got, "_acme-challenge.example.com            TXT ")
+			if parsed := zone.ParseTextValue(value); parsed != tc.key {
+				t.Errorf("expected parsed value %q, got %q", tc.key, parsed)
+			}
+		})
+	}
+}
+
+func TestRecordNameSuffix(t *testing.T) {
+	testCases := []struct {
+		name       string
+		domain     string
+		rootDomain string
+		suffix     string
+		want       string
+	}{
+		{
+			name:   "no suffix",
+			domain: "_acme-challenge.svc.example.com.",
+			want:   "_acme-challenge.svc.example.com",
+		},
+		{
+			name:   "suffix without root domain",
+			domain: "_acme-challenge.svc.example.com.",
+			suffix: "challenges",
+			want:   "_acme-challenge.svc.example.com.challenges",
+		},
+		{
+			name:       "suffix after root domain stripping",
+			domain:     "_acme-challenge.svc.example.com.",
+			rootDomain: "example.com",
+			suffix:     "challenges",
+			want:       "_acme-challenge.svc.challenges",
+		},
+		{
+			name:       "suffix with dots",
+			domain:     "_acme-challenge.svc.example.com",
+			rootDomain: "example.com",
+			suffix:     ".acme.challenges.",
+			want:       "_acme-challenge.svc.acme.challenges",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("ROOT_DOMAIN", tc.rootDomain)
+			t.Setenv("RECORD_NAME_SUFFIX", tc.suffix)
+
+			r := NewRecord(tc.domain, "", "key")
+			if r.Domain != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, r.Domain)
+			}
+			if err := r.Validate(); err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+
+			// Removing the suffix restores the owner name without suffix
+			t.Setenv("RECORD_NAME_SUFFIX", "")
+			if got, want := removeRecordNameSuffix(r.Domain, tc.suffix), NewRecord(tc.domain, "", "key").Domain; got != want {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestParseQuoteStyle(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  ValueFormat
+		err   bool
+	}{
+		{input: "", want: ""},
+		{input: "double", want: ValueFormatQuoted},
+		{input: "None", want: ValueFormatUnquoted},
+		{input: "SINGLE", want: ValueFormatSingleQuoted},
+		{input: "backtick", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseQuoteStyle(tc.input)
+			if tc.err != errors.Is(err, ErrInvalidQuoteStyle) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParseRecordType(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  string
+		err   bool
+	}{
+		{input: "", want: RecordTypeTXT},
+		{input: "txt", want: RecordTypeTXT},
+		{input: "caa", want: "CAA"},
+		{input: "TYPE65534", want: "TYPE65534"},
+		{input: "C A A", err: true},
+		{input: "1CAA", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseRecordType(tc.input)
+			if tc.err != errors.Is(err, ErrInvalidRecordType) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRecordType(t *testing.T) {
+	testCases := []struct {
+		name   string
+		record Record
+		want   string
+	}{
+		{
+			name:   "default",
+			record: Record{Domain: "_acme-challenge.example.com", Key: "key"},
+			want:   `_acme-challenge.example.com            TXT "key"`,
+		},
+		{
+			name:   "caa verbatim",
+			record: Record{Domain: "_acme-challenge.example.com", Key: `0 issue "letsencrypt.org"`, Type: "CAA", Format: ValueFormatQuoted},
+			want:   `_acme-challenge.example.com            CAA 0 issue "letsencrypt.org"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.record.GenerateTextRecord()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestQuoteStyleRoundTrip(t *testing.T) {
+	longKey := strings.Repeat("k", TXT_CHUNK_SIZE) + "ey"
+
+	testCases := []struct {
+		style string
+		want  string
+	}{
+		{style: "double", want: fmt.Sprintf(`_acme-challenge.example.com            TXT "%s" "ey"`, strings.Repeat("k", TXT_CHUNK_SIZE))},
+		{style: "none", want: "_acme-challenge.example.com            TXT " + longKey},
+		{style: "single", want: fmt.Sprintf(`_acme-challenge.example.com            TXT '%s' 'ey'`, strings.Repeat("k", TXT_CHUNK_SIZE))},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.style, func(t *testing.T) {
+			format, err := ParseQuoteStyle(tc.style)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fake, srv := newFakeGitlab(t, "main", fakeZone)
+			solver := newTestSolver(t, srv)
+			solver.txtValueFormat = format
+
+			challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: longKey}
+			if err := solver.Present(challenge); err != nil {
+				t.Fatal(err)
+			}
+			if content := fake.content("main"); !strings.Contains(content, tc.want+"\n") {
+				t.Fatalf("expected %q in the zone file, got %q", tc.want, content)
+			}
+
+			// A restarted solver extracts the record from the zone file and finds the key again
+			restarted := newTestSolver(t, srv)
+			restarted.txtValueFormat = format
+			restarted.synced = false
+			if err := restarted.Present(challenge); !errors.Is(err, ErrTextRecordAlreadyExists) {
+				t.Errorf("expected %v, got %v", ErrTextRecordAlreadyExists, err)
+			}
+			if err := restarted.CleanUp(challenge); err != nil {
+				t.Fatal(err)
+			}
+			if content := fake.content("main"); strings.Contains(content, "ey\n") {
+				t.Errorf("expected the record to be removed, got %q", content)
+			}
+		})
+	}
+}
+
+func TestParseOwnerNameCase(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  OwnerNameCase
+		err   bool
+	}{
+		{input: "", want: OwnerNameCasePreserve},
+		{input: "preserve", want: OwnerNameCasePreserve},
+		{input: "LOWER", want: OwnerNameCaseLower},
+		{input: "upper", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseOwnerNameCase(tc.input)
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+			if tc.err != (err != nil) {
+				t.Errorf("expected error %t, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestRecordOwnerNameCase(t *testing.T) {
+	testCases := []struct {
+		name          string
+		ownerNameCase OwnerNameCase
+		want          string
+	}{
+		{
+			name: "default",
+			want: "_acme-challenge.Svc.Example.com            TXT \"Key\"",
+		},
+		{
+			name:          "preserve",
+			ownerNameCase: OwnerNameCasePreserve,
+			want:          "_acme-challenge.Svc.Example.com            TXT \"Key\"",
+		},
+		{
+			name:          "lower",
+			ownerNameCase: OwnerNameCaseLower,
+			want:          "_acme-challenge.svc.example.com            TXT \"Key\"",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("ROOT_DOMAIN", "")
+			t.Setenv("RECORD_NAME_SUFFIX", "")
+
+			// The case of the key is never changed
+			h := &gitSolver{ownerNameCase: tc.ownerNameCase}
+			got, err := h.newRecord("_acme-challenge.Svc.Example.com.", "", "Key").GenerateTextRecord()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestNewRecordZone(t *testing.T) {
+	testCases := []struct {
+		name       string
+		domain     string
+		zone       string
+		rootDomain string
+		want       string
+	}{
+		{
+			name:   "zone",
+			domain: "_acme-challenge.svc.example.com.",
+			zone:   "example.com.",
+			want:   "_acme-challenge.svc",
+		},
+		{
+			name:   "zone without trailing dot",
+			domain: "_acme-challenge.svc.example.com",
+			zone:   "example.com",
+			want:   "_acme-challenge.svc",
+		},
+		{
+			name:   "zone in other case",
+			domain: "_acme-challenge.Svc.Example.com.",
+			zone:   "example.COM.",
+			want:   "_acme-challenge.Svc",
+		},
+		{
+			name:       "zone instead of root domain",
+			domain:     "_acme-challenge.svc.internal.example.com.",
+			zone:       "internal.example.com.",
+			rootDomain: "example.com",
+			want:       "_acme-challenge.svc",
+		},
+		{
+			name:       "root domain outside of zone",
+			domain:     "_acme-challenge.svc.example.com.",
+			zone:       "example.org.",
+			rootDomain: "example.com",
+			want:       "_acme-challenge.svc",
+		},
+		{
+			name:   "label suffix is not the zone",
+			domain: "_acme-challenge.svc.myexample.com.",
+			zone:   "example.com.",
+			want:   "_acme-challenge.svc.myexample.com",
+		},
+		{
+			name:       "no zone",
+			domain:     "_acme-challenge.svc.example.com.",
+			rootDomain: "example.com",
+			want:       "_acme-challenge.svc",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("ROOT_DOMAIN", tc.rootDomain)
+			t.Setenv("RECORD_NAME_SUFFIX", "")
+
+			if got := NewRecord(tc.domain, tc.zone, "key").Domain; got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestNewRecordZoneMatchesRootDomain(t *testing.T) {
+	// Stripping the zone gives the same owner names as stripping a ROOT_DOMAIN set to the zone
+	domains := []string{
+		"_acme-challenge.svc.example.com.",
+		"_acme-challenge.svc.example.com",
+		"_acme-challenge.a.b.example.com.",
+	}
+
+	for _, domain := range domains {
+		t.Run(domain, func(t *testing.T) {
+			t.Setenv("RECORD_NAME_SUFFIX", "challenges")
+
+			t.Setenv("ROOT_DOMAIN", "")
+			zoneBased := NewRecord(domain, "example.com.", "key")
+
+			t.Setenv("ROOT_DOMAIN", "example.com")
+			envBased := NewRecord(domain, "", "key")
+
+			if zoneBased.Domain != envBased.Domain {
+				t.Errorf("expected %q, got %q", envBased.Domain, zoneBased.Domain)
+			}
+		})
+	}
+}
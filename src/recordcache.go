@@ -0,0 +1,37 @@
+/*
+This file provides the switch of the in-memory record cache, txtRecords. By default, Present and CleanUp return
+early if the cache knows that the record exists or does not exist, without reading the zone file. In deployments
+with several replicas, the cache of one replica misses the records presented by the others, so with
+DISABLE_RECORD_CACHE set, these early returns are skipped and the decisions are taken from the zone file of the
+bot branch only, at the cost of a zone file read per call. The cache is still kept up to date, e.g. for the
+record store.
+*/
+package main
+
+// cachedRecord reports whether the cache knows the TXT record with the given ID to exist.
+func (h *gitSolver) cachedRecord(id string) bool {
+	return !h.recordCacheDisabled && h.hasRecord(id)
+}
+
+// cachedMissingRecord reports whether the cache knows the TXT record with the given ID not to exist.
+func (h *gitSolver) cachedMissingRecord(id string) bool {
+	return !h.recordCacheDisabled && !h.hasRecord(id)
+}
+
+// checkZoneRecordExists returns ErrTextRecordDoesNotExist if the cache is disabled and the zone file does not
+// have the TXT record with the given ID. With the cache, this was decided by cachedMissingRecord already.
+func (h *gitSolver) checkZoneRecordExists(content string, id string) error {
+	if !h.recordCacheDisabled {
+		return nil
+	}
+
+	exists, err := h.hasZoneRecord(content, id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrTextRecordDoesNotExist
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+// recordCacheTestCase is a decision of Present or CleanUp with the record in the cache, the zone file or both
+type recordCacheTestCase struct {
+	name     string
+	disabled bool
+	cached   bool
+	inZone   bool
+	err      error
+	// want is whether the zone file of the target branch has the record afterwards
+	want bool
+}
+
+func TestPresentRecordCacheDisabled(t *testing.T) {
+	testCases := []recordCacheTestCase{
+		{name: "cached", cached: true, err: ErrTextRecordAlreadyExists, want: false},
+		{name: "cached, cache disabled", disabled: true, cached: true, want: true},
+		{name: "in zone file, cache disabled", disabled: true, inZone: true, err: ErrTextRecordAlreadyExists, want: true},
+		{name: "missing, cache disabled", disabled: true, want: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testRecordCacheDecision(t, tc, func(solver *gitSolver, ch *acme.ChallengeRequest) error { return solver.Present(ch) })
+		})
+	}
+}
+
+func TestCleanUpRecordCacheDisabled(t *testing.T) {
+	testCases := []recordCacheTestCase{
+		{name: "in zone file", inZone: true, err: ErrTextRecordDoesNotExist, want: true},
+		{name: "in zone file, cache disabled", disabled: true, inZone: true, want: false},
+		{name: "cached, cache disabled", disabled: true, cached: true, err: ErrTextRecordDoesNotExist, want: false},
+		{name: "cached and in zone file, cache disabled", disabled: true, cached: true, inZone: true, want: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testRecordCacheDecision(t, tc, func(solver *gitSolver, ch *acme.ChallengeRequest) error { return solver.CleanUp(ch) })
+		})
+	}
+}
+
+// testRecordCacheDecision runs the operation on a solver whose cache and zone file disagree, e.g. because another
+// replica changed the zone file, and checks the outcome.
+func testRecordCacheDecision(t *testing.T, tc recordCacheTestCase, operation func(*gitSolver, *acme.ChallengeRequest) error) {
+	t.Helper()
+
+	const record = `_acme-challenge.example.com            TXT "wow-so-secret"` + "\n"
+	content := fakeZone
+	if tc.inZone {
+		content = strings.Replace(content, "; TEST-ACME-BOT-END", record+"; TEST-ACME-BOT-END", 1)
+	}
+
+	fake, srv := newFakeGitlab(t, "main", content)
+	solver := newTestSolver(t, srv)
+	solver.recordCacheDisabled = tc.disabled
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+	if tc.cached {
+		solver.setRecord(solver.recordID(challenge), challenge.Key)
+	}
+
+	if err := operation(solver, challenge); !errors.Is(err, tc.err) {
+		t.Fatalf("expected %v, got %v", tc.err, err)
+	}
+	if got := strings.Contains(fake.content("main"), record); got != tc.want {
+		t.Errorf("expected the record in the zone file to be %t, got %q", tc.want, fake.content("main"))
+	}
+}
@@ -0,0 +1,32 @@
+/*
+This file provides the limit of the records in the -ACME-BOT block, a safety valve against runaway additions, e.g.
+cert-manager presenting the same challenges over and over in a loop. If MAX_BLOCK_RECORDS is set, Present fails
+with ErrRecordLimitExceeded instead of adding a record to a block that already holds that many records. The error
+is not permanent, so that cert-manager presents the challenge again once records were cleaned up.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrRecordLimitExceeded = errors.New("-ACME-BOT block record limit exceeded")
+
+// checkRecordLimit fails if the -ACME-BOT block of the zone file cannot take another record. It does nothing
+// unless MAX_BLOCK_RECORDS is set.
+func (h *gitSolver) checkRecordLimit(content string, fqdn string) error {
+	if h.maxBlockRecords <= 0 {
+		return nil
+	}
+
+	txtRecords, err := h.readAcmeBotRecords(content)
+	if err != nil {
+		return err
+	}
+	if len(txtRecords) >= h.maxBlockRecords {
+		return fmt.Errorf("%w: cannot add the record of %s, the block already has %d records, MAX_BLOCK_RECORDS is %d", ErrRecordLimitExceeded, fqdn, len(txtRecords), h.maxBlockRecords)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestPresentRecordLimit(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	solver.maxBlockRecords = 2
+
+	for _, key := range []string{"first", "second"} {
+		if err := solver.Present(&acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	third := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.www.example.com.", Key: "third"}
+	err := solver.Present(third)
+	if !errors.Is(err, ErrRecordLimitExceeded) {
+		t.Fatalf("expected %v, got %v", ErrRecordLimitExceeded, err)
+	}
+	if IsPermanent(err) {
+		t.Errorf("expected a temporary error, got %v", err)
+	}
+	if content := fake.content("main"); strings.Contains(content, "third") {
+		t.Errorf("expected the record not to be added, got %q", content)
+	}
+
+	// The record is added once another one was cleaned up
+	if err := solver.CleanUp(&acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := solver.Present(third); err != nil {
+		t.Fatal(err)
+	}
+}
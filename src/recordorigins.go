@@ -0,0 +1,74 @@
+/*
+This file provides the origins of the presented records, linking the live challenge records to the merge requests
+that added them for auditing and incident response. Present notes the FQDN, the IID of its merge request, the time
+and a hash of the key of every record it added, and the removal of the record from memory forgets it again. The
+origins are part of the health response, see health.go:
+
+	"records": [{"fqdn": "_acme-challenge.example.com.", "mergeRequestIID": 42,
+	             "created": "2026-10-15T09:30:00Z", "keyHash": "9f86d081884c7d65"}]
+
+The key itself is never exposed. Records read from the zone file on startup or adopted from another replica have
+no origin, as the webhook did not create their merge request.
+*/
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// recordOrigin links a presented record to the merge request that added it
+type recordOrigin struct {
+	FQDN            string    `json:"fqdn"`
+	MergeRequestIID int       `json:"mergeRequestIID,omitempty"`
+	Created         time.Time `json:"created"`
+	KeyHash         string    `json:"keyHash"`
+}
+
+// keyHash returns a short hash of the key, so that the records of an FQDN can be told apart without the key.
+func keyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// trackMergeRequest returns the MergeConfig.Notify function firing the merge request stages of the challenge, which
+// also stores the IID of the created merge request in iid.
+func (h *gitSolver) trackMergeRequest(action string, fqdn string, iid *int) func(HookStage, int) {
+	notify := h.mergeHook(action, fqdn)
+
+	return func(stage HookStage, id int) {
+		if stage == HookMergeRequestCreated {
+			*iid = id
+		}
+		notify(stage, id)
+	}
+}
+
+// addOrigin stores the origin of the record with the given ID.
+func (s *operationStatus) addOrigin(id string, origin recordOrigin) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.origins == nil {
+		s.origins = make(map[string]recordOrigin)
+	}
+	s.origins[id] = origin
+}
+
+// removeOrigin forgets the origin of the record with the given ID.
+func (s *operationStatus) removeOrigin(id string) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.origins, id)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestRecordOrigins(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	solver.status = &operationStatus{}
+
+	first := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "first"}
+	second := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.www.example.com.", Key: "second"}
+	for _, ch := range []*acme.ChallengeRequest{first, second} {
+		if err := solver.Present(ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records := solver.status.snapshot().Records
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %+v", records)
+	}
+	for i, ch := range []*acme.ChallengeRequest{first, second} {
+		origin := records[i]
+		if origin.FQDN != ch.ResolvedFQDN || origin.KeyHash != keyHash(ch.Key) || origin.Created.IsZero() {
+			t.Errorf("unexpected origin of %s: %+v", ch.ResolvedFQDN, origin)
+		}
+		mr, ok := fake.mergeRequests[origin.MergeRequestIID]
+		if !ok || !strings.Contains(mr.description, `"`+ch.Key+`"`) {
+			t.Errorf("expected the merge request of %s, got %d", ch.ResolvedFQDN, origin.MergeRequestIID)
+		}
+		if strings.Contains(origin.KeyHash, ch.Key) {
+			t.Errorf("expected the key to be hashed, got %q", origin.KeyHash)
+		}
+	}
+
+	if err := solver.CleanUp(first); err != nil {
+		t.Fatal(err)
+	}
+	records = solver.status.snapshot().Records
+	if len(records) != 1 || records[0].FQDN != second.ResolvedFQDN {
+		t.Errorf("expected only the origin of %s, got %+v", second.ResolvedFQDN, records)
+	}
+}
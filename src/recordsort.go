@@ -0,0 +1,108 @@
+/*
+This file provides the ordering of the records in the -ACME-BOT block, for reviewers of blocks with many records.
+By default, records are appended directly before the end marker. RECORD_SORT rewrites the block after every added
+record in one of the orders:
+
+  - none (default): the records keep the order they were added in.
+  - name: the records are sorted alphabetically by their owner name.
+  - parent: the records are grouped by their parent domain, i.e. the owner name without the _acme-challenge label
+    and its first remaining label, and sorted by owner name within each group.
+
+The groups are ordered by the labels of the parent domain from the top-level domain down, so that the group of a
+subdomain follows the group of its parent domain:
+
+	; ACME-BOT
+	_acme-challenge.api.example.com        TXT "key"
+	_acme-challenge.www.example.com        TXT "key"
+	_acme-challenge.api.staging.example.com        TXT "key"
+	_acme-challenge.mail.example.org        TXT "key"
+	; ACME-BOT-END
+
+The comment of the webhook before a record moves with it, see zone.SortBlock. Structured zone files are not
+supported, as their records are not kept in a block.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kallepan/cert-manager-webhook/src/zone"
+)
+
+// RecordSort defines the order of the records in the -ACME-BOT block
+type RecordSort string
+
+const (
+	RecordSortNone   RecordSort = "none"
+	RecordSortName   RecordSort = "name"
+	RecordSortParent RecordSort = "parent"
+)
+
+var ErrInvalidRecordSort = errors.New("invalid record sort")
+
+// ParseRecordSort parses the given string into a RecordSort. An empty string defaults to RecordSortNone.
+func ParseRecordSort(s string) (RecordSort, error) {
+	switch RecordSort(strings.ToLower(s)) {
+	case "", RecordSortNone:
+		return RecordSortNone, nil
+	case RecordSortName:
+		return RecordSortName, nil
+	case RecordSortParent:
+		return RecordSortParent, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidRecordSort, s)
+}
+
+// key returns the sort key of the owner name, or nil if the records are not sorted.
+func (s RecordSort) key() func(owner string) string {
+	switch s {
+	case RecordSortName:
+		return func(owner string) string { return strings.ToLower(owner) }
+	case RecordSortParent:
+		return parentSortKey
+	}
+
+	return nil
+}
+
+// parentSortKey returns the labels of the parent domain of the owner name from the top-level domain down,
+// followed by the owner name, e.g. "com.example\x00_acme-challenge.www.example.com".
+func parentSortKey(owner string) string {
+	owner = strings.ToLower(strings.TrimSuffix(owner, "."))
+
+	labels := strings.Split(owner, ".")
+	for len(labels) > 0 && strings.HasPrefix(labels[0], "_") {
+		labels = labels[1:]
+	}
+	if len(labels) > 0 {
+		labels = labels[1:]
+	}
+	slices.Reverse(labels)
+
+	return strings.Join(labels, ".") + "\x00" + owner
+}
+
+// sortAcmeBotBlock sorts the records of the -ACME-BOT block of the content as configured by RECORD_SORT.
+// The content is returned unchanged if it has no -ACME-BOT block.
+func (h *gitSolver) sortAcmeBotBlock(content string) (string, error) {
+	key := h.recordSort.key()
+	if key == nil {
+		return content, nil
+	}
+
+	re, err := h.acmeBotBlockRegex()
+	if err != nil {
+		return "", err
+	}
+
+	loc := re.FindStringSubmatchIndex(content)
+	if loc == nil {
+		return content, nil
+	}
+
+	return content[:loc[2]] + zone.SortBlock(content[loc[2]:loc[3]], key) + content[loc[3]:], nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestParseRecordSort(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  RecordSort
+		err   bool
+	}{
+		{input: "", want: RecordSortNone},
+		{input: "none", want: RecordSortNone},
+		{input: "Name", want: RecordSortName},
+		{input: "PARENT", want: RecordSortParent},
+		{input: "zone", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseRecordSort(tc.input)
+			if tc.err != errors.Is(err, ErrInvalidRecordSort) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPresentRecordSort(t *testing.T) {
+	// The FQDNs in the order they are presented
+	fqdns := []string{
+		"_acme-challenge.www.example.org.",
+		"_acme-challenge.api.staging.example.com.",
+		"_acme-challenge.www.example.com.",
+		"_acme-challenge.mail.example.org.",
+		"_acme-challenge.api.example.com.",
+	}
+
+	testCases := []struct {
+		sort RecordSort
+		want []string
+	}{
+		{sort: RecordSortNone, want: fqdns},
+		{
+			sort: RecordSortName,
+			want: []string{
+				"_acme-challenge.api.example.com.",
+				"_acme-challenge.api.staging.example.com.",
+				"_acme-challenge.mail.example.org.",
+				"_acme-challenge.www.example.com.",
+				"_acme-challenge.www.example.org.",
+			},
+		},
+		{
+			sort: RecordSortParent,
+			want: []string{
+				"_acme-challenge.api.example.com.",
+				"_acme-challenge.www.example.com.",
+				"_acme-challenge.api.staging.example.com.",
+				"_acme-challenge.mail.example.org.",
+				"_acme-challenge.www.example.org.",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.sort), func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", fakeZone)
+			solver := newTestSolver(t, srv)
+			solver.recordSort = tc.sort
+			solver.recordBlockSpacing = true
+
+			for _, fqdn := range fqdns {
+				if err := solver.Present(&acme.ChallengeRequest{ResolvedFQDN: fqdn, Key: "key"}); err != nil {
+					t.Fatalf("present %s: %v", fqdn, err)
+				}
+			}
+
+			block, err := solver.extractAcmeBotContent(fake.content("main"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := []string{}
+			for _, line := range strings.Split(strings.TrimSpace(block), "\n") {
+				lines = append(lines, strings.Fields(line)[0]+".")
+			}
+			if strings.Join(lines, " ") != strings.Join(tc.want, " ") {
+				t.Errorf("expected records %v, got %v", tc.want, lines)
+			}
+		})
+	}
+}
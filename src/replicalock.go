@@ -0,0 +1,187 @@
+/*
+This file provides the coordination of several replicas of the webhook without leader election, using GitLab itself
+as the coordination point. If REPLICA_LOCK_BRANCH is set, Present and CleanUp hold an advisory lock from reading the
+zone file until their merge request is merged. The lock is a branch of the bot project with a lock file, created
+from the target branch by a single commit. GitLab only creates the lock file if it does not exist yet, so exactly
+one replica acquires the lock, the others wait until the holder removes the lock branch again.
+
+The lock file names the replica holding the lock and when the lock expires, REPLICA_LOCK_TTL after it was acquired:
+
+	{"holder": "cert-manager-webhook-6f9c8d-x2x7k", "token": "3f2a1b9c4d5e", "expires": "2026-10-15T09:40:00Z"}
+
+An expired lock, e.g. of a replica that was killed while holding it, is stale and removed by the next replica
+waiting for it. The TTL must therefore exceed the longest Present, including the wait for its merge request. A
+replica waits for the lock at most REPLICA_LOCK_TTL, after which the lock it waited for has expired, and never
+beyond the budget of the challenge, see budget.go. The lock only serializes the replicas of the webhook, the changes
+of other writers of the zone file are still handled by conflict.go.
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+const (
+	// replicaLockFile is the file on the lock branch whose existence means that a replica holds the lock
+	replicaLockFile = ".acme-bot.lock"
+
+	// defaultReplicaLockTTL is how long a lock is held at most, far above the usual time to merge a record
+	defaultReplicaLockTTL = 10 * time.Minute
+)
+
+var ErrReplicaLockTimeout = errors.New("timed out waiting for the replica lock")
+
+// replicaLock is the content of the lock file
+type replicaLock struct {
+	Holder  string    `json:"holder"`
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// beginReplicaLock acquires the lock of the replicas for the solver holding the zone lock, waiting until another
+// replica released its lock or the lock is stale. It does nothing unless REPLICA_LOCK_BRANCH is set. The returned
+// function releases the lock.
+func (h *gitSolver) beginReplicaLock(fqdn string) (func(), error) {
+	if h.replicaLockBranch == "" {
+		return func() {}, nil
+	}
+
+	lock := replicaLock{Holder: replicaName(), Token: newRequestID()}
+
+	// One more poll after the TTL finds the lock of the other replica expired
+	acquired, err := pollWithBackoff(h.bounded(h.replicaLockTTL+mergeRequestMaxPollInterval), func() (bool, error) {
+		lock.Expires = time.Now().Add(h.replicaLockTTL).UTC().Truncate(time.Second)
+		return h.tryReplicaLock(lock)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("acquiring replica lock %s: %w", h.replicaLockBranch, err)
+	}
+	if !acquired {
+		return nil, fmt.Errorf("%w: %s was not handled, %s is held by another replica", ErrReplicaLockTimeout, fqdn, h.replicaLockBranch)
+	}
+	slog.Info("replica lock acquired", "branch", h.replicaLockBranch, "expires", lock.Expires)
+
+	return func() {
+		h.releaseReplicaLock(lock)
+	}, nil
+}
+
+// tryReplicaLock creates the lock file on the lock branch. If another replica holds the lock, it reports false
+// and removes the lock if it is stale, so that the next attempt acquires it.
+func (h *gitSolver) tryReplicaLock(lock replicaLock) (bool, error) {
+	content, err := json.Marshal(lock)
+	if err != nil {
+		return false, err
+	}
+
+	action := &gitlab.CommitActionOptions{
+		Action:   gitlab.Ptr(gitlab.FileCreate),
+		FilePath: gitlab.Ptr(replicaLockFile),
+	}
+	action.Content, action.Encoding = h.commitConfig.Encoding.encode(string(content))
+	opts := h.commitConfig.createCommitOptions(h.replicaLockBranch, fmt.Sprintf("Lock zone file for %s", lock.Holder), []*gitlab.CommitActionOptions{action})
+	opts.StartBranch = gitlab.Ptr(h.gitTargetBranch)
+
+	_, _, err = h.gitClient.Commits.CreateCommit(h.gitBotPath(), opts)
+	if err == nil {
+		return true, nil
+	}
+	if !isLockFileExists(err) {
+		return false, err
+	}
+
+	held, err := h.readReplicaLock()
+	if errors.Is(err, gitlab.ErrNotFound) {
+		// The lock was released in the meantime
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if time.Now().Before(held.Expires) {
+		return false, nil
+	}
+
+	slog.Warn("removing stale replica lock", "branch", h.replicaLockBranch, "holder", held.Holder, "expired", held.Expires)
+	return false, h.removeReplicaLock(held)
+}
+
+// releaseReplicaLock removes the lock branch, unless the lock expired and was taken over by another replica.
+// A failed release is only logged, the lock expires after its TTL.
+func (h *gitSolver) releaseReplicaLock(lock replicaLock) {
+	if err := h.removeReplicaLock(lock); err != nil {
+		slog.Warn("failed to release replica lock, it expires after its TTL", "branch", h.replicaLockBranch, "expires", lock.Expires, "error", err)
+		return
+	}
+
+	slog.Info("replica lock released", "branch", h.replicaLockBranch)
+}
+
+// removeReplicaLock deletes the lock branch if the lock file still has the token of the lock, so that a replica
+// never removes a lock acquired by another replica in the meantime.
+func (h *gitSolver) removeReplicaLock(lock replicaLock) error {
+	current, err := h.readReplicaLock()
+	if errors.Is(err, gitlab.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current.Token != lock.Token {
+		slog.Warn("replica lock was taken over by another replica", "branch", h.replicaLockBranch, "holder", current.Holder)
+		return nil
+	}
+
+	_, err = h.gitClient.Branches.DeleteBranch(h.gitBotPath(), h.replicaLockBranch)
+	if errors.Is(err, gitlab.ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// readReplicaLock reads the lock file of the lock branch. A lock file that cannot be parsed is returned as a lock
+// that has expired, so that it is removed as stale.
+func (h *gitSolver) readReplicaLock() (replicaLock, error) {
+	content, err := ReadZoneFile(h.gitClient, h.replicaLockBranch, h.gitBotPath(), replicaLockFile)
+	if err != nil {
+		return replicaLock{}, err
+	}
+
+	var lock replicaLock
+	if err := json.Unmarshal([]byte(content), &lock); err != nil {
+		slog.Warn("replica lock file is invalid", "branch", h.replicaLockBranch, "error", err)
+		return replicaLock{}, nil
+	}
+
+	return lock, nil
+}
+
+// isLockFileExists reports whether GitLab rejected the commit of the lock file because it exists already.
+func isLockFileExists(err error) bool {
+	var errResp *gitlab.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Response == nil || errResp.Response.StatusCode != http.StatusBadRequest {
+		return false
+	}
+
+	return strings.Contains(strings.ToLower(errResp.Message), "already exists")
+}
+
+// replicaName returns the name of the replica holding a lock, the host name, which is the pod name in Kubernetes.
+func replicaName() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "unknown"
+	}
+
+	return name
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+const testReplicaLockBranch = "acme-bot-lock"
+
+// newReplicaTestSolver returns the solver of a replica with the replica lock enabled
+func newReplicaTestSolver(t *testing.T, srv *httptest.Server) *gitSolver {
+	solver := newTestSolver(t, srv)
+	solver.replicaLockBranch = testReplicaLockBranch
+	solver.replicaLockTTL = time.Minute
+
+	return solver
+}
+
+// setReplicaLock makes the fake hold the lock of another replica
+func setReplicaLock(t *testing.T, fake *fakeGitlab, lock replicaLock) {
+	content, err := json.Marshal(lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake.Lock()
+	defer fake.Unlock()
+	fake.branches[testReplicaLockBranch] = fakeZone
+	fake.setFile(testReplicaLockBranch, replicaLockFile, string(content))
+}
+
+// hasReplicaLock reports whether the lock branch exists
+func hasReplicaLock(fake *fakeGitlab) bool {
+	fake.Lock()
+	defer fake.Unlock()
+
+	_, ok := fake.branches[testReplicaLockBranch]
+	return ok
+}
+
+func TestReplicaLockContention(t *testing.T) {
+	defer func(d time.Duration) { mergeRequestPollInterval = d }(mergeRequestPollInterval)
+	defer func(d time.Duration) { mergeRequestMaxPollInterval = d }(mergeRequestMaxPollInterval)
+	mergeRequestPollInterval = 5 * time.Millisecond
+	mergeRequestMaxPollInterval = 20 * time.Millisecond
+
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	first := newReplicaTestSolver(t, srv)
+	second := newReplicaTestSolver(t, srv)
+
+	// The first replica holds the lock, e.g. while it waits for its merge request
+	release, err := first.beginReplicaLock("_acme-challenge.first.example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasReplicaLock(fake) {
+		t.Fatal("expected the lock branch to be created")
+	}
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.second.example.com.", Key: "wow-so-secret"}
+	done := make(chan error, 1)
+	go func() { done <- second.Present(challenge) }()
+
+	// The second replica waits for the lock without touching the zone file
+	select {
+	case err := <-done:
+		t.Fatalf("expected the second replica to wait for the lock, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	fake.Lock()
+	_, created := fake.file("acme-bot", fakeFile)
+	fake.Unlock()
+	if created {
+		t.Error("expected no bot branch while the lock is held")
+	}
+
+	release()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if content := fake.content("main"); !strings.Contains(content, "wow-so-secret") {
+		t.Errorf("expected the record of the second replica, got %q", content)
+	}
+	if hasReplicaLock(fake) {
+		t.Error("expected the lock to be released after the merge")
+	}
+}
+
+func TestReplicaLockStale(t *testing.T) {
+	defer func(d time.Duration) { mergeRequestPollInterval = d }(mergeRequestPollInterval)
+	mergeRequestPollInterval = 5 * time.Millisecond
+
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newReplicaTestSolver(t, srv)
+
+	// The replica holding the lock was killed long ago
+	setReplicaLock(t, fake, replicaLock{Holder: "killed", Token: "stale", Expires: time.Now().Add(-time.Minute)})
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if hasReplicaLock(fake) {
+		t.Error("expected the lock to be released")
+	}
+}
+
+func TestReplicaLockTimeout(t *testing.T) {
+	defer func(d time.Duration) { mergeRequestPollInterval = d }(mergeRequestPollInterval)
+	defer func(d time.Duration) { mergeRequestMaxPollInterval = d }(mergeRequestMaxPollInterval)
+	mergeRequestPollInterval = 5 * time.Millisecond
+	mergeRequestMaxPollInterval = 20 * time.Millisecond
+
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newReplicaTestSolver(t, srv)
+	solver.replicaLockTTL = 50 * time.Millisecond
+
+	// The lock of the other replica does not expire within the wait
+	setReplicaLock(t, fake, replicaLock{Holder: "busy", Token: "held", Expires: time.Now().Add(time.Hour)})
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+	err := solver.Present(challenge)
+	if !errors.Is(err, ErrReplicaLockTimeout) {
+		t.Fatalf("expected %v, got %v", ErrReplicaLockTimeout, err)
+	}
+	if IsPermanent(err) {
+		t.Errorf("expected %v to be retryable", err)
+	}
+	if content := fake.content("main"); strings.Contains(content, "wow-so-secret") {
+		t.Errorf("expected the zone file to be left alone, got %q", content)
+	}
+	if !hasReplicaLock(fake) {
+		t.Error("expected the lock of the other replica to be kept")
+	}
+}
+
+func TestReplicaLockTakenOver(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newReplicaTestSolver(t, srv)
+
+	release, err := solver.beginReplicaLock("_acme-challenge.example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The lock expired and another replica acquired it, releasing must not remove it
+	fake.Lock()
+	delete(fake.branches, testReplicaLockBranch)
+	fake.Unlock()
+	setReplicaLock(t, fake, replicaLock{Holder: "other", Token: "other", Expires: time.Now().Add(time.Minute)})
+
+	release()
+	if !hasReplicaLock(fake) {
+		t.Error("expected the lock of the other replica to be kept")
+	}
+}
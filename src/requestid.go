@@ -0,0 +1,54 @@
+/*
+This file provides the request IDs, to correlate an operation with the commits and the merge request it created.
+Every Present and CleanUp gets a short random ID, which is added to its log lines as request_id, to the commit
+messages as a trailer and to the description of the merge request:
+
+	Add TXT record: _acme-challenge.example.com.
+
+	Request-ID: 3f2a1b9c4d5e
+
+An operator can then search the logs and GitLab for the same ID. A batch of cleanups gets an ID of its own, which
+is logged with the IDs of its cleanups as batch_request_id, see cleanupbatch.go.
+*/
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// requestIDLength is the number of random bytes of a request ID
+const requestIDLength = 6
+
+// newRequestID returns a new random request ID.
+func newRequestID() string {
+	b := make([]byte, requestIDLength)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// requestIDTrailer returns the line naming the request ID in commit messages and merge request descriptions.
+func requestIDTrailer(requestID string) string {
+	return fmt.Sprintf("Request-ID: %s", requestID)
+}
+
+// withRequestID appends the request ID to the merge request description.
+func withRequestID(description string, requestID string) string {
+	return description + "\n\n" + requestIDTrailer(requestID)
+}
+
+// beginRequest adds the request ID to the commits of the solver holding the zone lock. The returned function
+// ends the request. The commits pinned for the reads of another request are dropped, see commitref.go.
+func (h *gitSolver) beginRequest(requestID string) func() {
+	h.commitConfig.RequestID = requestID
+	h.dropReadRefs()
+
+	return func() {
+		h.commitConfig.RequestID = ""
+		h.dropReadRefs()
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	defer func(logger *slog.Logger) { slog.SetDefault(logger) }(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+
+	// The log lines of the operation carry its request ID
+	requestID := ""
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry["msg"] != "Received challenge request" && entry["msg"] != "Challenge request completed" {
+			continue
+		}
+		id, _ := entry["request_id"].(string)
+		if id == "" || (requestID != "" && id != requestID) {
+			t.Fatalf("expected the same request ID in every log line, got %q", line)
+		}
+		requestID = id
+	}
+	if requestID == "" {
+		t.Fatalf("expected log lines with a request ID, got %q", logs.String())
+	}
+
+	// The commit and the merge request name the same request ID
+	trailer := "Request-ID: " + requestID
+	if len(fake.commits) != 1 || !strings.HasSuffix(fake.commits[0].message, "\n\n"+trailer) {
+		t.Errorf("expected a commit with %q, got %+v", trailer, fake.commits)
+	}
+	if mr := fake.mergeRequests[1]; mr == nil || !strings.HasSuffix(mr.description, trailer) {
+		t.Errorf("expected the merge request description to end with %q, got %+v", trailer, mr)
+	}
+
+	// The request ID is only added to the commits of the operation
+	if solver.commitConfig.RequestID != "" {
+		t.Errorf("expected the request ID to be reset, got %q", solver.commitConfig.RequestID)
+	}
+}
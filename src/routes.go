@@ -0,0 +1,250 @@
+/*
+This file provides the routing of challenges to different zone files, for naming schemes that are not a clean
+suffix hierarchy. ZONE_ROUTES is an ordered YAML (or JSON) list of rules, each with a regular expression matched
+against the resolved FQDN of the challenge (including the trailing dot) and the zone file to use:
+
+  - pattern: '\.internal\.example\.com\.$'
+    project: dns/internal
+    file: internal.zone
+    branch: main
+    botBranch: acme-bot-internal
+    fork: acme-bot/internal
+    serialFile: internal.soa.zone
+
+The first matching rule is used for Present and CleanUp. project, file, branch and botBranch default to
+GITLAB_PATH, GITLAB_FILE, GITLAB_TARGET_BRANCH and GITLAB_BOT_BRANCH. fork defaults to GITLAB_FORK_PATH for routes
+without a project, as the fork of the default project does not belong to another project. Likewise, serialFile
+defaults to GITLAB_SERIAL_FILE only for routes without a project and file, and RECONSTRUCT_FROM_BRANCH applies
+only to routes without a project and branch, the other routes reconstruct their records from their own target
+branch. If no rule matches, the challenge fails, unless ZONE_ROUTES_FALLBACK is set, in which case the default
+zone file is used.
+
+Every route is handled by its own solver, with its own records and zone lock, which reads its zone file on the
+first challenge. Routes must therefore not share a bot branch in the same project, as their merges would
+interleave. The routes cannot be combined with STATE_CONFIGMAP_NAME.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrNoZoneRoute = errors.New("no zone route matches the FQDN")
+
+// ZoneRoute routes the challenges of the FQDNs matching the pattern to a zone file
+type ZoneRoute struct {
+	Pattern    string `yaml:"pattern"`
+	Project    string `yaml:"project"`
+	File       string `yaml:"file"`
+	Branch     string `yaml:"branch"`
+	BotBranch  string `yaml:"botBranch"`
+	Fork       string `yaml:"fork"`
+	SerialFile string `yaml:"serialFile"`
+}
+
+// zoneRoute is a ZoneRoute with a compiled pattern and the solver handling its challenges
+type zoneRoute struct {
+	pattern *regexp.Regexp
+	solver  *gitSolver
+}
+
+// ParseZoneRoutes parses the YAML or JSON list of routes. An empty string returns no routes.
+func ParseZoneRoutes(s string) ([]ZoneRoute, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	// Unknown fields are rejected, so that a misspelled key does not silently route to the default zone file
+	dec := yaml.NewDecoder(strings.NewReader(s))
+	dec.KnownFields(true)
+
+	var routes []ZoneRoute
+	if err := dec.Decode(&routes); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: invalid ZONE_ROUTES: %w", ErrInvalidConfig, err)
+	}
+
+	for i, route := range routes {
+		if route.Pattern == "" {
+			return nil, fmt.Errorf("%w: invalid ZONE_ROUTES: route %d has no pattern", ErrInvalidConfig, i)
+		}
+		if _, err := regexp.Compile(route.Pattern); err != nil {
+			return nil, fmt.Errorf("%w: invalid ZONE_ROUTES: route %d: %w", ErrInvalidConfig, i, err)
+		}
+	}
+
+	return routes, nil
+}
+
+// setRoutes creates a solver for every route. The solvers share the configuration of h except for the zone
+// file, and read their zone file on the first challenge.
+func (h *gitSolver) setRoutes(routes []ZoneRoute, fallback bool) error {
+	if len(routes) == 0 {
+		return nil
+	}
+	if h.store != nil {
+		return fmt.Errorf("%w: ZONE_ROUTES cannot be combined with STATE_CONFIGMAP_NAME", ErrInvalidConfig)
+	}
+
+	// Routes on the same bot branch of a project would merge each other's changes
+	botBranches := map[string]int{}
+	if fallback {
+		botBranches[h.gitBotPath()+"\x00"+h.gitBotBranch] = -1
+	}
+
+	h.routes = make([]zoneRoute, 0, len(routes))
+	for i, route := range routes {
+		solver := h.newRouteSolver(route)
+
+		key := solver.gitBotPath() + "\x00" + solver.gitBotBranch
+		if other, ok := botBranches[key]; ok {
+			owner := "the default zone file"
+			if other >= 0 {
+				owner = fmt.Sprintf("route %d", other)
+			}
+			return fmt.Errorf("%w: invalid ZONE_ROUTES: route %d uses the bot branch %q of %s in %s", ErrInvalidConfig, i, solver.gitBotBranch, owner, solver.gitBotPath())
+		}
+		botBranches[key] = i
+
+		h.routes = append(h.routes, zoneRoute{
+			pattern: regexp.MustCompile(route.Pattern),
+			solver:  solver,
+		})
+	}
+	h.routeFallback = fallback
+
+	return nil
+}
+
+// newRouteSolver creates the solver of the route, the empty fields of the route default to those of h.
+func (h *gitSolver) newRouteSolver(route ZoneRoute) *gitSolver {
+	solver := &gitSolver{
+		name:                  h.name,
+		txtRecords:            make(map[string]string),
+		sharedRecordName:      h.sharedRecordName,
+		uniqueRecordNames:     h.uniqueRecordNames,
+		gitClient:             h.gitClient,
+		gitBotCommentPrefix:   h.gitBotCommentPrefix,
+		acmeBotBeginMarker:    h.acmeBotBeginMarker,
+		acmeBotEndMarker:      h.acmeBotEndMarker,
+		createMarkers:         h.createMarkers,
+		markersPosition:       h.markersPosition,
+		gitBotBranch:          h.gitBotBranch,
+		botBranchTemplate:     h.botBranchTemplate,
+		gitTargetBranch:       h.gitTargetBranch,
+		gitPath:               h.gitPath,
+		gitFile:               h.gitFile,
+		gitForkPath:           h.gitForkPath,
+		missingTargetBranch:   h.missingTargetBranch,
+		gitSerialFile:         h.gitSerialFile,
+		gitExtraFiles:         h.gitExtraFiles,
+		mergeConfig:           h.mergeConfig,
+		commitConfig:          h.commitConfig,
+		txtValueFormat:        h.txtValueFormat,
+		recordType:            h.recordType,
+		keyValidation:         h.keyValidation,
+		ownerNameCase:         h.ownerNameCase,
+		zoneRelativeNames:     h.zoneRelativeNames,
+		recordCommentTemplate: h.recordCommentTemplate,
+		changelogTemplate:     h.changelogTemplate,
+		normalizeZoneFile:     h.normalizeZoneFile,
+		zoneFileMaxSize:       h.zoneFileMaxSize,
+		maxBlockRecords:       h.maxBlockRecords,
+		separateSerialCommit:  h.separateSerialCommit,
+		optionalSerial:        h.optionalSerial,
+		keepSerialOnCleanup:   h.keepSerialOnCleanup,
+		cleanupBatchWindow:    h.cleanupBatchWindow,
+		replicaLockBranch:     h.replicaLockBranch,
+		replicaLockTTL:        h.replicaLockTTL,
+		serialStrategy:        h.serialStrategy,
+		serialZoneSelection:   h.serialZoneSelection,
+		serialSigningSecret:   h.serialSigningSecret,
+		serialBumpCooldown:    h.serialBumpCooldown,
+		recordCacheDisabled:   h.recordCacheDisabled,
+		unmanagedSerial:       h.unmanagedSerial,
+		challengeTimeout:      h.challengeTimeout,
+		presentRetries:        h.presentRetries,
+		presentRetryDelay:     h.presentRetryDelay,
+		readYourWritesTimeout: h.readYourWritesTimeout,
+		readByCommit:          h.readByCommit,
+		verifyAfterMerge:      h.verifyAfterMerge,
+		failOnForeignRecords:  h.failOnForeignRecords,
+		recordSort:            h.recordSort,
+		emptyBlock:            h.emptyBlock,
+		recordBlockSpacing:    h.recordBlockSpacing,
+		recordTombstones:      h.recordTombstones,
+		recordTombstoneNote:   h.recordTombstoneNote,
+		cleanupMode:           h.cleanupMode,
+		structuredZone:        h.structuredZone,
+		breaker:               h.breaker,
+		status:                h.status,
+		hooks:                 h.hooks,
+		statusCallback:        h.statusCallback,
+		allowedDomains:        h.allowedDomains,
+		acmeBotContentRegex:   h.acmeBotContentRegex,
+		sharedTxtRecordRegex:  h.sharedTxtRecordRegex,
+	}
+
+	if route.Project != "" {
+		solver.gitPath = route.Project
+		solver.gitForkPath = ""
+	}
+	if route.Fork != "" {
+		solver.gitForkPath = route.Fork
+	}
+	solver.mergeConfig.SourceProject = solver.gitForkPath
+	if route.Project != "" || route.File != "" {
+		solver.gitSerialFile = ""
+		solver.gitExtraFiles = nil
+	}
+	if route.File != "" {
+		solver.gitFile = route.File
+	}
+	if route.SerialFile != "" && route.SerialFile != solver.gitFile {
+		solver.gitSerialFile = route.SerialFile
+		solver.gitExtraFiles = nil
+	}
+	if route.Branch != "" {
+		solver.gitTargetBranch = route.Branch
+	}
+	if route.BotBranch != "" {
+		solver.gitBotBranch = route.BotBranch
+	}
+	if route.Project == "" && route.Branch == "" {
+		solver.reconstructBranch = h.reconstructBranch
+		if h.reconstructBranch == h.gitBotBranch {
+			solver.reconstructBranch = solver.gitBotBranch
+		}
+	}
+
+	return solver
+}
+
+// route returns the solver handling the challenges of the FQDN: the solver of the first matching route, the
+// solver of the project rendered from GITLAB_PATH_TEMPLATE, see projecttemplate.go, or h itself if there are no
+// routes or the fallback is enabled.
+func (h *gitSolver) route(fqdn string) (*gitSolver, error) {
+	// The patterns are written against the resolved FQDN, which always has a trailing dot
+	fqdn = strings.TrimSuffix(fqdn, ".") + "."
+
+	for _, route := range h.routes {
+		if route.pattern.MatchString(fqdn) {
+			return route.solver, nil
+		}
+	}
+
+	if h.projectTemplate != nil {
+		return h.projectRoute(fqdn)
+	}
+
+	if len(h.routes) > 0 && !h.routeFallback {
+		return nil, fmt.Errorf("%w: %s", ErrNoZoneRoute, fqdn)
+	}
+
+	return h, nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestParseZoneRoutes(t *testing.T) {
+	testCases := []struct {
+		name   string
+		routes string
+		want   []ZoneRoute
+		err    bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:   "yaml",
+			routes: "- pattern: internal\n  project: dns/internal\n  file: internal.zone\n  branch: main\n  botBranch: acme-bot-internal\n- pattern: lab\n",
+			want: []ZoneRoute{
+				{Pattern: "internal", Project: "dns/internal", File: "internal.zone", Branch: "main", BotBranch: "acme-bot-internal"},
+				{Pattern: "lab"},
+			},
+		},
+		{
+			name:   "json",
+			routes: `[{"pattern": "internal", "file": "internal.zone"}]`,
+			want:   []ZoneRoute{{Pattern: "internal", File: "internal.zone"}},
+		},
+		{
+			name:   "missing pattern",
+			routes: "- file: internal.zone\n",
+			err:    true,
+		},
+		{
+			name:   "invalid pattern",
+			routes: "- pattern: '(internal'\n",
+			err:    true,
+		},
+		{
+			name:   "unknown field",
+			routes: "- pattern: internal\n  zonefile: internal.zone\n",
+			err:    true,
+		},
+		{
+			name:   "not a list",
+			routes: "pattern: internal\n",
+			err:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseZoneRoutes(tc.routes)
+			if tc.err != (err != nil) {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("expected %v, got %v", ErrInvalidConfig, err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("expected %v, got %v", tc.want[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRoute(t *testing.T) {
+	// The patterns overlap, the first matching route is used
+	routes := []ZoneRoute{
+		{Pattern: `\.lab\.internal\.example\.com\.$`, File: "lab.zone", BotBranch: "acme-bot-lab"},
+		{Pattern: `\.internal\.example\.com\.$`, File: "internal.zone", BotBranch: "acme-bot-internal"},
+		{Pattern: `^_acme-challenge\.(dev|test)-`, File: "dev.zone", BotBranch: "acme-bot-dev"},
+	}
+
+	testCases := []struct {
+		name     string
+		fqdn     string
+		fallback bool
+		want     string
+		err      error
+	}{
+		{name: "first route", fqdn: "_acme-challenge.svc.lab.internal.example.com.", want: "lab.zone"},
+		{name: "second route", fqdn: "_acme-challenge.svc.internal.example.com.", want: "internal.zone"},
+		{name: "prefix", fqdn: "_acme-challenge.dev-svc.example.com.", want: "dev.zone"},
+		{name: "first match wins over prefix", fqdn: "_acme-challenge.dev-svc.internal.example.com.", want: "internal.zone"},
+		{name: "without trailing dot", fqdn: "_acme-challenge.svc.internal.example.com", want: "internal.zone"},
+		{name: "no match", fqdn: "_acme-challenge.example.com.", err: ErrNoZoneRoute},
+		{name: "fallback", fqdn: "_acme-challenge.example.com.", fallback: true, want: fakeFile},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, srv := newFakeGitlab(t, "main", fakeZone)
+			solver := newTestSolver(t, srv)
+			if err := solver.setRoutes(routes, tc.fallback); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := solver.route(tc.fqdn)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if err == nil && got.gitFile != tc.want {
+				t.Errorf("expected %s, got %s", tc.want, got.gitFile)
+			}
+		})
+	}
+}
+
+func TestRouteReconstructBranch(t *testing.T) {
+	testCases := []struct {
+		name   string
+		branch string
+		route  ZoneRoute
+		want   string
+	}{
+		{name: "default project and branch", branch: "staging", route: ZoneRoute{File: "a.zone"}, want: "staging"},
+		{name: "other project", branch: "staging", route: ZoneRoute{Project: "dns/a"}, want: ""},
+		{name: "other branch", branch: "staging", route: ZoneRoute{Branch: "release"}, want: ""},
+		{name: "bot branch of the route", branch: "acme-bot", route: ZoneRoute{BotBranch: "acme-bot-a"}, want: "acme-bot-a"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, srv := newFakeGitlab(t, "main", fakeZone)
+			solver := newTestSolver(t, srv)
+			solver.reconstructBranch = tc.branch
+
+			if got := solver.newRouteSolver(tc.route).reconstructBranch; got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSetRoutesSharedBotBranch(t *testing.T) {
+	testCases := []struct {
+		name     string
+		routes   []ZoneRoute
+		fallback bool
+		err      bool
+	}{
+		{
+			name:   "distinct bot branches",
+			routes: []ZoneRoute{{Pattern: "a", BotBranch: "acme-bot-a"}, {Pattern: "b", BotBranch: "acme-bot-b"}},
+		},
+		{
+			name:   "distinct projects",
+			routes: []ZoneRoute{{Pattern: "a", Project: "dns/a"}, {Pattern: "b", Project: "dns/b"}},
+		},
+		{
+			name:   "shared bot branch",
+			routes: []ZoneRoute{{Pattern: "a", File: "a.zone"}, {Pattern: "b", File: "b.zone"}},
+			err:    true,
+		},
+		{
+			name:   "default bot branch without fallback",
+			routes: []ZoneRoute{{Pattern: "a", File: "a.zone"}},
+		},
+		{
+			name:     "default bot branch with fallback",
+			routes:   []ZoneRoute{{Pattern: "a", File: "a.zone"}},
+			fallback: true,
+			err:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, srv := newFakeGitlab(t, "main", fakeZone)
+			solver := newTestSolver(t, srv)
+
+			err := solver.setRoutes(tc.routes, tc.fallback)
+			if tc.err != (err != nil) {
+				t.Errorf("expected error %t, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestPresentCleanUpRoutes(t *testing.T) {
+	// The fake GitLab keeps a zone file per branch, so the routes use different branches
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	fake.branches["internal"] = fakeZone
+	solver := newTestSolver(t, srv)
+	routes := []ZoneRoute{{Pattern: `\.internal\.example\.com\.$`, Branch: "internal", BotBranch: "acme-bot-internal"}}
+	if err := solver.setRoutes(routes, true); err != nil {
+		t.Fatal(err)
+	}
+
+	internal := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.svc.internal.example.com.", Key: "internal"}
+	public := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "public"}
+	for _, ch := range []*acme.ChallengeRequest{internal, public} {
+		if err := solver.Present(ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if content := fake.content("internal"); !strings.Contains(content, `TXT "internal"`) || strings.Contains(content, `TXT "public"`) {
+		t.Errorf("expected only the internal record in the internal zone file, got %q", content)
+	}
+	if content := fake.content("main"); !strings.Contains(content, `TXT "public"`) || strings.Contains(content, `TXT "internal"`) {
+		t.Errorf("expected only the public record in the default zone file, got %q", content)
+	}
+
+	present, err := solver.Verify(internal.ResolvedFQDN, internal.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !present {
+		t.Error("expected internal record to be verified in the internal zone file")
+	}
+
+	if err := solver.CleanUp(internal); err != nil {
+		t.Fatal(err)
+	}
+	if content := fake.content("internal"); strings.Contains(content, `TXT "internal"`) {
+		t.Errorf("expected internal record to be removed, got %q", content)
+	}
+	if content := fake.content("main"); !strings.Contains(content, `TXT "public"`) {
+		t.Errorf("expected public record to be kept, got %q", content)
+	}
+
+	// Without fallback, challenges matching no route fail
+	solver.routeFallback = false
+	if err := solver.Present(&acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.other.com.", Key: "other"}); !errors.Is(err, ErrNoZoneRoute) {
+		t.Errorf("expected %v, got %v", ErrNoZoneRoute, err)
+	}
+}
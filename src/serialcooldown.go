@@ -0,0 +1,29 @@
+/*
+This file provides the cooldown of the serial number increase on cleanup, for low-volume zones where a short-lived
+challenge would otherwise reload the zone twice within minutes, once for Present and once for CleanUp.
+If SERIAL_BUMP_COOLDOWN is set, e.g. to "10m", CleanUp removes the record without increasing the serial number if
+the last increase of this replica was less than the cooldown ago. The removal is then served with the next change
+of the serial number, e.g. by the next Present. Present always increases the serial number. Unlike
+BUMP_SERIAL_ON_CLEANUP=false, a cleanup long after the last increase still reloads the zone.
+*/
+package main
+
+import "time"
+
+// cleanupBumpsSerial reports whether a CleanUp at the given time increases the serial number.
+func (h *gitSolver) cleanupBumpsSerial(now time.Time) bool {
+	if h.keepSerialOnCleanup {
+		return false
+	}
+	if h.serialBumpCooldown <= 0 || h.lastSerialBump.IsZero() {
+		return true
+	}
+
+	return now.Sub(h.lastSerialBump) >= h.serialBumpCooldown
+}
+
+// noteSerialBump starts the cooldown at the given time of a serial number increase. It must be called with the
+// zone lock held.
+func (h *gitSolver) noteSerialBump(now time.Time) {
+	h.lastSerialBump = now
+}
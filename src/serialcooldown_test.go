@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/kallepan/cert-manager-webhook/src/zone"
+)
+
+func TestCleanupBumpsSerial(t *testing.T) {
+	const cooldown = 10 * time.Minute
+	lastBump := time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		keep     bool
+		cooldown time.Duration
+		lastBump time.Time
+		elapsed  time.Duration
+		want     bool
+	}{
+		{name: "no cooldown", lastBump: lastBump, want: true},
+		{name: "no bump yet", cooldown: cooldown, want: true},
+		{name: "right after the bump", cooldown: cooldown, lastBump: lastBump, want: false},
+		{name: "just before the end", cooldown: cooldown, lastBump: lastBump, elapsed: cooldown - time.Nanosecond, want: false},
+		{name: "end of the cooldown", cooldown: cooldown, lastBump: lastBump, elapsed: cooldown, want: true},
+		{name: "after the cooldown", cooldown: cooldown, lastBump: lastBump, elapsed: cooldown + time.Second, want: true},
+		{name: "cleanup bumps disabled", keep: true, cooldown: cooldown, lastBump: lastBump, elapsed: time.Hour, want: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &gitSolver{keepSerialOnCleanup: tc.keep, serialBumpCooldown: tc.cooldown, lastSerialBump: tc.lastBump}
+			if got := h.cleanupBumpsSerial(tc.lastBump.Add(tc.elapsed)); got != tc.want {
+				t.Errorf("expected %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCleanUpSerialBumpCooldown(t *testing.T) {
+	testCases := []struct {
+		name string
+		// sincePresent moves the last increase of Present into the past
+		sincePresent time.Duration
+		bumped       bool
+	}{
+		{name: "within the cooldown", bumped: false},
+		{name: "after the cooldown", sincePresent: 2 * time.Hour, bumped: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", fakeZone)
+			solver := newTestSolver(t, srv)
+			solver.serialBumpCooldown = time.Hour
+
+			challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+			if err := solver.Present(challenge); err != nil {
+				t.Fatal(err)
+			}
+			presented := zone.SerialNumber(fake.content("main"))
+			solver.lastSerialBump = solver.lastSerialBump.Add(-tc.sincePresent)
+
+			if err := solver.CleanUp(challenge); err != nil {
+				t.Fatal(err)
+			}
+			cleaned := zone.SerialNumber(fake.content("main"))
+			if bumped := cleaned != presented; bumped != tc.bumped {
+				t.Errorf("expected the serial number to be increased %t, got %s after %s", tc.bumped, cleaned, presented)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+/*
+This file provides the separate serial file for zones split with $INCLUDE directives, where the records of the
+webhook are kept in an included file (GITLAB_FILE) and the SOA record with the serial number in the main zone file
+(GITLAB_SERIAL_FILE). The records are written to the included file as usual, then the serial number of the serial
+file is increased in a second commit to the bot branch, so that both changes are merged by the same merge request.
+The serial number is increased from the serial file of the target branch, as it is never changed on the bot branch
+otherwise. If the bot branch already has the increased serial number, e.g. from a previous attempt, nothing is
+written.
+*/
+package main
+
+import "fmt"
+
+// serialFile returns the file holding the serial number.
+func (h *gitSolver) serialFile() string {
+	if h.gitSerialFile != "" {
+		return h.gitSerialFile
+	}
+
+	return h.gitFile
+}
+
+// increaseSerialFile increases the serial number of the serial file of the target branch and writes it to the
+// bot branch.
+func (h *gitSolver) increaseSerialFile() error {
+	content, err := h.readFile(h.gitPath, h.gitTargetBranch, h.gitSerialFile)
+	if err != nil {
+		return err
+	}
+
+	bumped, err := h.increaseSerialNumber(content)
+	if err != nil || bumped == content {
+		return err
+	}
+
+	current, err := h.readFile(h.gitBotPath(), h.gitBotBranch, h.gitSerialFile)
+	if err != nil || current == bumped {
+		return err
+	}
+
+	// The serial number increased from the target branch does not depend on the content of the bot branch
+	_, err = h.writeBotFile(h.gitSerialFile, bumped, fmt.Sprintf("Increase serial number of %s", h.gitSerialFile), func(string) (string, error) {
+		return bumped, nil
+	})
+	return err
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+const fakeSerialFile = "soa.zone"
+
+const fakeSOAZone = `$ORIGIN example.com.
+@ IN SOA ns.example.com. admin.example.com. (
+    2021091501 ; serial number
+    3600 ; refresh
+)
+$INCLUDE db.zone
+`
+
+const fakeIncludedZone = `; TEST-ACME-BOT
+; TEST-ACME-BOT-END
+`
+
+func TestPresentCleanUpSerialFile(t *testing.T) {
+	defer func(d time.Duration) { mergeRequestPollInterval = d }(mergeRequestPollInterval)
+	mergeRequestPollInterval = time.Millisecond
+
+	fake, srv := newFakeGitlab(t, "main", fakeIncludedZone)
+	fake.setFile("main", fakeSerialFile, fakeSOAZone)
+
+	solver := newTestSolver(t, srv)
+	solver.gitSerialFile = fakeSerialFile
+
+	serial := func() string {
+		t.Helper()
+
+		fake.Lock()
+		defer fake.Unlock()
+		content, _ := fake.file("main", fakeSerialFile)
+		return strings.Fields(strings.Split(content, "\n")[2])[0]
+	}
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "; TEST-ACME-BOT\n_acme-challenge.example.com            TXT \"wow-so-secret\"\n; TEST-ACME-BOT-END\n"
+	if got := fake.content("main"); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	presented := serial()
+	if presented == "2021091501" {
+		t.Error("expected the serial number of the serial file to be increased")
+	}
+
+	// The record and the serial number are committed separately and merged together
+	if len(fake.commits) != 2 || fake.commits[0].file != fakeFile || fake.commits[1].file != fakeSerialFile {
+		t.Errorf("expected a commit of %s and %s, got %v", fakeFile, fakeSerialFile, fake.commits)
+	}
+	if len(fake.mergeRequests) != 1 {
+		t.Errorf("expected 1 merge request, got %d", len(fake.mergeRequests))
+	}
+
+	if err := solver.CleanUp(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.content("main"); got != fakeIncludedZone {
+		t.Errorf("expected %q, got %q", fakeIncludedZone, got)
+	}
+	if cleanedUp := serial(); cleanedUp == presented {
+		t.Errorf("expected the serial number to be increased by the cleanup, got %s", cleanedUp)
+	}
+}
+
+func TestIncreaseSerialFileRetry(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeIncludedZone)
+	fake.setFile("main", fakeSerialFile, fakeSOAZone)
+	fake.copyBranch("main", "acme-bot")
+
+	solver := newTestSolver(t, srv)
+	solver.gitSerialFile = fakeSerialFile
+
+	// A retry before the merge finds the increased serial number on the bot branch
+	for i := 0; i < 2; i++ {
+		if err := solver.increaseSerialFile(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(fake.commits) != 1 {
+		t.Errorf("expected 1 commit, got %d", len(fake.commits))
+	}
+}
+
+func TestRouteSolverSerialFile(t *testing.T) {
+	h := &gitSolver{gitPath: fakeProject, gitFile: fakeFile, gitSerialFile: fakeSerialFile}
+
+	testCases := []struct {
+		name  string
+		route ZoneRoute
+		want  string
+	}{
+		{
+			name:  "default zone file",
+			route: ZoneRoute{Pattern: "."},
+			want:  fakeSerialFile,
+		},
+		{
+			name:  "other file",
+			route: ZoneRoute{Pattern: ".", File: "internal.zone"},
+			want:  "",
+		},
+		{
+			name:  "other file with serial file",
+			route: ZoneRoute{Pattern: ".", File: "internal.zone", SerialFile: "internal.soa.zone"},
+			want:  "internal.soa.zone",
+		},
+		{
+			name:  "serial file is the zone file",
+			route: ZoneRoute{Pattern: ".", File: "internal.zone", SerialFile: "internal.zone"},
+			want:  "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := h.newRouteSolver(tc.route).gitSerialFile; got != tc.want {
+				t.Errorf("expected serial file %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
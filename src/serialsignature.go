@@ -0,0 +1,76 @@
+/*
+This file provides the signature of the serial numbers written by the webhook, to detect serial numbers changed out
+of band. If SERIAL_SIGNING_SECRET is set, every serial number increase writes an HMAC of the new serial number
+next to it:
+
+	2021091502 ; serial number ; acme-bot-sig=5d41402abc4b2a76
+
+A verifier with the same secret can confirm that the serial number was increased by the webhook. The webhook itself
+verifies the signature before every increase and logs a warning if the serial number was changed by someone else,
+or was never signed. The increase is not blocked, as a human may have changed the zone file on purpose. The
+signature requires ZONE_FORMAT bind.
+*/
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"regexp"
+)
+
+// serialSignatureLength is the number of hex characters of the signature
+const serialSignatureLength = 16
+
+// signedSerialRegex matches the serial number with its comment and the signature if there is one
+var signedSerialRegex = regexp.MustCompile(`(\d*)(\s?;\s?serial number)([ \t]*; acme-bot-sig=([0-9a-f]*))?`)
+
+// serialSignature returns the signature of the serial number with the secret.
+func serialSignature(secret string, serialNumber string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(serialNumber))
+
+	return hex.EncodeToString(mac.Sum(nil))[:serialSignatureLength]
+}
+
+// signSerialNumber writes the signature of every serial number of the content next to it, replacing the previous
+// signature. The content is unchanged if signing is disabled or it has no serial number.
+func (h *gitSolver) signSerialNumber(content string) string {
+	if h.serialSigningSecret == "" {
+		return content
+	}
+
+	// The serial numbers are signed from the last, so that the indexes of the others stay valid
+	locs := signedSerialRegex.FindAllStringSubmatchIndex(content, -1)
+	for i := len(locs) - 1; i >= 0; i-- {
+		loc := locs[i]
+		serialNumber := content[loc[2]:loc[3]]
+		signature := fmt.Sprintf(" ; acme-bot-sig=%s", serialSignature(h.serialSigningSecret, serialNumber))
+		content = content[:loc[5]] + signature + content[loc[1]:]
+	}
+
+	return content
+}
+
+// verifySerialSignature reports whether every serial number of the content carries a valid signature. It logs a
+// warning otherwise. Without a secret or a serial number, there is nothing to verify.
+func (h *gitSolver) verifySerialSignature(content string) bool {
+	if h.serialSigningSecret == "" {
+		return true
+	}
+
+	valid := true
+	for _, matches := range signedSerialRegex.FindAllStringSubmatch(content, -1) {
+		serialNumber, signature := matches[1], matches[4]
+		if hmac.Equal([]byte(signature), []byte(serialSignature(h.serialSigningSecret, serialNumber))) {
+			continue
+		}
+
+		slog.Warn("serial number was not increased by the webhook, it was changed out of band or never signed", "file", h.serialFile(), "serial", serialNumber)
+		valid = false
+	}
+
+	return valid
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestSerialSignature(t *testing.T) {
+	h := &gitSolver{serialSigningSecret: "secret"}
+	signature := serialSignature("secret", "2021091502")
+
+	testCases := []struct {
+		name     string
+		content  string
+		expected string
+		valid    bool
+	}{
+		{
+			name:     "unsigned",
+			content:  "@ IN SOA ns. admin. (\n  2021091502 ; serial number\n  3600 ; refresh\n)\n",
+			expected: "@ IN SOA ns. admin. (\n  2021091502 ; serial number ; acme-bot-sig=" + signature + "\n  3600 ; refresh\n)\n",
+			valid:    false,
+		},
+		{
+			name:     "signed",
+			content:  "  2021091502 ; serial number ; acme-bot-sig=" + signature + "\n",
+			expected: "  2021091502 ; serial number ; acme-bot-sig=" + signature + "\n",
+			valid:    true,
+		},
+		{
+			name:     "outdated signature",
+			content:  "  2021091502 ; serial number ; acme-bot-sig=" + serialSignature("secret", "2021091501") + "\n",
+			expected: "  2021091502 ; serial number ; acme-bot-sig=" + signature + "\n",
+			valid:    false,
+		},
+		{
+			name:     "no serial number",
+			content:  "example.com. IN A 127.0.0.1\n",
+			expected: "example.com. IN A 127.0.0.1\n",
+			valid:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if valid := h.verifySerialSignature(tc.content); valid != tc.valid {
+				t.Errorf("expected valid %v, got %v", tc.valid, valid)
+			}
+			signed := h.signSerialNumber(tc.content)
+			if signed != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, signed)
+			}
+			if !h.verifySerialSignature(signed) {
+				t.Errorf("expected the signed content to be valid, got %q", signed)
+			}
+		})
+	}
+
+	if other := serialSignature("other", "2021091502"); other == signature {
+		t.Errorf("expected another signature for another secret, got %q", other)
+	}
+	if unsigned := (&gitSolver{}).signSerialNumber("2021091502 ; serial number\n"); unsigned != "2021091502 ; serial number\n" {
+		t.Errorf("expected no signature without a secret, got %q", unsigned)
+	}
+}
+
+func TestPresentSerialSignature(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	solver.serialSigningSecret = "secret"
+
+	if err := solver.Present(&acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	content := fake.content("main")
+	serialNumber := solver.serialNumber(content)
+	if !strings.Contains(content, serialNumber+" ; serial number ; acme-bot-sig="+serialSignature("secret", serialNumber)) {
+		t.Fatalf("expected the serial number %s to be signed, got %q", serialNumber, content)
+	}
+	if !solver.verifySerialSignature(content) {
+		t.Errorf("expected the signature to be valid")
+	}
+
+	// A serial number changed by hand no longer matches its signature
+	tampered := strings.Replace(content, serialNumber, "2099010101", 1)
+	if solver.verifySerialSignature(tampered) {
+		t.Errorf("expected the signature of the tampered serial number to be invalid, got %q", tampered)
+	}
+}
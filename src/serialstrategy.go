@@ -0,0 +1,54 @@
+/*
+This file provides the serial strategies, i.e. how the webhook computes the increased serial number of a zone file.
+SERIAL_STRATEGY is one of:
+
+  - date (default): the YYYYMMDDnn format, see zone.NextSerialNumber.
+  - unixtime: unix time in seconds, for zones with "serial-update-method unixtime". The serial number is the later
+    of the current time and the current serial number plus one, so it strictly increases even for two increases
+    within the same second or a clock behind the serial number, see zone.NextUnixSerialNumber.
+
+Both strategies also exceed the serial number of a zone file that changed since it was read, see conflict.go.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kallepan/cert-manager-webhook/src/zone"
+)
+
+// SerialStrategy defines how the serial number of the zone file is increased
+type SerialStrategy string
+
+const (
+	SerialStrategyDate     SerialStrategy = "date"
+	SerialStrategyUnixTime SerialStrategy = "unixtime"
+)
+
+var ErrInvalidSerialStrategy = errors.New("invalid serial strategy")
+
+// ParseSerialStrategy parses the given string into a SerialStrategy. An empty string defaults to SerialStrategyDate.
+func ParseSerialStrategy(s string) (SerialStrategy, error) {
+	switch SerialStrategy(strings.ToLower(s)) {
+	case "", SerialStrategyDate:
+		return SerialStrategyDate, nil
+	case SerialStrategyUnixTime:
+		return SerialStrategyUnixTime, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidSerialStrategy, s)
+}
+
+// nextSerialNumber returns the function computing the increased serial number of the configured strategy.
+func (h *gitSolver) nextSerialNumber() zone.NextSerialFunc {
+	if h.serialStrategy == SerialStrategyUnixTime {
+		return func(serialNumber string, after ...string) (string, error) {
+			return zone.NextUnixSerialNumber(time.Now(), serialNumber, after...)
+		}
+	}
+
+	return zone.NextSerialNumberAfter
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kallepan/cert-manager-webhook/src/zone"
+)
+
+func TestParseSerialStrategy(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  SerialStrategy
+		err   bool
+	}{
+		{input: "", want: SerialStrategyDate},
+		{input: "date", want: SerialStrategyDate},
+		{input: "UnixTime", want: SerialStrategyUnixTime},
+		{input: "epoch", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseSerialStrategy(tc.input)
+			if tc.err != errors.Is(err, ErrInvalidSerialStrategy) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestIncreaseSerialNumberUnixTime(t *testing.T) {
+	h := &gitSolver{serialStrategy: SerialStrategyUnixTime}
+
+	// Two increases within the same second strictly increase the serial number
+	content := "@ IN SOA ns.example.com. admin.example.com. (\n  1700000000 ; serial number\n)\n"
+	first, err := h.increaseSerialNumber(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := h.increaseSerialNumber(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	firstSerial, _ := strconv.ParseInt(zone.SerialNumber(first), 10, 64)
+	secondSerial, _ := strconv.ParseInt(zone.SerialNumber(second), 10, 64)
+	if firstSerial < time.Now().Add(-time.Minute).Unix() {
+		t.Errorf("expected the current unix time, got %d", firstSerial)
+	}
+	if secondSerial <= firstSerial {
+		t.Errorf("expected %d to exceed %d", secondSerial, firstSerial)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+This file provides the graceful shutdown of the solver.
+A Present or CleanUp interrupted between committing and merging leaves a half-applied change on the bot branch,
+e.g. during a rolling update. Every Present and CleanUp is therefore tracked as an operation: once the pod is
+asked to stop, either by SIGTERM/SIGINT or by the stop channel of the webhook server, new challenges are refused
+with ErrShuttingDown and cert-manager retries them against another replica, while main waits for the operations
+in flight to finish for up to SHUTDOWN_GRACE_PERIOD before exiting.
+The grace period should be shorter than the terminationGracePeriodSeconds of the pod, which kills it otherwise.
+*/
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+)
+
+var ErrShuttingDown = errors.New("webhook is shutting down")
+
+// defaultShutdownGracePeriod leaves a few seconds of the default terminationGracePeriodSeconds of 30s
+var defaultShutdownGracePeriod = 25 * time.Second
+
+// beginOperation tracks a Present or CleanUp until endOperation is called. It fails once the solver is stopping.
+func (h *gitSolver) beginOperation() error {
+	h.shutdownLock.Lock()
+	defer h.shutdownLock.Unlock()
+
+	if h.stopping {
+		return ErrShuttingDown
+	}
+	h.operations.Add(1)
+
+	return nil
+}
+
+// endOperation marks an operation started by beginOperation as finished.
+func (h *gitSolver) endOperation() {
+	h.operations.Done()
+}
+
+// stop refuses new operations, the operations in flight continue.
+func (h *gitSolver) stop() {
+	h.shutdownLock.Lock()
+	defer h.shutdownLock.Unlock()
+
+	if !h.stopping {
+		slog.Info("stopping, refusing new challenges")
+	}
+	h.stopping = true
+}
+
+// shutdown stops the solver and waits for the operations in flight to finish for up to the grace period.
+// It reports whether all operations finished in time.
+func (h *gitSolver) shutdown() bool {
+	h.stop()
+
+	done := make(chan struct{})
+	go func() {
+		h.operations.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		slog.Info("all challenges finished, shutting down")
+		return true
+	case <-time.After(h.shutdownGracePeriod):
+		slog.Warn("challenges still in flight after the grace period, shutting down", "grace_period", h.shutdownGracePeriod)
+		return false
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestShutdown(t *testing.T) {
+	defer func(d time.Duration) { mergeRequestPollInterval = d }(mergeRequestPollInterval)
+	mergeRequestPollInterval = time.Millisecond
+
+	testCases := []struct {
+		name        string
+		gracePeriod time.Duration
+		finished    bool
+	}{
+		{
+			name:        "operations finish in time",
+			gracePeriod: 10 * time.Second,
+			finished:    true,
+		},
+		{
+			name:        "grace period exceeded",
+			gracePeriod: 10 * time.Millisecond,
+			finished:    false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", fakeZone)
+			fake.delay = 20 * time.Millisecond
+			solver := newTestSolver(t, srv)
+			solver.shutdownGracePeriod = tc.gracePeriod
+
+			presented := make(chan error, 1)
+			go func() {
+				presented <- solver.Present(&acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "in-flight"})
+			}()
+
+			// Wait until the challenge reached GitLab
+			for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+				fake.Lock()
+				requests := fake.requests
+				fake.Unlock()
+				if requests > 0 {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("challenge did not reach GitLab")
+				}
+			}
+
+			if finished := solver.shutdown(); finished != tc.finished {
+				t.Errorf("expected finished %t, got %t", tc.finished, finished)
+			}
+
+			// New challenges are refused
+			err := solver.CleanUp(&acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "in-flight"})
+			if !errors.Is(err, ErrShuttingDown) {
+				t.Errorf("expected %v, got %v", ErrShuttingDown, err)
+			}
+
+			// The challenge in flight is not interrupted
+			if err := <-presented; err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(fake.content("main"), "in-flight") {
+				t.Errorf("expected record to be merged, got %q", fake.content("main"))
+			}
+		})
+	}
+}
+
+func TestShutdownStopChannel(t *testing.T) {
+	_, srv := newFakeGitlab(t, "main", fakeZone)
+
+	t.Setenv("GITLAB_BOT_BRANCH", "acme-bot")
+	t.Setenv("GITLAB_BOT_COMMENT_PREFIX", "TEST")
+	t.Setenv("GITLAB_TARGET_BRANCH", "main")
+	t.Setenv("GITLAB_PATH", fakeProject)
+	t.Setenv("GITLAB_FILE", fakeFile)
+	t.Setenv("GITLAB_TOKEN", "token")
+	t.Setenv("GITLAB_URL", srv.URL)
+	t.Setenv("LAZY_INIT", "true")
+
+	stopCh := make(chan struct{})
+	solver := newGitSolver()
+	if err := solver.Initialize(nil, stopCh); err != nil {
+		t.Fatal(err)
+	}
+	close(stopCh)
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		if errors.Is(solver.Present(challenge), ErrShuttingDown) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected challenges to be refused after the stop channel was closed")
+		}
+	}
+}
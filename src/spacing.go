@@ -0,0 +1,34 @@
+/*
+This file provides the spacing of the -ACME-BOT block for zone files that separate logical groups with blank lines.
+By default, records are spliced in directly before the end marker, so the block keeps whatever spacing it had and
+removed records can leave blank lines behind. If RECORD_BLOCK_SPACING is set, the block is rewritten after every
+change so that there is exactly one blank line between the markers and the records, and no blank lines in between:
+
+	; ACME-BOT
+
+	_acme-challenge.svc        TXT "key"
+
+	; ACME-BOT-END
+
+A block without records keeps a single blank line between the markers, so that repeated add and remove cycles
+always produce the same content.
+*/
+package main
+
+import "github.com/kallepan/cert-manager-webhook/src/zone"
+
+// spaceAcmeBotBlock rewrites the -ACME-BOT block of the content with a consistent spacing.
+// The content is returned unchanged if it has no -ACME-BOT block.
+func (h *gitSolver) spaceAcmeBotBlock(content string) (string, error) {
+	re, err := h.acmeBotBlockRegex()
+	if err != nil {
+		return "", err
+	}
+
+	loc := re.FindStringSubmatchIndex(content)
+	if loc == nil {
+		return content, nil
+	}
+
+	return content[:loc[2]] + zone.SpaceBlock(content[loc[2]:loc[3]]) + content[loc[3]:], nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+const fakeSpacedZone = `$ORIGIN example.com.
+@ IN SOA ns.example.com. admin.example.com. (
+    2021091501 ; serial number
+    3600 ; refresh
+)
+
+www    IN A 1.2.3.4
+mail   IN A 1.2.3.5
+
+; TEST-ACME-BOT
+
+; TEST-ACME-BOT-END
+
+ftp    IN A 1.2.3.6
+`
+
+func TestPresentCleanUpRecordBlockSpacing(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeSpacedZone)
+	solver := newTestSolver(t, srv)
+	solver.recordBlockSpacing = true
+
+	first := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "first"}
+	second := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.www.example.com.", Key: "second"}
+
+	// The content outside of the -ACME-BOT block is never changed
+	assertSpacedZone := func(records ...string) {
+		t.Helper()
+
+		block := "\n"
+		if len(records) > 0 {
+			block = "\n" + strings.Join(records, "\n") + "\n\n"
+		}
+		want := "; TEST-ACME-BOT\n" + block + "; TEST-ACME-BOT-END\n\nftp    IN A 1.2.3.6\n"
+
+		content := fake.content("main")
+		if !strings.HasSuffix(content, want) {
+			t.Errorf("expected zone file to end with %q, got %q", want, content)
+		}
+		if !strings.Contains(content, ")\n\nwww    IN A 1.2.3.4\nmail   IN A 1.2.3.5\n\n; TEST-ACME-BOT\n") {
+			t.Errorf("expected groups before the block to be kept, got %q", content)
+		}
+	}
+
+	firstRecord := `_acme-challenge.example.com            TXT "first"`
+	secondRecord := `_acme-challenge.www.example.com            TXT "second"`
+
+	for i := 0; i < 2; i++ {
+		if err := solver.Present(first); err != nil {
+			t.Fatal(err)
+		}
+		assertSpacedZone(firstRecord)
+
+		if err := solver.Present(second); err != nil {
+			t.Fatal(err)
+		}
+		assertSpacedZone(firstRecord, secondRecord)
+
+		if err := solver.CleanUp(first); err != nil {
+			t.Fatal(err)
+		}
+		assertSpacedZone(secondRecord)
+
+		if err := solver.CleanUp(second); err != nil {
+			t.Fatal(err)
+		}
+		assertSpacedZone()
+	}
+}
@@ -0,0 +1,158 @@
+/*
+This file provides the status callback, for external orchestration tracking the DNS changes driven by cert-manager
+without scraping GitLab or the logs of the webhook. If STATUS_CALLBACK_URL is set, every Present and CleanUp posts
+its outcome as JSON to the URL once it finished:
+
+	{"fqdn": "_acme-challenge.example.com.", "action": "present",
+	 "merge_request_url": "https://gitlab.example.com/group/dns/-/merge_requests/42", "result": "success"}
+
+The result is "success" or "error", with the error message in "error". The merge request URL is omitted if the
+operation did not get as far as a merge request. Each attempt times out after STATUS_CALLBACK_TIMEOUT and a failed
+attempt, i.e. an error or a response other than 2xx, is retried up to STATUS_CALLBACK_RETRIES times. A callback
+that still fails is logged and never fails the challenge.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the attempts of the status callback
+var (
+	defaultStatusCallbackTimeout = 10 * time.Second
+	defaultStatusCallbackRetries = 2
+
+	// statusCallbackRetryDelay is the delay between two attempts, it is shortened in tests
+	statusCallbackRetryDelay = time.Second
+)
+
+// statusPayload is the JSON posted to the status callback
+type statusPayload struct {
+	FQDN            string `json:"fqdn"`
+	Action          string `json:"action"`
+	MergeRequestURL string `json:"merge_request_url,omitempty"`
+	Result          string `json:"result"`
+	Error           string `json:"error,omitempty"`
+}
+
+// statusCallback posts the outcome of the operations to the callback URL. A nil statusCallback posts nothing.
+type statusCallback struct {
+	url     string
+	retries int
+	client  *http.Client
+
+	// iids holds the merge request IID of the running operations by action and FQDN, see hook
+	lock sync.Mutex
+	iids map[string]int
+}
+
+// newStatusCallback creates the callback posting to the URL. A callback created with an empty URL is nil.
+func newStatusCallback(url string, timeout time.Duration, retries int) *statusCallback {
+	if url == "" {
+		return nil
+	}
+
+	return &statusCallback{
+		url:     url,
+		retries: retries,
+		client:  &http.Client{Timeout: timeout},
+		iids:    make(map[string]int),
+	}
+}
+
+// hook remembers the merge request of the operation for its status.
+func (c *statusCallback) hook(event HookEvent) {
+	if event.MergeRequestIID == 0 {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.iids[event.Action+"\n"+event.FQDN] = event.MergeRequestIID
+}
+
+// takeIID returns and forgets the merge request IID of the operation, or 0 if it has none.
+func (c *statusCallback) takeIID(action string, fqdn string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	key := action + "\n" + fqdn
+	iid := c.iids[key]
+	delete(c.iids, key)
+
+	return iid
+}
+
+// postStatus posts the outcome of the operation on the FQDN to the status callback.
+func (h *gitSolver) postStatus(action string, fqdn string, err error) {
+	c := h.statusCallback
+	if c == nil {
+		return
+	}
+
+	payload := statusPayload{
+		FQDN:            fqdn,
+		Action:          action,
+		MergeRequestURL: h.mergeRequestURL(c.takeIID(action, fqdn)),
+		Result:          "success",
+	}
+	if err != nil {
+		payload.Result = "error"
+		payload.Error = err.Error()
+	}
+
+	body, jsonErr := json.Marshal(payload)
+	if jsonErr != nil {
+		slog.Warn("encoding status callback failed", "fqdn", fqdn, "error", jsonErr)
+		return
+	}
+
+	for attempt := 0; ; attempt++ {
+		postErr := c.post(body)
+		if postErr == nil {
+			return
+		}
+		if attempt >= c.retries {
+			slog.Warn("posting status callback failed", "action", action, "fqdn", fqdn, "attempts", attempt+1, "error", postErr)
+			return
+		}
+		time.Sleep(statusCallbackRetryDelay)
+	}
+}
+
+// post makes a single attempt to post the body.
+func (c *statusCallback) post(body []byte) error {
+	resp, err := c.client.Post(c.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// mergeRequestURL returns the web URL of the merge request of the project, or an empty string for IID 0.
+func (h *gitSolver) mergeRequestURL(iid int) string {
+	if iid == 0 || h.gitClient == nil {
+		return ""
+	}
+
+	// The web URL is the API URL without its API path, e.g. https://gitlab.example.com/api/v4/
+	base := *h.gitClient.BaseURL()
+	base.Path = strings.TrimSuffix(strings.TrimSuffix(base.Path, "/"), "/api/v4")
+
+	return base.JoinPath(h.gitPath, "-", "merge_requests", strconv.Itoa(iid)).String()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+// fakeCallback records the payloads posted to it after failing the given number of posts
+type fakeCallback struct {
+	lock     sync.Mutex
+	failures int
+	payloads []statusPayload
+}
+
+func (f *fakeCallback) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.failures > 0 {
+		f.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	var payload statusPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.payloads = append(f.payloads, payload)
+}
+
+func TestStatusCallback(t *testing.T) {
+	retryDelay := statusCallbackRetryDelay
+	statusCallbackRetryDelay = time.Millisecond
+	t.Cleanup(func() { statusCallbackRetryDelay = retryDelay })
+
+	callback := &fakeCallback{failures: 1}
+	callbackSrv := httptest.NewServer(callback)
+	defer callbackSrv.Close()
+
+	_, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	solver.statusCallback = newStatusCallback(callbackSrv.URL, time.Second, 2)
+	solver.hooks = append(solver.hooks, solver.statusCallback.hook)
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if err := solver.Present(challenge); !errors.Is(err, ErrTextRecordAlreadyExists) {
+		t.Fatalf("expected %v, got %v", ErrTextRecordAlreadyExists, err)
+	}
+
+	callback.lock.Lock()
+	defer callback.lock.Unlock()
+
+	if len(callback.payloads) != 2 {
+		t.Fatalf("expected 2 payloads after the retry, got %v", callback.payloads)
+	}
+	success := callback.payloads[0]
+	if success.FQDN != challenge.ResolvedFQDN || success.Action != "present" || success.Result != "success" || success.Error != "" {
+		t.Errorf("unexpected payload of the success: %+v", success)
+	}
+	if !strings.HasPrefix(success.MergeRequestURL, srv.URL+"/") || !strings.Contains(success.MergeRequestURL, "/-/merge_requests/") {
+		t.Errorf("expected the web URL of the merge request, got %q", success.MergeRequestURL)
+	}
+	failure := callback.payloads[1]
+	if failure.Result != "error" || !strings.Contains(failure.Error, ErrTextRecordAlreadyExists.Error()) || failure.MergeRequestURL != "" {
+		t.Errorf("unexpected payload of the failure: %+v", failure)
+	}
+}
+
+func TestStatusCallbackGivesUp(t *testing.T) {
+	retryDelay := statusCallbackRetryDelay
+	statusCallbackRetryDelay = time.Millisecond
+	t.Cleanup(func() { statusCallbackRetryDelay = retryDelay })
+
+	callback := &fakeCallback{failures: 3}
+	callbackSrv := httptest.NewServer(callback)
+	defer callbackSrv.Close()
+
+	solver := &gitSolver{statusCallback: newStatusCallback(callbackSrv.URL, time.Second, 1)}
+	solver.postStatus("cleanup", "_acme-challenge.example.com.", nil)
+
+	callback.lock.Lock()
+	defer callback.lock.Unlock()
+
+	// Two attempts failed, the third failure is left
+	if callback.failures != 1 || len(callback.payloads) != 0 {
+		t.Errorf("expected 2 failed attempts, got %d failures left and %v", callback.failures, callback.payloads)
+	}
+}
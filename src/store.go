@@ -0,0 +1,254 @@
+/*
+This file provides the optional ConfigMap state backend of the webhook.
+By default the presented records are only kept in memory and reconstructed from the zone file on startup.
+If STATE_CONFIGMAP_NAME is set, the records are checkpointed into a ConfigMap as well, so that Present/CleanUp
+calls on different replicas share a consistent view. On startup the ConfigMap is reconciled against the zone file.
+Every change is a read-modify-write of the ConfigMap, which is retried on update conflicts.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
+)
+
+// serviceAccountNamespaceFile contains the namespace of the pod the webhook is running in
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+var (
+	ErrStateNamespaceNotDefined = errors.New("STATE_CONFIGMAP_NAMESPACE not defined in environment variables and not running in a pod")
+	ErrKubeConfigNotDefined     = errors.New("STATE_CONFIGMAP_NAME requires a kubernetes client configuration")
+
+	// storeTimeout is the timeout of a single operation on the state backend
+	storeTimeout = 10 * time.Second
+)
+
+// RecordStore persists the presented records, mapping the record ID to its key
+type RecordStore interface {
+	// Load returns all stored records
+	Load(ctx context.Context) (map[string]string, error)
+	// Save stores the key of the record with the given ID
+	Save(ctx context.Context, id string, key string) error
+	// Delete removes the record with the given ID
+	Delete(ctx context.Context, id string) error
+	// Replace replaces all stored records
+	Replace(ctx context.Context, records map[string]string) error
+}
+
+// configMapStore stores the records in the data of a ConfigMap
+type configMapStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+func NewConfigMapStore(client kubernetes.Interface, namespace string, name string) RecordStore {
+	return &configMapStore{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+// newRecordStoreFromEnv creates the ConfigMap store if STATE_CONFIGMAP_NAME is set, otherwise it returns nil.
+func newRecordStoreFromEnv(kubeClientConfig *rest.Config) (RecordStore, error) {
+	name := os.Getenv("STATE_CONFIGMAP_NAME")
+	if name == "" {
+		return nil, nil
+	}
+	if kubeClientConfig == nil {
+		return nil, ErrKubeConfigNotDefined
+	}
+
+	namespace := os.Getenv("STATE_CONFIGMAP_NAMESPACE")
+	if namespace == "" {
+		data, err := os.ReadFile(serviceAccountNamespaceFile)
+		if err != nil {
+			return nil, ErrStateNamespaceNotDefined
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+
+	client, err := kubernetes.NewForConfig(kubeClientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewConfigMapStore(client, namespace, name), nil
+}
+
+func (s *configMapStore) Load(ctx context.Context) (map[string]string, error) {
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return make(map[string]string), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string]string, len(cm.Data))
+	for id, key := range cm.Data {
+		records[id] = key
+	}
+
+	return records, nil
+}
+
+func (s *configMapStore) Save(ctx context.Context, id string, key string) error {
+	return s.update(ctx, func(data map[string]string) {
+		data[id] = key
+	})
+}
+
+func (s *configMapStore) Delete(ctx context.Context, id string) error {
+	return s.update(ctx, func(data map[string]string) {
+		delete(data, id)
+	})
+}
+
+func (s *configMapStore) Replace(ctx context.Context, records map[string]string) error {
+	return s.update(ctx, func(data map[string]string) {
+		clear(data)
+		for id, key := range records {
+			data[id] = key
+		}
+	})
+}
+
+// update applies the mutation to the data of the ConfigMap, creating it if it does not exist.
+// The read-modify-write is retried if the ConfigMap was changed concurrently.
+func (s *configMapStore) update(ctx context.Context, mutate func(data map[string]string)) error {
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+
+		cm, err := configMaps.Get(ctx, s.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      s.name,
+					Namespace: s.namespace,
+				},
+				Data: make(map[string]string),
+			}
+			mutate(cm.Data)
+
+			// A concurrent create is reported as a conflict so that it is retried as an update
+			_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				return apierrors.NewConflict(corev1.Resource("configmaps"), s.name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		mutate(cm.Data)
+
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// loadRecords replaces the records in memory with the records of the store, if one is configured.
+func (h *gitSolver) loadRecords() error {
+	if h.store == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	records, err := h.store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("loading records from store: %w", err)
+	}
+
+	h.recordsLock.Lock()
+	h.txtRecords = records
+	h.recordsLock.Unlock()
+
+	return nil
+}
+
+// saveRecord stores the record in memory and in the store, if one is configured.
+func (h *gitSolver) saveRecord(id string, key string) error {
+	h.setRecord(id, key)
+	if h.store == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	if err := h.store.Save(ctx, id, key); err != nil {
+		return fmt.Errorf("saving record to store: %w", err)
+	}
+
+	return nil
+}
+
+// forgetRecord removes the record from memory and from the store, if one is configured.
+func (h *gitSolver) forgetRecord(id string) error {
+	h.deleteRecord(id)
+	if h.store == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	if err := h.store.Delete(ctx, id); err != nil {
+		return fmt.Errorf("deleting record from store: %w", err)
+	}
+
+	return nil
+}
+
+// reconcileStore reconciles the records of the store with the records found in the zone file.
+// The zone file is authoritative, stale records are removed from the store and missing records are added.
+func (h *gitSolver) reconcileStore(fileRecords map[string]string) error {
+	if h.store == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	stored, err := h.store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("loading records from store: %w", err)
+	}
+
+	changed := len(stored) != len(fileRecords)
+	for id, key := range fileRecords {
+		if stored[id] != key {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	slog.Info("reconciling records of store with zone file", "stored", len(stored), "zone", len(fileRecords))
+	if err := h.store.Replace(ctx, fileRecords); err != nil {
+		return fmt.Errorf("reconciling records of store: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestConfigMapStore(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	store := NewConfigMapStore(client, "default", "records")
+
+	// Loading a missing ConfigMap returns no records
+	records, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Errorf("expected no records, got %v", records)
+	}
+
+	if err := store.Save(ctx, "_acme-challenge.example.com.", "one"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, "_acme-challenge.test.com.", "two"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "_acme-challenge.example.com."); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err = store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"_acme-challenge.test.com.": "two"}; !reflect.DeepEqual(records, want) {
+		t.Errorf("expected %v, got %v", want, records)
+	}
+
+	if err := store.Replace(ctx, map[string]string{"_acme-challenge.other.com.": "three"}); err != nil {
+		t.Fatal(err)
+	}
+	records, err = store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"_acme-challenge.other.com.": "three"}; !reflect.DeepEqual(records, want) {
+		t.Errorf("expected %v, got %v", want, records)
+	}
+}
+
+func TestConfigMapStoreRetriesOnConflict(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	store := NewConfigMapStore(client, "default", "records")
+	if err := store.Save(ctx, "_acme-challenge.example.com.", "one"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fail the first update with a conflict, as if another replica changed the ConfigMap
+	conflicts := 0
+	client.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			return false, nil, nil
+		}
+		conflicts++
+		return true, nil, apierrors.NewConflict(corev1.Resource("configmaps"), "records", nil)
+	})
+
+	if err := store.Save(ctx, "_acme-challenge.test.com.", "two"); err != nil {
+		t.Fatal(err)
+	}
+	if conflicts != 1 {
+		t.Errorf("expected 1 conflict, got %d", conflicts)
+	}
+
+	records, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"_acme-challenge.example.com.": "one", "_acme-challenge.test.com.": "two"}; !reflect.DeepEqual(records, want) {
+		t.Errorf("expected %v, got %v", want, records)
+	}
+}
+
+func TestStoreSharedBetweenReplicas(t *testing.T) {
+	_, srv := newFakeGitlab(t, "main", fakeZone)
+	client := fake.NewSimpleClientset()
+
+	first := newTestSolver(t, srv)
+	first.store = NewConfigMapStore(client, "default", "records")
+	second := newTestSolver(t, srv)
+	second.store = NewConfigMapStore(client, "default", "records")
+
+	ch := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "key"}
+	if err := first.Present(ch); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second replica sees the record presented by the first replica
+	if err := second.Present(ch); err != ErrTextRecordAlreadyExists {
+		t.Errorf("expected %v, got %v", ErrTextRecordAlreadyExists, err)
+	}
+	if err := second.CleanUp(ch); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.CleanUp(ch); err != ErrTextRecordDoesNotExist {
+		t.Errorf("expected %v, got %v", ErrTextRecordDoesNotExist, err)
+	}
+}
+
+func TestReconcileStore(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	store := NewConfigMapStore(client, "default", "records")
+	if err := store.Replace(ctx, map[string]string{"_acme-challenge.stale.com.": "stale"}); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &gitSolver{store: store}
+	fileRecords := map[string]string{"_acme-challenge.example.com.": "key"}
+	if err := h.reconcileStore(fileRecords); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(records, fileRecords) {
+		t.Errorf("expected %v, got %v", fileRecords, records)
+	}
+}
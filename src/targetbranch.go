@@ -0,0 +1,91 @@
+/*
+This file provides the handling of a missing target branch.
+The bot branch is created from GITLAB_TARGET_BRANCH, so a missing target branch fails every challenge. For most
+repositories the target branch is the default branch and always exists, and a missing one is a misconfiguration,
+e.g. a typo in the branch name. TARGET_BRANCH_MISSING defines what happens then:
+
+  - fail (default): the challenge fails with ErrTargetBranchNotFound.
+  - create: the target branch is created from the default branch of GITLAB_PATH, for repositories that are
+    bootstrapped by the webhook.
+
+Creating the target branch is not supported with GITLAB_FORK_PATH, as the fork must contain the target branch of
+the upstream project, see fork.go.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// MissingTargetBranch defines what happens if the target branch does not exist
+type MissingTargetBranch string
+
+const (
+	MissingTargetBranchFail   MissingTargetBranch = "fail"
+	MissingTargetBranchCreate MissingTargetBranch = "create"
+)
+
+var (
+	ErrTargetBranchNotFound       = errors.New("target branch not found")
+	ErrInvalidMissingTargetBranch = errors.New("invalid missing target branch mode")
+)
+
+// ParseMissingTargetBranch parses the given string into a MissingTargetBranch. An empty string defaults to
+// MissingTargetBranchFail.
+func ParseMissingTargetBranch(s string) (MissingTargetBranch, error) {
+	switch MissingTargetBranch(strings.ToLower(s)) {
+	case "", MissingTargetBranchFail:
+		return MissingTargetBranchFail, nil
+	case MissingTargetBranchCreate:
+		return MissingTargetBranchCreate, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidMissingTargetBranch, s)
+}
+
+// EnsureTargetBranch creates the target branch from the default branch of the project if it does not exist.
+func EnsureTargetBranch(git *gitlab.Client, projectPath string, branch string) error {
+	_, _, err := git.Branches.GetBranch(projectPath, branch)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, gitlab.ErrNotFound) {
+		return err
+	}
+
+	project, _, err := git.Projects.GetProject(projectPath, &gitlab.GetProjectOptions{})
+	if err != nil {
+		return err
+	}
+	if project.DefaultBranch == "" {
+		return fmt.Errorf("%w: %s of %s cannot be created, the project has no default branch", ErrTargetBranchNotFound, branch, projectPath)
+	}
+
+	slog.Info("creating missing target branch", "branch", branch, "from", project.DefaultBranch)
+	_, _, err = git.Branches.CreateBranch(projectPath, &gitlab.CreateBranchOptions{
+		Branch: gitlab.Ptr(branch),
+		Ref:    gitlab.Ptr(project.DefaultBranch),
+	})
+	if err != nil {
+		return fmt.Errorf("creating target branch %s of %s from %s: %w", branch, projectPath, project.DefaultBranch, err)
+	}
+
+	return nil
+}
+
+// createBotBranch creates the bot branch from the target branch if it does not exist. The target branch is
+// created first if it is missing and TARGET_BRANCH_MISSING is create.
+func (h *gitSolver) createBotBranch() error {
+	if h.missingTargetBranch == MissingTargetBranchCreate {
+		if err := EnsureTargetBranch(h.gitClient, h.gitPath, h.gitTargetBranch); err != nil {
+			return err
+		}
+	}
+
+	return CreateBranch(h.gitClient, h.gitBotPath(), h.gitBotBranch, h.gitTargetBranch)
+}
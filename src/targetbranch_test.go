@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestParseMissingTargetBranch(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  MissingTargetBranch
+		err   bool
+	}{
+		{input: "", want: MissingTargetBranchFail},
+		{input: "fail", want: MissingTargetBranchFail},
+		{input: "Create", want: MissingTargetBranchCreate},
+		{input: "ignore", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseMissingTargetBranch(tc.input)
+			if tc.err != errors.Is(err, ErrInvalidMissingTargetBranch) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMissingTargetBranch(t *testing.T) {
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+
+	t.Run("fail", func(t *testing.T) {
+		fake, srv := newFakeGitlab(t, "main", fakeZone)
+		solver := newTestSolver(t, srv)
+		solver.gitTargetBranch = "release"
+
+		err := solver.Present(challenge)
+		if !errors.Is(err, ErrTargetBranchNotFound) {
+			t.Fatalf("expected %v, got %v", ErrTargetBranchNotFound, err)
+		}
+		if !strings.Contains(err.Error(), "release") {
+			t.Errorf("expected the error to name the target branch, got %v", err)
+		}
+		if ClassifyError(err) != ErrorClassPermanent {
+			t.Errorf("expected a permanent error, got %v", ClassifyError(err))
+		}
+		if _, ok := fake.branches["release"]; ok {
+			t.Error("expected the target branch not to be created")
+		}
+		if _, ok := fake.branches["acme-bot"]; ok {
+			t.Error("expected the bot branch not to be created")
+		}
+	})
+
+	t.Run("create", func(t *testing.T) {
+		fake, srv := newFakeGitlab(t, "main", fakeZone)
+		solver := newTestSolver(t, srv)
+		solver.gitTargetBranch = "release"
+		solver.missingTargetBranch = MissingTargetBranchCreate
+
+		if err := solver.Present(challenge); err != nil {
+			t.Fatal(err)
+		}
+
+		// The target branch is created from the default branch and receives the record
+		if !strings.Contains(fake.content("release"), "wow-so-secret") {
+			t.Errorf("expected record on the created target branch, got %q", fake.content("release"))
+		}
+		if strings.Contains(fake.content("main"), "wow-so-secret") {
+			t.Errorf("expected default branch to be unchanged, got %q", fake.content("main"))
+		}
+	})
+
+	t.Run("create without default branch", func(t *testing.T) {
+		fake, srv := newFakeGitlab(t, "main", fakeZone)
+		fake.defaultBranch = ""
+		solver := newTestSolver(t, srv)
+		solver.gitTargetBranch = "release"
+		solver.missingTargetBranch = MissingTargetBranchCreate
+
+		if err := solver.Present(challenge); !errors.Is(err, ErrTargetBranchNotFound) {
+			t.Fatalf("expected %v, got %v", ErrTargetBranchNotFound, err)
+		}
+	})
+}
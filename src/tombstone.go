@@ -0,0 +1,50 @@
+/*
+This file provides the tombstones of removed records, for teams that audit the zone file history in the file
+itself. If RECORD_TOMBSTONES is set, CleanUp and the manual cleanup comment out the TXT records instead of
+removing them, the comment written with the record is kept as well:
+
+	; acme-bot: added for example.com
+	; _acme-challenge.svc            TXT "key" ; removed 2026-10-15T09:30:00Z
+
+A commented out record no longer resolves and is never matched again, as the records are only matched at the
+start of a line. The time of the removal is only noted if RECORD_TOMBSTONE_NOTE is set. Tombstones are only
+supported for BIND zone files, as the structured zone files have no comments.
+*/
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TOMBSTONE_NOTE precedes the time of the removal in the note of a tombstone
+const TOMBSTONE_NOTE = "; removed"
+
+// tombstoneTxtRecord comments out the TXT record string in the given content and returns the updated content.
+func (h *gitSolver) tombstoneTxtRecord(content string, recordStr string) (string, error) {
+	re, err := regexp.Compile(fmt.Sprintf(`(?m)^[ \t]*%s$`, regexp.QuoteMeta(recordStr)))
+	if err != nil {
+		return "", err
+	}
+
+	return re.ReplaceAllStringFunc(content, h.tombstone), nil
+}
+
+// tombstone comments out the record line, keeping its indentation and newline, and notes the time of the
+// removal if configured.
+func (h *gitSolver) tombstone(line string) string {
+	record, newline := strings.CutSuffix(line, "\n")
+	indent := record[:len(record)-len(strings.TrimLeft(record, " \t"))]
+
+	tombstone := indent + "; " + record[len(indent):]
+	if h.recordTombstoneNote {
+		tombstone += fmt.Sprintf(" %s %s", TOMBSTONE_NOTE, time.Now().UTC().Format(time.RFC3339))
+	}
+	if newline {
+		tombstone += "\n"
+	}
+
+	return tombstone
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestTombstone(t *testing.T) {
+	testCases := []struct {
+		name string
+		line string
+		note bool
+		want string
+	}{
+		{
+			name: "record",
+			line: "_acme-challenge.svc            TXT \"key\"\n",
+			want: "; _acme-challenge.svc            TXT \"key\"\n",
+		},
+		{
+			name: "indented record without newline",
+			line: "    _acme-challenge.svc TXT \"key\"",
+			want: "    ; _acme-challenge.svc TXT \"key\"",
+		},
+		{
+			name: "note",
+			line: "_acme-challenge.svc            TXT \"key\"\n",
+			note: true,
+			want: `^; _acme-challenge.svc            TXT "key" ; removed \d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z\n$`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &gitSolver{recordTombstoneNote: tc.note}
+
+			got := h.tombstone(tc.line)
+			if tc.note {
+				if !regexp.MustCompile(tc.want).MatchString(got) {
+					t.Errorf("expected %q to match %q", got, tc.want)
+				}
+				return
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPresentCleanUpTombstones(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	solver.recordTombstones = true
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+	record := `_acme-challenge.example.com            TXT "wow-so-secret"`
+
+	// The same challenge can be presented again after its record was tombstoned
+	for i := 1; i <= 2; i++ {
+		if err := solver.Present(challenge); err != nil {
+			t.Fatal(err)
+		}
+		presented := fake.content("main")
+		if err := solver.CleanUp(challenge); err != nil {
+			t.Fatal(err)
+		}
+
+		content := fake.content("main")
+		if got := strings.Count(content, "; "+record+"\n"); got != i {
+			t.Errorf("expected %d tombstones, got %d in %q", i, got, content)
+		}
+		if strings.Contains(content, "\n"+record+"\n") {
+			t.Errorf("expected record to be commented out, got %q", content)
+		}
+		if strings.Contains(content, "; ; ") {
+			t.Errorf("expected tombstones to be kept as they are, got %q", content)
+		}
+		if serial := strings.Split(presented, "\n")[2]; strings.Contains(content, serial) {
+			t.Errorf("expected serial number %q to be increased on cleanup, got %q", serial, content)
+		}
+	}
+
+	// A restarted solver does not consider the tombstones as records
+	restarted := newTestSolver(t, srv)
+	restarted.recordTombstones = true
+	restarted.synced = false
+	if err := restarted.CleanUp(challenge); !errors.Is(err, ErrTextRecordDoesNotExist) {
+		t.Errorf("expected %v, got %v", ErrTextRecordDoesNotExist, err)
+	}
+}
+
+func TestRemoveTxtRecordsByNameTombstones(t *testing.T) {
+	const content = "; TEST-ACME-BOT\n" +
+		"; _acme-challenge.example.com            TXT \"old\"\n" +
+		RECORD_COMMENT_TAG + " added by test\n" +
+		"_acme-challenge.example.com            TXT \"one\"\n" +
+		"_acme-challenge.other.com            TXT \"two\"\n" +
+		"; TEST-ACME-BOT-END\n"
+
+	h := &gitSolver{gitBotCommentPrefix: "TEST", recordTombstones: true}
+
+	got, removed, err := h.removeTxtRecordsByName(content, "_acme-challenge.example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("expected 1 removed record, got %d", removed)
+	}
+
+	// The comment is kept and the old tombstone is not matched again
+	want := "; TEST-ACME-BOT\n" +
+		"; _acme-challenge.example.com            TXT \"old\"\n" +
+		RECORD_COMMENT_TAG + " added by test\n" +
+		"; _acme-challenge.example.com            TXT \"one\"\n" +
+		"_acme-challenge.other.com            TXT \"two\"\n" +
+		"; TEST-ACME-BOT-END\n"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,40 @@
+/*
+This file provides the unique owner names of UNIQUE_RECORD_NAME, for delegated setups where back-to-back
+challenges under the same owner name run into negative caching. The first label of the owner name gets a suffix
+derived from the FQDN and the key of the challenge, e.g.
+
+	_acme-challenge.example.com. -> _acme-challenge-3f2a1b9c.example.com.
+
+The suffix is reproducible from the challenge, so CleanUp removes the record written by Present without any state,
+also after a restart. The name stays under the parent domain of the FQDN and thus in the delegated zone, which must
+answer the challenge FQDN from the unique names itself. It cannot be combined with SHARED_RECORD_NAME, which writes
+all records under a single owner name.
+*/
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// uniqueNameSuffixLength is the number of hex characters of the suffix of a unique owner name
+const uniqueNameSuffixLength = 8
+
+// uniqueRecordName returns the owner name of the record of the challenge with the given FQDN and key, which is
+// the FQDN with a suffix on its first label if UNIQUE_RECORD_NAME is set.
+func (h *gitSolver) uniqueRecordName(fqdn string, key string) string {
+	if !h.uniqueRecordNames {
+		return fqdn
+	}
+
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSuffix(fqdn, ".")) + "\n" + key))
+	suffix := "-" + hex.EncodeToString(sum[:])[:uniqueNameSuffixLength]
+
+	label, parent, found := strings.Cut(fqdn, ".")
+	if !found {
+		return fqdn + suffix
+	}
+
+	return label + suffix + "." + parent
+}
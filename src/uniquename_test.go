@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestUniqueRecordName(t *testing.T) {
+	h := &gitSolver{uniqueRecordNames: true}
+
+	name := h.uniqueRecordName("_acme-challenge.example.com.", "key")
+	if !strings.HasPrefix(name, "_acme-challenge-") || !strings.HasSuffix(name, ".example.com.") {
+		t.Fatalf("expected a suffix on the first label, got %q", name)
+	}
+	if len(name) != len("_acme-challenge.example.com.")+1+uniqueNameSuffixLength {
+		t.Errorf("expected a suffix of %d characters, got %q", uniqueNameSuffixLength, name)
+	}
+	if again := h.uniqueRecordName("_acme-challenge.example.com.", "key"); again != name {
+		t.Errorf("expected %q again, got %q", name, again)
+	}
+	if other := h.uniqueRecordName("_acme-challenge.example.com.", "other-key"); other == name {
+		t.Errorf("expected another name for another key, got %q", other)
+	}
+
+	h.uniqueRecordNames = false
+	if name := h.uniqueRecordName("_acme-challenge.example.com.", "key"); name != "_acme-challenge.example.com." {
+		t.Errorf("expected the FQDN without UNIQUE_RECORD_NAME, got %q", name)
+	}
+}
+
+func TestPresentCleanUpUniqueRecordName(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	solver.uniqueRecordNames = true
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+	name := strings.TrimSuffix(solver.uniqueRecordName(challenge.ResolvedFQDN, challenge.Key), ".")
+
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if content := fake.content("main"); !strings.Contains(content, name+" ") || strings.Contains(content, "_acme-challenge.example.com ") {
+		t.Fatalf("expected the record under %s, got %q", name, content)
+	}
+	if found, err := solver.Verify(challenge.ResolvedFQDN, challenge.Key); err != nil || !found {
+		t.Errorf("expected the record to be verified, got %v, %v", found, err)
+	}
+
+	// A restarted solver computes the same name from the challenge
+	restarted := newTestSolver(t, srv)
+	restarted.uniqueRecordNames = true
+	restarted.synced = false
+	if err := restarted.CleanUp(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if content := fake.content("main"); strings.Contains(content, name) {
+		t.Errorf("expected the record under %s to be removed, got %q", name, content)
+	}
+	if err := restarted.CleanUp(challenge); !errors.Is(err, ErrTextRecordDoesNotExist) {
+		t.Errorf("expected %v, got %v", ErrTextRecordDoesNotExist, err)
+	}
+}
+
+func TestRemoveRecordsUniqueRecordName(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	solver.uniqueRecordNames = true
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+	name := strings.TrimSuffix(solver.uniqueRecordName(challenge.ResolvedFQDN, challenge.Key), ".")
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+
+	// The owner name cannot be derived without the key
+	if _, err := solver.RemoveRecords("_acme-challenge.example.com", ""); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected %v, got %v", ErrInvalidConfig, err)
+	}
+
+	removed, err := solver.RemoveRecords("_acme-challenge.example.com", challenge.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("expected 1 removed record, got %d", removed)
+	}
+	if content := fake.content("main"); strings.Contains(content, name) {
+		t.Errorf("expected the record under %s to be removed, got %q", name, content)
+	}
+	if solver.hasRecord(solver.recordID(challenge)) {
+		t.Error("expected the record to be removed from memory")
+	}
+}
@@ -0,0 +1,96 @@
+/*
+This file provides a read-only check of the records in the zone file.
+Verify reads the zone file of the target branch, which is the live zone, and reports whether the TXT record
+of the given FQDN and key is present. Nothing is written, neither to GitLab nor to the records in memory,
+so it can be used by external monitoring to confirm that the webhook's view matches the live zone.
+
+If VERIFY_AFTER_MERGE is set, Present and CleanUp use the same check after their merge, so that an edit that
+succeeded at the API level but produced a zone file the records cannot be read back from fails the challenge
+and is retried by cert-manager, instead of going unnoticed. If MERGE_REQUEST_DRAFT is set as well, the bot branch
+is checked the same way before the draft merge request is marked as ready.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrVerificationFailed = errors.New("zone file verification failed")
+
+// Verify reports whether the TXT record of the given FQDN with the given key is present in the zone file
+// of the target branch.
+func (h *gitSolver) Verify(fqdn string, key string) (bool, error) {
+	route, err := h.route(fqdn)
+	if err != nil {
+		return false, err
+	}
+	if route != h {
+		return route.Verify(fqdn, key)
+	}
+
+	return h.hasBranchRecord(h.gitPath, h.gitTargetBranch, fqdn, key)
+}
+
+// hasBranchRecord reports whether the TXT record of the given FQDN with the given key is present in the zone
+// file of the branch.
+func (h *gitSolver) hasBranchRecord(project string, branch string, fqdn string, key string) (bool, error) {
+	content, err := h.readZoneFile(project, branch)
+	if err != nil {
+		return false, err
+	}
+
+	txtRecords, err := h.readAcmeBotRecords(content)
+	if err != nil {
+		return false, err
+	}
+
+	_, ok := txtRecords[h.recordIDFor(h.uniqueRecordName(fqdn, key), key)]
+	return ok, nil
+}
+
+// verifyMerged checks that the TXT record is present, or absent if present is false, in the target branch
+// after a merge. It does nothing unless VERIFY_AFTER_MERGE is set.
+func (h *gitSolver) verifyMerged(fqdn string, key string, present bool) error {
+	if !h.verifyAfterMerge {
+		return nil
+	}
+
+	found, err := h.Verify(fqdn, key)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrVerificationFailed, err)
+	}
+	if found != present {
+		state := "missing from"
+		if found {
+			state = "still in"
+		}
+		return fmt.Errorf("%w: TXT record of %s is %s %s after the merge", ErrVerificationFailed, fqdn, state, h.gitTargetBranch)
+	}
+
+	return nil
+}
+
+// readyCheck returns the check of a draft merge request, which fails unless the TXT record is present, or absent
+// if present is false, in the bot branch. It returns nil, i.e. no check, unless VERIFY_AFTER_MERGE is set.
+func (h *gitSolver) readyCheck(fqdn string, key string, present bool) func() error {
+	if !h.verifyAfterMerge {
+		return nil
+	}
+
+	return func() error {
+		found, err := h.hasBranchRecord(h.gitBotPath(), h.gitBotBranch, fqdn, key)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrVerificationFailed, err)
+		}
+		if found != present {
+			state := "missing from"
+			if found {
+				state = "still in"
+			}
+			return fmt.Errorf("%w: TXT record of %s is %s %s", ErrVerificationFailed, fqdn, state, h.gitBotBranch)
+		}
+
+		return nil
+	}
+}
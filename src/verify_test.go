@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestVerify(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+
+	challenge := &acme.ChallengeRequest{
+		ResolvedFQDN: "_acme-challenge.example.com.",
+		Key:          "wow-so-secret",
+	}
+
+	testCases := []struct {
+		name string
+		fqdn string
+		key  string
+		want bool
+	}{
+		{
+			name: "present",
+			fqdn: "_acme-challenge.example.com.",
+			key:  "wow-so-secret",
+			want: true,
+		},
+		{
+			name: "without trailing dot",
+			fqdn: "_acme-challenge.example.com",
+			key:  "wow-so-secret",
+			want: true,
+		},
+		{
+			name: "other key",
+			fqdn: "_acme-challenge.example.com.",
+			key:  "other",
+			want: false,
+		},
+		{
+			name: "other fqdn",
+			fqdn: "_acme-challenge.other.com.",
+			key:  "wow-so-secret",
+			want: false,
+		},
+	}
+
+	// Nothing is present before the challenge was presented
+	present, err := solver.Verify(challenge.ResolvedFQDN, challenge.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if present {
+		t.Error("expected record to be absent before Present")
+	}
+
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake.Lock()
+			requests := fake.requests
+			content := fake.branches["main"]
+			fake.Unlock()
+
+			got, err := solver.Verify(tc.fqdn, tc.key)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %t, got %t", tc.want, got)
+			}
+
+			// Verify must only read the zone file
+			if got := fake.content("main"); got != content {
+				t.Errorf("expected zone file to be unchanged, got %q", got)
+			}
+			fake.Lock()
+			if fake.requests != requests+1 {
+				t.Errorf("expected a single request, got %d", fake.requests-requests)
+			}
+			fake.Unlock()
+		})
+	}
+}
+
+func TestVerifyAfterMerge(t *testing.T) {
+	// Corrupt the record when it is merged, e.g. by a broken edit of the zone file
+	corrupt := func(content string) string {
+		return strings.ReplaceAll(content, "TXT \"wow-so-secret\"", "TXT \"wow-so-secret")
+	}
+	// Keep the record when the removal is merged
+	keep := func(content string) string {
+		return strings.Replace(content, "; TEST-ACME-BOT-END", "_acme-challenge.example.com            TXT \"wow-so-secret\"\n; TEST-ACME-BOT-END", 1)
+	}
+
+	testCases := []struct {
+		name        string
+		verify      bool
+		presentEdit func(string) string
+		cleanUpEdit func(string) string
+		err         error
+	}{
+		{name: "disabled with corrupt present", presentEdit: corrupt},
+		{name: "enabled", verify: true},
+		{name: "enabled with corrupt present", verify: true, presentEdit: corrupt, err: ErrVerificationFailed},
+		{name: "enabled with failed cleanup", verify: true, cleanUpEdit: keep, err: ErrVerificationFailed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", fakeZone)
+			solver := newTestSolver(t, srv)
+			solver.verifyAfterMerge = tc.verify
+
+			challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+
+			fake.mergeEdit = tc.presentEdit
+			err := solver.Present(challenge)
+			if tc.presentEdit != nil {
+				if !errors.Is(err, tc.err) {
+					t.Errorf("expected %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fake.mergeEdit = tc.cleanUpEdit
+			if err := solver.CleanUp(challenge); !errors.Is(err, tc.err) {
+				t.Errorf("expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestVerifyDraftMergeRequest(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeZone)
+	solver := newTestSolver(t, srv)
+	solver.verifyAfterMerge = true
+	solver.mergeConfig.Draft = true
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+
+	// A lagging read of the bot branch misses the record, so the merge request is not marked as ready
+	fake.staleReads = 1
+	if err := solver.Present(challenge); !errors.Is(err, ErrVerificationFailed) {
+		t.Fatalf("expected %v, got %v", ErrVerificationFailed, err)
+	}
+	if mr := fake.mergeRequests[1]; mr.title != "Draft: Add TXT record" || mr.state != "opened" {
+		t.Errorf("expected an open draft, got %q in state %s", mr.title, mr.state)
+	}
+
+	// The retry marks the same merge request as ready once the record is verified
+	fake.staleReads = 0
+	if err := solver.Present(challenge); !errors.Is(err, ErrTextRecordAlreadyExists) {
+		t.Fatalf("expected %v, got %v", ErrTextRecordAlreadyExists, err)
+	}
+	if mr := fake.mergeRequests[1]; mr.title != "Add TXT record" || mr.state != "merged" {
+		t.Errorf("expected merged merge request without draft status, got %q in state %s", mr.title, mr.state)
+	}
+
+	if err := solver.CleanUp(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if mr := fake.mergeRequests[2]; mr.title != "Remove TXT record" || mr.state != "merged" {
+		t.Errorf("expected merged merge request without draft status, got %q in state %s", mr.title, mr.state)
+	}
+}
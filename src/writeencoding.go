@@ -0,0 +1,48 @@
+/*
+This file provides the encoding of the content written to GitLab. By default, the zone files are sent as plain
+text, GitLab's default encoding. Zone files with characters the API mangles in text, e.g. control characters or
+invalid UTF-8 in comments, can be sent base64-encoded instead by setting GITLAB_WRITE_ENCODING to base64, matching
+the encoding GitLab uses to return the files. The written file is the same with both encodings.
+*/
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// ContentEncoding defines how the content of the files is sent to GitLab
+type ContentEncoding string
+
+const (
+	ContentEncodingText   ContentEncoding = "text"
+	ContentEncodingBase64 ContentEncoding = "base64"
+)
+
+var ErrInvalidContentEncoding = errors.New("invalid content encoding")
+
+// ParseContentEncoding parses the given string into a ContentEncoding. An empty string defaults to
+// ContentEncodingText.
+func ParseContentEncoding(s string) (ContentEncoding, error) {
+	switch ContentEncoding(strings.ToLower(s)) {
+	case "", ContentEncodingText:
+		return ContentEncodingText, nil
+	case ContentEncodingBase64:
+		return ContentEncodingBase64, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidContentEncoding, s)
+}
+
+// encode returns the content and the encoding to send it with. The encoding is nil for text, GitLab's default.
+func (e ContentEncoding) encode(content string) (*string, *string) {
+	if e != ContentEncodingBase64 {
+		return gitlab.Ptr(content), nil
+	}
+
+	return gitlab.Ptr(base64.StdEncoding.EncodeToString([]byte(content))), gitlab.Ptr(string(ContentEncodingBase64))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestParseContentEncoding(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  ContentEncoding
+		err   bool
+	}{
+		{input: "", want: ContentEncodingText},
+		{input: "text", want: ContentEncodingText},
+		{input: "Base64", want: ContentEncodingBase64},
+		{input: "gzip", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseContentEncoding(tc.input)
+			if tc.err != errors.Is(err, ErrInvalidContentEncoding) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestWriteEncodingSameFile(t *testing.T) {
+	// A comment with characters beyond ASCII and a tab
+	zoneFile := "; Zone für example.com\t(€)\n" + fakeZone
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+
+	written := map[ContentEncoding]map[string]string{}
+	for _, encoding := range []ContentEncoding{ContentEncodingText, ContentEncodingBase64} {
+		fake, srv := newFakeGitlab(t, "main", zoneFile)
+		fake.setFile("main", fakeExternalFile, zoneFile)
+		solver := newTestSolver(t, srv)
+		solver.commitConfig.Encoding = encoding
+
+		// The default file is written with the files API, the extra files with the commits API
+		if err := solver.Present(challenge); err != nil {
+			t.Fatal(err)
+		}
+		solver.gitExtraFiles = []string{fakeExternalFile}
+		if err := solver.CleanUp(challenge); err != nil {
+			t.Fatal(err)
+		}
+
+		written[encoding] = map[string]string{}
+		for _, file := range []string{fakeFile, fakeExternalFile} {
+			written[encoding][file], _ = fake.file("main", file)
+		}
+	}
+
+	for _, file := range []string{fakeFile, fakeExternalFile} {
+		text, base64 := written[ContentEncodingText][file], written[ContentEncodingBase64][file]
+		if text != base64 {
+			t.Errorf("expected the same %s with both encodings, got %q and %q", file, text, base64)
+		}
+	}
+	if content := written[ContentEncodingBase64][fakeFile]; !strings.HasPrefix(content, "; Zone für example.com\t(€)\n") {
+		t.Errorf("expected the comment to be kept, got %q", content)
+	}
+}
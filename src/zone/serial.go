@@ -0,0 +1,227 @@
+package zone
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrSerialNumberNotFound = errors.New("serial number not found")
+
+// SerialNumberRegex matches the serial number of the zone file, e.g. "2021091501 ; serial number"
+var SerialNumberRegex = regexp.MustCompile(`(\d*)\s?;\s?serial number`)
+
+// soaOwnerRegex matches an SOA record up to its type, capturing its owner name, which is empty if the line starts
+// with whitespace
+var soaOwnerRegex = regexp.MustCompile(`(?im)^([^\s;]*)[^;\n]*?\sSOA\s`)
+
+// originDirectiveRegex matches the $ORIGIN directives of a zone file
+var originDirectiveRegex = regexp.MustCompile(`(?m)^\$ORIGIN[ \t]+(\S+)`)
+
+// SerialNumber returns the serial number of the zone file, or an empty string if it has none.
+func SerialNumber(content string) string {
+	matches := SerialNumberRegex.FindStringSubmatch(content)
+	if len(matches) == 0 {
+		return ""
+	}
+
+	return matches[1]
+}
+
+// NextSerialFunc returns the serial number following the given one that also exceeds the serial numbers after,
+// e.g. NextSerialNumberAfter
+type NextSerialFunc func(serialNumber string, after ...string) (string, error)
+
+// IncreaseSerialNumber increases the serial number marked with a "; serial number" comment. The increased serial
+// number also exceeds the serial numbers after, see NextSerialNumberAfter.
+func IncreaseSerialNumber(content string, after ...string) (string, error) {
+	return IncreaseSerialNumberWith(content, NextSerialNumberAfter, after...)
+}
+
+// IncreaseSerialNumberWith increases the serial number marked with a "; serial number" comment to the serial
+// number returned by next.
+func IncreaseSerialNumberWith(content string, next NextSerialFunc, after ...string) (string, error) {
+	matches := SerialNumberRegex.FindStringSubmatch(content)
+	if len(matches) == 0 {
+		return "", ErrSerialNumberNotFound
+	}
+
+	serialNumber, err := next(matches[1], after...)
+	if err != nil {
+		return "", err
+	}
+
+	return SerialNumberRegex.ReplaceAllString(content, fmt.Sprintf("%s ; serial number", serialNumber)), nil
+}
+
+// ZoneSerialNumber returns the serial number of the SOA record of the zone in a zone file with several zones, or an
+// empty string if it has none.
+func ZoneSerialNumber(content string, zone string) string {
+	loc := zoneSerialNumberIndex(content, zone)
+	if loc == nil {
+		return ""
+	}
+
+	return content[loc[2]:loc[3]]
+}
+
+// IncreaseZoneSerialNumberWith increases the serial number of the SOA record of the zone to the serial number
+// returned by next, leaving the serial numbers of the other zones of the content unchanged. The SOA record of the
+// zone is the one whose owner name, resolved against the $ORIGIN directives before it, is the zone.
+func IncreaseZoneSerialNumberWith(content string, zone string, next NextSerialFunc, after ...string) (string, error) {
+	loc := zoneSerialNumberIndex(content, zone)
+	if loc == nil {
+		return "", fmt.Errorf("%w: no SOA record of zone %s", ErrSerialNumberNotFound, zone)
+	}
+
+	serialNumber, err := next(content[loc[2]:loc[3]], after...)
+	if err != nil {
+		return "", err
+	}
+
+	return content[:loc[0]] + fmt.Sprintf("%s ; serial number", serialNumber) + content[loc[1]:], nil
+}
+
+// zoneSerialNumberIndex returns the index pair of the serial number of the SOA record of the zone and of its
+// submatch, see SerialNumberRegex, or nil if the zone has no SOA record with a serial number.
+func zoneSerialNumberIndex(content string, zone string) []int {
+	origins := originDirectiveRegex.FindAllStringSubmatchIndex(content, -1)
+	soas := soaOwnerRegex.FindAllStringSubmatchIndex(content, -1)
+	for i, soa := range soas {
+		origin := ""
+		for _, o := range origins {
+			if o[0] < soa[0] {
+				origin = content[o[2]:o[3]]
+			}
+		}
+		if !sameZone(resolveOwnerName(content[soa[2]:soa[3]], origin), zone) {
+			continue
+		}
+
+		// The serial number of the SOA record is the first one before the next SOA record
+		end := len(content)
+		if i+1 < len(soas) {
+			end = soas[i+1][0]
+		}
+		loc := SerialNumberRegex.FindStringSubmatchIndex(content[soa[0]:end])
+		if loc == nil {
+			return nil
+		}
+		for j := range loc {
+			loc[j] += soa[0]
+		}
+		return loc
+	}
+
+	return nil
+}
+
+// resolveOwnerName returns the owner name relative to the origin, or the origin for "@" or an empty owner name.
+func resolveOwnerName(owner string, origin string) string {
+	switch {
+	case owner == "" || owner == "@":
+		return origin
+	case strings.HasSuffix(owner, ".") || origin == "":
+		return owner
+	}
+
+	return owner + "." + origin
+}
+
+// sameZone reports whether both zone names are the same, ignoring their case and trailing dots.
+func sameZone(a string, b string) bool {
+	return a != "" && strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
+
+// NextSerialNumber returns the serial number following the given one in the YYYYMMDDnn format.
+func NextSerialNumber(serialNumber string) (string, error) {
+	// Check if the first part of the serial number is the current date
+	currentDate := time.Now().Format("20060102")
+	if !strings.HasPrefix(serialNumber, currentDate) {
+		// Use the currentDate to replace the tail of the serial number
+		return fmt.Sprintf("%s01", currentDate), nil
+	}
+
+	// Increment the tail of the serial number
+	tail := serialNumber[len(currentDate):]
+	convertedTail, err := strconv.Atoi(tail)
+	if err != nil {
+		return "", err
+	}
+
+	// Increment the tail of the serial number
+	convertedTail++
+
+	// Convert Tail to 00 if larger than 99
+	if convertedTail > 99 {
+		convertedTail = 0
+	}
+
+	return fmt.Sprintf("%s%02d", currentDate, convertedTail), nil
+}
+
+// NextSerialNumberAfter returns the serial number following the highest of the given one and the serial numbers
+// after like NextSerialNumber, e.g. to exceed the serial number of a zone file that changed since it was read.
+// If the following serial number would not exceed all of them, e.g. because the highest one is from a future date
+// or its tail is exhausted, the highest one is incremented by one instead. Empty serial numbers are ignored.
+func NextSerialNumberAfter(serialNumber string, after ...string) (string, error) {
+	if len(after) == 0 {
+		return NextSerialNumber(serialNumber)
+	}
+
+	highest, highestValue, err := highestSerialNumber(append([]string{serialNumber}, after...))
+	if err != nil {
+		return "", err
+	}
+
+	next, err := NextSerialNumber(highest)
+	if err != nil {
+		return "", err
+	}
+	if value, err := strconv.ParseUint(next, 10, 32); err == nil && (highest == "" || value > highestValue) {
+		return next, nil
+	}
+
+	return strconv.FormatUint(highestValue+1, 10), nil
+}
+
+// NextUnixSerialNumber returns the serial number following the highest of the given one and the serial numbers
+// after as unix time in seconds, for zones with "serial-update-method unixtime". The serial number is the later of
+// now and the highest one plus one, so that it strictly increases even for two increases within the same second
+// or a clock behind the serial number. Empty serial numbers are ignored.
+func NextUnixSerialNumber(now time.Time, serialNumber string, after ...string) (string, error) {
+	highest, highestValue, err := highestSerialNumber(append([]string{serialNumber}, after...))
+	if err != nil {
+		return "", err
+	}
+
+	next := uint64(now.Unix())
+	if highest != "" && next <= highestValue {
+		next = highestValue + 1
+	}
+
+	return strconv.FormatUint(next, 10), nil
+}
+
+// highestSerialNumber returns the highest of the serial numbers and its value, ignoring empty serial numbers.
+// The serial number is empty if all of them are.
+func highestSerialNumber(serialNumbers []string) (string, uint64, error) {
+	highest, highestValue := "", uint64(0)
+	for _, s := range serialNumbers {
+		if s == "" {
+			continue
+		}
+		value, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return "", 0, err
+		}
+		if highest == "" || value > highestValue {
+			highest, highestValue = s, value
+		}
+	}
+
+	return highest, highestValue, nil
+}
@@ -0,0 +1,154 @@
+package zone
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNextSerialNumber(t *testing.T) {
+	currentDate := time.Now().Format("20060102")
+
+	testCases := []struct {
+		serial string
+		want   string
+	}{
+		{serial: "2021091501", want: currentDate + "01"},
+		{serial: currentDate + "01", want: currentDate + "02"},
+		{serial: currentDate + "99", want: currentDate + "00"},
+		{serial: "", want: currentDate + "01"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.serial, func(t *testing.T) {
+			got, err := NextSerialNumber(tc.serial)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSerialNumber(t *testing.T) {
+	if got := SerialNumber("@ IN SOA ns. admin. (\n    2021091501 ; serial number\n)"); got != "2021091501" {
+		t.Errorf("expected 2021091501, got %q", got)
+	}
+	if got := SerialNumber("no serial number"); got != "" {
+		t.Errorf("expected no serial number, got %q", got)
+	}
+}
+
+func TestNextSerialNumberAfter(t *testing.T) {
+	currentDate := time.Now().Format("20060102")
+	exhausted, _ := strconv.Atoi(currentDate + "99")
+
+	testCases := []struct {
+		name   string
+		serial string
+		after  []string
+		want   string
+	}{
+		{name: "no after", serial: currentDate + "99", want: currentDate + "00"},
+		{name: "after is lower", serial: currentDate + "05", after: []string{currentDate + "01"}, want: currentDate + "06"},
+		{name: "after is higher", serial: currentDate + "01", after: []string{currentDate + "05"}, want: currentDate + "06"},
+		{name: "after is from a future date", serial: currentDate + "01", after: []string{"2999010101"}, want: "2999010102"},
+		{name: "tail exhausted", serial: "2021091501", after: []string{currentDate + "99"}, want: strconv.Itoa(exhausted + 1)},
+		{name: "empty after", serial: "2021091501", after: []string{""}, want: currentDate + "01"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NextSerialNumberAfter(tc.serial, tc.after...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestNextUnixSerialNumber(t *testing.T) {
+	now := time.Unix(1790000000, 0)
+
+	testCases := []struct {
+		name   string
+		serial string
+		after  []string
+		want   string
+	}{
+		{name: "older serial", serial: "1700000000", want: "1790000000"},
+		{name: "date serial", serial: "2021091501", want: "2021091502"},
+		{name: "same second", serial: "1790000000", want: "1790000001"},
+		{name: "clock skew", serial: "1790000300", want: "1790000301"},
+		{name: "after is higher", serial: "1700000000", after: []string{"1790000005"}, want: "1790000006"},
+		{name: "empty after", serial: "1700000000", after: []string{""}, want: "1790000000"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NextUnixSerialNumber(now, tc.serial, tc.after...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestIncreaseZoneSerialNumberWith(t *testing.T) {
+	content := `$ORIGIN example.com.
+@ IN SOA ns.example.com. admin.example.com. (
+    2021091501 ; serial number
+)
+$ORIGIN example.org.
+@ IN SOA ns.example.org. admin.example.org. (
+    2021091601 ; serial number
+)
+sub 3600 IN SOA ns.example.org. admin.example.org. ( 2021091701 ; serial number
+)
+`
+	next := func(serialNumber string, after ...string) (string, error) {
+		return "2099010101", nil
+	}
+
+	testCases := []struct {
+		zone string
+		want string
+	}{
+		{zone: "example.com.", want: "2021091501"},
+		{zone: "EXAMPLE.org", want: "2021091601"},
+		{zone: "sub.example.org.", want: "2021091701"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.zone, func(t *testing.T) {
+			if got := ZoneSerialNumber(content, tc.zone); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+
+			bumped, err := IncreaseZoneSerialNumberWith(content, tc.zone, next)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ZoneSerialNumber(bumped, tc.zone); got != "2099010101" {
+				t.Errorf("expected the serial number of %s to be increased, got %q", tc.zone, got)
+			}
+			if strings.Count(bumped, "2099010101") != 1 || strings.Count(bumped, "; serial number") != 3 {
+				t.Errorf("expected only the serial number of %s to change, got %q", tc.zone, bumped)
+			}
+		})
+	}
+
+	if _, err := IncreaseZoneSerialNumberWith(content, "example.net.", next); !errors.Is(err, ErrSerialNumberNotFound) {
+		t.Errorf("expected %v, got %v", ErrSerialNumberNotFound, err)
+	}
+}
@@ -0,0 +1,208 @@
+/*
+Package zone provides the editing of BIND zone files used by the webhook, independent of GitLab and of the
+configuration of the webhook. The records of the webhook live in a block between two marker comments, e.g.
+
+	; ACME-BOT
+	_acme-challenge.svc        TXT "key"
+	; ACME-BOT-END
+
+The block is matched by a regular expression whose first group captures its content, see BlockPattern.
+Records are added directly before the end marker and removed by their exact text, together with a comment of the
+webhook on the line before, see RecordCommentTag. The serial number of the zone is the number marked with a
+"; serial number" comment, see IncreaseSerialNumber.
+*/
+package zone
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrBlockNotFound      = errors.New("-ACME-BOT comments not found")
+	ErrTxtRecordsNotFound = errors.New("txt records do not exist")
+)
+
+// RecordCommentTag identifies the comments written by the webhook
+const RecordCommentTag = "; acme-bot:"
+
+// quotedChunkRegex and singleQuotedChunkRegex match the quoted character-strings of a TXT value
+var (
+	quotedChunkRegex       = regexp.MustCompile(`"([^"]*)"`)
+	singleQuotedChunkRegex = regexp.MustCompile(`'([^']*)'`)
+)
+
+// TxtRecord is a TXT record of the zone file, Name is its owner name as written in the zone file
+type TxtRecord struct {
+	Name  string
+	Value string
+}
+
+// BlockPattern returns the pattern of the -ACME-BOT block with the given prefix, capturing its content.
+func BlockPattern(prefix string) string {
+	return fmt.Sprintf(`; %s-ACME-BOT\n([\s\S]*?); %s-ACME-BOT-END`, prefix, prefix)
+}
+
+// TxtRecordPattern returns the pattern of a TXT record, capturing its owner name and value. The value is quoted
+// unless unquoted is set. The record has to start its line, so that commented out records, e.g. tombstones,
+// are not matched.
+func TxtRecordPattern(ownerPattern string, unquoted bool) string {
+	if unquoted {
+		return fmt.Sprintf(`(?m)^[ \t]*(%s)\s+TXT\s+([^\s"]+)\n`, ownerPattern)
+	}
+
+	return fmt.Sprintf(`(?m)^[ \t]*(%s)\s+TXT\s+("[^\n]*")\n`, ownerPattern)
+}
+
+// SingleQuotedTxtRecordPattern returns the pattern of a TXT record with a value in single quotes, as written by
+// some legacy zone tooling, capturing its owner name and value. See TxtRecordPattern.
+func SingleQuotedTxtRecordPattern(ownerPattern string) string {
+	return fmt.Sprintf(`(?m)^[ \t]*(%s)\s+TXT\s+('[^\n]*')\n`, ownerPattern)
+}
+
+// RecordPattern returns the pattern of a record of the RR type, capturing its owner name and its RDATA without
+// trailing whitespace. See TxtRecordPattern for TXT records.
+func RecordPattern(ownerPattern string, rrType string) string {
+	return fmt.Sprintf(`(?m)^[ \t]*(%s)\s+%s\s+([^\s][^\n]*?)[ \t]*\n`, ownerPattern, regexp.QuoteMeta(rrType))
+}
+
+// ExtractBlock returns the content of the block matched by block, see BlockPattern.
+func ExtractBlock(content string, block *regexp.Regexp) (string, error) {
+	matches := block.FindStringSubmatch(content)
+	if len(matches) == 0 {
+		return "", ErrBlockNotFound
+	}
+
+	return matches[1], nil
+}
+
+// ExtractTxtRecords returns the TXT records of the content matched by re, see TxtRecordPattern. The values are
+// parsed with ParseTextValue.
+func ExtractTxtRecords(content string, re *regexp.Regexp) ([]TxtRecord, error) {
+	records, err := ExtractRecords(content, re)
+	for i := range records {
+		records[i].Value = ParseTextValue(records[i].Value)
+	}
+
+	return records, err
+}
+
+// ExtractRecords returns the records of the content matched by re with their values as written, see RecordPattern.
+func ExtractRecords(content string, re *regexp.Regexp) ([]TxtRecord, error) {
+	submatches := re.FindAllStringSubmatch(content, -1)
+	if len(submatches) == 0 {
+		return nil, ErrTxtRecordsNotFound
+	}
+
+	records := make([]TxtRecord, 0, len(submatches))
+	for _, submatch := range submatches {
+		records = append(records, TxtRecord{Name: submatch[1], Value: submatch[2]})
+	}
+
+	return records, nil
+}
+
+// ParseTextValue returns the value of a TXT record by stripping the quotes and joining the chunks of a quoted value.
+// The chunks are either all in double quotes or all in single quotes.
+func ParseTextValue(value string) string {
+	chunkRegex := quotedChunkRegex
+	switch {
+	case strings.HasPrefix(value, "'"):
+		chunkRegex = singleQuotedChunkRegex
+	case !strings.HasPrefix(value, "\""):
+		return value
+	}
+
+	var sb strings.Builder
+	for _, chunk := range chunkRegex.FindAllStringSubmatch(value, -1) {
+		sb.WriteString(chunk[1])
+	}
+
+	return sb.String()
+}
+
+// AddTxtRecord adds a new TXT record string directly before the end marker of the block matched by block and
+// returns the updated content. If comment is not empty, it is written on the line before the record.
+// The content is returned unchanged if it has no block.
+func AddTxtRecord(content string, recordStr string, block *regexp.Regexp, comment string) (string, error) {
+	loc := block.FindStringSubmatchIndex(content)
+	if loc == nil {
+		return content, nil
+	}
+
+	if comment != "" {
+		recordStr = fmt.Sprintf("%s\n%s", comment, recordStr)
+	}
+
+	return content[:loc[3]] + recordStr + "\n" + content[loc[3]:], nil
+}
+
+// RemoveTxtRecord removes the TXT record string from the given content and returns the updated content.
+// A comment written by the webhook directly before the record is removed as well. The record has to start
+// its line, so that a tombstone of the same record is kept. The record string is matched literally, as the RDATA
+// of other RR types than TXT may contain regexp metacharacters.
+func RemoveTxtRecord(content string, recordStr string) (string, error) {
+	reToCompile := fmt.Sprintf(`(?m)(^%s[^\n]*\n)?^[ \t]*%s\n`, regexp.QuoteMeta(RecordCommentTag), regexp.QuoteMeta(recordStr))
+	re, err := regexp.Compile(reToCompile)
+	if err != nil {
+		return "", err
+	}
+
+	return re.ReplaceAllString(content, ""), nil
+}
+
+// SpaceBlock removes the blank lines of the block content and surrounds its lines with a single blank line.
+// The indentation of the end marker, i.e. the text after the last newline, is kept.
+func SpaceBlock(block string) string {
+	i := strings.LastIndex(block, "\n")
+	indent := block[i+1:]
+
+	lines := []string{}
+	for _, line := range strings.Split(block[:i+1], "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if len(lines) == 0 {
+		return "\n" + indent
+	}
+
+	return "\n" + strings.Join(lines, "\n") + "\n\n" + indent
+}
+
+// SortBlock returns the block content with its records sorted by the keys returned by key for their owner names.
+// Records with the same key keep their order. The comments and blank lines before a record, e.g. the comment of the
+// webhook, move with it, the lines after the last record and the indentation of the end marker stay at the end.
+func SortBlock(block string, key func(owner string) string) string {
+	type entry struct {
+		lines string
+		key   string
+	}
+
+	entries := []entry{}
+	pending := ""
+	for _, line := range strings.SplitAfter(block, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], ";") || !strings.HasSuffix(line, "\n") {
+			pending += line
+			continue
+		}
+
+		entries = append(entries, entry{lines: pending + line, key: key(fields[0])})
+		pending = ""
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	var sb strings.Builder
+	for _, e := range entries {
+		sb.WriteString(e.lines)
+	}
+	sb.WriteString(pending)
+
+	return sb.String()
+}
@@ -0,0 +1,285 @@
+package zone
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestAddTxtRecord(t *testing.T) {
+	testCases := []struct {
+		name      string
+		content   string
+		recordStr string
+		want      string
+		err       error
+	}{
+		{
+			name:      "empty content",
+			content:   "",
+			recordStr: "_acme-challenge.example.com TXT \"somevalue\"",
+			want:      "",
+			err:       nil,
+		},
+		{
+			name:      "single record",
+			content:   "; TEST-ACME-BOT\nsome content\n; TEST-ACME-BOT-END",
+			recordStr: "_acme-challenge.example.com TXT \"somevalue\"",
+			want:      "; TEST-ACME-BOT\nsome content\n_acme-challenge.example.com TXT \"somevalue\"\n; TEST-ACME-BOT-END",
+			err:       nil,
+		},
+		{
+			name:      "no opening comment",
+			content:   "some content\n; ACME-BOT-END",
+			recordStr: "_acme-challenge.example.com TXT \"somevalue\"",
+			want:      "some content\n; ACME-BOT-END",
+			err:       nil,
+		},
+		{
+			name:      "surrounding text",
+			content:   "text-before; TEST-ACME-BOT\nsome content\n; TEST-ACME-BOT-ENDtext-text-after",
+			recordStr: "_acme-challenge.example.com TXT \"somevalue\"",
+			want:      "text-before; TEST-ACME-BOT\nsome content\n_acme-challenge.example.com TXT \"somevalue\"\n; TEST-ACME-BOT-ENDtext-text-after",
+			err:       nil,
+		},
+		{
+			name:      "trailing newline",
+			content:   "; TEST-ACME-BOT\nsome content\n; TEST-ACME-BOT-END\n",
+			recordStr: "_acme-challenge.example.com TXT \"somevalue\"",
+			want:      "; TEST-ACME-BOT\nsome content\n_acme-challenge.example.com TXT \"somevalue\"\n; TEST-ACME-BOT-END\n",
+			err:       nil,
+		},
+		{
+			name:      "no acme bot content",
+			content:   "no acme bot content here",
+			recordStr: "_acme-challenge.example.com TXT \"somevalue\"",
+			want:      "no acme bot content here",
+			err:       nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := AddTxtRecord(tc.content, tc.recordStr, regexp.MustCompile(BlockPattern("TEST")), "")
+			if !reflect.DeepEqual(actual, tc.want) {
+				t.Errorf("expected %q, got %q", tc.want, actual)
+			}
+
+			if tc.err == nil && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+
+			if tc.err != nil {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+
+				if err.Error() != tc.err.Error() {
+					t.Errorf("expected error %q, got %q", tc.err, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoveTxtRecord(t *testing.T) {
+	testCases := []struct {
+		name      string
+		content   string
+		recordStr string
+		want      string
+		err       error
+	}{
+		{
+			name:      "empty content",
+			content:   "",
+			recordStr: "_acme-challenge.example.com TXT \"somevalue\"",
+			want:      "",
+		},
+		{
+			name:      "single record with trailing newline",
+			content:   "_acme-challenge.example.com TXT \"somevalue\"\notherrecord",
+			recordStr: "_acme-challenge.example.com TXT \"somevalue\"",
+			want:      "otherrecord",
+		},
+		{
+			name:      "multiple records",
+			content:   "_acme-challenge.example.com TXT \"somevalue\"\n_acme-challenge.example.com TXT \"anothervalue\"\n",
+			recordStr: "_acme-challenge.example.com TXT \"somevalue\"",
+			want:      "_acme-challenge.example.com TXT \"anothervalue\"\n",
+		},
+		{
+			name:    "no record",
+			content: "someotherrecord",
+			want:    "someotherrecord",
+		},
+		{
+			name:      "multiple records different domains",
+			content:   "_acme-challenge.example.com TXT \"somevalue\"\n_acme-challenge.test.com TXT \"anothervalue\"\n",
+			recordStr: "_acme-challenge.test.com TXT \"anothervalue\"",
+			want:      "_acme-challenge.example.com TXT \"somevalue\"\n",
+		},
+		{
+			name:      "wrong recordStr",
+			content:   "_acme-challenge.example.com TXT \"somevalue\"\n_acme-challenge.example.com TXT \"anothervalue\"\n",
+			recordStr: "example.com",
+			want:      "_acme-challenge.example.com TXT \"somevalue\"\n_acme-challenge.example.com TXT \"anothervalue\"\n",
+		},
+		{
+			name:      "record with metacharacters",
+			content:   "foo IN HINFO \"x86+64\" \"Linux\"\nfoo IN HINFO \"x866664\" \"Linux\"\n",
+			recordStr: "foo IN HINFO \"x86+64\" \"Linux\"",
+			want:      "foo IN HINFO \"x866664\" \"Linux\"\n",
+		},
+		{
+			name:      "record with unbalanced parenthesis",
+			content:   "foo IN HINFO \"(x86\" \"Linux\"\nother\n",
+			recordStr: "foo IN HINFO \"(x86\" \"Linux\"",
+			want:      "other\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := RemoveTxtRecord(tc.content, tc.recordStr)
+			if !reflect.DeepEqual(actual, tc.want) {
+				t.Errorf("expected %q, got %q", tc.want, actual)
+			}
+
+			if tc.err == nil && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+
+			if tc.err != nil {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+
+				if err.Error() != tc.err.Error() {
+					t.Errorf("expected error %q, got %q", tc.err, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSpaceBlock(t *testing.T) {
+	testCases := []struct {
+		name  string
+		block string
+		want  string
+	}{
+		{
+			name:  "empty",
+			block: "",
+			want:  "\n",
+		},
+		{
+			name:  "blank lines only",
+			block: "\n\n  \n",
+			want:  "\n",
+		},
+		{
+			name:  "record without spacing",
+			block: "a TXT \"1\"\n",
+			want:  "\na TXT \"1\"\n\n",
+		},
+		{
+			name:  "orphaned blank lines",
+			block: "\n\na TXT \"1\"\n\n\nb TXT \"2\"\n\n\n",
+			want:  "\na TXT \"1\"\nb TXT \"2\"\n\n",
+		},
+		{
+			name:  "indented end marker",
+			block: "    a TXT \"1\"\n    ",
+			want:  "\n    a TXT \"1\"\n\n    ",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := SpaceBlock(tc.block); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSortBlock(t *testing.T) {
+	testCases := []struct {
+		name  string
+		block string
+		want  string
+	}{
+		{
+			name:  "empty",
+			block: "\n",
+			want:  "\n",
+		},
+		{
+			name:  "records",
+			block: "c TXT \"1\"\na TXT \"2\"\nb TXT \"3\"\n",
+			want:  "a TXT \"2\"\nb TXT \"3\"\nc TXT \"1\"\n",
+		},
+		{
+			name:  "same owner keeps order",
+			block: "b TXT \"1\"\na TXT \"2\"\nb TXT \"3\"\n",
+			want:  "a TXT \"2\"\nb TXT \"1\"\nb TXT \"3\"\n",
+		},
+		{
+			name:  "comments move with their record",
+			block: "; acme-bot: c\nc TXT \"1\"\n; acme-bot: a\na TXT \"2\"\n",
+			want:  "; acme-bot: a\na TXT \"2\"\n; acme-bot: c\nc TXT \"1\"\n",
+		},
+		{
+			name:  "trailing lines and indented end marker stay at the end",
+			block: "\n    b TXT \"1\"\n    a TXT \"2\"\n    ; b TXT \"old\"\n\n    ",
+			want:  "    a TXT \"2\"\n\n    b TXT \"1\"\n    ; b TXT \"old\"\n\n    ",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := SortBlock(tc.block, func(owner string) string { return owner }); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestExtractTxtRecords(t *testing.T) {
+	block := "; TEST-ACME-BOT\n_acme-challenge.svc TXT \"some\" \"value\"\n; _acme-challenge.old TXT \"removed\"\n_acme-challenge.www TXT \"other\"\n; TEST-ACME-BOT-END\n"
+
+	content, err := ExtractBlock(block, regexp.MustCompile(BlockPattern("TEST")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Commented out records are not matched and chunked values are joined
+	got, err := ExtractTxtRecords(content, regexp.MustCompile(TxtRecordPattern(`_acme-challenge\..*?`, false)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TxtRecord{{Name: "_acme-challenge.svc", Value: "somevalue"}, {Name: "_acme-challenge.www", Value: "other"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// Single-quoted values are matched by their own pattern only
+	single := "_acme-challenge.svc TXT 'some' 'value'\n_acme-challenge.www TXT \"other\"\n"
+	got, err = ExtractTxtRecords(single, regexp.MustCompile(SingleQuotedTxtRecordPattern(`_acme-challenge\..*?`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []TxtRecord{{Name: "_acme-challenge.svc", Value: "somevalue"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if _, err := ExtractBlock("no block", regexp.MustCompile(BlockPattern("TEST"))); err != ErrBlockNotFound {
+		t.Errorf("expected %v, got %v", ErrBlockNotFound, err)
+	}
+	if _, err := ExtractTxtRecords("no records", regexp.MustCompile(TxtRecordPattern(`_acme-challenge\..*?`, true))); err != ErrTxtRecordsNotFound {
+		t.Errorf("expected %v, got %v", ErrTxtRecordsNotFound, err)
+	}
+}
@@ -0,0 +1,416 @@
+/*
+This file provides the editing of zone files kept as structured YAML or JSON instead of BIND text, e.g. when a
+templating step renders the zone file from it. If ZONE_FORMAT is "yaml" or "json", the records of the webhook
+are kept in a designated list (ZONE_RECORDS_PATH) instead of the -ACME-BOT block, and the serial number is a
+field of the document (ZONE_SERIAL_PATH). Both paths are dot separated keys of nested mappings, e.g. "soa.serial".
+
+	serial: 2021091501
+	acme-bot:
+	  - name: _acme-challenge.svc
+	    type: TXT
+	    value: key
+
+Every entry of the list has the owner name, type and value of the record, and an optional comment.
+The document is edited as a YAML node tree, so that the order of the keys and the comments of YAML files are kept.
+
+Data files consumed by a CI template that only knows TXT records, e.g. the dynamic records of a zone generated in a
+pipeline, may list plain {name, value} entries instead. If ZONE_RECORD_ENTRY is "name-value", the entries are
+written without a type and every entry with a name is a TXT record, unless it has a type other than TXT. Such files
+often have no serial number, which the template derives itself, and need REQUIRE_SERIAL disabled.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kallepan/cert-manager-webhook/src/zone"
+	"gopkg.in/yaml.v3"
+)
+
+// ZoneFormat defines the format of the zone file
+type ZoneFormat string
+
+const (
+	ZoneFormatBind ZoneFormat = "bind"
+	ZoneFormatYAML ZoneFormat = "yaml"
+	ZoneFormatJSON ZoneFormat = "json"
+)
+
+const (
+	defaultZoneSerialPath  = "serial"
+	defaultZoneRecordsPath = "acme-bot"
+)
+
+var (
+	ErrInvalidZoneFormat   = errors.New("invalid zone format")
+	ErrZoneRecordsNotFound = errors.New("records list not found in zone file")
+)
+
+// ParseZoneFormat parses the given string into a ZoneFormat. An empty string defaults to ZoneFormatBind.
+func ParseZoneFormat(s string) (ZoneFormat, error) {
+	switch ZoneFormat(strings.ToLower(s)) {
+	case "", ZoneFormatBind:
+		return ZoneFormatBind, nil
+	case ZoneFormatYAML:
+		return ZoneFormatYAML, nil
+	case ZoneFormatJSON:
+		return ZoneFormatJSON, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidZoneFormat, s)
+}
+
+// RecordEntryFormat defines the fields of the entries of the records list
+type RecordEntryFormat string
+
+const (
+	RecordEntryTyped     RecordEntryFormat = "typed"
+	RecordEntryNameValue RecordEntryFormat = "name-value"
+)
+
+var ErrInvalidRecordEntryFormat = errors.New("invalid record entry format")
+
+// ParseRecordEntryFormat parses the given string into a RecordEntryFormat. An empty string defaults to
+// RecordEntryTyped.
+func ParseRecordEntryFormat(s string) (RecordEntryFormat, error) {
+	switch RecordEntryFormat(strings.ToLower(s)) {
+	case "", RecordEntryTyped:
+		return RecordEntryTyped, nil
+	case RecordEntryNameValue:
+		return RecordEntryNameValue, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidRecordEntryFormat, s)
+}
+
+// structuredZone edits a zone file kept as YAML or JSON
+type structuredZone struct {
+	format      ZoneFormat
+	serialPath  []string
+	recordsPath []string
+
+	// entryFormat defines whether the entries of the records list have a type, an empty format is typed
+	entryFormat RecordEntryFormat
+}
+
+func newStructuredZone(format ZoneFormat, serialPath string, recordsPath string) *structuredZone {
+	return &structuredZone{
+		format:      format,
+		serialPath:  strings.Split(serialPath, "."),
+		recordsPath: strings.Split(recordsPath, "."),
+	}
+}
+
+// records returns the TXT records of the records list.
+func (z *structuredZone) records(content string) ([]*Record, error) {
+	_, list, err := z.parseRecords(content)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []*Record{}
+	for _, entry := range list.Content {
+		if !z.isTxtEntry(entry) {
+			continue
+		}
+		records = append(records, &Record{
+			Domain: mappingValue(entry, "name"),
+			Key:    mappingValue(entry, "value"),
+		})
+	}
+
+	return records, nil
+}
+
+// addRecord appends the record to the records list. The comment is written without the RECORD_COMMENT_TAG.
+func (z *structuredZone) addRecord(content string, record *Record, comment string) (string, error) {
+	if err := record.Validate(); err != nil {
+		return "", err
+	}
+
+	doc, list, err := z.parseRecords(content)
+	if err != nil {
+		return "", err
+	}
+
+	entry := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	appendMappingValue(entry, "name", record.Domain)
+	if z.entryFormat != RecordEntryNameValue {
+		appendMappingValue(entry, "type", "TXT")
+	}
+	appendMappingValue(entry, "value", record.Key)
+	if comment != "" {
+		appendMappingValue(entry, "comment", strings.TrimSpace(strings.TrimPrefix(comment, RECORD_COMMENT_TAG)))
+	}
+
+	// An empty flow list, e.g. "[]", is written as a block list once it has entries
+	list.Style = 0
+	list.Content = append(list.Content, entry)
+
+	return z.encode(doc)
+}
+
+// removeRecords removes the TXT records with the given owner name from the records list.
+// If key is not empty, only the records with the given key are removed.
+// It returns the updated content and the number of removed records.
+func (z *structuredZone) removeRecords(content string, name string, key string) (string, int, error) {
+	doc, list, err := z.parseRecords(content)
+	if err != nil {
+		return "", 0, err
+	}
+
+	removed := 0
+	kept := []*yaml.Node{}
+	for _, entry := range list.Content {
+		if z.isTxtEntry(entry) && mappingValue(entry, "name") == name && (key == "" || mappingValue(entry, "value") == key) {
+			removed++
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	list.Content = kept
+
+	content, err = z.encode(doc)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return content, removed, nil
+}
+
+// serialNumber returns the serial number field of the zone file, or an empty string if it has none.
+func (z *structuredZone) serialNumber(content string) string {
+	doc, err := z.parse(content)
+	if err != nil {
+		return ""
+	}
+
+	serial := lookupPath(doc.Content[0], z.serialPath)
+	if serial == nil || serial.Kind != yaml.ScalarNode {
+		return ""
+	}
+
+	return serial.Value
+}
+
+// increaseSerialNumber increases the serial number field of the zone file to the serial number returned by next.
+func (z *structuredZone) increaseSerialNumber(content string, next zone.NextSerialFunc, after ...string) (string, error) {
+	doc, err := z.parse(content)
+	if err != nil {
+		return "", err
+	}
+
+	serial := lookupPath(doc.Content[0], z.serialPath)
+	if serial == nil || serial.Kind != yaml.ScalarNode {
+		return "", ErrSerialNumberNotFound
+	}
+
+	serialNumber, err := next(serial.Value, after...)
+	if err != nil {
+		return "", err
+	}
+	serial.Value = serialNumber
+	serial.Tag = "!!int"
+	serial.Style = 0
+
+	return z.encode(doc)
+}
+
+// parseRecords parses the content and returns the document and its records list.
+// A records key without a value is turned into an empty list.
+func (z *structuredZone) parseRecords(content string) (*yaml.Node, *yaml.Node, error) {
+	doc, err := z.parse(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	list := lookupPath(doc.Content[0], z.recordsPath)
+	if list == nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrZoneRecordsNotFound, strings.Join(z.recordsPath, "."))
+	}
+	if list.Kind == yaml.ScalarNode && list.ShortTag() == "!!null" {
+		list.Kind = yaml.SequenceNode
+		list.Tag = "!!seq"
+		list.Value = ""
+	}
+	if list.Kind != yaml.SequenceNode {
+		return nil, nil, fmt.Errorf("%w: %s is not a list", ErrZoneRecordsNotFound, strings.Join(z.recordsPath, "."))
+	}
+
+	return doc, list, nil
+}
+
+func (z *structuredZone) parse(content string) (*yaml.Node, error) {
+	// JSON is a subset of YAML, so both formats are parsed the same way
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		return nil, fmt.Errorf("parsing %s zone file: %w", z.format, err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, fmt.Errorf("parsing %s zone file: empty document", z.format)
+	}
+
+	return &doc, nil
+}
+
+func (z *structuredZone) encode(doc *yaml.Node) (string, error) {
+	var buf bytes.Buffer
+
+	if z.format == ZoneFormatJSON {
+		if err := writeJSONNode(&buf, doc); err != nil {
+			return "", err
+		}
+
+		var out bytes.Buffer
+		if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+			return "", err
+		}
+		out.WriteString("\n")
+		return out.String(), nil
+	}
+
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// lookupPath returns the value of the nested mapping keys of the node, or nil if it does not exist.
+func lookupPath(node *yaml.Node, path []string) *yaml.Node {
+	for _, key := range path {
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				next = node.Content[i+1]
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		node = next
+	}
+
+	return node
+}
+
+// mappingValue returns the scalar value of the key of the mapping, or an empty string.
+func mappingValue(node *yaml.Node, key string) string {
+	if value := lookupPath(node, []string{key}); value != nil {
+		return value.Value
+	}
+
+	return ""
+}
+
+func appendMappingValue(node *yaml.Node, key string, value string) {
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value},
+	)
+}
+
+// isTxtEntry reports whether the entry of the records list is a TXT record. The entries of a name-value list
+// are TXT records unless they have another type.
+func (z *structuredZone) isTxtEntry(entry *yaml.Node) bool {
+	if entry.Kind != yaml.MappingNode {
+		return false
+	}
+	if z.entryFormat == RecordEntryNameValue {
+		rrType := lookupPath(entry, []string{"type"})
+		return lookupPath(entry, []string{"name"}) != nil && (rrType == nil || strings.EqualFold(rrType.Value, "TXT"))
+	}
+
+	return strings.EqualFold(mappingValue(entry, "type"), "TXT")
+}
+
+// writeJSONNode writes the node as compact JSON, keeping the order of the mapping keys.
+func writeJSONNode(buf *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		return writeJSONNode(buf, node.Content[0])
+	case yaml.AliasNode:
+		return writeJSONNode(buf, node.Alias)
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, err := json.Marshal(node.Content[i].Value)
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := writeJSONNode(buf, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSONNode(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!null":
+			buf.WriteString("null")
+		case "!!int", "!!float", "!!bool":
+			buf.WriteString(node.Value)
+		default:
+			value, err := json.Marshal(node.Value)
+			if err != nil {
+				return err
+			}
+			buf.Write(value)
+		}
+	}
+
+	return nil
+}
+
+// readStructuredRecords returns the records of the structured zone file, like extractTxtRecords does for BIND.
+func (h *gitSolver) readStructuredRecords(content string) (map[string]string, error) {
+	records, err := h.structuredZone.records(content)
+	if err != nil {
+		return nil, err
+	}
+
+	// In shared mode only the records of the shared owner name are considered
+	sharedName := ""
+	if h.sharedRecordName != "" {
+		sharedName = h.newRecord(h.sharedRecordName, "", "").Domain
+	}
+
+	txtRecords := make(map[string]string, len(records))
+	for _, record := range records {
+		if sharedName != "" && record.Domain != sharedName {
+			continue
+		}
+		txtRecords[h.recordIDFor(recordFQDN(record.Domain, ""), record.Key)] = record.Key
+	}
+
+	return txtRecords, nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/kallepan/cert-manager-webhook/src/zone"
+)
+
+const fakeYAMLZone = `# rendered to BIND by the pipeline
+soa:
+  serial: 2021091501 # serial number
+records:
+  - name: www
+    type: A
+    value: 1.2.3.4
+acme-bot: []
+`
+
+const fakeJSONZone = `{
+  "soa": {
+    "serial": 2021091501
+  },
+  "records": [
+    {
+      "name": "www",
+      "type": "A",
+      "value": "1.2.3.4"
+    }
+  ],
+  "acme-bot": []
+}
+`
+
+func TestParseZoneFormat(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  ZoneFormat
+		err   bool
+	}{
+		{input: "", want: ZoneFormatBind},
+		{input: "bind", want: ZoneFormatBind},
+		{input: "YAML", want: ZoneFormatYAML},
+		{input: "json", want: ZoneFormatJSON},
+		{input: "toml", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseZoneFormat(tc.input)
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+			if tc.err != (err != nil) {
+				t.Errorf("expected error %t, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestStructuredZoneAddRemoveRecord(t *testing.T) {
+	testCases := []struct {
+		name    string
+		format  ZoneFormat
+		content string
+		added   string
+	}{
+		{
+			name:    "yaml",
+			format:  ZoneFormatYAML,
+			content: fakeYAMLZone,
+			added:   "acme-bot:\n  - name: _acme-challenge.svc.example.com\n    type: TXT\n    value: secret\n    comment: added by test\n",
+		},
+		{
+			name:    "json",
+			format:  ZoneFormatJSON,
+			content: fakeJSONZone,
+			added:   "\"acme-bot\": [\n    {\n      \"name\": \"_acme-challenge.svc.example.com\",\n      \"type\": \"TXT\",\n      \"value\": \"secret\",\n      \"comment\": \"added by test\"\n    }\n  ]\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			z := newStructuredZone(tc.format, "soa.serial", "acme-bot")
+			record := &Record{Domain: "_acme-challenge.svc.example.com", Key: "secret"}
+
+			added, err := z.addRecord(tc.content, record, RECORD_COMMENT_TAG+" added by test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(added, tc.added) {
+				t.Errorf("expected %q in %q", tc.added, added)
+			}
+
+			records, err := z.records(added)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 1 || *records[0] != *record {
+				t.Errorf("expected %v, got %v", []*Record{record}, records)
+			}
+
+			// The other records are kept, only the TXT record of the webhook is removed
+			removed, count, err := z.removeRecords(added, record.Domain, "other")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 0 || removed != added {
+				t.Errorf("expected no record with another key to be removed, got %d", count)
+			}
+			removed, count, err = z.removeRecords(added, record.Domain, record.Key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 1 {
+				t.Errorf("expected 1 removed record, got %d", count)
+			}
+			if strings.Contains(removed, "secret") || !strings.Contains(removed, "1.2.3.4") {
+				t.Errorf("expected only the TXT record to be removed, got %q", removed)
+			}
+		})
+	}
+}
+
+func TestStructuredZoneKeepsComments(t *testing.T) {
+	z := newStructuredZone(ZoneFormatYAML, "soa.serial", "acme-bot")
+
+	content, err := z.increaseSerialNumber(fakeYAMLZone, zone.NextSerialNumberAfter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "serial: " + time.Now().Format("20060102") + "01 # serial number"
+	if !strings.Contains(content, want) {
+		t.Errorf("expected %q in %q", want, content)
+	}
+	if !strings.HasPrefix(content, "# rendered to BIND by the pipeline\n") {
+		t.Errorf("expected comment to be kept, got %q", content)
+	}
+}
+
+func TestStructuredZoneErrors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		err     error
+	}{
+		{
+			name:    "missing records",
+			content: "soa:\n  serial: 2021091501\n",
+			err:     ErrZoneRecordsNotFound,
+		},
+		{
+			name:    "records not a list",
+			content: "acme-bot: records\n",
+			err:     ErrZoneRecordsNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			z := newStructuredZone(ZoneFormatYAML, "soa.serial", "acme-bot")
+
+			if _, err := z.records(tc.content); !errors.Is(err, tc.err) {
+				t.Errorf("expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+
+	z := newStructuredZone(ZoneFormatYAML, "soa.serial", "acme-bot")
+	if _, err := z.increaseSerialNumber("acme-bot: []\n", zone.NextSerialNumberAfter); err != ErrSerialNumberNotFound {
+		t.Errorf("expected %v, got %v", ErrSerialNumberNotFound, err)
+	}
+}
+
+func TestPresentCleanUpStructuredZone(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeYAMLZone)
+	solver := newTestSolver(t, srv)
+	solver.structuredZone = newStructuredZone(ZoneFormatYAML, "soa.serial", "acme-bot")
+
+	challenge := &acme.ChallengeRequest{
+		ResolvedFQDN: "_acme-challenge.example.com.",
+		Key:          "wow-so-secret",
+	}
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(fake.content("main"), "  - name: _acme-challenge.example.com\n    type: TXT\n    value: wow-so-secret\n") {
+		t.Errorf("expected record in zone file, got %q", fake.content("main"))
+	}
+	if strings.Contains(fake.content("main"), "2021091501") {
+		t.Errorf("expected serial number to be increased, got %q", fake.content("main"))
+	}
+
+	present, err := solver.Verify(challenge.ResolvedFQDN, challenge.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !present {
+		t.Error("expected record to be verified")
+	}
+
+	if err := solver.CleanUp(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(fake.content("main"), "wow-so-secret") {
+		t.Errorf("expected record to be removed, got %q", fake.content("main"))
+	}
+}
+
+// fakeDataFile is a data file of the dynamic TXT records of a zone rendered by a CI template
+const fakeDataFile = `serial: 2021091501
+txt:
+  - name: _dmarc
+    value: v=DMARC1; p=none
+  - name: www
+    type: A
+    value: 1.2.3.4
+`
+
+func TestParseRecordEntryFormat(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  RecordEntryFormat
+		err   bool
+	}{
+		{input: "", want: RecordEntryTyped},
+		{input: "typed", want: RecordEntryTyped},
+		{input: "Name-Value", want: RecordEntryNameValue},
+		{input: "list", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseRecordEntryFormat(tc.input)
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+			if tc.err != (err != nil) {
+				t.Errorf("expected error %t, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestStructuredZoneNameValueEntries(t *testing.T) {
+	z := newStructuredZone(ZoneFormatYAML, "serial", "txt")
+	z.entryFormat = RecordEntryNameValue
+
+	// The entries without a type are TXT records, the A record is not
+	records, err := z.records(fakeDataFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Domain != "_dmarc" {
+		t.Fatalf("expected the _dmarc record, got %v", records)
+	}
+
+	record := &Record{Domain: "_acme-challenge.svc", Key: "secret"}
+	added, err := z.addRecord(fakeDataFile, record, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "  - name: _acme-challenge.svc\n    value: secret\n"; !strings.HasSuffix(added, want) {
+		t.Errorf("expected %q at the end of %q", want, added)
+	}
+
+	removed, count, err := z.removeRecords(added, record.Domain, record.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 || removed != fakeDataFile {
+		t.Errorf("expected the data file without the record, got %d removed and %q", count, removed)
+	}
+}
+
+func TestPresentCleanUpNameValueEntries(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		serial  bool
+	}{
+		{name: "with serial", content: fakeDataFile, serial: true},
+		{name: "without serial", content: strings.TrimPrefix(fakeDataFile, "serial: 2021091501\n")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", tc.content)
+			solver := newTestSolver(t, srv)
+			solver.structuredZone = newStructuredZone(ZoneFormatYAML, "serial", "txt")
+			solver.structuredZone.entryFormat = RecordEntryNameValue
+			solver.optionalSerial = true
+
+			challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+			if err := solver.Present(challenge); err != nil {
+				t.Fatal(err)
+			}
+			content := fake.content("main")
+			if !strings.Contains(content, "  - name: _acme-challenge.example.com\n    value: wow-so-secret\n") {
+				t.Errorf("expected a name-value entry, got %q", content)
+			}
+			if got := solver.structuredZone.serialNumber(content); tc.serial == (got == "" || got == "2021091501") {
+				t.Errorf("expected the serial number to be increased %t, got %q", tc.serial, got)
+			}
+
+			if err := solver.CleanUp(challenge); err != nil {
+				t.Fatal(err)
+			}
+			content = fake.content("main")
+			if strings.Contains(content, "wow-so-secret") || !strings.Contains(content, "v=DMARC1") {
+				t.Errorf("expected only the record of the challenge to be removed, got %q", content)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+/*
+This file provides the validation of the zone file during the initialization. A GITLAB_FILE pointing at a
+directory or at a file that is no zone file otherwise fails the first challenge with an unrelated error, e.g. a
+missing -ACME-BOT block. Instead, Initialize checks that the path is a file of the target branch and that its
+content looks like a zone file: a BIND zone file needs an SOA record or the -ACME-BOT block, a structured zone
+file needs its records list. A BIND zone file without the -ACME-BOT block of GITLAB_BOT_COMMENT_PREFIX is also
+checked for a begin and an end marker of different prefixes, e.g. "; PROD-ACME-BOT" closed by "; PRD-ACME-BOT-END",
+which is reported with both prefixes instead of as a missing block. The check is skipped with LAZY_INIT, as the
+zone file is not read before the first challenge then.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+var (
+	ErrZoneFileIsDirectory  = errors.New("GITLAB_FILE is a directory, not a zone file")
+	ErrZoneFileNotFound     = errors.New("GITLAB_FILE does not exist")
+	ErrNotAZoneFile         = errors.New("GITLAB_FILE does not look like a zone file")
+	ErrMarkerPrefixMismatch = errors.New("marker prefix mismatch")
+)
+
+// soaRecordRegex matches the type of an SOA record in a BIND zone file
+var soaRecordRegex = regexp.MustCompile(`(?i)\sSOA\s`)
+
+// beginMarkerRegex and endMarkerRegex match the -ACME-BOT markers and capture their prefix
+var (
+	beginMarkerRegex = regexp.MustCompile(`(?m)^[ \t]*; (\S+)-ACME-BOT[ \t]*$`)
+	endMarkerRegex   = regexp.MustCompile(`(?m)^[ \t]*; (\S+)-ACME-BOT-END[ \t]*$`)
+)
+
+// checkMarkerPrefixes returns ErrMarkerPrefixMismatch if the content has a begin marker without an end marker of
+// the same prefix and an end marker without a begin marker of the same prefix.
+func checkMarkerPrefixes(content string) error {
+	begins := markerPrefixes(beginMarkerRegex, content)
+	ends := markerPrefixes(endMarkerRegex, content)
+
+	begin, end := "", ""
+	for _, prefix := range begins {
+		if !slices.Contains(ends, prefix) {
+			begin = prefix
+			break
+		}
+	}
+	for _, prefix := range ends {
+		if !slices.Contains(begins, prefix) {
+			end = prefix
+			break
+		}
+	}
+	if begin == "" || end == "" {
+		return nil
+	}
+
+	return fmt.Errorf("%w: begin=%s end=%s", ErrMarkerPrefixMismatch, begin, end)
+}
+
+// markerPrefixes returns the prefixes of the markers matched by the regex in the order of the content.
+func markerPrefixes(re *regexp.Regexp, content string) []string {
+	prefixes := []string{}
+	for _, match := range re.FindAllStringSubmatch(content, -1) {
+		prefixes = append(prefixes, match[1])
+	}
+
+	return prefixes
+}
+
+// checkZoneFile checks that GITLAB_FILE is a file of the target branch that looks like a zone file.
+func (h *gitSolver) checkZoneFile() error {
+	content, err := h.readZoneFile(h.gitPath, h.gitTargetBranch)
+	if err != nil {
+		if !errors.Is(err, gitlab.ErrNotFound) {
+			return err
+		}
+
+		// GitLab reports a directory as a missing file, the tree of the path tells them apart
+		entries, _, treeErr := h.gitClient.Repositories.ListTree(h.gitPath, &gitlab.ListTreeOptions{
+			Path: gitlab.Ptr(h.gitFile),
+			Ref:  gitlab.Ptr(h.gitTargetBranch),
+		})
+		if treeErr == nil && len(entries) > 0 {
+			return fmt.Errorf("%w: %s in %s on branch %s, set it to the path of the zone file in the directory", ErrZoneFileIsDirectory, h.gitFile, h.gitPath, h.gitTargetBranch)
+		}
+		return fmt.Errorf("%w: %s in %s on branch %s, check the path and the branch: %w", ErrZoneFileNotFound, h.gitFile, h.gitPath, h.gitTargetBranch, err)
+	}
+
+	if h.structuredZone != nil {
+		if _, err := h.structuredZone.records(content); err != nil {
+			return fmt.Errorf("%w: %s in %s on branch %s: %w", ErrNotAZoneFile, h.gitFile, h.gitPath, h.gitTargetBranch, err)
+		}
+		return nil
+	}
+
+	re, err := h.acmeBotBlockRegex()
+	if err != nil {
+		return err
+	}
+	if re.MatchString(content) {
+		return nil
+	}
+	if h.acmeBotBeginMarker == "" {
+		if err := checkMarkerPrefixes(content); err != nil {
+			return fmt.Errorf("%w in %s in %s on branch %s, check the markers and GITLAB_BOT_COMMENT_PREFIX", err, h.gitFile, h.gitPath, h.gitTargetBranch)
+		}
+	}
+	if !soaRecordRegex.MatchString(content) {
+		return fmt.Errorf("%w: %s in %s on branch %s has neither an SOA record nor the -ACME-BOT block", ErrNotAZoneFile, h.gitFile, h.gitPath, h.gitTargetBranch)
+	}
+
+	return nil
+}
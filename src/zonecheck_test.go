@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckZoneFile(t *testing.T) {
+	testCases := []struct {
+		name    string
+		file    string
+		content string
+		err     error
+	}{
+		{
+			name:    "zone file",
+			file:    "db.zone",
+			content: fakeZone,
+		},
+		{
+			name:    "markers only",
+			file:    "db.zone",
+			content: "; TEST-ACME-BOT\n; TEST-ACME-BOT-END\n",
+		},
+		{
+			name:    "SOA only",
+			file:    "db.zone",
+			content: "@ IN SOA ns.example.com. admin.example.com. 1 3600 600 86400 300\n",
+		},
+		{
+			name:    "mismatched marker prefixes",
+			file:    "db.zone",
+			content: "@ IN SOA ns.example.com. admin.example.com. 1 3600 600 86400 300\n; PROD-ACME-BOT\n; PRD-ACME-BOT-END\n",
+			err:     ErrMarkerPrefixMismatch,
+		},
+		{
+			name: "directory",
+			file: "zones",
+			err:  ErrZoneFileIsDirectory,
+		},
+		{
+			name: "missing file",
+			file: "db.zone.typo",
+			err:  ErrZoneFileNotFound,
+		},
+		{
+			name:    "not a zone file",
+			file:    "db.zone",
+			content: "# README\n\nThe zone files are in zones/.\n",
+			err:     ErrNotAZoneFile,
+		},
+		{
+			name:    "binary content",
+			file:    "db.zone",
+			content: "\x89PNG\r\n\x1a\n\x00\x00",
+			err:     ErrNotAZoneFile,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", tc.content)
+			fake.setFile("main", "zones/db.zone", fakeZone)
+
+			solver := newTestSolver(t, srv)
+			solver.gitFile = tc.file
+
+			err := solver.checkZoneFile()
+			if !errors.Is(err, tc.err) {
+				t.Errorf("expected %v, got %v", tc.err, err)
+			}
+			if err != nil && ClassifyError(err) != ErrorClassPermanent {
+				t.Errorf("expected %v to be permanent", err)
+			}
+		})
+	}
+}
+
+func TestCheckZoneFileStructured(t *testing.T) {
+	_, srv := newFakeGitlab(t, "main", "soa:\n  serial: 1\n")
+	solver := newTestSolver(t, srv)
+	solver.structuredZone = newStructuredZone(ZoneFormatYAML, "soa.serial", "acme-bot")
+
+	if err := solver.checkZoneFile(); !errors.Is(err, ErrNotAZoneFile) {
+		t.Errorf("expected %v, got %v", ErrNotAZoneFile, err)
+	}
+}
+
+func TestCheckMarkerPrefixes(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "matching", content: "; PROD-ACME-BOT\n; PROD-ACME-BOT-END\n"},
+		{name: "no markers", content: "www IN A 1.2.3.4\n"},
+		{name: "begin only", content: "; PROD-ACME-BOT\n"},
+		{name: "mismatch", content: "; PROD-ACME-BOT\n; PRD-ACME-BOT-END\n", want: "marker prefix mismatch: begin=PROD end=PRD"},
+		{
+			name:    "mismatch next to a matching block",
+			content: "; TEST-ACME-BOT\n; TEST-ACME-BOT-END\n  ; PROD-ACME-BOT\n  ; PRD-ACME-BOT-END\n",
+			want:    "marker prefix mismatch: begin=PROD end=PRD",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkMarkerPrefixes(tc.content)
+			if tc.want == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrMarkerPrefixMismatch) || err.Error() != tc.want {
+				t.Errorf("expected %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+/*
+This file provides the optional normalization of the zone file.
+Editors and CI steps may introduce CRLF line endings or trailing whitespace, which interact badly with the
+regex based edits of the -ACME-BOT block. If ZONE_FILE_NORMALIZE is set, the zone file is normalized when it is
+read: CRLF line endings are converted to LF, trailing spaces and tabs are removed from every line and the file
+ends with a single newline. Since every edit starts from the normalized content, the written zone file uses
+consistent line endings as well. Nothing else is changed, the indentation and alignment of the records are kept.
+
+Every file read is limited to ZONE_FILE_MAX_SIZE bytes, so that a huge file, e.g. a binary behind a wrong
+GITLAB_FILE, fails with a clear error instead of being processed by the regexes in memory.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// defaultZoneFileMaxSize is the default limit of the size of the zone file, far above the size of normal zones
+const defaultZoneFileMaxSize = 16 << 20
+
+var ErrZoneFileTooLarge = errors.New("zone file too large")
+
+// readZoneFile reads the zone file from the given branch of the project, normalized if configured.
+func (h *gitSolver) readZoneFile(projectPath string, branch string) (string, error) {
+	return h.readFile(projectPath, branch, h.gitFile)
+}
+
+// readFile reads the given file from the given branch of the project, normalized if configured.
+// Files larger than ZONE_FILE_MAX_SIZE are rejected.
+// The read waits for the last write of the webhook to the file if configured, see consistency.go, or reads the
+// commit of the last write, see commitref.go.
+func (h *gitSolver) readFile(projectPath string, branch string, file string) (string, error) {
+	ref := h.takeReadRef(projectPath, branch, file)
+
+	return h.readExpected(projectPath, branch, file, func() (string, error) {
+		content, err := ReadZoneFile(h.gitClient, ref, projectPath, file)
+		if err != nil {
+			return "", err
+		}
+		if h.zoneFileMaxSize > 0 && len(content) > h.zoneFileMaxSize {
+			return "", fmt.Errorf("%w: %s on branch %s has %d bytes, ZONE_FILE_MAX_SIZE is %d", ErrZoneFileTooLarge, file, branch, len(content), h.zoneFileMaxSize)
+		}
+
+		if h.normalizeZoneFile {
+			content = normalizeZoneFile(content)
+		}
+
+		return content, nil
+	})
+}
+
+// normalizeZoneFile converts the line endings of the content to LF, removes trailing spaces and tabs from
+// every line and ensures that the content ends with a single newline.
+func normalizeZoneFile(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+
+	content = strings.TrimRight(strings.Join(lines, "\n"), "\n")
+	if content == "" {
+		return content
+	}
+
+	return content + "\n"
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestNormalizeZoneFile(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "already normalized",
+			content: "@ IN SOA ns.example.com. (\n    2021091501 ; serial number\n)\n",
+			want:    "@ IN SOA ns.example.com. (\n    2021091501 ; serial number\n)\n",
+		},
+		{
+			name:    "crlf",
+			content: "; TEST-ACME-BOT\r\n; TEST-ACME-BOT-END\r\n",
+			want:    "; TEST-ACME-BOT\n; TEST-ACME-BOT-END\n",
+		},
+		{
+			name:    "trailing whitespace",
+			content: "www    IN A 1.2.3.4 \t\n; TEST-ACME-BOT  \n",
+			want:    "www    IN A 1.2.3.4\n; TEST-ACME-BOT\n",
+		},
+		{
+			name:    "missing trailing newline",
+			content: "; TEST-ACME-BOT-END",
+			want:    "; TEST-ACME-BOT-END\n",
+		},
+		{
+			name:    "multiple trailing newlines",
+			content: "; TEST-ACME-BOT-END\r\n\r\n\n",
+			want:    "; TEST-ACME-BOT-END\n",
+		},
+		{
+			name:    "empty",
+			content: "",
+			want:    "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := normalizeZoneFile(tc.content); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPresentCleanUpCRLFZoneFile(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", strings.ReplaceAll(fakeZone, "\n", "\r\n"))
+	solver := newTestSolver(t, srv)
+	solver.normalizeZoneFile = true
+
+	challenge := &acme.ChallengeRequest{
+		ResolvedFQDN: "_acme-challenge.example.com.",
+		Key:          "wow-so-secret",
+	}
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+	content := fake.content("main")
+	if strings.Contains(content, "\r") {
+		t.Errorf("expected LF line endings, got %q", content)
+	}
+	if !strings.Contains(content, "_acme-challenge.example.com            TXT \"wow-so-secret\"\n; TEST-ACME-BOT-END\n") {
+		t.Errorf("expected record in zone file, got %q", content)
+	}
+
+	if err := solver.CleanUp(challenge); err != nil {
+		t.Fatal(err)
+	}
+	content = fake.content("main")
+	if strings.Contains(content, "\r") {
+		t.Errorf("expected LF line endings, got %q", content)
+	}
+	if !strings.Contains(content, "; TEST-ACME-BOT\n; TEST-ACME-BOT-END\n") {
+		t.Errorf("expected record to be removed, got %q", content)
+	}
+}
+
+func TestZoneFileMaxSize(t *testing.T) {
+	oversized := fakeZone + strings.Repeat("; padding\n", 100)
+
+	testCases := []struct {
+		name    string
+		content string
+		maxSize int
+		err     error
+	}{
+		{name: "unlimited", content: oversized},
+		{name: "within limit", content: fakeZone, maxSize: len(fakeZone)},
+		{name: "oversized", content: oversized, maxSize: len(fakeZone), err: ErrZoneFileTooLarge},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeGitlab(t, "main", tc.content)
+			solver := newTestSolver(t, srv)
+			solver.zoneFileMaxSize = tc.maxSize
+
+			challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Key: "wow-so-secret"}
+			err := solver.Present(challenge)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if err == nil {
+				return
+			}
+
+			// The oversized zone file is neither processed nor written
+			if ClassifyError(err) != ErrorClassPermanent {
+				t.Errorf("expected %v to be permanent", err)
+			}
+			if len(fake.commits) > 0 {
+				t.Errorf("expected no commits, got %d", len(fake.commits))
+			}
+		})
+	}
+}
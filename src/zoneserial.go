@@ -0,0 +1,87 @@
+/*
+This file provides the serial number increase of zone files with several zones, each with an SOA record and a
+"; serial number" comment of its own. By default, every serial number comment of the zone file is set to the
+increased serial number. If SERIAL_ZONE_SELECTION is zone, only the serial number of the zone of the changed
+records is increased, the ResolvedZone of their challenges, and the serial numbers of the other zones are left
+untouched:
+
+	$ORIGIN example.com.
+	@ IN SOA ns.example.com. admin.example.com. ( 2021091502 ; serial number
+	  ... )
+	$ORIGIN example.org.
+	@ IN SOA ns.example.org. admin.example.org. ( 2021091501 ; serial number
+	  ... )
+
+The SOA record of the zone is the one whose owner name, resolved against the $ORIGIN directives before it, is the
+zone. A batch of cleanups increases the serial numbers of the zones of all its records. Operations without a
+challenge, e.g. the manual cleanup, use ROOT_DOMAIN as their zone. The selection requires ZONE_FORMAT bind.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/kallepan/cert-manager-webhook/src/zone"
+)
+
+// SerialZoneSelection defines which serial numbers of a zone file with several zones are increased
+type SerialZoneSelection string
+
+const (
+	SerialZoneSelectionAll  SerialZoneSelection = "all"
+	SerialZoneSelectionZone SerialZoneSelection = "zone"
+)
+
+var ErrInvalidSerialZoneSelection = errors.New("invalid serial zone selection")
+
+// ParseSerialZoneSelection parses the given string into a SerialZoneSelection. An empty string defaults to
+// SerialZoneSelectionAll.
+func ParseSerialZoneSelection(s string) (SerialZoneSelection, error) {
+	switch SerialZoneSelection(strings.ToLower(s)) {
+	case "", SerialZoneSelectionAll:
+		return SerialZoneSelectionAll, nil
+	case SerialZoneSelectionZone:
+		return SerialZoneSelectionZone, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidSerialZoneSelection, s)
+}
+
+// beginSerialZones selects the zones whose serial numbers are increased by the solver holding the zone lock. The
+// returned function clears the selection.
+func (h *gitSolver) beginSerialZones(zones ...string) func() {
+	if h.serialZoneSelection != SerialZoneSelectionZone {
+		return func() {}
+	}
+
+	h.serialZones = []string{}
+	for _, z := range zones {
+		if z == "" {
+			z = os.Getenv("ROOT_DOMAIN")
+		}
+		if z != "" && !slices.Contains(h.serialZones, z) {
+			h.serialZones = append(h.serialZones, z)
+		}
+	}
+
+	return func() {
+		h.serialZones = nil
+	}
+}
+
+// increaseZoneSerialNumbers increases the serial numbers of the selected zones, see zone.IncreaseZoneSerialNumberWith.
+func (h *gitSolver) increaseZoneSerialNumbers(content string, after ...string) (string, error) {
+	for _, z := range h.serialZones {
+		bumped, err := zone.IncreaseZoneSerialNumberWith(content, z, h.nextSerialNumber(), after...)
+		if err != nil {
+			return "", err
+		}
+		content = bumped
+	}
+
+	return content, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	acme "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/kallepan/cert-manager-webhook/src/zone"
+)
+
+// fakeTwoZones is a zone file with two zones, the -ACME-BOT block is in the first one
+const fakeTwoZones = `$ORIGIN example.com.
+@ IN SOA ns.example.com. admin.example.com. (
+    2021091501 ; serial number
+    3600 ; refresh
+)
+; TEST-ACME-BOT
+; TEST-ACME-BOT-END
+$ORIGIN example.org.
+@ IN SOA ns.example.org. admin.example.org. (
+    2021091601 ; serial number
+    3600 ; refresh
+)
+`
+
+func TestParseSerialZoneSelection(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  SerialZoneSelection
+		err   bool
+	}{
+		{input: "", want: SerialZoneSelectionAll},
+		{input: "all", want: SerialZoneSelectionAll},
+		{input: "Zone", want: SerialZoneSelectionZone},
+		{input: "first", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseSerialZoneSelection(tc.input)
+			if tc.err != errors.Is(err, ErrInvalidSerialZoneSelection) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPresentCleanUpSerialZoneSelection(t *testing.T) {
+	fake, srv := newFakeGitlab(t, "main", fakeTwoZones)
+	solver := newTestSolver(t, srv)
+	solver.serialZoneSelection = SerialZoneSelectionZone
+
+	challenge := &acme.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", ResolvedZone: "example.com.", Key: "wow-so-secret"}
+	for _, step := range []func(*acme.ChallengeRequest) error{solver.Present, solver.CleanUp} {
+		before := fake.content("main")
+		if err := step(challenge); err != nil {
+			t.Fatal(err)
+		}
+
+		content := fake.content("main")
+		if serial := zone.ZoneSerialNumber(content, "example.com."); serial == zone.ZoneSerialNumber(before, "example.com.") {
+			t.Errorf("expected the serial number of example.com. to be increased, got %s", serial)
+		}
+		if serial := zone.ZoneSerialNumber(content, "example.org."); serial != "2021091601" {
+			t.Errorf("expected the serial number of example.org. to be kept, got %s", serial)
+		}
+	}
+
+	// By default, every serial number is increased
+	solver.serialZoneSelection = SerialZoneSelectionAll
+	if err := solver.Present(challenge); err != nil {
+		t.Fatal(err)
+	}
+	if content := fake.content("main"); strings.Contains(content, "2021091601") {
+		t.Errorf("expected every serial number to be increased, got %q", content)
+	}
+}